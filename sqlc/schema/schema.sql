@@ -67,3 +67,321 @@ CREATE TABLE IF NOT EXISTS custom_domains (
 -- Create index
 CREATE INDEX IF NOT EXISTS idx_custom_domains_user ON custom_domains(user_id); 
 
+-- Including migration: 000005_create_short_code_sequence.up.sql
+
+-- Standalone sequence for counter-based short code generation
+CREATE SEQUENCE IF NOT EXISTS short_code_seq; 
+
+-- Including migration: 000006_add_url_versioning.up.sql
+
+-- Track edits on URLs
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS is_custom_alias BOOLEAN NOT NULL DEFAULT false;
+
+-- Snapshot of a URL taken before each edit
+CREATE TABLE IF NOT EXISTS url_history (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    short_code VARCHAR(10) NOT NULL,
+    original_url TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    is_active BOOLEAN NOT NULL,
+    changed_by VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Also serves the lookups of a URL's history by url_id
+    UNIQUE (url_id, version)
+); 
+
+-- Including migration: 000007_add_url_listing_indexes.up.sql
+
+-- Links can be served on a custom domain
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS domain_id INTEGER REFERENCES custom_domains(id) ON DELETE SET NULL;
+
+-- Keyset pagination over a user's active links
+CREATE INDEX IF NOT EXISTS idx_urls_user_created ON urls(user_id, created_at DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_urls_user_clicks ON urls(user_id, click_count DESC, id DESC) WHERE is_active;
+
+-- Filters
+CREATE INDEX IF NOT EXISTS idx_urls_domain_id ON urls(domain_id);
+CREATE INDEX IF NOT EXISTS idx_url_tags_tag_id ON url_tags(tag_id);
+
+-- Substring search on original URL and short code
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING GIN (original_url gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING GIN (short_code gin_trgm_ops); 
+
+-- Including migration: 000008_add_analytics_user_agent.up.sql
+
+-- Classification of the visitor's user agent
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS browser VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS os VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT false; 
+
+-- Including migration: 000009_add_analytics_location.up.sql
+
+-- Location of the visitor
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS region VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS city VARCHAR(100);
+
+-- Create index
+CREATE INDEX IF NOT EXISTS idx_analytics_url_country ON analytics(url_id, country_code); 
+
+-- Including migration: 000010_add_analytics_rollups.up.sql
+
+-- Record when each visit was written, so the aggregator only rolls up settled visits
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Create hourly rollup table; dimension '' holds the total over all visits
+CREATE TABLE IF NOT EXISTS analytics_rollup_hourly (
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    visitors BYTEA NOT NULL, -- HyperLogLog sketch of distinct visitors
+    PRIMARY KEY (url_id, dimension, bucket, value)
+);
+
+-- Create rollup watermark table
+CREATE TABLE IF NOT EXISTS analytics_rollup_state (
+    name VARCHAR(32) PRIMARY KEY,
+    last_id BIGINT NOT NULL DEFAULT 0, -- Highest analytics id rolled up
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO analytics_rollup_state (name) VALUES ('hourly') ON CONFLICT DO NOTHING; 
+
+-- Including migration: 000011_add_domain_verification.up.sql
+
+-- Add DNS verification state
+ALTER TABLE custom_domains
+    ADD COLUMN IF NOT EXISTS verification_token VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS verification_error TEXT;
+
+-- Give existing domains a token to publish
+UPDATE custom_domains
+SET verification_token = md5(random()::text || id::text)
+WHERE verification_token = '';
+
+-- Create index for the re-checker
+CREATE INDEX IF NOT EXISTS idx_custom_domains_recheck ON custom_domains(last_checked_at) WHERE verified; 
+
+-- Including migration: 000012_add_custom_domain_routing.up.sql
+
+-- Short codes are unique per domain rather than globally
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_short_code_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_default_short_code ON urls(short_code) WHERE domain_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_domain_short_code ON urls(domain_id, short_code) WHERE domain_id IS NOT NULL;
+
+-- Moving a domain's links to the default host could clash with existing
+-- short codes, so a domain cannot be deleted while links are served on it
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_domain_id_fkey,
+    ADD CONSTRAINT urls_domain_id_fkey FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE RESTRICT;
+
+-- Per-domain redirect targets
+ALTER TABLE custom_domains
+    ADD COLUMN IF NOT EXISTS root_url TEXT,
+    ADD COLUMN IF NOT EXISTS not_found_url TEXT; 
+
+-- Including migration: 000013_add_tls_certificates.up.sql
+
+-- ACME account keys, one per CA directory
+CREATE TABLE IF NOT EXISTS acme_accounts (
+    directory_url TEXT PRIMARY KEY,
+    key_pem BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Certificates of custom domains, shared by every instance
+CREATE TABLE IF NOT EXISTS tls_certificates (
+    domain VARCHAR(255) PRIMARY KEY REFERENCES custom_domains(domain) ON DELETE CASCADE,
+    cert_pem BYTEA,
+    key_pem BYTEA,
+    not_after TIMESTAMPTZ,
+    -- An instance holds the domain until claimed_until while it requests a
+    -- certificate; after a failure it is left alone until then
+    claimed_until TIMESTAMPTZ,
+    last_error TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Pending HTTP-01 challenge responses
+CREATE TABLE IF NOT EXISTS acme_challenges (
+    token VARCHAR(255) PRIMARY KEY,
+    key_authorization TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create index for the renewal scan
+CREATE INDEX IF NOT EXISTS idx_tls_certificates_not_after ON tls_certificates(not_after); 
+
+-- Including migration: 000014_add_api_keys.up.sql
+
+-- Hashed API keys for programmatic access; the keys themselves are never stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id); 
+
+-- Including migration: 000015_add_workspaces.up.sql
+
+-- Create workspaces; every user gets a personal one
+CREATE TABLE IF NOT EXISTS workspaces (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT false,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_personal ON workspaces(created_by) WHERE personal;
+
+-- Create memberships
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id);
+
+-- Create invitations; only a hash of the token is stored
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_by VARCHAR(255),
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_workspace_id ON workspace_invitations(workspace_id);
+
+-- Links and domains belong to a workspace; anonymous links belong to none
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id);
+ALTER TABLE custom_domains ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id);
+
+-- Move everything users own into their personal workspace
+INSERT INTO workspaces (name, personal, created_by)
+SELECT 'Personal', true, user_id FROM (
+    SELECT user_id FROM urls WHERE user_id <> ''
+    UNION SELECT user_id FROM custom_domains
+    UNION SELECT user_id FROM api_keys
+) owners
+ON CONFLICT (created_by) WHERE personal DO NOTHING;
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, created_by, 'owner' FROM workspaces WHERE personal
+ON CONFLICT DO NOTHING;
+
+UPDATE urls SET workspace_id = w.id
+FROM workspaces w
+WHERE w.personal AND w.created_by = urls.user_id AND urls.workspace_id IS NULL;
+
+UPDATE custom_domains SET workspace_id = w.id
+FROM workspaces w
+WHERE w.personal AND w.created_by = custom_domains.user_id AND custom_domains.workspace_id IS NULL;
+
+ALTER TABLE custom_domains ALTER COLUMN workspace_id SET NOT NULL;
+
+-- Create indexes for workspace listings
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_created ON urls(workspace_id, created_at DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_clicks ON urls(workspace_id, click_count DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_custom_domains_workspace_id ON custom_domains(workspace_id); 
+
+-- Including migration: 000016_scope_tags_to_workspaces.up.sql
+
+-- Tags belong to a workspace instead of being shared by everyone
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS color VARCHAR(7);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS description VARCHAR(200);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+
+-- Give every workspace its own copy of the tags its links carry
+INSERT INTO tags (workspace_id, name)
+SELECT DISTINCT u.workspace_id, t.name
+FROM url_tags ut
+JOIN tags t ON t.id = ut.tag_id
+JOIN urls u ON u.id = ut.url_id
+WHERE u.workspace_id IS NOT NULL AND t.workspace_id IS NULL;
+
+UPDATE url_tags SET tag_id = nt.id
+FROM tags ot, urls u, tags nt
+WHERE ot.id = url_tags.tag_id AND ot.workspace_id IS NULL
+  AND u.id = url_tags.url_id
+  AND nt.workspace_id = u.workspace_id AND nt.name = ot.name;
+
+-- Whatever is left was on anonymous links, which cannot be tagged
+DELETE FROM url_tags USING tags t WHERE t.id = url_tags.tag_id AND t.workspace_id IS NULL;
+DELETE FROM tags WHERE workspace_id IS NULL;
+
+ALTER TABLE tags ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE tags ADD CONSTRAINT tags_workspace_name_key UNIQUE (workspace_id, name);
+
+-- Deleting a tag removes it from its links
+ALTER TABLE url_tags DROP CONSTRAINT IF EXISTS url_tags_tag_id_fkey;
+ALTER TABLE url_tags ADD CONSTRAINT url_tags_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE; 
+
+-- Including migration: 000017_add_plans.up.sql
+
+-- Every workspace is on a plan that sets its quotas
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS plan VARCHAR(16) NOT NULL DEFAULT 'free'
+    CHECK (plan IN ('free', 'pro', 'business'));
+
+-- Links created per workspace and calendar month (UTC). Deleting links
+-- leaves the count alone, so the monthly quota cannot be recycled.
+CREATE TABLE IF NOT EXISTS workspace_usage (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    links_created INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (workspace_id, period)
+);
+
+-- Count the links already created this month
+INSERT INTO workspace_usage (workspace_id, period, links_created)
+SELECT workspace_id, date_trunc('month', created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+FROM urls
+WHERE workspace_id IS NOT NULL
+  AND created_at >= date_trunc('month', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING; 
+
+-- Including migration: 000018_add_url_passwords.up.sql
+
+-- Protected links hold a bcrypt hash of their password; NULL leaves a
+-- link open to everyone
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash VARCHAR(100); 
+
+-- Including migration: 000019_add_url_deleted_at.up.sql
+
+-- Deleted links stay behind for their history but can no longer be edited
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ; 
+
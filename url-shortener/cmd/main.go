@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/auth"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/config"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/db"
 	httphandler "github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http"
 	authmiddleware "github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/dnsverify"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/geoip"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ingest"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/repository/postgres"
+	redisrepo "github.com/riskibarqy/Snax-be/url-shortener/internal/repository/redis"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/rollup"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/service"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/telemetry"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/tlscert"
 )
 
 func main() {
@@ -45,37 +58,213 @@ func main() {
 	// 	log.Fatalf("Failed to initialize auth service: %v", err)
 	// }
 
-	// Initialize auth middleware
-	authMiddleware, err := authmiddleware.NewAuthMiddleware(appConfig.ClerkSecretKey)
-	if err != nil {
-		log.Fatalf("Failed to initialize auth middleware: %v", err)
-	}
-
 	// Connect to database
 	ctx := context.Background()
-	db, err := pgx.Connect(ctx, appConfig.DatabaseURL)
+	pool, err := db.NewPool(ctx, db.PoolConfig{
+		DatabaseURL:       appConfig.DatabaseURL,
+		MaxConns:          int32(appConfig.DBMaxConns),
+		MinConns:          int32(appConfig.DBMinConns),
+		MaxConnLifetime:   appConfig.DBMaxConnLifetime,
+		MaxConnIdleTime:   appConfig.DBMaxConnIdleTime,
+		HealthCheckPeriod: appConfig.DBHealthCheckPeriod,
+		StatementTimeout:  appConfig.DBStatementTimeout,
+	})
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v", err)
 	}
-	defer db.Close(ctx)
+	defer pool.Close()
 
 	// Initialize repositories
-	urlRepo := postgres.NewURLRepository(db)
-	analyticsRepo := postgres.NewAnalyticsRepository(db)
-	tagRepo := postgres.NewTagRepository(db)
-	customDomainRepo := postgres.NewCustomDomainRepository(db)
+	urlRepo := postgres.NewURLRepository(pool)
+	analyticsRepo := postgres.NewAnalyticsRepository(pool)
+	analyticsRollupRepo := postgres.NewAnalyticsRollupRepository(pool)
+	tagRepo := postgres.NewTagRepository(pool)
+	customDomainRepo := postgres.NewCustomDomainRepository(pool)
+	apiKeyRepo := postgres.NewAPIKeyRepository(pool)
+	workspaceRepo := postgres.NewWorkspaceRepository(pool)
+	usageRepo := postgres.NewUsageRepository(pool)
+
+	// Cache short code lookups for redirects
+	if appConfig.URLCacheEnabled {
+		urlCache, err := redisrepo.NewURLCache(ctx, urlRepo, config.RedisClient, redisrepo.URLCacheConfig{
+			TTL:         appConfig.URLCacheTTL,
+			NegativeTTL: appConfig.URLCacheNegativeTTL,
+			LocalSize:   appConfig.URLCacheLocalSize,
+			LocalTTL:    appConfig.URLCacheLocalTTL,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize URL cache: %v", err)
+		}
+		defer urlCache.Close()
+		urlRepo = urlCache
+	}
+
+	// Initialize short code generation
+	var shortCodeCounter domain.Counter
+	switch appConfig.ShortCodeStrategy {
+	case service.ShortCodeStrategyHashids:
+		shortCodeCounter = postgres.NewSequenceCounter(pool, postgres.URLIDSequence)
+	case service.ShortCodeStrategyCounter:
+		if appConfig.ShortCodeCounter == "redis" {
+			shortCodeCounter = redisrepo.NewCounter(config.RedisClient, redisrepo.ShortCodeCounterKey)
+		} else {
+			shortCodeCounter = postgres.NewSequenceCounter(pool, postgres.ShortCodeSequence)
+		}
+	}
+	shortCodeGenerator, err := service.NewShortCodeGenerator(service.ShortCodeConfig{
+		Strategy: appConfig.ShortCodeStrategy,
+		Length:   appConfig.ShortCodeLength,
+		Alphabet: appConfig.ShortCodeAlphabet,
+		Readable: appConfig.ShortCodeReadable,
+		Salt:     appConfig.ShortCodeSalt,
+	}, shortCodeCounter)
+	if err != nil {
+		log.Fatalf("Invalid short code configuration: %v", err)
+	}
 
 	// Initialize services
-	urlService := service.NewURLService(urlRepo)
-	analyticsService := service.NewAnalyticsService(analyticsRepo)
-	tagService := service.NewTagService(tagRepo)
-	customDomainService := service.NewCustomDomainService(customDomainRepo)
+	ownershipChecker := service.NewOwnershipChecker(urlRepo, customDomainRepo, workspaceRepo)
+	planService := service.NewPlanService(usageRepo, workspaceRepo, urlRepo, ownershipChecker)
+	urlService := service.NewURLService(urlRepo, customDomainRepo, ownershipChecker, shortCodeGenerator, planService)
+	analyticsService := service.NewAnalyticsService(analyticsRepo, analyticsRollupRepo, ownershipChecker, planService)
+	tagService := service.NewTagService(tagRepo, ownershipChecker, planService)
+	domainVerifier := dnsverify.NewVerifier(net.DefaultResolver, appConfig.DomainEdgeHost)
+	customDomainService := service.NewCustomDomainService(customDomainRepo, ownershipChecker, domainVerifier, planService)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, ownershipChecker, planService)
+
+	// Initialize auth middleware, accepting the configured provider's
+	// sessions and API keys
+	staticTokens, err := auth.ParseStaticTokens(appConfig.AuthStaticTokens)
+	if err != nil {
+		log.Fatalf("Invalid AUTH_STATIC_TOKENS: %v", err)
+	}
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Provider:       appConfig.AuthProvider,
+		ClerkSecretKey: appConfig.ClerkSecretKey,
+		OIDC: auth.OIDCConfig{
+			IssuerURL:       appConfig.OIDCIssuerURL,
+			Audience:        appConfig.OIDCAudience,
+			JWKSURL:         appConfig.OIDCJWKSURL,
+			RefreshInterval: appConfig.OIDCJWKSRefresh,
+		},
+		StaticTokens: staticTokens,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
+	authMiddleware := authmiddleware.NewAuthMiddleware(authenticator, apiKeyService)
+
+	// Client addresses are taken from forwarding headers only when a trusted
+	// proxy set them
+	trustedProxies, err := clientip.ParsePrefixes(appConfig.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	clientIPs := clientip.NewResolver(trustedProxies)
+
+	// Rate limits are shared by every instance through Redis; while Redis is
+	// unhealthy the configured failure mode decides
+	rateLimitPolicies, err := ratelimit.LoadPolicies(appConfig.RateLimitPoliciesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rateLimitFailureMode, err := ratelimit.ParseFailureMode(appConfig.RateLimitFailureMode)
+	if err != nil {
+		log.Fatalf("RATE_LIMIT_FAILURE_MODE: %v", err)
+	}
+	resilientLimiter := ratelimit.NewResilientLimiter(ratelimit.NewRedisLimiter(config.RedisClient), ratelimit.ResilientConfig{
+		Mode:             rateLimitFailureMode,
+		FailureThreshold: appConfig.RateLimitBreakerFailures,
+		Cooldown:         appConfig.RateLimitBreakerCooldown,
+		Timeout:          appConfig.RateLimitRedisTimeout,
+	})
+	userPlan := func(ctx context.Context, userID string) string {
+		plan, err := planService.UserPlan(ctx, userID)
+		if err != nil {
+			log.Printf("[ERROR] looking up the plan of %s: %v", userID, err)
+		}
+		return plan
+	}
+	rateLimiter := authmiddleware.NewRateLimiter(resilientLimiter, rateLimitPolicies, userPlan)
+
+	// Visits are geolocated from a local database when one is configured
+	enrichers := []ingest.Enricher{ingest.UserAgentEnricher}
+	if appConfig.GeoIPDatabasePath != "" {
+		geoReader := geoip.NewReader(appConfig.GeoIPDatabasePath)
+		if err := geoReader.Reload(); err != nil {
+			log.Printf("GeoIP database not loaded, visits stay unlocated until it is: %v", err)
+		}
+		defer geoReader.Close()
+
+		geoCtx, stopGeo := context.WithCancel(ctx)
+		defer stopGeo()
+		go geoReader.Watch(geoCtx, appConfig.GeoIPReloadInterval)
+
+		enrichers = append(enrichers, ingest.GeoIPEnricher(geoReader))
+	}
+
+	// Visits are buffered and written in batches, and drained on shutdown
+	clickPipeline := ingest.NewPipeline(ingest.Config{
+		QueueSize:     appConfig.IngestQueueSize,
+		BatchSize:     appConfig.IngestBatchSize,
+		FlushInterval: appConfig.IngestFlushInterval,
+	}, analyticsRepo, urlRepo, enrichers...)
+
+	// Keep the rollups analytics summaries are served from up to date
+	rollupCtx, stopRollups := context.WithCancel(ctx)
+	defer stopRollups()
+	go rollup.NewAggregator(analyticsRollupRepo, appConfig.AnalyticsRollupInterval, appConfig.AnalyticsRollupBatchSize).Run(rollupCtx)
+
+	// Verified domains are re-checked so removed records revoke verification
+	recheckCtx, stopRecheck := context.WithCancel(ctx)
+	defer stopRecheck()
+	go dnsverify.NewRechecker(customDomainRepo, domainVerifier, appConfig.DomainRecheckInterval).Run(recheckCtx)
 
 	// Initialize handler
-	handler := httphandler.NewHandler(urlService, analyticsService, tagService, customDomainService)
+	handler := httphandler.NewHandler(urlService, analyticsService, tagService, customDomainService, apiKeyService, workspaceService, planService, clickPipeline)
+	handler.RegisterMetrics("ingest", func() any { return clickPipeline.Stats() })
+	handler.RegisterMetrics("ratelimit", func() any { return resilientLimiter.Stats() })
+	if appConfig.MetricsToken == "" {
+		log.Printf("METRICS_TOKEN is not set, /metrics is disabled")
+	}
+	handler.ProtectMetrics(appConfig.MetricsToken)
+
+	// Visitors who enter a link's password are remembered by a signed cookie
+	if appConfig.LinkUnlockSecret == "" {
+		log.Printf("LINK_UNLOCK_SECRET is not set, unlock cookies only hold on this instance until it restarts")
+	}
+	handler.ProtectLinks(linkpass.NewCookies([]byte(appConfig.LinkUnlockSecret), appConfig.LinkUnlockTTL, appConfig.LinkUnlockSecure), rateLimiter)
+
+	// Custom domains are served over HTTPS with certificates from an ACME CA
+	var certManager *tlscert.Manager
+	var acmeChallenges http.Handler
+	if appConfig.ACMEEnabled {
+		acmeHTTPClient := http.DefaultClient
+		if appConfig.ACMECACertFile != "" {
+			rootCAs, err := tlscert.LoadRootCAs(appConfig.ACMECACertFile)
+			if err != nil {
+				log.Fatalf("Failed to load ACME CA certificates: %v", err)
+			}
+			acmeHTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+		}
+
+		certManager = tlscert.NewManager(postgres.NewCertificateRepository(pool), customDomainService, tlscert.Config{
+			DirectoryURL: appConfig.ACMEDirectoryURL,
+			Email:        appConfig.ACMEEmail,
+			RenewBefore:  appConfig.ACMERenewBefore,
+			Interval:     appConfig.ACMEInterval,
+			HTTPClient:   acmeHTTPClient,
+		})
+		acmeChallenges = certManager
+
+		certCtx, stopCerts := context.WithCancel(ctx)
+		defer stopCerts()
+		go certManager.Run(certCtx)
+	}
 
 	// Setup router using the router.go configuration
-	router := httphandler.SetupRouter(handler, authMiddleware)
+	router := httphandler.SetupRouter(handler, authMiddleware, clientIPs, rateLimiter, acmeChallenges)
 
 	// Set up graceful shutdown
 	srv := &http.Server{
@@ -83,8 +272,10 @@ func main() {
 		Handler: router,
 	}
 
-	// Channel to listen for errors coming from the listener.
-	serverErrors := make(chan error, 1)
+	servers := []*http.Server{srv}
+
+	// Channel to listen for errors coming from the listeners.
+	serverErrors := make(chan error, 2)
 	// Channel to listen for an interrupt or terminate signal from the OS.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -95,6 +286,24 @@ func main() {
 		serverErrors <- srv.ListenAndServe()
 	}()
 
+	// Serve custom domains over HTTPS with the certificates the manager obtained
+	if certManager != nil {
+		tlsSrv := &http.Server{
+			Addr:    ":" + appConfig.TLSPort,
+			Handler: router,
+			TLSConfig: &tls.Config{
+				GetCertificate: certManager.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+			},
+		}
+		servers = append(servers, tlsSrv)
+
+		go func() {
+			log.Printf("TLS server starting on port %s", appConfig.TLSPort)
+			serverErrors <- tlsSrv.ListenAndServeTLS("", "")
+		}()
+	}
+
 	// Blocking main and waiting for shutdown.
 	select {
 	case err := <-serverErrors:
@@ -107,13 +316,24 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Asking listener to shut down and shed load.
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Graceful shutdown did not complete in %v: %v", 5*time.Second, err)
-			if err := srv.Close(); err != nil {
-				log.Printf("Error killing server: %v", err)
+		// Asking listeners to shut down and shed load.
+		for _, s := range servers {
+			if err := s.Shutdown(ctx); err != nil {
+				log.Printf("Graceful shutdown did not complete in %v: %v", 5*time.Second, err)
+				if err := s.Close(); err != nil {
+					log.Printf("Error killing server: %v", err)
+				}
 			}
 		}
+
+		// No handler can record visits anymore; flush the queued ones
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer drainCancel()
+		if err := clickPipeline.Shutdown(drainCtx); err != nil {
+			log.Printf("Queued visits were lost at shutdown: %v", err)
+		}
+		stats := clickPipeline.Stats()
+		log.Printf("Click ingestion drained: %d written, %d dropped, %d failed", stats.Written, stats.Dropped, stats.Failed)
 	}
 }
 
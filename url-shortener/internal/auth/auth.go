@@ -0,0 +1,58 @@
+// Package auth verifies the bearer tokens of signed-in users. The provider
+// is chosen in configuration: Clerk, any OIDC issuer, or a fixed set of
+// tokens for local development.
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Authentication providers
+const (
+	ProviderClerk  = "clerk"
+	ProviderOIDC   = "oidc"
+	ProviderStatic = "static"
+)
+
+// Config selects and configures the authentication provider
+type Config struct {
+	Provider       string
+	ClerkSecretKey string
+	OIDC           OIDCConfig
+	// StaticTokens maps tokens to user IDs for the static provider
+	StaticTokens map[string]string
+}
+
+// NewAuthenticator creates the authenticator of the configured provider
+func NewAuthenticator(cfg Config) (domain.Authenticator, error) {
+	switch cfg.Provider {
+	case ProviderClerk, "":
+		return NewClerkAuthenticator(cfg.ClerkSecretKey)
+	case ProviderOIDC:
+		return NewOIDCAuthenticator(cfg.OIDC)
+	case ProviderStatic:
+		return NewStaticAuthenticator(cfg.StaticTokens)
+	default:
+		return nil, fmt.Errorf("unknown authentication provider %q", cfg.Provider)
+	}
+}
+
+// ParseStaticTokens parses a comma separated list of token:user_id pairs
+func ParseStaticTokens(s string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		token, userID, ok := strings.Cut(pair, ":")
+		if !ok || token == "" || userID == "" {
+			return nil, fmt.Errorf("static token %q must be token:user_id", pair)
+		}
+		tokens[token] = userID
+	}
+	return tokens, nil
+}
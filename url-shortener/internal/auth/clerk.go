@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clerkinc/clerk-sdk-go/clerk"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// ClerkAuthenticator verifies Clerk session tokens
+type ClerkAuthenticator struct {
+	client clerk.Client
+}
+
+// NewClerkAuthenticator creates an authenticator for the Clerk instance of secretKey
+func NewClerkAuthenticator(secretKey string) (domain.Authenticator, error) {
+	if secretKey == "" {
+		return nil, errors.New("Clerk secret key is required")
+	}
+
+	client, err := clerk.NewClient(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClerkAuthenticator{
+		client: client,
+	}, nil
+}
+
+// Authenticate verifies a Clerk session token
+func (a *ClerkAuthenticator) Authenticate(ctx context.Context, token string) (*domain.Claims, error) {
+	clerkClaims, err := a.client.VerifyToken(token)
+	if err != nil {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+	}
+
+	return fromClerkClaims(clerkClaims), nil
+}
+
+// fromClerkClaims converts Clerk claims to our domain claims
+func fromClerkClaims(c *clerk.SessionClaims) *domain.Claims {
+	claims := &domain.Claims{
+		Subject: c.Subject,
+		TokenID: c.ID,
+	}
+	if c.Expiry != nil {
+		claims.ExpiresAt = c.Expiry.Time().Unix()
+	}
+	if c.IssuedAt != nil {
+		claims.IssuedAt = c.IssuedAt.Time().Unix()
+	}
+	return claims
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clerkinc/clerk-sdk-go/clerk"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromClerkClaims(t *testing.T) {
+	issued := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	claims := fromClerkClaims(&clerk.SessionClaims{Claims: jwt.Claims{
+		Subject:  "user_2abc",
+		ID:       "jti-1",
+		IssuedAt: jwt.NewNumericDate(issued),
+		Expiry:   jwt.NewNumericDate(issued.Add(time.Minute)),
+	}})
+
+	assert.Equal(t, "user_2abc", claims.Subject)
+	assert.Equal(t, "jti-1", claims.TokenID)
+	assert.Equal(t, issued.Unix(), claims.IssuedAt)
+	assert.Equal(t, issued.Add(time.Minute).Unix(), claims.ExpiresAt)
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+const (
+	// minKeyRefreshInterval limits how often a token signed with an unknown
+	// key, or an issuer that failed to serve its keys, can make us fetch the
+	// key set again
+	minKeyRefreshInterval = 30 * time.Second
+
+	// clockSkew is tolerated on exp, nbf and iat
+	clockSkew = time.Minute
+
+	// maxDocumentSize bounds the discovery document and key set
+	maxDocumentSize = 1 << 20
+)
+
+// allowedAlgorithms are the signature algorithms accepted from an issuer;
+// "none" and HMAC algorithms never verify with a published key
+var allowedAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.RS384): true,
+	string(jose.RS512): true,
+	string(jose.PS256): true,
+	string(jose.PS384): true,
+	string(jose.PS512): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// OIDCConfig configures verification of an OIDC issuer's tokens
+type OIDCConfig struct {
+	// IssuerURL must match the iss claim of tokens
+	IssuerURL string
+	// Audience, when set, must be in the aud claim of tokens
+	Audience string
+	// JWKSURL overrides the key set URL found through discovery
+	JWKSURL string
+	// RefreshInterval is how long fetched keys are used before they are
+	// fetched again; tokens signed with an unknown key refresh them sooner
+	RefreshInterval time.Duration
+	HTTPClient      *http.Client
+}
+
+// OIDCAuthenticator verifies JWTs signed with the keys an OIDC issuer
+// publishes. Keys are cached and refetched when the issuer rotates them.
+type OIDCAuthenticator struct {
+	cfg OIDCConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	jwksURL     string
+	keys        *jose.JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// refreshErr is why the last attempt to fetch the keys failed
+	refreshErr error
+	// refreshing is closed when the fetch under way finishes
+	refreshing chan struct{}
+}
+
+// NewOIDCAuthenticator creates an authenticator for the tokens of an OIDC
+// issuer. Keys are fetched on first use, so the issuer does not have to be
+// reachable at startup.
+func NewOIDCAuthenticator(cfg OIDCConfig) (domain.Authenticator, error) {
+	if cfg.IssuerURL == "" {
+		return nil, errors.New("OIDC issuer URL is required")
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &OIDCAuthenticator{
+		cfg:     cfg,
+		now:     time.Now,
+		jwksURL: cfg.JWKSURL,
+	}, nil
+}
+
+// Authenticate verifies the signature and claims of an OIDC token
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context, token string) (*domain.Claims, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil || len(parsed.Headers) != 1 {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+	}
+	header := parsed.Headers[0]
+	if !allowedAlgorithms[header.Algorithm] {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+	}
+
+	key, err := a.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+	}
+
+	var claims jwt.Claims
+	if err := parsed.Claims(key.Key, &claims); err != nil {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+	}
+
+	expected := jwt.Expected{Issuer: a.cfg.IssuerURL, Time: a.now()}
+	if a.cfg.Audience != "" {
+		expected.Audience = jwt.Audience{a.cfg.Audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, clockSkew); err != nil {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token: " + err.Error()}
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return nil, &domain.ErrInvalidToken{Message: "Invalid token: exp and sub are required"}
+	}
+
+	result := &domain.Claims{
+		Subject:   claims.Subject,
+		ExpiresAt: claims.Expiry.Time().Unix(),
+		TokenID:   claims.ID,
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time().Unix()
+	}
+	return result, nil
+}
+
+// key returns the verification key kid, refreshing the key set when it is
+// stale or does not have kid. Only one request fetches the keys at a time,
+// without holding the lock; the others keep verifying with the keys they
+// have, or wait for the fetch when none of them fits.
+func (a *OIDCAuthenticator) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	a.mu.Lock()
+
+	now := a.now()
+	fresh := a.keys != nil && now.Sub(a.fetchedAt) < a.cfg.RefreshInterval
+	if fresh {
+		if key := findKey(a.keys, kid); key != nil {
+			a.mu.Unlock()
+			return key, nil
+		}
+	}
+
+	// An unknown key may mean the issuer rotated its keys. Attempts are
+	// spaced out whether they failed or not, so a broken issuer is not asked
+	// again on every request.
+	done := a.refreshing
+	if done == nil && now.Sub(a.attemptedAt) >= minKeyRefreshInterval {
+		done = make(chan struct{})
+		a.refreshing = done
+		a.attemptedAt = now
+		jwksURL := a.jwksURL
+		a.mu.Unlock()
+
+		// The fetch is shared, so the caller giving up must not cancel it;
+		// the HTTP client's timeout bounds it instead
+		keys, jwksURL, err := a.fetchKeys(context.WithoutCancel(ctx), jwksURL)
+
+		a.mu.Lock()
+		if err != nil {
+			log.Printf("[ERROR] refreshing OIDC keys of %s: %v", a.cfg.IssuerURL, err)
+			a.refreshErr = err
+		} else {
+			a.keys, a.jwksURL, a.fetchedAt, a.refreshErr = keys, jwksURL, a.now(), nil
+		}
+		a.refreshing = nil
+		close(done)
+	} else if done != nil && (a.keys == nil || findKey(a.keys, kid) == nil) {
+		a.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		a.mu.Lock()
+	}
+	defer a.mu.Unlock()
+
+	// Keep verifying with the keys we have while the issuer is down
+	if a.keys == nil {
+		return nil, a.refreshErr
+	}
+	if key := findKey(a.keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, &domain.ErrInvalidToken{Message: "Invalid token: unknown signing key"}
+}
+
+// findKey returns the signing key kid of keys. Tokens without a key ID
+// match a key set holding a single signing key.
+func findKey(keys *jose.JSONWebKeySet, kid string) *jose.JSONWebKey {
+	var found []jose.JSONWebKey
+	for _, k := range keys.Keys {
+		if (k.Use == "" || k.Use == "sig") && (kid == "" || k.KeyID == kid) {
+			found = append(found, k)
+		}
+	}
+	if len(found) != 1 {
+		return nil
+	}
+	return &found[0]
+}
+
+// fetchKeys fetches the issuer's public keys from jwksURL, discovering the
+// URL first when it is empty
+func (a *OIDCAuthenticator) fetchKeys(ctx context.Context, jwksURL string) (*jose.JSONWebKeySet, string, error) {
+	if jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(a.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+		if err := a.fetchJSON(ctx, discoveryURL, &discovery); err != nil {
+			return nil, "", err
+		}
+		if discovery.Issuer != a.cfg.IssuerURL {
+			return nil, "", fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, "", errors.New("discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := a.fetchJSON(ctx, jwksURL, &keys); err != nil {
+		return nil, "", err
+	}
+
+	public := &jose.JSONWebKeySet{}
+	for _, k := range keys.Keys {
+		if k.IsPublic() && k.Valid() {
+			public.Keys = append(public.Keys, k)
+		}
+	}
+
+	return public, jwksURL, nil
+}
+
+func (a *OIDCAuthenticator) fetchJSON(ctx context.Context, url string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(dest)
+}
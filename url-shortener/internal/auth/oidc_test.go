@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssuer serves an OIDC discovery document and a key set that can be
+// rotated, or fails to serve the key set
+type fakeIssuer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	keys       []jose.JSONWebKey
+	keyFetches int
+	failing    bool
+	// hold, when set, delays key set responses until it is closed
+	hold chan struct{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	issuer := &fakeIssuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.URL,
+			"jwks_uri": issuer.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		issuer.keyFetches++
+		keys, failing, hold := issuer.keys, issuer.failing, issuer.hold
+		issuer.mu.Unlock()
+
+		if hold != nil {
+			<-hold
+		}
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: keys})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// rotate publishes a new signing key and returns its private half
+func (f *fakeIssuer) rotate(t *testing.T, kid string) *jose.JSONWebKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	private := &jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = []jose.JSONWebKey{private.Public()}
+	return private
+}
+
+func (f *fakeIssuer) setFailing(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+func (f *fakeIssuer) fetches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.keyFetches
+}
+
+func sign(t *testing.T, key *jose.JSONWebKey, claims jwt.Claims) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.KeyID))
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key := issuer.rotate(t, "key-1")
+	now := time.Now()
+
+	a, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer.URL, Audience: "snax"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	valid := jwt.Claims{
+		Issuer:   issuer.URL,
+		Subject:  "user123",
+		Audience: jwt.Audience{"snax"},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+		ID:       "token-1",
+	}
+
+	t.Run("Valid Token", func(t *testing.T) {
+		claims, err := a.Authenticate(ctx, sign(t, key, valid))
+		require.NoError(t, err)
+		assert.Equal(t, "user123", claims.Subject)
+		assert.Equal(t, "token-1", claims.TokenID)
+		assert.Equal(t, valid.Expiry.Time().Unix(), claims.ExpiresAt)
+		assert.Equal(t, valid.IssuedAt.Time().Unix(), claims.IssuedAt)
+	})
+
+	rejected := []struct {
+		name   string
+		modify func(c *jwt.Claims)
+	}{
+		{name: "Expired", modify: func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-time.Hour)) }},
+		{name: "Other Issuer", modify: func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" }},
+		{name: "Other Audience", modify: func(c *jwt.Claims) { c.Audience = jwt.Audience{"other"} }},
+		{name: "No Expiry", modify: func(c *jwt.Claims) { c.Expiry = nil }},
+		{name: "No Subject", modify: func(c *jwt.Claims) { c.Subject = "" }},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+
+			_, err := a.Authenticate(ctx, sign(t, key, claims))
+			assert.IsType(t, &domain.ErrInvalidToken{}, err)
+		})
+	}
+
+	t.Run("Unpublished Key", func(t *testing.T) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		forged := sign(t, &jose.JSONWebKey{Key: other, KeyID: "key-1"}, valid)
+
+		_, err = a.Authenticate(ctx, forged)
+		assert.IsType(t, &domain.ErrInvalidToken{}, err)
+	})
+
+	t.Run("HMAC Token", func(t *testing.T) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("secret-secret-secret-secret-1234")},
+			(&jose.SignerOptions{}).WithHeader("kid", "key-1"))
+		require.NoError(t, err)
+		token, err := jwt.Signed(signer).Claims(valid).CompactSerialize()
+		require.NoError(t, err)
+
+		_, err = a.Authenticate(ctx, token)
+		assert.IsType(t, &domain.ErrInvalidToken{}, err)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := a.Authenticate(ctx, "not-a-jwt")
+		assert.IsType(t, &domain.ErrInvalidToken{}, err)
+	})
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	oldKey := issuer.rotate(t, "key-1")
+	now := time.Now()
+
+	authenticator, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer.URL})
+	require.NoError(t, err)
+	a := authenticator.(*OIDCAuthenticator)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	claims := jwt.Claims{Issuer: issuer.URL, Subject: "user123", Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+
+	_, err = a.Authenticate(ctx, sign(t, oldKey, claims))
+	require.NoError(t, err)
+	_, err = a.Authenticate(ctx, sign(t, oldKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, 1, issuer.fetches(), "keys are cached")
+
+	// The issuer rotates; right away, unknown keys do not trigger a fetch
+	newKey := issuer.rotate(t, "key-2")
+	_, err = a.Authenticate(ctx, sign(t, newKey, claims))
+	assert.IsType(t, &domain.ErrInvalidToken{}, err)
+	assert.Equal(t, 1, issuer.fetches())
+
+	// Soon after, the unknown key makes us fetch the new key set
+	now = now.Add(minKeyRefreshInterval)
+	_, err = a.Authenticate(ctx, sign(t, newKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, 2, issuer.fetches())
+
+	// The retired key no longer verifies
+	_, err = a.Authenticate(ctx, sign(t, oldKey, claims))
+	assert.IsType(t, &domain.ErrInvalidToken{}, err)
+}
+
+func TestOIDCIssuerUnavailable(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	key := issuer.rotate(t, "key-1")
+	now := time.Now()
+
+	authenticator, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer.URL, RefreshInterval: time.Hour})
+	require.NoError(t, err)
+	a := authenticator.(*OIDCAuthenticator)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+	token := sign(t, key, jwt.Claims{Issuer: issuer.URL, Subject: "user123", Expiry: jwt.NewNumericDate(now.Add(3 * time.Hour))})
+
+	_, err = a.Authenticate(ctx, token)
+	require.NoError(t, err)
+
+	// Cached keys keep working while the issuer is down
+	issuer.Close()
+	now = now.Add(2 * time.Hour)
+	_, err = a.Authenticate(ctx, token)
+	assert.NoError(t, err)
+}
+
+func TestOIDCFailingIssuerBacksOff(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.rotate(t, "key-1")
+	issuer.setFailing(true)
+	now := time.Now()
+
+	authenticator, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer.URL, JWKSURL: issuer.URL + "/keys"})
+	require.NoError(t, err)
+	a := authenticator.(*OIDCAuthenticator)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	concurrently := func(n int) []error {
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = a.key(ctx, "key-1")
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	// Concurrent requests share one failed fetch
+	for _, err := range concurrently(20) {
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, issuer.fetches())
+
+	// The failure is remembered, so requests during the back-off fail
+	// without asking the issuer again
+	now = now.Add(minKeyRefreshInterval / 2)
+	for _, err := range concurrently(20) {
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, issuer.fetches())
+
+	// After the back-off the issuer is tried again
+	issuer.setFailing(false)
+	now = now.Add(minKeyRefreshInterval)
+	for _, err := range concurrently(20) {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, issuer.fetches())
+
+	// Once the keys are stale and the issuer fails again, the cached keys
+	// are served through the failed refresh and the back-off after it
+	issuer.setFailing(true)
+	now = now.Add(2 * time.Hour)
+	for _, err := range concurrently(20) {
+		assert.NoError(t, err)
+	}
+	now = now.Add(minKeyRefreshInterval / 2)
+	for _, err := range concurrently(20) {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, issuer.fetches())
+}
+
+func TestOIDCRefreshDoesNotBlockCachedKeys(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.rotate(t, "key-1")
+	now := time.Now()
+
+	authenticator, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer.URL, JWKSURL: issuer.URL + "/keys"})
+	require.NoError(t, err)
+	a := authenticator.(*OIDCAuthenticator)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err = a.key(ctx, "key-1")
+	require.NoError(t, err)
+
+	// A token signed with a new key starts a refresh the issuer is slow to answer
+	hold := make(chan struct{})
+	issuer.mu.Lock()
+	issuer.hold = hold
+	issuer.mu.Unlock()
+	now = now.Add(minKeyRefreshInterval)
+
+	refreshed := make(chan error)
+	go func() {
+		_, err := a.key(ctx, "key-2")
+		refreshed <- err
+	}()
+	require.Eventually(t, func() bool { return issuer.fetches() == 2 }, time.Second, time.Millisecond)
+
+	// Meanwhile tokens signed with a known key are verified right away
+	_, err = a.key(ctx, "key-1")
+	assert.NoError(t, err)
+
+	close(hold)
+	assert.IsType(t, &domain.ErrInvalidToken{}, <-refreshed)
+	assert.Equal(t, 2, issuer.fetches())
+}
+
+func TestStaticAuthenticate(t *testing.T) {
+	tokens, err := ParseStaticTokens("dev-token:user123, other:user456")
+	require.NoError(t, err)
+	a, err := NewStaticAuthenticator(tokens)
+	require.NoError(t, err)
+
+	claims, err := a.Authenticate(context.Background(), "other")
+	require.NoError(t, err)
+	assert.Equal(t, "user456", claims.Subject)
+
+	_, err = a.Authenticate(context.Background(), "dev-tok")
+	assert.IsType(t, &domain.ErrInvalidToken{}, err)
+
+	_, err = ParseStaticTokens("missing-user")
+	assert.Error(t, err)
+	_, err = NewStaticAuthenticator(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+// Package clientip works out the address of the client behind a request.
+// Forwarding headers are only believed when they were handed over by a
+// trusted proxy, so clients cannot pick their own address.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Resolver finds the client address of requests arriving through the
+// trusted proxies
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver that follows forwarding headers through
+// the trusted networks only. With none, the peer address is the client.
+func NewResolver(trusted []netip.Prefix) *Resolver {
+	return &Resolver{trusted: trusted}
+}
+
+// ParsePrefixes reads a comma separated list of CIDRs such as
+// "10.0.0.0/8, fd00::/8". Bare addresses stand for themselves.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is neither a CIDR nor an address", entry)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a CIDR nor an address", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// trusts reports whether addr is one of the trusted proxies
+func (res *Resolver) trusts(addr netip.Addr) bool {
+	if res == nil {
+		return false
+	}
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest returns the client address. Starting from the peer, the
+// proxy chain is walked back while the hop is trusted: X-Forwarded-For from
+// right to left or, without it, X-Real-IP. The first untrusted hop is the
+// client; entries left of it may be forged and are ignored. It returns false
+// when the peer address cannot be parsed.
+func (res *Resolver) FromRequest(r *http.Request) (netip.Addr, bool) {
+	client, ok := Parse(r.RemoteAddr)
+	if !ok || !res.trusts(client) {
+		return client, ok
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		hops = r.Header.Values("X-Real-IP")
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := Parse(hops[i])
+		if !ok {
+			// Whoever wrote the garbage is the last hop we can vouch for
+			break
+		}
+		client = hop
+		if !res.trusts(hop) {
+			break
+		}
+	}
+
+	return client, true
+}
+
+// Middleware resolves the client address of each request once and stores it
+// in the request context
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := res.FromRequest(r); ok {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, addr))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FromContext returns the address stored by Middleware
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(contextKey{}).(netip.Addr)
+	return addr, ok
+}
+
+// String returns the client address of r as resolved by Middleware, falling
+// back to the peer address, or RemoteAddr verbatim when it cannot be parsed
+func String(r *http.Request) string {
+	if addr, ok := FromContext(r.Context()); ok {
+		return addr.String()
+	}
+	if addr, ok := Parse(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// Bucket returns the rate limit identity of addr: the address itself for
+// IPv4 and its /64 for IPv6, since a single subscriber usually holds a whole
+// /64 and can rotate through it at will
+func Bucket(addr netip.Addr) string {
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
+
+// Parse reads an address as found in forwarding headers or RemoteAddr:
+// surrounding spaces, a port, brackets and IPv6 zones are tolerated and
+// IPv4-mapped IPv6 addresses are unmapped
+func Parse(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap().WithZone(""), true
+}
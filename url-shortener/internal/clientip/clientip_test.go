@@ -0,0 +1,163 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromRequest(t *testing.T) {
+	trusted, err := ParsePrefixes("10.0.0.0/8, 2001:db8:ffff::/48, 192.0.2.1")
+	require.NoError(t, err)
+	resolver := NewResolver(trusted)
+
+	tests := []struct {
+		name       string
+		resolver   *Resolver
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "Remote Address Only",
+			resolver:   resolver,
+			remoteAddr: "203.0.113.7:52100",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarded Chain",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20, 10.0.0.1"},
+			want:       "198.51.100.20",
+		},
+		{
+			name:       "Forged Entries Left Of The Client Are Ignored",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.20"},
+			want:       "198.51.100.20",
+		},
+		{
+			name:       "Untrusted Peer",
+			resolver:   resolver,
+			remoteAddr: "203.0.113.7:52100",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20", "X-Real-IP": "198.51.100.30"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "No Trusted Proxies",
+			resolver:   NewResolver(nil),
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Single Trusted Address",
+			resolver:   resolver,
+			remoteAddr: "192.0.2.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20"},
+			want:       "198.51.100.20",
+		},
+		{
+			name:       "Garbage Stops The Walk",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20, unknown, 10.0.0.1"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "Every Hop Trusted",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.1"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "X-Real-IP",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.30"},
+			want:       "198.51.100.30",
+		},
+		{
+			name:       "X-Real-IP Is Ignored Next To X-Forwarded-For",
+			resolver:   resolver,
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.20", "X-Real-IP": "198.51.100.30"},
+			want:       "198.51.100.20",
+		},
+		{
+			name:       "IPv6 Proxy",
+			resolver:   resolver,
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			headers:    map[string]string{"X-Forwarded-For": "[2001:db8:1:2::3]:8080"},
+			want:       "2001:db8:1:2::3",
+		},
+		{
+			name:       "IPv4 Mapped IPv6",
+			resolver:   resolver,
+			remoteAddr: "[::ffff:198.51.100.40]:443",
+			want:       "198.51.100.40",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			addr, ok := tt.resolver.FromRequest(r)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, addr.String())
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	resolver := NewResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	var got string
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = String(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.20")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "198.51.100.20", got)
+
+	// Without the middleware the peer is the client
+	assert.Equal(t, "10.0.0.2", String(r))
+
+	r.RemoteAddr = "pipe"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "pipe", got)
+}
+
+func TestBucket(t *testing.T) {
+	assert.Equal(t, "198.51.100.20", Bucket(netip.MustParseAddr("198.51.100.20")))
+	assert.Equal(t, "2001:db8:1:2::/64", Bucket(netip.MustParseAddr("2001:db8:1:2:aaaa:bbbb:cccc:dddd")))
+	assert.Equal(t, Bucket(netip.MustParseAddr("2001:db8:1:2::1")), Bucket(netip.MustParseAddr("2001:db8:1:2:ffff::9")))
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes(" 10.1.2.3/8 ,, ::ffff:192.0.2.1, fd00::/8")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}, prefixes)
+
+	_, err = ParsePrefixes("10.0.0.0/33")
+	assert.EqualError(t, err, `"10.0.0.0/33" is neither a CIDR nor an address`)
+}
@@ -3,24 +3,95 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	// Database
-	DatabaseURL string
+	DatabaseURL         string
+	DBMaxConns          int
+	DBMinConns          int
+	DBMaxConnLifetime   time.Duration
+	DBMaxConnIdleTime   time.Duration
+	DBHealthCheckPeriod time.Duration
+	DBStatementTimeout  time.Duration
 
 	// Redis
 	RedisURL   string
 	RedisToken string
 
-	// Clerk
-	ClerkSecretKey string
+	// Authentication
+	AuthProvider     string // clerk, oidc or static
+	ClerkSecretKey   string
+	OIDCIssuerURL    string
+	OIDCAudience     string
+	OIDCJWKSURL      string // empty discovers it from the issuer
+	OIDCJWKSRefresh  time.Duration
+	AuthStaticTokens string // token:user_id pairs for the static provider
 
 	// Uptrace
 	UptraceDSN string
 
+	// Short codes
+	ShortCodeStrategy string // random, counter or hashids
+	ShortCodeLength   int
+	ShortCodeAlphabet string
+	ShortCodeReadable bool   // strip '-' and '_' from the alphabet
+	ShortCodeCounter  string // redis or postgres, for the counter strategy
+	ShortCodeSalt     string // hashids salt
+
+	// Redirect cache
+	URLCacheEnabled     bool
+	URLCacheTTL         time.Duration
+	URLCacheNegativeTTL time.Duration
+	URLCacheLocalSize   int // 0 disables the in-process cache
+	URLCacheLocalTTL    time.Duration
+
+	// GeoIP
+	GeoIPDatabasePath   string // MaxMind .mmdb file; empty disables geolocation
+	GeoIPReloadInterval time.Duration
+
+	// Click ingestion
+	IngestQueueSize     int
+	IngestBatchSize     int
+	IngestFlushInterval time.Duration
+
+	// Analytics rollups
+	AnalyticsRollupInterval  time.Duration
+	AnalyticsRollupBatchSize int
+
+	// Custom domains
+	DomainEdgeHost        string // CNAME target accepted as proof of ownership; empty allows TXT only
+	DomainRecheckInterval time.Duration
+
+	// TLS certificates for custom domains
+	ACMEEnabled      bool
+	ACMEDirectoryURL string // empty uses Let's Encrypt
+	ACMEEmail        string
+	ACMECACertFile   string // PEM bundle trusted for the ACME directory, e.g. Pebble's
+	ACMERenewBefore  time.Duration
+	ACMEInterval     time.Duration
+	TLSPort          string
+
+	// Rate limiting
+	TrustedProxies           string // comma separated CIDRs whose forwarding headers are believed
+	RateLimitPoliciesFile    string // JSON policies by route group; empty uses the defaults
+	RateLimitFailureMode     string // local, open or closed while Redis is unhealthy
+	RateLimitBreakerFailures int
+	RateLimitBreakerCooldown time.Duration
+	RateLimitRedisTimeout    time.Duration
+
+	// Password protected links
+	LinkUnlockSecret string // signs unlock cookies; empty picks a random key per process
+	LinkUnlockTTL    time.Duration
+	LinkUnlockSecure bool // marks unlock cookies Secure when TLS ends at a proxy
+
+	// Runtime metrics
+	MetricsToken string // bearer token for /metrics; empty disables the endpoint
+
 	// Service specific
 	ServicePort string
 	ServiceName string
@@ -45,12 +116,46 @@ func LoadConfig() (*Config, error) {
 		RedisURL:   os.Getenv("UPSTASH_REDIS_URL"),
 		RedisToken: os.Getenv("UPSTASH_REDIS_TOKEN"),
 
-		// Clerk
-		ClerkSecretKey: os.Getenv("CLERK_SECRET_KEY"),
+		// Authentication
+		AuthProvider:     getEnv("AUTH_PROVIDER", "clerk"),
+		ClerkSecretKey:   os.Getenv("CLERK_SECRET_KEY"),
+		OIDCIssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		OIDCAudience:     os.Getenv("OIDC_AUDIENCE"),
+		OIDCJWKSURL:      os.Getenv("OIDC_JWKS_URL"),
+		AuthStaticTokens: os.Getenv("AUTH_STATIC_TOKENS"),
 
 		// Uptrace
 		UptraceDSN: os.Getenv("UPTRACE_DSN"),
 
+		// Short codes
+		ShortCodeStrategy: getEnv("SHORT_CODE_STRATEGY", "random"),
+		ShortCodeAlphabet: os.Getenv("SHORT_CODE_ALPHABET"),
+		ShortCodeCounter:  getEnv("SHORT_CODE_COUNTER", "postgres"),
+		ShortCodeSalt:     os.Getenv("SHORT_CODE_SALT"),
+
+		// GeoIP
+		GeoIPDatabasePath: os.Getenv("GEOIP_DATABASE_PATH"),
+
+		// Custom domains
+		DomainEdgeHost: os.Getenv("DOMAIN_EDGE_HOST"),
+
+		// TLS certificates for custom domains
+		ACMEDirectoryURL: os.Getenv("ACME_DIRECTORY_URL"),
+		ACMEEmail:        os.Getenv("ACME_EMAIL"),
+		ACMECACertFile:   os.Getenv("ACME_CA_CERT_FILE"),
+		TLSPort:          getEnv("TLS_PORT", "8443"),
+
+		// Rate limiting
+		TrustedProxies:        os.Getenv("TRUSTED_PROXIES"),
+		RateLimitPoliciesFile: os.Getenv("RATE_LIMIT_POLICIES_FILE"),
+		RateLimitFailureMode:  getEnv("RATE_LIMIT_FAILURE_MODE", "local"),
+
+		// Password protected links
+		LinkUnlockSecret: os.Getenv("LINK_UNLOCK_SECRET"),
+
+		// Runtime metrics
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
+
 		// Service specific
 		ServicePort: os.Getenv("PORT"),
 		ServiceName: os.Getenv("SERVICE_NAME"),
@@ -61,14 +166,171 @@ func LoadConfig() (*Config, error) {
 		config.ServicePort = "8080"
 	}
 
+	var err error
+	if config.DBMaxConns, err = getEnvInt("DB_MAX_CONNS", 10); err != nil {
+		return nil, err
+	}
+	if config.DBMinConns, err = getEnvInt("DB_MIN_CONNS", 0); err != nil {
+		return nil, err
+	}
+	if config.DBMaxConnLifetime, err = getEnvDuration("DB_MAX_CONN_LIFETIME", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.DBMaxConnIdleTime, err = getEnvDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.DBHealthCheckPeriod, err = getEnvDuration("DB_HEALTH_CHECK_PERIOD", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.DBStatementTimeout, err = getEnvDuration("DB_STATEMENT_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if config.ShortCodeLength, err = getEnvInt("SHORT_CODE_LENGTH", 8); err != nil {
+		return nil, err
+	}
+	if config.ShortCodeReadable, err = getEnvBool("SHORT_CODE_READABLE", false); err != nil {
+		return nil, err
+	}
+	if config.URLCacheEnabled, err = getEnvBool("URL_CACHE_ENABLED", true); err != nil {
+		return nil, err
+	}
+	if config.URLCacheTTL, err = getEnvDuration("URL_CACHE_TTL", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.URLCacheNegativeTTL, err = getEnvDuration("URL_CACHE_NEGATIVE_TTL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.URLCacheLocalSize, err = getEnvInt("URL_CACHE_LOCAL_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if config.URLCacheLocalTTL, err = getEnvDuration("URL_CACHE_LOCAL_TTL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.GeoIPReloadInterval, err = getEnvDuration("GEOIP_RELOAD_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.IngestQueueSize, err = getEnvInt("INGEST_QUEUE_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if config.IngestBatchSize, err = getEnvInt("INGEST_BATCH_SIZE", 500); err != nil {
+		return nil, err
+	}
+	if config.IngestFlushInterval, err = getEnvDuration("INGEST_FLUSH_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	if config.AnalyticsRollupInterval, err = getEnvDuration("ANALYTICS_ROLLUP_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.AnalyticsRollupBatchSize, err = getEnvInt("ANALYTICS_ROLLUP_BATCH_SIZE", 5000); err != nil {
+		return nil, err
+	}
+	if config.DomainRecheckInterval, err = getEnvDuration("DOMAIN_RECHECK_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.ACMEEnabled, err = getEnvBool("ACME_ENABLED", false); err != nil {
+		return nil, err
+	}
+	if config.ACMERenewBefore, err = getEnvDuration("ACME_RENEW_BEFORE", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.ACMEInterval, err = getEnvDuration("ACME_INTERVAL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.OIDCJWKSRefresh, err = getEnvDuration("OIDC_JWKS_REFRESH_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.RateLimitBreakerFailures, err = getEnvInt("RATE_LIMIT_BREAKER_FAILURES", 5); err != nil {
+		return nil, err
+	}
+	if config.RateLimitBreakerCooldown, err = getEnvDuration("RATE_LIMIT_BREAKER_COOLDOWN", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.RateLimitRedisTimeout, err = getEnvDuration("RATE_LIMIT_REDIS_TIMEOUT", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.LinkUnlockTTL, err = getEnvDuration("LINK_UNLOCK_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.LinkUnlockSecure, err = getEnvBool("LINK_UNLOCK_SECURE", false); err != nil {
+		return nil, err
+	}
+
 	// Validate required configurations
 	if config.DatabaseURL == "" {
 		return nil, fmt.Errorf("NEON_DATABASE_URL is required")
 	}
 
-	if config.ClerkSecretKey == "" {
-		return nil, fmt.Errorf("CLERK_SECRET_KEY is required")
+	if config.DBMinConns > config.DBMaxConns {
+		return nil, fmt.Errorf("DB_MIN_CONNS must not exceed DB_MAX_CONNS")
+	}
+
+	switch config.AuthProvider {
+	case "clerk":
+		if config.ClerkSecretKey == "" {
+			return nil, fmt.Errorf("CLERK_SECRET_KEY is required")
+		}
+	case "oidc":
+		if config.OIDCIssuerURL == "" {
+			return nil, fmt.Errorf("OIDC_ISSUER_URL is required with AUTH_PROVIDER=oidc")
+		}
+	case "static":
+		if config.AuthStaticTokens == "" {
+			return nil, fmt.Errorf("AUTH_STATIC_TOKENS is required with AUTH_PROVIDER=static")
+		}
+		// Static tokens never expire and are not meant to guard real users
+		if env == "production" {
+			return nil, fmt.Errorf("AUTH_PROVIDER=static is not allowed in production")
+		}
+	default:
+		return nil, fmt.Errorf("AUTH_PROVIDER must be clerk, oidc or static")
 	}
 
 	return config, nil
 }
+
+// getEnv returns the value of key or def when it is unset
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt parses key as an integer, returning def when it is unset
+func getEnvInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %v", key, err)
+	}
+	return n, nil
+}
+
+// getEnvBool parses key as a boolean, returning def when it is unset
+func getEnvBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean: %v", key, err)
+	}
+	return b, nil
+}
+
+// getEnvDuration parses key as a duration such as "500ms", returning def when it is unset
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %v", key, err)
+	}
+	return d, nil
+}
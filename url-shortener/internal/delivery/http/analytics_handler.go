@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -15,6 +19,13 @@ func (h *Handler) HandleGetURLAnalytics(w http.ResponseWriter, r *http.Request)
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetURLAnalytics")
 	defer span.End()
 
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
@@ -22,12 +33,17 @@ func (h *Handler) HandleGetURLAnalytics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	span.SetAttributes(attribute.Int64("url_id", urlID))
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+	)
 
-	analytics, err := h.analyticsService.GetURLAnalytics(ctx, urlID)
+	analytics, err := h.analyticsService.GetURLAnalytics(ctx, urlID, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to fetch analytics", http.StatusInternalServerError)
+		if !writeAccessError(w, err) {
+			http.Error(w, "Failed to fetch analytics", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -36,3 +52,130 @@ func (h *Handler) HandleGetURLAnalytics(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(analytics)
 }
+
+// HandleGetURLAnalyticsSummary handles retrieving bucketed analytics for a URL
+func (h *Handler) HandleGetURLAnalyticsSummary(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetURLAnalyticsSummary")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+	)
+
+	query, err := parseSummaryQuery(r, urlID, time.Now())
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.UserID = claims.Subject
+
+	summary, err := h.analyticsService.GetURLSummary(ctx, query)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		switch err.(type) {
+		case *internalDomain.ErrInvalidQuery:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to fetch analytics summary", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	span.SetAttributes(attribute.Int("bucket_count", len(summary.Buckets)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// parseSummaryQuery reads a summary query from the query string: from and
+// to (RFC 3339, or YYYY-MM-DD in tz with to inclusive), bucket, tz (IANA
+// name), dimensions (comma separated) and limit. The range defaults to the
+// seven days up to now.
+func parseSummaryQuery(r *http.Request, urlID int64, now time.Time) (internalDomain.SummaryQuery, error) {
+	params := r.URL.Query()
+	query := internalDomain.SummaryQuery{
+		URLID:    urlID,
+		Bucket:   params.Get("bucket"),
+		Location: time.UTC,
+	}
+
+	if tz := params.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return query, &internalDomain.ErrInvalidQuery{Reason: "tz must be an IANA time zone"}
+		}
+		query.Location = loc
+	}
+
+	query.To = now
+	if v := params.Get("to"); v != "" {
+		t, err := parseSummaryTime(v, query.Location, true)
+		if err != nil {
+			return query, &internalDomain.ErrInvalidQuery{Reason: "to must be an RFC 3339 timestamp or a date"}
+		}
+		query.To = t
+	}
+
+	query.From = query.To.AddDate(0, 0, -7)
+	if v := params.Get("from"); v != "" {
+		t, err := parseSummaryTime(v, query.Location, false)
+		if err != nil {
+			return query, &internalDomain.ErrInvalidQuery{Reason: "from must be an RFC 3339 timestamp or a date"}
+		}
+		query.From = t
+	}
+
+	if v := params.Get("dimensions"); v != "" {
+		for _, dimension := range strings.Split(v, ",") {
+			if dimension = strings.TrimSpace(dimension); dimension != "" {
+				query.Dimensions = append(query.Dimensions, dimension)
+			}
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return query, &internalDomain.ErrInvalidQuery{Reason: "limit must be an integer"}
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// parseSummaryTime parses an RFC 3339 timestamp or a date in loc. An end
+// date includes the whole day.
+func parseSummaryTime(v string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, v, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// HandleCreateAPIKey handles creating an API key. The key is only ever
+// returned by this response.
+func (h *Handler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleCreateAPIKey")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(attribute.String("user_id", claims.Subject))
+
+	key, err := h.apiKeyService.CreateAPIKey(ctx, claims.Subject, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		switch err.(type) {
+		case *internalDomain.ErrInvalidAPIKeyRequest:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("api_key_id", key.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// HandleListAPIKeys handles listing user's API keys
+func (h *Handler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleListAPIKeys")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	span.SetAttributes(attribute.String("user_id", claims.Subject))
+
+	keys, err := h.apiKeyService.ListAPIKeys(ctx, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+
+	span.SetAttributes(attribute.Int("api_key_count", len(keys)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// HandleUpdateAPIKey handles renaming an API key
+func (h *Handler) HandleUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleUpdateAPIKey")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("api_key_id", keyID),
+	)
+
+	key, err := h.apiKeyService.RenameAPIKey(ctx, keyID, claims.Subject, req.Name)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		switch err.(type) {
+		case *internalDomain.ErrInvalidAPIKeyRequest:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update API key", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// HandleRevokeAPIKey handles revoking an API key
+func (h *Handler) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRevokeAPIKey")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("api_key_id", keyID),
+	)
+
+	if err := h.apiKeyService.RevokeAPIKey(ctx, keyID, claims.Subject); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
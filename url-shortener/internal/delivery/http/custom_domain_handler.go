@@ -31,17 +31,29 @@ func (h *Handler) HandleRegisterDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	span.SetAttributes(
 		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
 		attribute.String("domain", req.Domain),
 	)
 
-	domain, err := h.customDomainService.RegisterDomain(ctx, req.Domain, claims.Subject)
+	domain, err := h.customDomainService.RegisterDomain(ctx, req.Domain, claims.Subject, workspace)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
 		switch err.(type) {
-		case *internalDomain.ErrDomainNotFound:
+		case *internalDomain.ErrDomainAlreadyExists:
 			http.Error(w, err.Error(), http.StatusConflict)
+		case *internalDomain.ErrForbidden:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case *internalDomain.ErrQuotaExceeded:
+			writeQuotaError(w, err.(*internalDomain.ErrQuotaExceeded))
 		default:
 			http.Error(w, "Failed to register domain", http.StatusInternalServerError)
 		}
@@ -59,6 +71,13 @@ func (h *Handler) HandleVerifyDomain(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleVerifyDomain")
 	defer span.End()
 
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	domainID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
@@ -66,21 +85,85 @@ func (h *Handler) HandleVerifyDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	span.SetAttributes(attribute.Int64("domain_id", domainID))
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("domain_id", domainID),
+	)
 
-	err = h.customDomainService.VerifyDomain(ctx, domainID)
+	domain, err := h.customDomainService.VerifyDomain(ctx, domainID, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
 		switch err.(type) {
-		case *internalDomain.ErrDomainNotFound:
-			http.Error(w, err.Error(), http.StatusNotFound)
+		case *internalDomain.ErrDomainVerificationFailed:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case *internalDomain.ErrQuotaExceeded:
+			writeQuotaError(w, err.(*internalDomain.ErrQuotaExceeded))
 		default:
 			http.Error(w, "Failed to verify domain", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	span.SetAttributes(attribute.Bool("verified", domain.Verified))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain)
+}
+
+// HandleUpdateDomain handles changing a custom domain's redirect targets
+func (h *Handler) HandleUpdateDomain(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleUpdateDomain")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	domainID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid domain ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("domain_id", domainID),
+	)
+
+	domain, err := h.customDomainService.UpdateDomain(ctx, domainID, claims.Subject, internalDomain.CustomDomainUpdate{
+		RootURL:     req.RootURL,
+		NotFoundURL: req.NotFoundURL,
+	})
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		switch err.(type) {
+		case *internalDomain.ErrInvalidDomainSettings:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update domain", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain)
 }
 
 // HandleListUserDomains handles listing user's custom domains
@@ -95,11 +178,24 @@ func (h *Handler) HandleListUserDomains(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	span.SetAttributes(attribute.String("user_id", claims.Subject))
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+	)
 
-	domains, err := h.customDomainService.GetUserDomains(ctx, claims.Subject)
+	domains, err := h.customDomainService.GetUserDomains(ctx, claims.Subject, workspace)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
 		http.Error(w, "Failed to fetch domains", http.StatusInternalServerError)
 		return
 	}
@@ -137,9 +233,12 @@ func (h *Handler) HandleDeleteDomain(w http.ResponseWriter, r *http.Request) {
 	err = h.customDomainService.DeleteDomain(ctx, domainID, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
 		switch err.(type) {
-		case *internalDomain.ErrDomainNotFound:
-			http.Error(w, err.Error(), http.StatusNotFound)
+		case *internalDomain.ErrDomainInUse:
+			http.Error(w, err.Error(), http.StatusConflict)
 		default:
 			http.Error(w, "Failed to delete domain", http.StatusInternalServerError)
 		}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type contextKey string
+
+// CustomDomainContextKey holds the verified custom domain a request was made on
+const CustomDomainContextKey contextKey = "custom-domain"
+
+// CustomDomainRouting hands requests for a verified custom domain to
+// domainRouter and passes every other request on
+func (h *Handler) CustomDomainRouting(domainRouter http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+
+			domain, err := h.customDomainService.ResolveHost(r.Context(), host)
+			if err != nil {
+				var notFound *internalDomain.ErrDomainNotFound
+				if !errors.As(err, &notFound) {
+					log.Printf("[ERROR] resolving host %s failed: %v", host, err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), CustomDomainContextKey, domain)
+			domainRouter.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HandleDomainRoot redirects the bare custom domain to its root URL
+func (h *Handler) HandleDomainRoot(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleDomainRoot")
+	defer span.End()
+
+	domain := ctx.Value(CustomDomainContextKey).(*internalDomain.CustomDomain)
+	span.SetAttributes(attribute.String("domain", domain.Domain))
+
+	if domain.RootURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, domain.RootURL, http.StatusFound)
+}
+
+// HandleDomainRedirect handles URL redirection on a custom domain. Unknown
+// and expired short codes go to the domain's not-found URL when it has one.
+func (h *Handler) HandleDomainRedirect(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleDomainRedirect")
+	defer span.End()
+
+	domain := ctx.Value(CustomDomainContextKey).(*internalDomain.CustomDomain)
+	shortCode := chi.URLParam(r, "shortCode")
+	span.SetAttributes(
+		attribute.String("domain", domain.Domain),
+		attribute.String("short_code", shortCode),
+	)
+
+	url, err := h.urlService.GetDomainURL(ctx, domain.ID, shortCode)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		switch err.(type) {
+		case *internalDomain.ErrURLNotFound, *internalDomain.ErrURLExpired:
+			if domain.NotFoundURL != "" {
+				http.Redirect(w, r, domain.NotFoundURL, http.StatusFound)
+				return
+			}
+		}
+		writeLookupError(w, err)
+		return
+	}
+
+	h.redirect(w, r.WithContext(ctx), url)
+}
+
+// HandleDomainNotFound sends paths no route matches on a custom domain to
+// its not-found URL
+func (h *Handler) HandleDomainNotFound(w http.ResponseWriter, r *http.Request) {
+	domain := r.Context().Value(CustomDomainContextKey).(*internalDomain.CustomDomain)
+	if domain.NotFoundURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, domain.NotFoundURL, http.StatusFound)
+}
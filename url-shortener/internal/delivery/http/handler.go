@@ -1,20 +1,42 @@
 package http
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
 	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/utils"
 )
 
+// WorkspaceHeader selects the workspace that links and domains are created
+// in and listed from; without it requests act on the caller's personal workspace
+const WorkspaceHeader = "X-Workspace-ID"
+
+// MetricsSource returns a snapshot of runtime counters for the metrics endpoint
+type MetricsSource func() any
+
 // Handler contains all the dependencies for HTTP handlers
 type Handler struct {
 	urlService          internalDomain.URLService
 	analyticsService    internalDomain.AnalyticsService
 	tagService          internalDomain.TagService
 	customDomainService internalDomain.CustomDomainService
+	apiKeyService       internalDomain.APIKeyService
+	workspaceService    internalDomain.WorkspaceService
+	usageService        internalDomain.UsageService
+	visitRecorder       internalDomain.VisitRecorder
+	metrics             map[string]MetricsSource
+	metricsToken        string
+	unlockCookies       *linkpass.Cookies
+	unlockLimiter       UnlockLimiter
 }
 
 // NewHandler creates a new Handler instance
@@ -23,13 +45,109 @@ func NewHandler(
 	analyticsService internalDomain.AnalyticsService,
 	tagService internalDomain.TagService,
 	customDomainService internalDomain.CustomDomainService,
+	apiKeyService internalDomain.APIKeyService,
+	workspaceService internalDomain.WorkspaceService,
+	usageService internalDomain.UsageService,
+	visitRecorder internalDomain.VisitRecorder,
 ) *Handler {
 	return &Handler{
 		urlService:          urlService,
 		analyticsService:    analyticsService,
 		tagService:          tagService,
 		customDomainService: customDomainService,
+		apiKeyService:       apiKeyService,
+		workspaceService:    workspaceService,
+		usageService:        usageService,
+		visitRecorder:       visitRecorder,
+		metrics:             make(map[string]MetricsSource),
+		unlockCookies:       linkpass.NewCookies(nil, time.Hour, false),
+	}
+}
+
+// RegisterMetrics adds a named source to the metrics endpoint
+func (h *Handler) RegisterMetrics(name string, source MetricsSource) {
+	h.metrics[name] = source
+}
+
+// ProtectMetrics sets the bearer token the metrics endpoint asks for. The
+// endpoint stays disabled until a token is set.
+func (h *Handler) ProtectMetrics(token string) {
+	h.metricsToken = token
+}
+
+// HandleMetrics reports the registered runtime counters to callers with the
+// metrics token
+func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.metricsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.metricsToken)) != 1 {
+		http.Error(w, "Invalid metrics token", http.StatusUnauthorized)
+		return
+	}
+
+	snapshot := make(map[string]any, len(h.metrics))
+	for name, source := range h.metrics {
+		snapshot[name] = source()
+	}
+
+	utils.JSONResponse(utils.JSONOpts{
+		W:      w,
+		Status: http.StatusOK,
+		Data:   snapshot,
+	})
+}
+
+// workspaceID reads the WorkspaceHeader, zero when it is absent
+func workspaceID(r *http.Request) (int64, error) {
+	v := r.Header.Get(WorkspaceHeader)
+	if v == "" {
+		return 0, nil
 	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%s must be a workspace ID", WorkspaceHeader)
+	}
+
+	return id, nil
+}
+
+// writeAccessError responds to a failed permission check and reports whether
+// err was one: 404 when the resource does not exist, 403 when the caller's
+// role does not allow the request or the workspace's plan does not
+func writeAccessError(w http.ResponseWriter, err error) bool {
+	switch e := err.(type) {
+	case *internalDomain.ErrURLNotFound, *internalDomain.ErrDomainNotFound, *internalDomain.ErrAPIKeyNotFound,
+		*internalDomain.ErrWorkspaceNotFound, *internalDomain.ErrMemberNotFound, *internalDomain.ErrInvitationNotFound,
+		*internalDomain.ErrTagNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case *internalDomain.ErrForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case *internalDomain.ErrQuotaExceeded:
+		writeQuotaError(w, e)
+	default:
+		return false
+	}
+	return true
+}
+
+// writeQuotaError responds 402 when upgrading the plan would lift the quota
+// and 403 when no plan would
+func writeQuotaError(w http.ResponseWriter, err *internalDomain.ErrQuotaExceeded) {
+	if err.Upgradable() {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusForbidden)
+}
+
+// visitorIP returns the client address, following trusted proxies the same
+// way the rate limiter does
+func visitorIP(r *http.Request) string {
+	return clientip.String(r)
 }
 
 // HandlePublicShorten handles URL shortening requests from unauthenticated users
@@ -55,7 +173,7 @@ func (h *Handler) HandlePublicShorten(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try creating the short URL
-	shortURL, err := h.urlService.CreateShortURL(r.Context(), req.URL, "", nil)
+	shortURL, err := h.urlService.CreateShortURL(r.Context(), req.URL, "", 0, nil, "", "", "")
 	if err != nil {
 		utils.RespondError(w, http.StatusInternalServerError, "Failed to create short URL", err)
 		return
@@ -0,0 +1,1128 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/auth"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockURLService is a mock implementation of URLService
+type MockURLService struct {
+	mock.Mock
+}
+
+func (m *MockURLService) CreateShortURL(ctx context.Context, originalURL string, userID string, workspaceID int64, expiresAt *time.Time, alias string, domainName string, password string) (*internalDomain.URL, error) {
+	args := m.Called(ctx, originalURL, userID, workspaceID, expiresAt, alias, domainName, password)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URL), args.Error(1)
+}
+
+func (m *MockURLService) GetURL(ctx context.Context, shortCode string) (*internalDomain.URL, error) {
+	args := m.Called(ctx, shortCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URL), args.Error(1)
+}
+
+func (m *MockURLService) GetDomainURL(ctx context.Context, domainID int64, shortCode string) (*internalDomain.URL, error) {
+	args := m.Called(ctx, domainID, shortCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URL), args.Error(1)
+}
+
+func (m *MockURLService) ListUserURLs(ctx context.Context, query internalDomain.URLQuery) (*internalDomain.URLPage, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URLPage), args.Error(1)
+}
+
+func (m *MockURLService) DeleteURL(ctx context.Context, id int64, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockURLService) RecordClick(ctx context.Context, urlID int64) error {
+	args := m.Called(ctx, urlID)
+	return args.Error(0)
+}
+
+func (m *MockURLService) UpdateURL(ctx context.Context, id int64, userID string, update internalDomain.URLUpdate, expectedVersion int) (*internalDomain.URL, error) {
+	args := m.Called(ctx, id, userID, update, expectedVersion)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URL), args.Error(1)
+}
+
+func (m *MockURLService) GetURLHistory(ctx context.Context, id int64, userID string) ([]internalDomain.URLHistory, error) {
+	args := m.Called(ctx, id, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.URLHistory), args.Error(1)
+}
+
+func (m *MockURLService) RollbackURL(ctx context.Context, id int64, userID string, historyID int64, expectedVersion int) (*internalDomain.URL, error) {
+	args := m.Called(ctx, id, userID, historyID, expectedVersion)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URL), args.Error(1)
+}
+
+func (m *MockURLService) BulkUpdateURLs(ctx context.Context, query internalDomain.URLQuery, action internalDomain.URLBulkAction) (*internalDomain.URLBulkResult, error) {
+	args := m.Called(ctx, query, action)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.URLBulkResult), args.Error(1)
+}
+
+// visitLog records visits in memory
+type visitLog struct {
+	visits []internalDomain.Analytics
+}
+
+func (l *visitLog) Record(visit internalDomain.Analytics) {
+	l.visits = append(l.visits, visit)
+}
+
+// MockAnalyticsService is a mock implementation of AnalyticsService
+type MockAnalyticsService struct {
+	mock.Mock
+}
+
+func (m *MockAnalyticsService) RecordVisit(ctx context.Context, urlID int64, visitorIP, userAgent, referer string, visitedAt time.Time) error {
+	args := m.Called(ctx, urlID, visitorIP, userAgent, referer, visitedAt)
+	return args.Error(0)
+}
+
+func (m *MockAnalyticsService) GetURLAnalytics(ctx context.Context, urlID int64, userID string) ([]internalDomain.Analytics, error) {
+	args := m.Called(ctx, urlID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.Analytics), args.Error(1)
+}
+
+func (m *MockAnalyticsService) GetURLSummary(ctx context.Context, query internalDomain.SummaryQuery) (*internalDomain.AnalyticsSummary, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.AnalyticsSummary), args.Error(1)
+}
+
+// MockTagService is a mock implementation of TagService
+type MockTagService struct {
+	mock.Mock
+}
+
+func (m *MockTagService) CreateTag(ctx context.Context, tag internalDomain.Tag, userID string, workspaceID int64) (*internalDomain.Tag, error) {
+	args := m.Called(ctx, tag, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) GetTag(ctx context.Context, id int64, userID string) (*internalDomain.Tag, error) {
+	args := m.Called(ctx, id, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) GetTagByName(ctx context.Context, name string, userID string, workspaceID int64) (*internalDomain.Tag, error) {
+	args := m.Called(ctx, name, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) ListTags(ctx context.Context, userID string, workspaceID int64) ([]internalDomain.TagUsage, error) {
+	args := m.Called(ctx, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.TagUsage), args.Error(1)
+}
+
+func (m *MockTagService) UpdateTag(ctx context.Context, id int64, userID string, update internalDomain.TagUpdate) (*internalDomain.Tag, error) {
+	args := m.Called(ctx, id, userID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) MergeTags(ctx context.Context, sourceID int64, targetID int64, userID string) (*internalDomain.Tag, error) {
+	args := m.Called(ctx, sourceID, targetID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) DeleteTag(ctx context.Context, id int64, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockTagService) BulkTagURLs(ctx context.Context, urlIDs []int64, userID string, workspaceID int64, add []string, remove []string) error {
+	args := m.Called(ctx, urlIDs, userID, workspaceID, add, remove)
+	return args.Error(0)
+}
+
+func (m *MockTagService) GetURLTags(ctx context.Context, urlID int64, userID string) ([]internalDomain.Tag, error) {
+	args := m.Called(ctx, urlID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.Tag), args.Error(1)
+}
+
+func (m *MockTagService) AddTagToURL(ctx context.Context, urlID int64, userID string, tag string) error {
+	args := m.Called(ctx, urlID, userID, tag)
+	return args.Error(0)
+}
+
+func (m *MockTagService) RemoveTagFromURL(ctx context.Context, urlID int64, userID string, tag string) error {
+	args := m.Called(ctx, urlID, userID, tag)
+	return args.Error(0)
+}
+
+// MockCustomDomainService is a mock implementation of CustomDomainService
+type MockCustomDomainService struct {
+	mock.Mock
+}
+
+func (m *MockCustomDomainService) RegisterDomain(ctx context.Context, domain string, userID string, workspaceID int64) (*internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, domain, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.CustomDomain), args.Error(1)
+}
+
+func (m *MockCustomDomainService) GetUserDomains(ctx context.Context, userID string, workspaceID int64) ([]internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.CustomDomain), args.Error(1)
+}
+
+func (m *MockCustomDomainService) DeleteDomain(ctx context.Context, id int64, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockCustomDomainService) VerifyDomain(ctx context.Context, id int64, userID string) (*internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, id, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.CustomDomain), args.Error(1)
+}
+
+func (m *MockCustomDomainService) UpdateDomain(ctx context.Context, id int64, userID string, update internalDomain.CustomDomainUpdate) (*internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, id, userID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.CustomDomain), args.Error(1)
+}
+
+func (m *MockCustomDomainService) ResolveHost(ctx context.Context, host string) (*internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, host)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.CustomDomain), args.Error(1)
+}
+
+// MockAPIKeyService is a mock implementation of APIKeyService
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) CreateAPIKey(ctx context.Context, userID string, name string, scopes []string, expiresAt *time.Time) (*internalDomain.NewAPIKey, error) {
+	args := m.Called(ctx, userID, name, scopes, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.NewAPIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]internalDomain.APIKey, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) RenameAPIKey(ctx context.Context, id int64, userID string, name string) (*internalDomain.APIKey, error) {
+	args := m.Called(ctx, id, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) RevokeAPIKey(ctx context.Context, id int64, userID string) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) Authenticate(ctx context.Context, key string) (*internalDomain.APIKey, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.APIKey), args.Error(1)
+}
+
+// MockWorkspaceService is a mock implementation of WorkspaceService
+type MockWorkspaceService struct {
+	mock.Mock
+}
+
+func (m *MockWorkspaceService) CreateWorkspace(ctx context.Context, userID string, name string) (*internalDomain.Workspace, error) {
+	args := m.Called(ctx, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspaceService) ListWorkspaces(ctx context.Context, userID string) ([]internalDomain.Workspace, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspaceService) ListMembers(ctx context.Context, workspaceID int64, userID string) ([]internalDomain.WorkspaceMember, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.WorkspaceMember), args.Error(1)
+}
+
+func (m *MockWorkspaceService) UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, memberID string, role string) (*internalDomain.WorkspaceMember, error) {
+	args := m.Called(ctx, workspaceID, userID, memberID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.WorkspaceMember), args.Error(1)
+}
+
+func (m *MockWorkspaceService) RemoveMember(ctx context.Context, workspaceID int64, userID string, memberID string) error {
+	args := m.Called(ctx, workspaceID, userID, memberID)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceService) CreateInvitation(ctx context.Context, workspaceID int64, userID string, email string, role string) (*internalDomain.NewWorkspaceInvitation, error) {
+	args := m.Called(ctx, workspaceID, userID, email, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.NewWorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceService) ListInvitations(ctx context.Context, workspaceID int64, userID string) ([]internalDomain.WorkspaceInvitation, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.WorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceService) RevokeInvitation(ctx context.Context, workspaceID int64, invitationID int64, userID string) error {
+	args := m.Called(ctx, workspaceID, invitationID, userID)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceService) AcceptInvitation(ctx context.Context, token string, userID string) (*internalDomain.Workspace, error) {
+	args := m.Called(ctx, token, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Workspace), args.Error(1)
+}
+
+// MockUsageService is a mock implementation of UsageService
+type MockUsageService struct {
+	mock.Mock
+}
+
+func (m *MockUsageService) GetUsage(ctx context.Context, userID string, workspaceID int64) (*internalDomain.Usage, error) {
+	args := m.Called(ctx, userID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Usage), args.Error(1)
+}
+
+func (m *MockUsageService) UserPlan(ctx context.Context, userID string) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+// serve routes a request to handler the way the router would, signed in as
+// userID unless it is empty
+func serve(handler http.HandlerFunc, method, pattern, target, body, userID string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if userID != "" {
+				claims := &internalDomain.Claims{Subject: userID}
+				req = req.WithContext(context.WithValue(req.Context(), middleware.SessionContextKey, claims))
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Method(method, pattern, handler)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestOwnershipEnforcement(t *testing.T) {
+	analyticsService := new(MockAnalyticsService)
+	tagService := new(MockTagService)
+	domainService := new(MockCustomDomainService)
+	apiKeyService := new(MockAPIKeyService)
+	workspaceService := new(MockWorkspaceService)
+	usageService := new(MockUsageService)
+	h := NewHandler(nil, analyticsService, tagService, domainService, apiKeyService, workspaceService, usageService, nil)
+
+	urlNotFound := &internalDomain.ErrURLNotFound{}
+	urlForbidden := &internalDomain.ErrForbidden{Resource: "URL", ID: 1}
+
+	endpoints := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		pattern string
+		target  string
+		body    string
+		// mockResult makes the service call for user123 on resource 1 return err
+		mockResult func(err error)
+		wantOK     int
+		notFound   error
+		forbidden  error
+	}{
+		{
+			name:    "Get URL Analytics",
+			handler: h.HandleGetURLAnalytics,
+			method:  http.MethodGet,
+			pattern: "/private/urls/{id}/analytics",
+			target:  "/private/urls/1/analytics",
+			mockResult: func(err error) {
+				if err != nil {
+					analyticsService.On("GetURLAnalytics", mock.Anything, int64(1), "user123").Return(nil, err)
+					return
+				}
+				analyticsService.On("GetURLAnalytics", mock.Anything, int64(1), "user123").Return([]internalDomain.Analytics{}, nil)
+			},
+			wantOK: http.StatusOK,
+		},
+		{
+			name:    "Get URL Analytics Summary",
+			handler: h.HandleGetURLAnalyticsSummary,
+			method:  http.MethodGet,
+			pattern: "/private/urls/{id}/analytics/summary",
+			target:  "/private/urls/1/analytics/summary",
+			mockResult: func(err error) {
+				matchesUser := mock.MatchedBy(func(q internalDomain.SummaryQuery) bool {
+					return q.URLID == 1 && q.UserID == "user123"
+				})
+				if err != nil {
+					analyticsService.On("GetURLSummary", mock.Anything, matchesUser).Return(nil, err)
+					return
+				}
+				analyticsService.On("GetURLSummary", mock.Anything, matchesUser).Return(&internalDomain.AnalyticsSummary{}, nil)
+			},
+			wantOK: http.StatusOK,
+		},
+		{
+			name:    "Get URL Tags",
+			handler: h.HandleGetURLTags,
+			method:  http.MethodGet,
+			pattern: "/private/urls/{id}/tags",
+			target:  "/private/urls/1/tags",
+			mockResult: func(err error) {
+				if err != nil {
+					tagService.On("GetURLTags", mock.Anything, int64(1), "user123").Return(nil, err)
+					return
+				}
+				tagService.On("GetURLTags", mock.Anything, int64(1), "user123").Return([]internalDomain.Tag{}, nil)
+			},
+			wantOK: http.StatusOK,
+		},
+		{
+			name:    "Add Tag",
+			handler: h.HandleAddTag,
+			method:  http.MethodPost,
+			pattern: "/private/urls/{id}/tags",
+			target:  "/private/urls/1/tags",
+			body:    `{"tag":"promo"}`,
+			mockResult: func(err error) {
+				tagService.On("AddTagToURL", mock.Anything, int64(1), "user123", "promo").Return(err)
+			},
+			wantOK: http.StatusNoContent,
+		},
+		{
+			name:    "Remove Tag",
+			handler: h.HandleRemoveTag,
+			method:  http.MethodDelete,
+			pattern: "/private/urls/{id}/tags/{tag}",
+			target:  "/private/urls/1/tags/promo",
+			mockResult: func(err error) {
+				tagService.On("RemoveTagFromURL", mock.Anything, int64(1), "user123", "promo").Return(err)
+			},
+			wantOK: http.StatusNoContent,
+		},
+		{
+			name:    "Update Tag",
+			handler: h.HandleUpdateTag,
+			method:  http.MethodPatch,
+			pattern: "/private/tags/{id}",
+			target:  "/private/tags/1",
+			body:    `{"name":"summer"}`,
+			mockResult: func(err error) {
+				if err != nil {
+					tagService.On("UpdateTag", mock.Anything, int64(1), "user123", mock.Anything).Return(nil, err)
+					return
+				}
+				tagService.On("UpdateTag", mock.Anything, int64(1), "user123", mock.Anything).Return(&internalDomain.Tag{ID: 1, Name: "summer"}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrTagNotFound{},
+			forbidden: &internalDomain.ErrForbidden{Resource: "tag", ID: 1},
+		},
+		{
+			name:    "Merge Tag",
+			handler: h.HandleMergeTag,
+			method:  http.MethodPost,
+			pattern: "/private/tags/{id}/merge",
+			target:  "/private/tags/1/merge",
+			body:    `{"into":2}`,
+			mockResult: func(err error) {
+				if err != nil {
+					tagService.On("MergeTags", mock.Anything, int64(1), int64(2), "user123").Return(nil, err)
+					return
+				}
+				tagService.On("MergeTags", mock.Anything, int64(1), int64(2), "user123").Return(&internalDomain.Tag{ID: 2, Name: "sale"}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrTagNotFound{},
+			forbidden: &internalDomain.ErrForbidden{Resource: "tag", ID: 1},
+		},
+		{
+			name:    "Delete Tag",
+			handler: h.HandleDeleteTag,
+			method:  http.MethodDelete,
+			pattern: "/private/tags/{id}",
+			target:  "/private/tags/1",
+			mockResult: func(err error) {
+				tagService.On("DeleteTag", mock.Anything, int64(1), "user123").Return(err)
+			},
+			wantOK:    http.StatusNoContent,
+			notFound:  &internalDomain.ErrTagNotFound{},
+			forbidden: &internalDomain.ErrForbidden{Resource: "tag", ID: 1},
+		},
+		{
+			name:    "Verify Domain",
+			handler: h.HandleVerifyDomain,
+			method:  http.MethodPost,
+			pattern: "/private/domains/{id}/verify",
+			target:  "/private/domains/1/verify",
+			mockResult: func(err error) {
+				if err != nil {
+					domainService.On("VerifyDomain", mock.Anything, int64(1), "user123").Return(nil, err)
+					return
+				}
+				domainService.On("VerifyDomain", mock.Anything, int64(1), "user123").Return(&internalDomain.CustomDomain{ID: 1, Verified: true}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrDomainNotFound{},
+			forbidden: &internalDomain.ErrForbidden{Resource: "domain", ID: 1},
+		},
+		{
+			name:    "Update Domain",
+			handler: h.HandleUpdateDomain,
+			method:  http.MethodPatch,
+			pattern: "/private/domains/{id}",
+			target:  "/private/domains/1",
+			body:    `{"root_url":"https://acme.com"}`,
+			mockResult: func(err error) {
+				if err != nil {
+					domainService.On("UpdateDomain", mock.Anything, int64(1), "user123", mock.Anything).Return(nil, err)
+					return
+				}
+				domainService.On("UpdateDomain", mock.Anything, int64(1), "user123", mock.Anything).Return(&internalDomain.CustomDomain{ID: 1, RootURL: "https://acme.com"}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrDomainNotFound{},
+			forbidden: &internalDomain.ErrForbidden{Resource: "domain", ID: 1},
+		},
+		{
+			name:    "Rename API Key",
+			handler: h.HandleUpdateAPIKey,
+			method:  http.MethodPatch,
+			pattern: "/private/api-keys/{id}",
+			target:  "/private/api-keys/1",
+			body:    `{"name":"ci"}`,
+			mockResult: func(err error) {
+				if err != nil {
+					apiKeyService.On("RenameAPIKey", mock.Anything, int64(1), "user123", "ci").Return(nil, err)
+					return
+				}
+				apiKeyService.On("RenameAPIKey", mock.Anything, int64(1), "user123", "ci").Return(&internalDomain.APIKey{ID: 1, Name: "ci"}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrAPIKeyNotFound{ID: 1},
+			forbidden: &internalDomain.ErrForbidden{Resource: "API key", ID: 1},
+		},
+		{
+			name:    "Revoke API Key",
+			handler: h.HandleRevokeAPIKey,
+			method:  http.MethodDelete,
+			pattern: "/private/api-keys/{id}",
+			target:  "/private/api-keys/1",
+			mockResult: func(err error) {
+				apiKeyService.On("RevokeAPIKey", mock.Anything, int64(1), "user123").Return(err)
+			},
+			wantOK:    http.StatusNoContent,
+			notFound:  &internalDomain.ErrAPIKeyNotFound{ID: 1},
+			forbidden: &internalDomain.ErrForbidden{Resource: "API key", ID: 1},
+		},
+		{
+			name:    "List Workspace Members",
+			handler: h.HandleListMembers,
+			method:  http.MethodGet,
+			pattern: "/private/workspaces/{id}/members",
+			target:  "/private/workspaces/1/members",
+			mockResult: func(err error) {
+				if err != nil {
+					workspaceService.On("ListMembers", mock.Anything, int64(1), "user123").Return(nil, err)
+					return
+				}
+				workspaceService.On("ListMembers", mock.Anything, int64(1), "user123").Return([]internalDomain.WorkspaceMember{}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrWorkspaceNotFound{ID: 1},
+			forbidden: &internalDomain.ErrForbidden{Resource: "workspace", ID: 1},
+		},
+		{
+			name:    "Update Workspace Member",
+			handler: h.HandleUpdateMember,
+			method:  http.MethodPatch,
+			pattern: "/private/workspaces/{id}/members/{userID}",
+			target:  "/private/workspaces/1/members/user456",
+			body:    `{"role":"editor"}`,
+			mockResult: func(err error) {
+				if err != nil {
+					workspaceService.On("UpdateMemberRole", mock.Anything, int64(1), "user123", "user456", "editor").Return(nil, err)
+					return
+				}
+				workspaceService.On("UpdateMemberRole", mock.Anything, int64(1), "user123", "user456", "editor").Return(&internalDomain.WorkspaceMember{WorkspaceID: 1, UserID: "user456", Role: "editor"}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrMemberNotFound{WorkspaceID: 1, UserID: "user456"},
+			forbidden: &internalDomain.ErrForbidden{Resource: "workspace", ID: 1},
+		},
+		{
+			name:    "Revoke Workspace Invitation",
+			handler: h.HandleRevokeInvitation,
+			method:  http.MethodDelete,
+			pattern: "/private/workspaces/{id}/invitations/{invitationID}",
+			target:  "/private/workspaces/1/invitations/2",
+			mockResult: func(err error) {
+				workspaceService.On("RevokeInvitation", mock.Anything, int64(1), int64(2), "user123").Return(err)
+			},
+			wantOK:    http.StatusNoContent,
+			notFound:  &internalDomain.ErrInvitationNotFound{ID: 2},
+			forbidden: &internalDomain.ErrForbidden{Resource: "workspace", ID: 1},
+		},
+		{
+			name:    "Get Usage",
+			handler: h.HandleGetUsage,
+			method:  http.MethodGet,
+			pattern: "/private/usage",
+			target:  "/private/usage",
+			mockResult: func(err error) {
+				if err != nil {
+					usageService.On("GetUsage", mock.Anything, "user123", int64(0)).Return(nil, err)
+					return
+				}
+				usageService.On("GetUsage", mock.Anything, "user123", int64(0)).Return(&internalDomain.Usage{Plan: internalDomain.PlanFree}, nil)
+			},
+			wantOK:    http.StatusOK,
+			notFound:  &internalDomain.ErrWorkspaceNotFound{ID: 1},
+			forbidden: &internalDomain.ErrForbidden{Resource: "workspace", ID: 1},
+		},
+	}
+
+	for _, e := range endpoints {
+		if e.notFound == nil {
+			e.notFound, e.forbidden = urlNotFound, urlForbidden
+		}
+
+		cases := []struct {
+			name       string
+			userID     string
+			err        error
+			wantStatus int
+		}{
+			{name: "Owner", userID: "user123", err: nil, wantStatus: e.wantOK},
+			{name: "Not Owner", userID: "user123", err: e.forbidden, wantStatus: http.StatusForbidden},
+			{name: "Not Found", userID: "user123", err: e.notFound, wantStatus: http.StatusNotFound},
+			{name: "Service Error", userID: "user123", err: assert.AnError, wantStatus: http.StatusInternalServerError},
+			{name: "Unauthenticated", userID: "", wantStatus: http.StatusUnauthorized},
+		}
+
+		for _, tt := range cases {
+			t.Run(e.name+"/"+tt.name, func(t *testing.T) {
+				analyticsService.ExpectedCalls = nil
+				tagService.ExpectedCalls = nil
+				domainService.ExpectedCalls = nil
+				apiKeyService.ExpectedCalls = nil
+				workspaceService.ExpectedCalls = nil
+				usageService.ExpectedCalls = nil
+				if tt.userID != "" {
+					e.mockResult(tt.err)
+				}
+
+				rec := serve(e.handler, e.method, e.pattern, e.target, e.body, tt.userID)
+				assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			})
+		}
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	tagService := new(MockTagService)
+	domainService := new(MockCustomDomainService)
+	h := NewHandler(nil, nil, tagService, domainService, nil, nil, nil, nil)
+
+	// A higher plan would allow the tag
+	tagService.On("AddTagToURL", mock.Anything, int64(1), "user123", "promo").
+		Return(&internalDomain.ErrQuotaExceeded{Quota: internalDomain.QuotaTags, Plan: internalDomain.PlanFree, Limit: 20})
+	rec := serve(h.HandleAddTag, http.MethodPost, "/private/urls/{id}/tags", "/private/urls/1/tags", `{"tag":"promo"}`, "user123")
+	assert.Equal(t, http.StatusPaymentRequired, rec.Code, rec.Body.String())
+
+	// None would allow another domain
+	domainService.On("RegisterDomain", mock.Anything, "go.acme.com", "user123", int64(0)).
+		Return(nil, &internalDomain.ErrQuotaExceeded{Quota: internalDomain.QuotaCustomDomains, Plan: internalDomain.PlanBusiness, Limit: 50})
+	rec = serve(h.HandleRegisterDomain, http.MethodPost, "/private/domains", "/private/domains", `{"domain":"go.acme.com"}`, "user123")
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	// Verifying counts against the domain quota too
+	domainService.On("VerifyDomain", mock.Anything, int64(2), "user123").
+		Return(nil, &internalDomain.ErrQuotaExceeded{Quota: internalDomain.QuotaCustomDomains, Plan: internalDomain.PlanFree, Limit: 1})
+	rec = serve(h.HandleVerifyDomain, http.MethodPost, "/private/domains/{id}/verify", "/private/domains/2/verify", "", "user123")
+	assert.Equal(t, http.StatusPaymentRequired, rec.Code, rec.Body.String())
+}
+
+func TestMetricsRequireToken(t *testing.T) {
+	domainService := new(MockCustomDomainService)
+	domainService.On("ResolveHost", mock.Anything, mock.Anything).Return(nil, &internalDomain.ErrDomainNotFound{})
+	h := NewHandler(nil, nil, nil, domainService, nil, nil, nil, nil)
+	h.RegisterMetrics("ingest", func() any { return map[string]int{"dropped": 3} })
+	router := SetupRouter(h, nil, nil, nil, nil)
+
+	get := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without a token the endpoint is disabled
+	assert.Equal(t, http.StatusNotFound, get("Bearer ").Code)
+
+	h.ProtectMetrics("s3cret")
+	assert.Equal(t, http.StatusUnauthorized, get("").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("s3cret").Code)
+
+	rec := get("Bearer s3cret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"dropped":3`)
+
+	// The old public path is gone
+	req := httptest.NewRequest(http.MethodGet, "/public/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleVerifyDomainFailed(t *testing.T) {
+	domainService := new(MockCustomDomainService)
+	h := NewHandler(nil, nil, nil, domainService, nil, nil, nil, nil)
+
+	domainService.On("VerifyDomain", mock.Anything, int64(1), "user123").
+		Return(nil, &internalDomain.ErrDomainVerificationFailed{Domain: "go.acme.com", Reason: "no TXT record"})
+
+	rec := serve(h.HandleVerifyDomain, http.MethodPost, "/private/domains/{id}/verify", "/private/domains/1/verify", "", "user123")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no TXT record")
+}
+
+func TestCustomDomainRouting(t *testing.T) {
+	urlService := new(MockURLService)
+	domainService := new(MockCustomDomainService)
+	visits := &visitLog{}
+	challenges := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("key-authorization"))
+	})
+	router := SetupRouter(NewHandler(urlService, nil, nil, domainService, nil, nil, nil, visits), nil, nil, nil, challenges)
+
+	acme := &internalDomain.CustomDomain{ID: 7, Domain: "go.acme.com", Verified: true,
+		RootURL: "https://acme.com", NotFoundURL: "https://acme.com/missing"}
+	bare := &internalDomain.CustomDomain{ID: 8, Domain: "bare.example.com", Verified: true}
+	expired := &internalDomain.ErrURLExpired{ShortCode: "old"}
+
+	tests := []struct {
+		name         string
+		host         string
+		path         string
+		mockSetup    func()
+		wantStatus   int
+		wantLocation string
+		wantVisits   int
+	}{
+		{
+			name: "Short Code On Domain",
+			host: "go.acme.com:8080",
+			path: "/promo",
+			mockSetup: func() {
+				urlService.On("GetDomainURL", mock.Anything, int64(7), "promo").Return(&internalDomain.URL{ID: 1, OriginalURL: "https://example.com/promo"}, nil)
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/promo",
+			wantVisits:   1,
+		},
+		{
+			name:         "Domain Root",
+			host:         "go.acme.com",
+			path:         "/",
+			mockSetup:    func() {},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://acme.com",
+		},
+		{
+			name: "Unknown Short Code",
+			host: "go.acme.com",
+			path: "/nope",
+			mockSetup: func() {
+				urlService.On("GetDomainURL", mock.Anything, int64(7), "nope").Return(nil, &internalDomain.ErrURLNotFound{ShortCode: "nope"})
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://acme.com/missing",
+		},
+		{
+			name: "Expired Short Code",
+			host: "go.acme.com",
+			path: "/old",
+			mockSetup: func() {
+				urlService.On("GetDomainURL", mock.Anything, int64(7), "old").Return(nil, expired)
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://acme.com/missing",
+		},
+		{
+			name:       "ACME Challenge",
+			host:       "go.acme.com",
+			path:       "/.well-known/acme-challenge/token123",
+			mockSetup:  func() {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "Unknown Path",
+			host:         "go.acme.com",
+			path:         "/public/r/abc",
+			mockSetup:    func() {},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://acme.com/missing",
+		},
+		{
+			name:       "Domain Without Root URL",
+			host:       "bare.example.com",
+			path:       "/",
+			mockSetup:  func() {},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Domain Without Not Found URL",
+			host: "bare.example.com",
+			path: "/old",
+			mockSetup: func() {
+				urlService.On("GetDomainURL", mock.Anything, int64(8), "old").Return(nil, expired)
+			},
+			wantStatus: http.StatusGone,
+		},
+		{
+			name: "Lookup Error",
+			host: "bare.example.com",
+			path: "/abc",
+			mockSetup: func() {
+				urlService.On("GetDomainURL", mock.Anything, int64(8), "abc").Return(nil, assert.AnError)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "Default Host",
+			host: "snax.link",
+			path: "/public/r/abc",
+			mockSetup: func() {
+				urlService.On("GetURL", mock.Anything, "abc").Return(&internalDomain.URL{ID: 2, OriginalURL: "https://example.com"}, nil)
+			},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com",
+			wantVisits:   1,
+		},
+		{
+			name:       "Default Host Keeps Its Routes",
+			host:       "snax.link",
+			path:       "/health",
+			mockSetup:  func() {},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlService.ExpectedCalls = nil
+			domainService.ExpectedCalls = nil
+			visits.visits = nil
+			domainService.On("ResolveHost", mock.Anything, "go.acme.com").Return(acme, nil)
+			domainService.On("ResolveHost", mock.Anything, "bare.example.com").Return(bare, nil)
+			domainService.On("ResolveHost", mock.Anything, "snax.link").Return(nil, &internalDomain.ErrDomainNotFound{Domain: "snax.link"})
+			tt.mockSetup()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+			assert.Len(t, visits.visits, tt.wantVisits)
+		})
+	}
+}
+
+// fakeUnlockLimiter admits password attempts until blocked is set
+type fakeUnlockLimiter struct {
+	blocked  bool
+	err      error
+	attempts int
+}
+
+func (f *fakeUnlockLimiter) AllowUnlock(r *http.Request, urlID int64) (*ratelimit.Result, error) {
+	f.attempts++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ratelimit.Result{Allowed: !f.blocked, RetryAfter: 90 * time.Second}, nil
+}
+
+func TestPasswordProtectedRedirect(t *testing.T) {
+	urlService := new(MockURLService)
+	domainService := new(MockCustomDomainService)
+	visits := &visitLog{}
+	limiter := &fakeUnlockLimiter{}
+	h := NewHandler(urlService, nil, nil, domainService, nil, nil, nil, visits)
+	h.ProtectLinks(linkpass.NewCookies([]byte("secret"), time.Hour, false), limiter)
+	router := SetupRouter(h, nil, nil, nil, nil)
+
+	hash, err := linkpass.Hash("open-sesame")
+	assert.NoError(t, err)
+	urlService.On("GetURL", mock.Anything, "abc").Return(&internalDomain.URL{ID: 1, OriginalURL: "https://example.com", PasswordHash: hash, PasswordProtected: true}, nil)
+	domainService.On("ResolveHost", mock.Anything, mock.Anything).Return(nil, &internalDomain.ErrDomainNotFound{})
+
+	serve := func(method, password string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/public/r/abc", strings.NewReader("password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Visitors are asked for the password instead of redirected
+	rec := serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `name="password"`)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Empty(t, rec.Header().Get("Location"))
+
+	rec = serve(http.MethodPost, "wrong")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Incorrect password")
+	assert.Empty(t, rec.Result().Cookies())
+
+	// The right password redirects and remembers the visitor
+	rec = serve(http.MethodPost, "open-sesame")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com", rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, 2, limiter.attempts)
+
+	rec = serve(http.MethodGet, "", cookies...)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, 2, limiter.attempts)
+	assert.Len(t, visits.visits, 2)
+
+	// Blocked clients are turned away even with the right password
+	limiter.blocked = true
+	rec = serve(http.MethodPost, "open-sesame")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+	assert.Empty(t, rec.Result().Cookies())
+
+	limiter.err = &ratelimit.ErrUnavailable{RetryAfter: 5 * time.Second}
+	rec = serve(http.MethodPost, "open-sesame")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	assert.Len(t, visits.visits, 2)
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	analyticsService := new(MockAnalyticsService)
+	domainService := new(MockCustomDomainService)
+	apiKeyService := new(MockAPIKeyService)
+	authenticator, err := auth.NewStaticAuthenticator(map[string]string{"dev-token": "user123"})
+	assert.NoError(t, err)
+	authMiddleware := middleware.NewAuthMiddleware(authenticator, apiKeyService)
+	router := SetupRouter(NewHandler(nil, analyticsService, nil, domainService, apiKeyService, nil, nil, nil), authMiddleware, nil, nil, nil)
+
+	analyticsKey := &internalDomain.APIKey{ID: 3, UserID: "user123", Scopes: []string{internalDomain.ScopeAnalyticsRead}}
+	unscopedKey := &internalDomain.APIKey{ID: 4, UserID: "user123", Scopes: []string{}}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		mockSetup  func()
+		wantStatus int
+	}{
+		{
+			name:   "Scoped Key",
+			method: http.MethodGet,
+			path:   "/private/urls/1/analytics",
+			key:    "snx_analytics",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_analytics").Return(analyticsKey, nil)
+				analyticsService.On("GetURLAnalytics", mock.Anything, int64(1), "user123").Return([]internalDomain.Analytics{}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "Missing Scope",
+			method: http.MethodGet,
+			path:   "/private/domains",
+			key:    "snx_analytics",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_analytics").Return(analyticsKey, nil)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Unscoped Key",
+			method: http.MethodGet,
+			path:   "/private/domains",
+			key:    "snx_unscoped",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_unscoped").Return(unscopedKey, nil)
+				domainService.On("GetUserDomains", mock.Anything, "user123", int64(0)).Return([]internalDomain.CustomDomain{}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "Keys Cannot Manage Keys",
+			method: http.MethodGet,
+			path:   "/private/api-keys",
+			key:    "snx_unscoped",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_unscoped").Return(unscopedKey, nil)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Revoked Key",
+			method: http.MethodGet,
+			path:   "/private/urls/1/analytics",
+			key:    "snx_revoked",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_revoked").Return(nil, &internalDomain.ErrInvalidToken{Message: "API key revoked"})
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "Key Lookup Error",
+			method: http.MethodGet,
+			path:   "/private/urls/1/analytics",
+			key:    "snx_analytics",
+			mockSetup: func() {
+				apiKeyService.On("Authenticate", mock.Anything, "snx_analytics").Return(nil, assert.AnError)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyticsService.ExpectedCalls = nil
+			domainService.ExpectedCalls = nil
+			apiKeyService.ExpectedCalls = nil
+			domainService.On("ResolveHost", mock.Anything, mock.Anything).Return(nil, &internalDomain.ErrDomainNotFound{})
+			tt.mockSetup()
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -4,36 +4,27 @@ import (
 	"context"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/clerkinc/clerk-sdk-go/clerk"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
-// Custom context key for Clerk session
+// Custom context key for the authenticated user's claims
 type contextKey string
 
 const SessionContextKey contextKey = "clerk-session"
 
-// SessionClaims represents the claims from a verified token
-type SessionClaims struct {
-	Subject string
-	// Add other claims as needed
-}
-
 type AuthMiddleware struct {
-	client clerk.Client
+	authenticator domain.Authenticator
+	apiKeys       domain.APIKeyService
 }
 
-func NewAuthMiddleware(secretKey string) (*AuthMiddleware, error) {
-	client, err := clerk.NewClient(secretKey)
-	if err != nil {
-		return nil, err
-	}
-
+// NewAuthMiddleware accepts the session tokens of authenticator and, when
+// apiKeys is not nil, API keys
+func NewAuthMiddleware(authenticator domain.Authenticator, apiKeys domain.APIKeyService) *AuthMiddleware {
 	return &AuthMiddleware{
-		client: client,
-	}, nil
+		authenticator: authenticator,
+		apiKeys:       apiKeys,
+	}
 }
 
 func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
@@ -48,15 +39,18 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// Validate token
-		claims, err := am.ValidateToken(tokenString)
+		claims, err := am.validate(r.Context(), tokenString)
 		if err != nil {
+			if _, ok := err.(*domain.ErrInvalidToken); !ok {
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
 		// Add claims to context
 		ctx := context.WithValue(r.Context(), SessionContextKey, claims)
-		r.Header.Set("X-User-ID", claims.Subject)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -68,34 +62,73 @@ func (am *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader != "" {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims, err := am.client.VerifyToken(tokenString)
+			claims, err := am.validate(r.Context(), tokenString)
 			if err == nil {
-				sessionClaims := &SessionClaims{
-					Subject: claims.Subject,
-				}
-				ctx := context.WithValue(r.Context(), SessionContextKey, sessionClaims)
+				ctx := context.WithValue(r.Context(), SessionContextKey, claims)
 				r = r.WithContext(ctx)
-				r.Header.Set("X-User-ID", sessionClaims.Subject)
 			}
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (am *AuthMiddleware) ValidateToken(token string) (*domain.Claims, error) {
-	// Verify token using Clerk
-	clerkClaims, err := am.client.VerifyToken(token)
+// validate authenticates token as an API key or a session token
+func (am *AuthMiddleware) validate(ctx context.Context, token string) (*domain.Claims, error) {
+	if strings.HasPrefix(token, domain.APIKeyPrefix) && am.apiKeys != nil {
+		return am.ValidateAPIKey(ctx, token)
+	}
+	return am.ValidateToken(ctx, token)
+}
+
+// ValidateToken verifies a session token with the configured provider
+func (am *AuthMiddleware) ValidateToken(ctx context.Context, token string) (*domain.Claims, error) {
+	return am.authenticator.Authenticate(ctx, token)
+}
+
+// ValidateAPIKey authenticates an API key and returns claims for its owner
+func (am *AuthMiddleware) ValidateAPIKey(ctx context.Context, key string) (*domain.Claims, error) {
+	apiKey, err := am.apiKeys.Authenticate(ctx, key)
 	if err != nil {
-		return nil, &domain.ErrInvalidToken{Message: "Invalid token"}
+		return nil, err
 	}
 
-	// Convert Clerk claims to our domain claims
 	claims := &domain.Claims{
-		Subject:   clerkClaims.Subject,
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(), // Default to 24 hours
-		IssuedAt:  time.Now().Unix(),
-		TokenID:   clerkClaims.ID,
+		Subject:  apiKey.UserID,
+		IssuedAt: apiKey.CreatedAt.Unix(),
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = apiKey.ExpiresAt.Unix()
 	}
 
 	return claims, nil
 }
+
+// RequireScope rejects API keys that were not given scope. Sessions and
+// unscoped keys pass.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(SessionContextKey).(*domain.Claims)
+			if ok && !claims.HasScope(scope) {
+				http.Error(w, "API key lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests authenticated with an API key, so a key
+// cannot be used to mint or revoke keys
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(SessionContextKey).(*domain.Claims)
+		if ok && claims.APIKeyID != 0 {
+			http.Error(w, "API keys cannot be managed with an API key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,113 +3,155 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"net"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/riskibarqy/Snax-be/url-shortener/internal/config"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
 )
 
+// PlanFunc returns the plan of a user, picking the per-plan policies
+type PlanFunc func(ctx context.Context, userID string) string
+
 type RateLimiter struct {
-	// Requests per minute limits
-	AuthUserLimit   int
-	GuestUserLimit  int
-	ExpirationInSec int
+	limiter  ratelimit.Limiter
+	policies ratelimit.Policies
+	plans    PlanFunc
 }
 
-func NewRateLimiter() *RateLimiter {
+// NewRateLimiter limits route groups with policies, counted in limiter. A nil
+// plans puts every user on the default user policy.
+func NewRateLimiter(limiter ratelimit.Limiter, policies ratelimit.Policies, plans PlanFunc) *RateLimiter {
 	return &RateLimiter{
-		AuthUserLimit:   10, // 10 requests per minute for authenticated users
-		GuestUserLimit:  5,  // 5 requests per minute for guests
-		ExpirationInSec: 60, // Reset counter every minute (60 seconds)
+		limiter:  limiter,
+		policies: policies,
+		plans:    plans,
 	}
 }
 
-// getIP extracts the IP address from various headers and falls back to RemoteAddr
-func getIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		// Get the original client IP (first one)
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
+// clientAddr returns the client address as resolved through the trusted
+// proxies, bucketing IPv6 clients by /64
+func clientAddr(r *http.Request) string {
+	addr, ok := clientip.FromContext(r.Context())
+	if !ok {
+		addr, ok = clientip.Parse(r.RemoteAddr)
 	}
-
-	// Check X-Real-IP header next
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return xrip
-	}
-
-	// Fall back to RemoteAddr, but clean it
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		// If we can't split, just return RemoteAddr as is
+	if !ok {
 		return r.RemoteAddr
 	}
-	return ip
+	return clientip.Bucket(addr)
 }
 
-func (rl *RateLimiter) RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var clientID string
-
-		// Get client identifier (IP for guests, user ID for authenticated users)
-		if userID := r.Header.Get("X-User-ID"); userID != "" {
-			clientID = "user:" + userID // Use user ID for authenticated users
-		} else {
-			clientID = "ip:" + getIP(r) // Use IP address for guests
+// Limit applies the policies of group. Requests the group has no policy for,
+// and every request when rl is nil, pass.
+func (rl *RateLimiter) Limit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rl == nil {
+			return next
 		}
 
-		// Create Redis key with timestamp to ensure per-minute window
-		timestamp := time.Now().Unix() / 60 // Get current minute
-		key := fmt.Sprintf("ratelimit:%s:%d", clientID, timestamp)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Users are only known from verified claims, never from headers
+			userID := ""
+			if claims, ok := r.Context().Value(SessionContextKey).(*domain.Claims); ok {
+				userID = claims.Subject
+			}
+			// Plans are only looked up for groups that tell them apart
+			plan := ""
+			if userID != "" && rl.plans != nil && rl.policies.HasPlans(group) {
+				plan = rl.plans(r.Context(), userID)
+			}
+
+			policy := rl.policies.For(group, userID, plan)
+			if policy == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			clientID := "ip:" + clientAddr(r)
+			if policy.Scope == ratelimit.ScopeUser && userID != "" {
+				clientID = "user:" + userID
+			}
+
+			result, err := rl.limiter.Allow(r.Context(), group+":"+clientID, *policy)
+			if err != nil {
+				if unavailable, ok := err.(*ratelimit.ErrUnavailable); ok {
+					w.Header().Set("Retry-After", strconv.Itoa(seconds(unavailable.RetryAfter)))
+					http.Error(w, unavailable.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				http.Error(w, "Rate limiting error", http.StatusInternalServerError)
+				return
+			}
+
+			if !result.Skipped {
+				writeRateLimitHeaders(w, *policy, result)
+			}
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		// Determine rate limit based on authentication
-		limit := rl.GuestUserLimit
-		if r.Header.Get("X-User-ID") != "" {
-			limit = rl.AuthUserLimit
-		}
+// AllowUnlock counts an attempt to unlock the password protected link urlID
+// against the GroupUnlock policies: the guest policy per client address,
+// then the link policy. It reports the first policy that rejects the attempt;
+// attempts pass when rl is nil or the group has no policies.
+func (rl *RateLimiter) AllowUnlock(r *http.Request, urlID int64) (*ratelimit.Result, error) {
+	if rl == nil {
+		return &ratelimit.Result{Allowed: true, Skipped: true}, nil
+	}
 
-		// Use Redis MULTI to ensure atomicity
-		ctx := context.Background()
-		pipe := config.RedisClient.TxPipeline()
+	group := rl.policies[ratelimit.GroupUnlock]
+	checks := []struct {
+		policy *ratelimit.Policy
+		key    string
+	}{
+		{group.Guest, ratelimit.GroupUnlock + ":ip:" + clientAddr(r)},
+		{group.Link, ratelimit.GroupUnlock + ":link:" + strconv.FormatInt(urlID, 10)},
+	}
 
-		// Increment first (returns new value)
-		incr := pipe.Incr(ctx, key)
-		// Set expiration (only if key is new)
-		pipe.Expire(ctx, key, time.Duration(rl.ExpirationInSec)*time.Second)
+	result := &ratelimit.Result{Allowed: true, Skipped: true}
+	for _, check := range checks {
+		if check.policy == nil {
+			continue
+		}
 
-		// Execute transaction
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			http.Error(w, "Rate limiting error", http.StatusInternalServerError)
-			return
+		var err error
+		if result, err = rl.limiter.Allow(r.Context(), check.key, *check.policy); err != nil {
+			return nil, err
+		}
+		if !result.Allowed {
+			return result, nil
 		}
+	}
 
-		// Get the new count after increment
-		count := incr.Val()
+	return result, nil
+}
 
-		// Check if rate limit exceeded
-		if count > int64(limit) {
-			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
-			w.Header().Set("X-RateLimit-Remaining", "0")
-			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt((timestamp+1)*60, 10))
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
+// writeRateLimitHeaders describes the policy and what is left of it in the
+// RateLimit header fields of draft-ietf-httpapi-ratelimit-headers
+func writeRateLimitHeaders(w http.ResponseWriter, policy ratelimit.Policy, result *ratelimit.Result) {
+	description := fmt.Sprintf("%d;w=%d", policy.Limit, seconds(policy.Window))
+	if policy.Algorithm == ratelimit.TokenBucket {
+		description += fmt.Sprintf(";burst=%d", policy.Capacity())
+	}
 
-		// Set rate limit headers
-		remaining := limit - int(count)
-		if remaining < 0 {
-			remaining = 0
-		}
-		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
-		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
-		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt((timestamp+1)*60, 10))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	w.Header().Set("RateLimit-Policy", description)
+}
 
-		next.ServeHTTP(w, r)
-	})
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLimiter admits the first allow requests of each key
+type fakeLimiter struct {
+	allow    int
+	err      error
+	counts   map[string]int
+	policies []ratelimit.Policy
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, key string, policy ratelimit.Policy) (*ratelimit.Result, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.counts == nil {
+		f.counts = map[string]int{}
+	}
+	f.counts[key]++
+	f.policies = append(f.policies, policy)
+
+	used := min(f.counts[key], f.allow)
+	return &ratelimit.Result{
+		Allowed:    f.counts[key] <= f.allow,
+		Limit:      policy.Capacity(),
+		Remaining:  f.allow - used,
+		Reset:      1500 * time.Millisecond,
+		RetryAfter: 200 * time.Millisecond,
+	}, nil
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	guest := &ratelimit.Policy{Algorithm: ratelimit.SlidingWindow, Limit: 2, Window: time.Minute, Scope: ratelimit.ScopeIP}
+	user := &ratelimit.Policy{Algorithm: ratelimit.TokenBucket, Limit: 10, Window: time.Minute, Burst: 2, Scope: ratelimit.ScopeUser}
+	pro := &ratelimit.Policy{Algorithm: ratelimit.TokenBucket, Limit: 100, Window: time.Minute, Scope: ratelimit.ScopeUser}
+	policies := ratelimit.Policies{ratelimit.GroupShorten: {Guest: guest, User: user, Plans: map[string]*ratelimit.Policy{"pro": pro}}}
+	plans := func(ctx context.Context, userID string) string {
+		if userID == "pro-user" {
+			return "pro"
+		}
+		return "free"
+	}
+
+	limiter := &fakeLimiter{allow: 2}
+	handler := NewRateLimiter(limiter, policies, plans).Limit(ratelimit.GroupShorten)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	serve := func(remoteAddr, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/public/shorten", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), SessionContextKey, &domain.Claims{Subject: userID}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("203.0.113.7:1234", "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	serve("203.0.113.7:1234", "")
+	rec = serve("203.0.113.7:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Users are counted apart from their address, on their plan's policy
+	rec = serve("203.0.113.7:1234", "user123")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "10;w=60;burst=2", rec.Header().Get("RateLimit-Policy"))
+	rec = serve("203.0.113.7:1234", "pro-user")
+	assert.Equal(t, "100;w=60;burst=100", rec.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, map[string]int{"shorten:ip:203.0.113.7": 3, "shorten:user:user123": 1, "shorten:user:pro-user": 1}, limiter.counts)
+}
+
+func TestRateLimiterClientIdentity(t *testing.T) {
+	limiter := &fakeLimiter{allow: 100}
+	resolver := clientip.NewResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	handler := resolver.Middleware(NewRateLimiter(limiter, ratelimit.DefaultPolicies(), nil).Limit(ratelimit.GroupShorten)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantKey    string
+	}{
+		{
+			name:       "User Header Is Ignored",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-User-ID": "user123"},
+			wantKey:    "shorten:ip:203.0.113.7",
+		},
+		{
+			name:       "Forwarded By An Untrusted Peer",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			wantKey:    "shorten:ip:203.0.113.7",
+		},
+		{
+			name:       "Forwarded By A Trusted Proxy",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 198.51.100.2"},
+			wantKey:    "shorten:ip:198.51.100.2",
+		},
+		{
+			name:       "IPv6 By /64",
+			remoteAddr: "[2001:db8:1:2:aaaa::1]:1234",
+			wantKey:    "shorten:ip:2001:db8:1:2::/64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.counts = nil
+			req := httptest.NewRequest(http.MethodPost, "/public/shorten", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, map[string]int{tt.wantKey: 1}, limiter.counts)
+		})
+	}
+}
+
+func TestRateLimiterWithoutPolicy(t *testing.T) {
+	limiter := &fakeLimiter{allow: 0}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, handler := range []http.Handler{
+		NewRateLimiter(limiter, ratelimit.Policies{}, nil).Limit(ratelimit.GroupAPI)(next),
+		(*RateLimiter)(nil).Limit(ratelimit.GroupShorten)(next),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/private/urls", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+	}
+	assert.Empty(t, limiter.counts)
+}
+
+func TestRateLimiterError(t *testing.T) {
+	limiter := &fakeLimiter{err: errors.New("connection refused")}
+	handler := NewRateLimiter(limiter, ratelimit.DefaultPolicies(), nil).Limit(ratelimit.GroupShorten)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/public/shorten", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestRateLimiterWithoutRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	mr.SetError("ERR down")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/public/shorten", nil))
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		mode       ratelimit.FailureMode
+		wantCodes  []int
+		wantHeader string
+	}{
+		{
+			name:       "Local",
+			mode:       ratelimit.FailLocal,
+			wantCodes:  []int{http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests},
+			wantHeader: "RateLimit-Remaining",
+		},
+		{
+			name:      "Open",
+			mode:      ratelimit.FailOpen,
+			wantCodes: []int{http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated},
+		},
+		{
+			name:       "Closed",
+			mode:       ratelimit.FailClosed,
+			wantCodes:  []int{http.StatusServiceUnavailable},
+			wantHeader: "Retry-After",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimit.NewResilientLimiter(ratelimit.NewRedisLimiter(client), ratelimit.ResilientConfig{Mode: tt.mode})
+			handler := NewRateLimiter(limiter, ratelimit.DefaultPolicies(), nil).Limit(ratelimit.GroupShorten)(next)
+
+			var rec *httptest.ResponseRecorder
+			for _, want := range tt.wantCodes {
+				rec = serve(handler)
+				assert.Equal(t, want, rec.Code)
+			}
+			if tt.wantHeader != "" {
+				assert.NotEmpty(t, rec.Header().Get(tt.wantHeader))
+			} else {
+				assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowUnlock(t *testing.T) {
+	perIP := &ratelimit.Policy{Algorithm: ratelimit.SlidingWindow, Limit: 2, Window: time.Minute, Scope: ratelimit.ScopeIP}
+	perLink := &ratelimit.Policy{Algorithm: ratelimit.SlidingWindow, Limit: 2, Window: time.Minute, Scope: ratelimit.ScopeLink}
+	limiter := &fakeLimiter{allow: 2}
+	rl := NewRateLimiter(limiter, ratelimit.Policies{ratelimit.GroupUnlock: {Guest: perIP, Link: perLink}}, nil)
+
+	attempt := func(remoteAddr string, urlID int64) bool {
+		req := httptest.NewRequest(http.MethodPost, "/public/r/abc", nil)
+		req.RemoteAddr = remoteAddr
+		result, err := rl.AllowUnlock(req, urlID)
+		assert.NoError(t, err)
+		return result.Allowed
+	}
+
+	assert.True(t, attempt("203.0.113.7:1234", 1))
+	assert.True(t, attempt("203.0.113.7:1234", 1))
+	// The client is out of attempts; the link is not counted again
+	assert.False(t, attempt("203.0.113.7:1234", 1))
+	assert.Equal(t, 2, limiter.counts["unlock:link:1"])
+
+	// Another client is still held back by the link's limit
+	assert.False(t, attempt("198.51.100.20:1234", 1))
+	assert.True(t, attempt("198.51.100.21:1234", 2))
+
+	// Without policies, or without a limiter, attempts pass
+	result, err := NewRateLimiter(limiter, ratelimit.Policies{}, nil).AllowUnlock(httptest.NewRequest(http.MethodPost, "/", nil), 1)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	var disabled *RateLimiter
+	result, err = disabled.AllowUnlock(httptest.NewRequest(http.MethodPost, "/", nil), 1)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
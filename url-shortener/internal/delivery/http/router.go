@@ -6,18 +6,25 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
 	customMiddleware "github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
 )
 
-// SetupRouter configures and returns the router with all endpoints
-func SetupRouter(h *Handler, authMiddleware *customMiddleware.AuthMiddleware) *chi.Mux {
+// SetupRouter configures and returns the router with all endpoints.
+// clientIPs resolves client addresses; nil ignores forwarding headers. A nil
+// rateLimiter leaves requests unlimited. acmeChallenges answers HTTP-01
+// challenges on custom domains; nil when certificates are not issued.
+func SetupRouter(h *Handler, authMiddleware *customMiddleware.AuthMiddleware, clientIPs *clientip.Resolver, rateLimiter *customMiddleware.RateLimiter, acmeChallenges http.Handler) *chi.Mux {
 	r := chi.NewRouter()
 
 	// CORS middleware - configure it properly!
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", WorkspaceHeader},
+		ExposedHeaders:   []string{"ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300, // Cache preflight for 5 minutes
 	}))
@@ -26,10 +33,20 @@ func SetupRouter(h *Handler, authMiddleware *customMiddleware.AuthMiddleware) *c
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-
-	// Create rate limiter
-	rateLimiter := customMiddleware.NewRateLimiter()
+	// Forwarding headers are only followed through trusted proxies
+	r.Use(clientIPs.Middleware)
+
+	// Requests for verified custom domains only reach their links
+	domainRouter := chi.NewRouter()
+	domainRouter.Get("/", h.HandleDomainRoot)
+	domainRouter.Get("/{shortCode}", h.HandleDomainRedirect)
+	// Password protected links post their unlock form back to themselves
+	domainRouter.Post("/{shortCode}", h.HandleDomainRedirect)
+	domainRouter.NotFound(h.HandleDomainNotFound)
+	if acmeChallenges != nil {
+		domainRouter.Get("/.well-known/acme-challenge/{token}", acmeChallenges.ServeHTTP)
+	}
+	r.Use(h.CustomDomainRouting(domainRouter))
 
 	// Health check endpoint
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -37,50 +54,116 @@ func SetupRouter(h *Handler, authMiddleware *customMiddleware.AuthMiddleware) *c
 		w.Write([]byte("OK"))
 	})
 
+	// Runtime counters, for operators holding the metrics token
+	r.Get("/metrics", h.HandleMetrics)
+
 	// Public routes (/public/...)
 	r.Route("/public", func(r chi.Router) {
 		// Apply rate limiting to public shortening endpoint
-		r.With(rateLimiter.RateLimit).Post("/shorten", h.HandlePublicShorten)
+		r.With(rateLimiter.Limit(ratelimit.GroupShorten)).Post("/shorten", h.HandlePublicShorten)
 
-		// URL shortener redirect endpoint (no rate limit)
+		// URL shortener redirect endpoint (no rate limit; password
+		// attempts on protected links are limited by the handler)
 		r.Get("/r/{shortCode}", h.HandleRedirect)
-
-		// Public metrics endpoint (if needed)
-		r.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("Public Metrics"))
-		})
+		r.Post("/r/{shortCode}", h.HandleRedirect)
 	})
 
 	// Private routes (/private/...)
 	r.Route("/private", func(r chi.Router) {
 		// Apply authentication middleware to all private routes
 		r.Use(authMiddleware.Authenticate)
+		r.Use(rateLimiter.Limit(ratelimit.GroupAPI))
 
-		// Apply rate limiting to private URL creation
+		// API keys are limited to the scopes they were given
 		r.Route("/urls", func(r chi.Router) {
-			r.With(rateLimiter.RateLimit).Post("/", h.HandleShorten)
-			r.Get("/", h.HandleListURLs)
-			r.Delete("/{id}", h.HandleDeleteURL)
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeURLsRead))
+				r.Get("/", h.HandleListURLs)
+				r.Get("/{id}/history", h.HandleGetURLHistory)
+				r.Get("/{id}/tags", h.HandleGetURLTags)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeURLsWrite))
+				// Apply rate limiting to private URL creation
+				r.With(rateLimiter.Limit(ratelimit.GroupShorten)).Post("/", h.HandleShorten)
+				r.Post("/bulk", h.HandleBulkUpdateURLs)
+				r.Patch("/{id}", h.HandleUpdateURL)
+				r.Delete("/{id}", h.HandleDeleteURL)
+				r.Post("/{id}/history/{historyID}/rollback", h.HandleRollbackURL)
+			})
 
 			// URL Analytics
-			r.Get("/{id}/analytics", h.HandleGetURLAnalytics)
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeAnalyticsRead))
+				r.Get("/{id}/analytics", h.HandleGetURLAnalytics)
+				r.Get("/{id}/analytics/summary", h.HandleGetURLAnalyticsSummary)
+			})
 
 			// URL Tags
-			r.Route("/{id}/tags", func(r chi.Router) {
-				r.Get("/", h.HandleGetURLTags)
-				r.Post("/", h.HandleAddTag)
-				r.Delete("/{tag}", h.HandleRemoveTag)
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeTagsWrite))
+				r.Post("/{id}/tags", h.HandleAddTag)
+				r.Post("/bulk/tags", h.HandleBulkTagURLs)
+				r.Delete("/{id}/tags/{tag}", h.HandleRemoveTag)
+			})
+		})
+
+		// Tag Management
+		r.Route("/tags", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeURLsRead))
+				r.Get("/", h.HandleListTags)
+				r.Get("/{id}", h.HandleGetTag)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeTagsWrite))
+				r.Post("/", h.HandleCreateTag)
+				r.Patch("/{id}", h.HandleUpdateTag)
+				r.Post("/{id}/merge", h.HandleMergeTag)
+				r.Delete("/{id}", h.HandleDeleteTag)
 			})
 		})
 
 		// Domain Management
 		r.Route("/domains", func(r chi.Router) {
-			r.Get("/", h.HandleListUserDomains)
-			r.Post("/", h.HandleRegisterDomain)
-			r.Post("/{id}/verify", h.HandleVerifyDomain)
-			r.Delete("/{id}", h.HandleDeleteDomain)
+			r.With(customMiddleware.RequireScope(domain.ScopeDomainsRead)).Get("/", h.HandleListUserDomains)
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope(domain.ScopeDomainsWrite))
+				r.Post("/", h.HandleRegisterDomain)
+				r.Patch("/{id}", h.HandleUpdateDomain)
+				r.Post("/{id}/verify", h.HandleVerifyDomain)
+				r.Delete("/{id}", h.HandleDeleteDomain)
+			})
+		})
+
+		// Plan usage of a workspace
+		r.With(customMiddleware.RequireScope(domain.ScopeURLsRead)).Get("/usage", h.HandleGetUsage)
+
+		// API Key Management, only with a session
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(customMiddleware.RequireSession)
+			r.Get("/", h.HandleListAPIKeys)
+			r.Post("/", h.HandleCreateAPIKey)
+			r.Patch("/{id}", h.HandleUpdateAPIKey)
+			r.Delete("/{id}", h.HandleRevokeAPIKey)
+		})
+
+		// Workspace Management, only with a session
+		r.Route("/workspaces", func(r chi.Router) {
+			r.Use(customMiddleware.RequireSession)
+			r.Get("/", h.HandleListWorkspaces)
+			r.Post("/", h.HandleCreateWorkspace)
+			r.Get("/{id}/members", h.HandleListMembers)
+			r.Patch("/{id}/members/{userID}", h.HandleUpdateMember)
+			r.Delete("/{id}/members/{userID}", h.HandleRemoveMember)
+			r.Get("/{id}/invitations", h.HandleListInvitations)
+			r.Post("/{id}/invitations", h.HandleCreateInvitation)
+			r.Delete("/{id}/invitations/{invitationID}", h.HandleRevokeInvitation)
 		})
+		r.With(customMiddleware.RequireSession).Post("/invitations/{token}/accept", h.HandleAcceptInvitation)
 	})
 
 	return r
@@ -6,15 +6,39 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
 
+// writeTagError maps errors from tag operations to HTTP statuses
+func writeTagError(w http.ResponseWriter, err error, message string) {
+	if writeAccessError(w, err) {
+		return
+	}
+	switch err.(type) {
+	case *internalDomain.ErrInvalidTag:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case *internalDomain.ErrTagAlreadyExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
 // HandleAddTag handles adding a tag to a URL
 func (h *Handler) HandleAddTag(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleAddTag")
 	defer span.End()
 
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
@@ -30,14 +54,15 @@ func (h *Handler) HandleAddTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
 		attribute.Int64("url_id", urlID),
 		attribute.String("tag", req.Tag),
 	)
 
-	err = h.tagService.AddTagToURL(ctx, urlID, req.Tag)
+	err = h.tagService.AddTagToURL(ctx, urlID, claims.Subject, req.Tag)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to add tag", http.StatusInternalServerError)
+		writeTagError(w, err, "Failed to add tag")
 		return
 	}
 
@@ -49,6 +74,13 @@ func (h *Handler) HandleRemoveTag(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRemoveTag")
 	defer span.End()
 
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
@@ -58,14 +90,15 @@ func (h *Handler) HandleRemoveTag(w http.ResponseWriter, r *http.Request) {
 
 	tagName := chi.URLParam(r, "tag")
 	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
 		attribute.Int64("url_id", urlID),
 		attribute.String("tag", tagName),
 	)
 
-	err = h.tagService.RemoveTagFromURL(ctx, urlID, tagName)
+	err = h.tagService.RemoveTagFromURL(ctx, urlID, claims.Subject, tagName)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to remove tag", http.StatusInternalServerError)
+		writeTagError(w, err, "Failed to remove tag")
 		return
 	}
 
@@ -77,6 +110,13 @@ func (h *Handler) HandleGetURLTags(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetURLTags")
 	defer span.End()
 
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
@@ -84,12 +124,17 @@ func (h *Handler) HandleGetURLTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	span.SetAttributes(attribute.Int64("url_id", urlID))
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+	)
 
-	tags, err := h.tagService.GetURLTags(ctx, urlID)
+	tags, err := h.tagService.GetURLTags(ctx, urlID, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		if !writeAccessError(w, err) {
+			http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -98,3 +143,295 @@ func (h *Handler) HandleGetURLTags(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tags)
 }
+
+// HandleListTags handles listing the workspace's tags with their link counts
+func (h *Handler) HandleListTags(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleListTags")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+	)
+
+	tags, err := h.tagService.ListTags(ctx, claims.Subject, workspace)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to fetch tags")
+		return
+	}
+
+	span.SetAttributes(attribute.Int("tag_count", len(tags)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// HandleCreateTag handles creating a tag in the workspace
+func (h *Handler) HandleCreateTag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleCreateTag")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req CreateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+		attribute.String("tag", req.Name),
+	)
+
+	tag, err := h.tagService.CreateTag(ctx, internalDomain.Tag{
+		Name:        req.Name,
+		Color:       req.Color,
+		Description: req.Description,
+	}, claims.Subject, workspace)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to create tag")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// HandleGetTag handles retrieving a tag
+func (h *Handler) HandleGetTag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetTag")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("tag_id", tagID),
+	)
+
+	tag, err := h.tagService.GetTag(ctx, tagID, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to fetch tag")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// HandleUpdateTag handles renaming a tag or changing its color or description
+func (h *Handler) HandleUpdateTag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleUpdateTag")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("tag_id", tagID),
+	)
+
+	tag, err := h.tagService.UpdateTag(ctx, tagID, claims.Subject, internalDomain.TagUpdate{
+		Name:        req.Name,
+		Color:       req.Color,
+		Description: req.Description,
+	})
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to update tag")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// HandleMergeTag handles moving a tag's links onto another tag and deleting it
+func (h *Handler) HandleMergeTag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleMergeTag")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MergeTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Into < 1 {
+		msg := "Invalid request body"
+		if err == nil {
+			msg = "into is required"
+		}
+		span.SetAttributes(attribute.String("error", msg))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("tag_id", tagID),
+		attribute.Int64("target_tag_id", req.Into),
+	)
+
+	tag, err := h.tagService.MergeTags(ctx, tagID, req.Into, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to merge tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// HandleDeleteTag handles deleting a tag from every link
+func (h *Handler) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleDeleteTag")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("tag_id", tagID),
+	)
+
+	if err := h.tagService.DeleteTag(ctx, tagID, claims.Subject); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeTagError(w, err, "Failed to delete tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleBulkTagURLs handles adding and removing tags on many links at once
+func (h *Handler) HandleBulkTagURLs(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleBulkTagURLs")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+		attribute.Int("url_count", len(req.URLIDs)),
+	)
+
+	err = h.tagService.BulkTagURLs(ctx, req.URLIDs, claims.Subject, workspace, req.Add, req.Remove)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if _, ok := err.(*internalDomain.ErrInvalidBulkRequest); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeTagError(w, err, "Failed to update tags")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
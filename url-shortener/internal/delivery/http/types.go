@@ -1,11 +1,20 @@
 package http
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
 
 // URL-related types
 type ShortenRequest struct {
 	URL       string     `json:"url"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	// Domain is a verified custom domain to serve the link on
+	Domain string `json:"domain,omitempty"`
+	// Password must be entered before the link redirects
+	Password string `json:"password,omitempty"`
 }
 
 type ShortenResponse struct {
@@ -15,12 +24,104 @@ type ShortenResponse struct {
 	CreatedAt time.Time  `json:"created_at"`
 }
 
+// BulkUpdateURLsRequest applies Action to the links carrying Tag or matching
+// the tag expression Tags
+type BulkUpdateURLsRequest struct {
+	Action    string     `json:"action"`
+	Tag       string     `json:"tag,omitempty"`
+	Tags      string     `json:"tags,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type UpdateURLRequest struct {
+	URL       *string      `json:"url,omitempty"`
+	ExpiresAt NullableTime `json:"expires_at"`
+	IsActive  *bool        `json:"is_active,omitempty"`
+	Alias     *string      `json:"alias,omitempty"`
+	// Password protects the link; an empty string removes the protection
+	Password *string `json:"password,omitempty"`
+	// Version is an alternative to the If-Match header
+	Version int `json:"version,omitempty"`
+}
+
+// NullableTime tells an absent JSON field apart from an explicit null
+type NullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		t.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &t.Value)
+}
+
 // Tag-related types
 type AddTagRequest struct {
 	Tag string `json:"tag"`
 }
 
+// BulkTagRequest adds and removes tags on many links at once
+type BulkTagRequest struct {
+	URLIDs []int64  `json:"url_ids"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+type CreateTagRequest struct {
+	Name        string `json:"name"`
+	Color       string `json:"color,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// UpdateTagRequest renames a tag or changes its details; an empty color or
+// description clears it
+type UpdateTagRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Color       *string `json:"color,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// MergeTagRequest names the tag the links are moved to
+type MergeTagRequest struct {
+	Into int64 `json:"into"`
+}
+
 // Custom domain-related types
 type RegisterDomainRequest struct {
 	Domain string `json:"domain"`
 }
+
+// UpdateDomainRequest changes a domain's redirect targets; an empty string clears one
+type UpdateDomainRequest struct {
+	RootURL     *string `json:"root_url,omitempty"`
+	NotFoundURL *string `json:"not_found_url,omitempty"`
+}
+
+// API key-related types
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type UpdateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// Workspace-related types
+type CreateWorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
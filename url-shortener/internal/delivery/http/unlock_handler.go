@@ -0,0 +1,116 @@
+package http
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UnlockLimiter counts attempts to unlock a password protected link
+type UnlockLimiter interface {
+	AllowUnlock(r *http.Request, urlID int64) (*ratelimit.Result, error)
+}
+
+// ProtectLinks sets how visitors get through password protected links:
+// cookies remembers who entered the password and limiter counts their
+// attempts. A nil limiter leaves attempts unlimited.
+func (h *Handler) ProtectLinks(cookies *linkpass.Cookies, limiter UnlockLimiter) {
+	h.unlockCookies = cookies
+	h.unlockLimiter = limiter
+}
+
+// maxUnlockFormSize bounds the body of a password attempt
+const maxUnlockFormSize = 4096
+
+// unlockForm asks for the password of a protected link and posts it back to
+// the link itself
+var unlockForm = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post">
+<h1>This link is password protected</h1>
+{{if .}}<p role="alert">{{.}}</p>{{end}}
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// writeUnlockForm serves the password form with status and an optional message
+func writeUnlockForm(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	unlockForm.Execute(w, message)
+}
+
+// unlocked reports whether the visitor may follow url. Visitors without an
+// unlock cookie get the password form; those posting it get the cookie when
+// the password is right.
+func (h *Handler) unlocked(w http.ResponseWriter, r *http.Request, url *internalDomain.URL) bool {
+	if url.PasswordHash == "" || h.unlockCookies.Unlocked(r, url.ID, url.PasswordHash) {
+		return true
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Bool("password_protected", true))
+
+	if r.Method != http.MethodPost {
+		writeUnlockForm(w, http.StatusOK, "")
+		return false
+	}
+
+	// Every attempt is counted before the password is checked, so a blocked
+	// client cannot keep guessing and learn which guess was right
+	if h.unlockLimiter != nil {
+		result, err := h.unlockLimiter.AllowUnlock(r, url.ID)
+		if err != nil {
+			span.SetAttributes(attribute.String("error", err.Error()))
+			if unavailable, ok := err.(*ratelimit.ErrUnavailable); ok {
+				w.Header().Set("Retry-After", retryAfter(unavailable.RetryAfter))
+				writeUnlockForm(w, http.StatusServiceUnavailable, "Passwords cannot be checked right now, please try again shortly.")
+				return false
+			}
+			writeUnlockForm(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+			return false
+		}
+		if !result.Allowed {
+			span.SetAttributes(attribute.String("error", "too many attempts"))
+			w.Header().Set("Retry-After", retryAfter(result.RetryAfter))
+			writeUnlockForm(w, http.StatusTooManyRequests, "Too many attempts, please try again later.")
+			return false
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormSize)
+	if !linkpass.Check(url.PasswordHash, r.PostFormValue("password")) {
+		span.SetAttributes(attribute.String("error", "incorrect password"))
+		writeUnlockForm(w, http.StatusForbidden, "Incorrect password.")
+		return false
+	}
+
+	h.unlockCookies.Issue(w, r, url.ID, url.PasswordHash)
+	return true
+}
+
+// retryAfter formats d as a Retry-After value, rounded up to whole seconds
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -2,14 +2,20 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
 	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/tagexpr"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HandleShorten handles the creation of short URLs
@@ -31,15 +37,36 @@ func (h *Handler) HandleShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	span.SetAttributes(
 		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
 		attribute.String("original_url", req.URL),
+		attribute.String("alias", req.Alias),
+		attribute.String("domain", req.Domain),
 	)
 
-	url, err := h.urlService.CreateShortURL(ctx, req.URL, claims.Subject, req.ExpiresAt)
+	url, err := h.urlService.CreateShortURL(ctx, req.URL, claims.Subject, workspace, req.ExpiresAt, req.Alias, req.Domain, req.Password)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to create short URL", http.StatusInternalServerError)
+		switch err.(type) {
+		case *internalDomain.ErrInvalidAlias, *internalDomain.ErrInvalidPassword, *internalDomain.ErrDomainNotFound, *internalDomain.ErrDomainNotVerified:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case *internalDomain.ErrForbidden:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case *internalDomain.ErrQuotaExceeded:
+			writeQuotaError(w, err.(*internalDomain.ErrQuotaExceeded))
+		case *internalDomain.ErrShortCodeConflict:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to create short URL", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -56,7 +83,7 @@ func (h *Handler) HandleShorten(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// HandleRedirect handles URL redirection
+// HandleRedirect handles URL redirection on the default host
 func (h *Handler) HandleRedirect(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRedirect")
 	defer span.End()
@@ -67,26 +94,49 @@ func (h *Handler) HandleRedirect(w http.ResponseWriter, r *http.Request) {
 	url, err := h.urlService.GetURL(ctx, shortCode)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		switch err.(type) {
-		case *internalDomain.ErrURLNotFound:
-			http.Error(w, err.Error(), http.StatusNotFound)
-		case *internalDomain.ErrURLExpired:
-			http.Error(w, err.Error(), http.StatusGone)
-		default:
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		writeLookupError(w, err)
 		return
 	}
 
-	span.SetAttributes(
-		attribute.String("original_url", url.OriginalURL),
-		attribute.Int64("url_id", url.ID),
-	)
+	h.redirect(w, r.WithContext(ctx), url)
+}
 
-	// Record click asynchronously
-	go h.urlService.RecordClick(url.ID)
+// writeLookupError responds to a failed short code lookup
+func writeLookupError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *internalDomain.ErrURLNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case *internalDomain.ErrURLExpired:
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// redirect records a visit to url and sends the client on to its
+// destination. Password protected links first ask for their password.
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, url *internalDomain.URL) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Int64("url_id", url.ID))
+
+	if !h.unlocked(w, r, url) {
+		return
+	}
+	// The destination of a protected link is only traced once unlocked
+	span.SetAttributes(attribute.String("original_url", url.OriginalURL))
+
+	// Record the visit without holding up the redirect
+	h.visitRecorder.Record(internalDomain.Analytics{
+		URLID:     url.ID,
+		VisitorIP: visitorIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+		Timestamp: time.Now(),
+	})
 
-	http.Redirect(w, r, url.OriginalURL, http.StatusMovedPermanently)
+	// 302 rather than 301 so browsers don't cache the redirect: every visit
+	// reaches us and edits to the destination take effect immediately
+	http.Redirect(w, r, url.OriginalURL, http.StatusFound)
 }
 
 // HandleListURLs handles listing user's URLs
@@ -103,17 +153,93 @@ func (h *Handler) HandleListURLs(w http.ResponseWriter, r *http.Request) {
 
 	span.SetAttributes(attribute.String("user_id", claims.Subject))
 
-	urls, err := h.urlService.ListUserURLs(ctx, claims.Subject)
+	query, err := parseURLQuery(r, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		http.Error(w, "Failed to fetch URLs", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.urlService.ListUserURLs(ctx, query)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		switch err.(type) {
+		case *internalDomain.ErrInvalidQuery:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case *internalDomain.ErrForbidden:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to fetch URLs", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	span.SetAttributes(attribute.Int("url_count", len(urls)))
+	span.SetAttributes(attribute.Int("url_count", len(page.URLs)))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(urls)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseURLQuery reads the workspace from the WorkspaceHeader and listing
+// filters from the query string: tag, tags (a tag expression),
+// created_after, created_before (RFC 3339), state, domain, q, sort, order
+// (asc or desc), cursor and limit
+func parseURLQuery(r *http.Request, userID string) (internalDomain.URLQuery, error) {
+	params := r.URL.Query()
+	query := internalDomain.URLQuery{
+		UserID: userID,
+		Tag:    params.Get("tag"),
+		State:  params.Get("state"),
+		Domain: params.Get("domain"),
+		Search: params.Get("q"),
+		SortBy: params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		return query, err
+	}
+	query.WorkspaceID = workspace
+
+	if v := params.Get("tags"); v != "" {
+		expr, err := tagexpr.Parse(v)
+		if err != nil {
+			return query, err
+		}
+		query.TagExpr = expr
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, &internalDomain.ErrInvalidQuery{Reason: name + " must be an RFC 3339 timestamp"}
+			}
+			*dst = &t
+		}
+	}
+
+	switch params.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return query, &internalDomain.ErrInvalidQuery{Reason: `order must be "asc" or "desc"`}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return query, &internalDomain.ErrInvalidQuery{Reason: "limit must be an integer"}
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
 }
 
 // HandleDeleteURL handles URL deletion
@@ -143,10 +269,7 @@ func (h *Handler) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
 	err = h.urlService.DeleteURL(ctx, urlID, claims.Subject)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", err.Error()))
-		switch err.(type) {
-		case *internalDomain.ErrURLNotFound:
-			http.Error(w, err.Error(), http.StatusNotFound)
-		default:
+		if !writeAccessError(w, err) {
 			http.Error(w, "Failed to delete URL", http.StatusInternalServerError)
 		}
 		return
@@ -154,3 +277,272 @@ func (h *Handler) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// expectedVersion reads the version a client expects from If-Match, falling
+// back to the version in the request body. Zero means no precondition.
+func expectedVersion(r *http.Request, bodyVersion int) (int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return bodyVersion, nil
+	}
+
+	ifMatch = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	version, err := strconv.Atoi(ifMatch)
+	if err != nil {
+		return 0, fmt.Errorf("invalid If-Match header: %w", err)
+	}
+	return version, nil
+}
+
+// writeURL responds with url and its version as ETag
+func writeURL(w http.ResponseWriter, url *internalDomain.URL) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, url.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(url)
+}
+
+// writeURLUpdateError maps errors from editing a URL to HTTP statuses
+func writeURLUpdateError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *internalDomain.ErrURLNotFound, *internalDomain.ErrHistoryNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case *internalDomain.ErrForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case *internalDomain.ErrVersionMismatch:
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case *internalDomain.ErrInvalidAlias, *internalDomain.ErrInvalidPassword:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case *internalDomain.ErrShortCodeConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update URL", http.StatusInternalServerError)
+	}
+}
+
+// HandleUpdateURL handles editing an existing URL
+func (h *Handler) HandleUpdateURL(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleUpdateURL")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.URL != nil {
+		if _, err := neturl.ParseRequestURI(*req.URL); err != nil {
+			span.SetAttributes(attribute.String("error", err.Error()))
+			http.Error(w, "Invalid URL format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	version, err := expectedVersion(r, req.Version)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+		attribute.Int("expected_version", version),
+	)
+
+	update := internalDomain.URLUpdate{
+		OriginalURL:    req.URL,
+		IsActive:       req.IsActive,
+		Alias:          req.Alias,
+		Password:       req.Password,
+		ExpiresAt:      req.ExpiresAt.Value,
+		ClearExpiresAt: req.ExpiresAt.Set && req.ExpiresAt.Value == nil,
+	}
+
+	url, err := h.urlService.UpdateURL(ctx, urlID, claims.Subject, update, version)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeURLUpdateError(w, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Int("version", url.Version))
+
+	writeURL(w, url)
+}
+
+// HandleGetURLHistory handles listing previous versions of a URL
+func (h *Handler) HandleGetURLHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetURLHistory")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+	)
+
+	history, err := h.urlService.GetURLHistory(ctx, urlID, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if !writeAccessError(w, err) {
+			http.Error(w, "Failed to fetch URL history", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	span.SetAttributes(attribute.Int("history_count", len(history)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// HandleRollbackURL handles restoring the destination of a previous version
+func (h *Handler) HandleRollbackURL(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRollbackURL")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
+		return
+	}
+
+	historyID, err := strconv.ParseInt(chi.URLParam(r, "historyID"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid history ID", http.StatusBadRequest)
+		return
+	}
+
+	version, err := expectedVersion(r, 0)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("url_id", urlID),
+		attribute.Int64("history_id", historyID),
+	)
+
+	url, err := h.urlService.RollbackURL(ctx, urlID, claims.Subject, historyID, version)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeURLUpdateError(w, err)
+		return
+	}
+
+	writeURL(w, url)
+}
+
+// HandleBulkUpdateURLs handles deactivating, extending or deleting every link
+// under a tag or tag expression
+func (h *Handler) HandleBulkUpdateURLs(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleBulkUpdateURLs")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req BulkUpdateURLsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	query := internalDomain.URLQuery{
+		UserID:      claims.Subject,
+		WorkspaceID: workspace,
+		Tag:         req.Tag,
+	}
+	if req.Tags != "" {
+		expr, err := tagexpr.Parse(req.Tags)
+		if err != nil {
+			span.SetAttributes(attribute.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.TagExpr = expr
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+		attribute.String("action", req.Action),
+	)
+
+	result, err := h.urlService.BulkUpdateURLs(ctx, query, internalDomain.URLBulkAction{
+		Action:    req.Action,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		switch err.(type) {
+		case *internalDomain.ErrInvalidBulkRequest:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update URLs", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	span.SetAttributes(attribute.Int("url_count", result.Affected))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// HandleGetUsage handles reporting a workspace's plan and what it has used
+// of its quotas
+func (h *Handler) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleGetUsage")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspace, err := workspaceID(r)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspace),
+	)
+
+	usage, err := h.usageService.GetUsage(ctx, claims.Subject, workspace)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, "Failed to fetch usage", http.StatusInternalServerError)
+		return
+	}
+
+	span.SetAttributes(attribute.String("plan", usage.Plan))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
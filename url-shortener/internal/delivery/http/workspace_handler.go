@@ -0,0 +1,361 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/delivery/http/middleware"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// writeWorkspaceError maps errors from workspace operations to HTTP statuses
+func writeWorkspaceError(w http.ResponseWriter, err error, message string) {
+	if writeAccessError(w, err) {
+		return
+	}
+	switch err.(type) {
+	case *internalDomain.ErrInvalidWorkspaceRequest:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case *internalDomain.ErrLastOwner, *internalDomain.ErrAlreadyMember:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case *internalDomain.ErrQuotaExceeded:
+		writeQuotaError(w, err.(*internalDomain.ErrQuotaExceeded))
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateWorkspace handles creating a shared workspace
+func (h *Handler) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleCreateWorkspace")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(attribute.String("user_id", claims.Subject))
+
+	workspace, err := h.workspaceService.CreateWorkspace(ctx, claims.Subject, req.Name)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to create workspace")
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("workspace_id", workspace.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// HandleListWorkspaces handles listing the workspaces the user belongs to
+func (h *Handler) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleListWorkspaces")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	span.SetAttributes(attribute.String("user_id", claims.Subject))
+
+	workspaces, err := h.workspaceService.ListWorkspaces(ctx, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Failed to fetch workspaces", http.StatusInternalServerError)
+		return
+	}
+
+	span.SetAttributes(attribute.Int("workspace_count", len(workspaces)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// HandleListMembers handles listing a workspace's members
+func (h *Handler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleListMembers")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+	)
+
+	members, err := h.workspaceService.ListMembers(ctx, workspaceID, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to fetch members")
+		return
+	}
+
+	span.SetAttributes(attribute.Int("member_count", len(members)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// HandleUpdateMember handles changing a member's role
+func (h *Handler) HandleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleUpdateMember")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	memberID := chi.URLParam(r, "userID")
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+		attribute.String("member_id", memberID),
+		attribute.String("role", req.Role),
+	)
+
+	member, err := h.workspaceService.UpdateMemberRole(ctx, workspaceID, claims.Subject, memberID, req.Role)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to update member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// HandleRemoveMember handles removing a member, or leaving the workspace
+func (h *Handler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRemoveMember")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	memberID := chi.URLParam(r, "userID")
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+		attribute.String("member_id", memberID),
+	)
+
+	if err := h.workspaceService.RemoveMember(ctx, workspaceID, claims.Subject, memberID); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to remove member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreateInvitation handles inviting someone to a workspace. The
+// invitation token is only ever returned by this response.
+func (h *Handler) HandleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleCreateInvitation")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+		attribute.String("role", req.Role),
+	)
+
+	invitation, err := h.workspaceService.CreateInvitation(ctx, workspaceID, claims.Subject, req.Email, req.Role)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to create invitation")
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("invitation_id", invitation.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// HandleListInvitations handles listing a workspace's pending invitations
+func (h *Handler) HandleListInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleListInvitations")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+	)
+
+	invitations, err := h.workspaceService.ListInvitations(ctx, workspaceID, claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to fetch invitations")
+		return
+	}
+
+	span.SetAttributes(attribute.Int("invitation_count", len(invitations)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// HandleRevokeInvitation handles deleting a pending invitation
+func (h *Handler) HandleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleRevokeInvitation")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("user_id", claims.Subject),
+		attribute.Int64("workspace_id", workspaceID),
+		attribute.Int64("invitation_id", invitationID),
+	)
+
+	if err := h.workspaceService.RevokeInvitation(ctx, workspaceID, invitationID, claims.Subject); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to revoke invitation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAcceptInvitation handles joining a workspace with an invitation token
+func (h *Handler) HandleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("url-handler").Start(r.Context(), "HandleAcceptInvitation")
+	defer span.End()
+
+	claims, ok := ctx.Value(middleware.SessionContextKey).(*internalDomain.Claims)
+	if !ok {
+		span.SetAttributes(attribute.String("error", "unauthorized"))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	span.SetAttributes(attribute.String("user_id", claims.Subject))
+
+	workspace, err := h.workspaceService.AcceptInvitation(ctx, chi.URLParam(r, "token"), claims.Subject)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		writeWorkspaceError(w, err, "Failed to accept invitation")
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("workspace_id", workspace.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspace)
+}
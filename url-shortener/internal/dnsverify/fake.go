@@ -0,0 +1,82 @@
+package dnsverify
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// FakeResolver answers lookups from fixed records, for tests
+type FakeResolver struct {
+	mu    sync.Mutex
+	txt   map[string][]string
+	cname map[string]string
+	err   error
+}
+
+// NewFakeResolver returns a resolver without any records
+func NewFakeResolver() *FakeResolver {
+	return &FakeResolver{
+		txt:   make(map[string][]string),
+		cname: make(map[string]string),
+	}
+}
+
+// SetTXT publishes TXT records at name; no values removes them
+func (f *FakeResolver) SetTXT(name string, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(values) == 0 {
+		delete(f.txt, name)
+		return
+	}
+	f.txt[name] = values
+}
+
+// SetCNAME points host at target; an empty target removes the record
+func (f *FakeResolver) SetCNAME(host, target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if target == "" {
+		delete(f.cname, host)
+		return
+	}
+	f.cname[host] = target
+}
+
+// SetError makes every lookup fail with err until it is cleared with nil
+func (f *FakeResolver) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *FakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	values, ok := f.txt[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	return values, nil
+}
+
+func (f *FakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	target, ok := f.cname[host]
+	if !ok {
+		return "", notFound(host)
+	}
+	return target + ".", nil
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
@@ -0,0 +1,86 @@
+package dnsverify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// recheckBatchSize is the number of domains loaded per query
+const recheckBatchSize = 100
+
+// Rechecker periodically re-checks verified domains and un-verifies those
+// whose records have disappeared
+type Rechecker struct {
+	repo     domain.CustomDomainRepository
+	verifier *Verifier
+	interval time.Duration
+}
+
+// NewRechecker creates a rechecker that checks every verified domain about
+// once per interval
+func NewRechecker(repo domain.CustomDomainRepository, verifier *Verifier, interval time.Duration) *Rechecker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	return &Rechecker{
+		repo:     repo,
+		verifier: verifier,
+		interval: interval,
+	}
+}
+
+// Run re-checks domains until ctx is done
+func (r *Rechecker) Run(ctx context.Context) {
+	// Look for due domains more often than each is checked so the checks
+	// spread out over the interval
+	ticker := time.NewTicker(r.interval / 10)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RecheckDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[ERROR] domain re-check failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecheckDue re-checks the verified domains not checked within the interval
+// and returns how many it checked
+func (r *Rechecker) RecheckDue(ctx context.Context) (int, error) {
+	before := r.verifier.now().Add(-r.interval)
+	checked := 0
+
+	for {
+		domains, err := r.repo.ListVerifiedCheckedBefore(ctx, before, recheckBatchSize)
+		if err != nil {
+			return checked, err
+		}
+
+		for i := range domains {
+			d := &domains[i]
+			if err := r.verifier.Apply(ctx, d); err != nil && d.Verified {
+				log.Printf("[ERROR] re-checking domain %s: %v", d.Domain, err)
+			} else if !d.Verified {
+				log.Printf("[WARN] domain %s un-verified: %s", d.Domain, d.VerificationError)
+			}
+			// Re-checks never verify a domain anew, so the quota is not in play
+			if err := r.repo.UpdateVerification(ctx, d, domain.QuotaLimit{Limit: domain.Unlimited}); err != nil {
+				return checked, err
+			}
+			checked++
+		}
+
+		if len(domains) < recheckBatchSize {
+			return checked, nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package dnsverify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDomainRepo keeps domains in memory; the embedded interface panics if
+// the rechecker calls anything else
+type fakeDomainRepo struct {
+	domain.CustomDomainRepository
+	domains map[int64]domain.CustomDomain
+}
+
+func (r *fakeDomainRepo) ListVerifiedCheckedBefore(ctx context.Context, t time.Time, limit int) ([]domain.CustomDomain, error) {
+	var due []domain.CustomDomain
+	for _, d := range r.domains {
+		if d.Verified && (d.LastCheckedAt == nil || d.LastCheckedAt.Before(t)) && len(due) < limit {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeDomainRepo) UpdateVerification(ctx context.Context, d *domain.CustomDomain, quota domain.QuotaLimit) error {
+	r.domains[d.ID] = *d
+	return nil
+}
+
+func TestRecheckerUnverifiesRemovedRecords(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	stale := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+
+	repo := &fakeDomainRepo{domains: map[int64]domain.CustomDomain{
+		1: {ID: 1, Domain: "kept.com", VerificationToken: "t1", Verified: true, LastCheckedAt: &stale},
+		2: {ID: 2, Domain: "removed.com", VerificationToken: "t2", Verified: true, LastCheckedAt: &stale},
+		3: {ID: 3, Domain: "recent.com", VerificationToken: "t3", Verified: true, LastCheckedAt: &recent},
+		4: {ID: 4, Domain: "pending.com", VerificationToken: "t4"},
+	}}
+
+	resolver := NewFakeResolver()
+	resolver.SetTXT("_snax-verify.kept.com", "t1")
+	verifier := NewVerifier(resolver, "")
+	verifier.now = func() time.Time { return now }
+
+	checked, err := NewRechecker(repo, verifier, time.Hour).RecheckDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, checked)
+
+	assert.True(t, repo.domains[1].Verified)
+	assert.Equal(t, now, *repo.domains[1].LastCheckedAt)
+
+	assert.False(t, repo.domains[2].Verified)
+	assert.NotEmpty(t, repo.domains[2].VerificationError)
+
+	// Domains checked within the interval and unverified ones are left alone
+	assert.Equal(t, recent, *repo.domains[3].LastCheckedAt)
+	assert.Nil(t, repo.domains[4].LastCheckedAt)
+}
@@ -0,0 +1,106 @@
+// Package dnsverify proves ownership of custom domains through DNS and keeps
+// re-checking domains once they are verified.
+package dnsverify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Verifier checks that a domain publishes its verification token in a TXT
+// record or points at the edge host with a CNAME
+type Verifier struct {
+	resolver domain.DNSResolver
+	edgeHost string
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier. An empty edgeHost only accepts TXT records.
+func NewVerifier(resolver domain.DNSResolver, edgeHost string) *Verifier {
+	return &Verifier{
+		resolver: resolver,
+		edgeHost: normalizeHost(edgeHost),
+		now:      time.Now,
+	}
+}
+
+// NewToken generates a verification token for a newly registered domain
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Check looks up the records of d. It returns
+// *domain.ErrDomainVerificationFailed when they do not prove ownership and
+// other errors when DNS could not be queried.
+func (v *Verifier) Check(ctx context.Context, d *domain.CustomDomain) error {
+	txts, err := v.resolver.LookupTXT(ctx, d.VerificationRecord())
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	for _, txt := range txts {
+		if strings.TrimSpace(txt) == d.VerificationToken {
+			return nil
+		}
+	}
+
+	reason := fmt.Sprintf("no TXT record %s holding the verification token", d.VerificationRecord())
+	if v.edgeHost != "" {
+		cname, err := v.resolver.LookupCNAME(ctx, d.Domain)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if err == nil && normalizeHost(cname) == v.edgeHost {
+			return nil
+		}
+		reason += " and no CNAME to " + v.edgeHost
+	}
+
+	return &domain.ErrDomainVerificationFailed{Domain: d.Domain, Reason: reason}
+}
+
+// Apply runs Check and records the outcome on d. A failed DNS query leaves
+// the verified state alone, so a resolver outage never un-verifies domains.
+func (v *Verifier) Apply(ctx context.Context, d *domain.CustomDomain) error {
+	err := v.Check(ctx, d)
+	now := v.now()
+	d.LastCheckedAt = &now
+
+	var failed *domain.ErrDomainVerificationFailed
+	switch {
+	case err == nil:
+		if !d.Verified {
+			d.Verified = true
+			d.VerifiedAt = &now
+		}
+		d.VerificationError = ""
+	case errors.As(err, &failed):
+		d.Verified = false
+		d.VerifiedAt = nil
+		d.VerificationError = failed.Reason
+	default:
+		d.VerificationError = "DNS lookup failed: " + err.Error()
+	}
+
+	return err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,79 @@
+package dnsverify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifierApply(t *testing.T) {
+	ctx := context.Background()
+	resolver := NewFakeResolver()
+	v := NewVerifier(resolver, "edge.snax.link.")
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	d := &domain.CustomDomain{Domain: "go.acme.com", VerificationToken: "token123"}
+
+	// Nothing published yet
+	var failed *domain.ErrDomainVerificationFailed
+	require.ErrorAs(t, v.Apply(ctx, d), &failed)
+	assert.False(t, d.Verified)
+	assert.Equal(t, now, *d.LastCheckedAt)
+	assert.Contains(t, d.VerificationError, "_snax-verify.go.acme.com")
+	assert.Contains(t, d.VerificationError, "edge.snax.link")
+
+	resolver.SetTXT("_snax-verify.go.acme.com", " token123 ")
+	require.NoError(t, v.Apply(ctx, d))
+	assert.True(t, d.Verified)
+	assert.Equal(t, now, *d.VerifiedAt)
+	assert.Empty(t, d.VerificationError)
+
+	// A resolver outage does not un-verify the domain
+	resolver.SetError(&net.DNSError{Err: "i/o timeout", Name: "go.acme.com", IsTimeout: true})
+	err := v.Apply(ctx, d)
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &failed))
+	assert.True(t, d.Verified)
+	assert.Contains(t, d.VerificationError, "DNS lookup failed")
+
+	// Switching to a CNAME keeps it verified
+	resolver.SetError(nil)
+	resolver.SetTXT("_snax-verify.go.acme.com")
+	resolver.SetCNAME("go.acme.com", "edge.snax.link")
+	require.NoError(t, v.Apply(ctx, d))
+	assert.True(t, d.Verified)
+
+	// Removing every record un-verifies it
+	resolver.SetCNAME("go.acme.com", "")
+	require.ErrorAs(t, v.Apply(ctx, d), &failed)
+	assert.False(t, d.Verified)
+	assert.Nil(t, d.VerifiedAt)
+}
+
+func TestVerifierWithoutEdgeHost(t *testing.T) {
+	resolver := NewFakeResolver()
+	resolver.SetCNAME("go.acme.com", "edge.snax.link")
+	v := NewVerifier(resolver, "")
+
+	err := v.Check(context.Background(), &domain.CustomDomain{Domain: "go.acme.com", VerificationToken: "token123"})
+	var failed *domain.ErrDomainVerificationFailed
+	require.ErrorAs(t, err, &failed)
+	assert.NotContains(t, failed.Reason, "CNAME")
+}
+
+func TestNewToken(t *testing.T) {
+	a, err := NewToken()
+	require.NoError(t, err)
+	b, err := NewToken()
+	require.NoError(t, err)
+
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b)
+}
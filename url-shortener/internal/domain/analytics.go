@@ -7,24 +7,126 @@ import (
 
 // Analytics represents a visit to a shortened URL
 type Analytics struct {
-	ID          int64     `json:"id"`
-	URLID       int64     `json:"url_id"`
-	VisitorIP   string    `json:"visitor_ip"`
-	UserAgent   string    `json:"user_agent"`
-	Referer     string    `json:"referer"`
-	Timestamp   time.Time `json:"timestamp"`
-	CountryCode string    `json:"country_code"`
-	DeviceType  string    `json:"device_type"`
+	ID        int64     `json:"id"`
+	URLID     int64     `json:"url_id"`
+	VisitorIP string    `json:"visitor_ip"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	Timestamp time.Time `json:"timestamp"`
+	// CountryCode is the ISO 3166-1 alpha-2 code, empty when unknown
+	CountryCode string `json:"country_code"`
+	Region      string `json:"region"`
+	City        string `json:"city"`
+	// DeviceType is desktop, mobile, tablet or bot
+	DeviceType string `json:"device_type"`
+	Browser    string `json:"browser"`
+	OS         string `json:"os"`
+	// IsBot marks crawlers and link unfurlers; their visits do not count as clicks
+	IsBot bool `json:"is_bot"`
 }
 
 // AnalyticsService defines the interface for analytics operations
 type AnalyticsService interface {
-	RecordVisit(ctx context.Context, urlID int64, visitorIP, userAgent, referer string) error
-	GetURLAnalytics(ctx context.Context, urlID int64) ([]Analytics, error)
+	RecordVisit(ctx context.Context, urlID int64, visitorIP, userAgent, referer string, visitedAt time.Time) error
+	// GetURLAnalytics returns the raw visits of a URL owned by userID
+	GetURLAnalytics(ctx context.Context, urlID int64, userID string) ([]Analytics, error)
+	// GetURLSummary reports clicks and unique visitors from the hourly rollups
+	// of a URL owned by query.UserID
+	GetURLSummary(ctx context.Context, query SummaryQuery) (*AnalyticsSummary, error)
 }
 
 // AnalyticsRepository defines the interface for analytics storage operations
 type AnalyticsRepository interface {
 	Create(ctx context.Context, analytics *Analytics) error
+	// CreateBatch bulk inserts visits; IDs are not populated
+	CreateBatch(ctx context.Context, visits []Analytics) error
 	GetByURLID(ctx context.Context, urlID int64) ([]Analytics, error)
 }
+
+// AnalyticsRollupRepository stores the hourly rollups summaries are served from
+type AnalyticsRollupRepository interface {
+	// AggregateVisits folds up to limit visits that are not yet rolled up
+	// into the hourly rollups and returns how many it processed
+	AggregateVisits(ctx context.Context, limit int) (int, error)
+	// GetRollups returns rollups of urlID with from <= bucket < to for the
+	// given dimensions; DimensionTotal is always included
+	GetRollups(ctx context.Context, urlID int64, from, to time.Time, dimensions []string) ([]AnalyticsRollup, error)
+}
+
+// VisitRecorder accepts visits captured during a redirect and persists them
+// off the request path
+type VisitRecorder interface {
+	Record(visit Analytics)
+}
+
+// Bucket sizes of an analytics summary
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// Dimensions an analytics summary can be grouped by
+const (
+	// DimensionTotal holds the rollup over all visits
+	DimensionTotal   = ""
+	DimensionCountry = "country"
+	DimensionDevice  = "device_type"
+	DimensionReferer = "referer_host"
+	DimensionBrowser = "browser"
+)
+
+// AnalyticsRollup is the aggregate of one URL's human visits in one UTC hour,
+// overall or for one value of a dimension
+type AnalyticsRollup struct {
+	URLID     int64
+	Bucket    time.Time
+	Dimension string
+	Value     string
+	Clicks    int64
+	// Visitors is a marshalled HyperLogLog sketch of the distinct visitors
+	Visitors []byte
+}
+
+// SummaryQuery selects the range and grouping of an analytics summary
+type SummaryQuery struct {
+	URLID  int64
+	UserID string
+	// From and To bound the range as [From, To)
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Location *time.Location
+	// Dimensions to break clicks down by
+	Dimensions []string
+	// Limit is the number of values reported per dimension, busiest first
+	Limit int
+}
+
+// SummaryBucket is the activity within one time bucket
+type SummaryBucket struct {
+	Start          time.Time `json:"start"`
+	Clicks         int64     `json:"clicks"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+}
+
+// DimensionCount is the activity for one value of a dimension
+type DimensionCount struct {
+	Value          string `json:"value"`
+	Clicks         int64  `json:"clicks"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+// AnalyticsSummary is the bucketed activity of a URL over a range. Unique
+// visitor counts are estimates with an error of a few percent.
+type AnalyticsSummary struct {
+	URLID          int64                       `json:"url_id"`
+	From           time.Time                   `json:"from"`
+	To             time.Time                   `json:"to"`
+	Bucket         string                      `json:"bucket"`
+	Timezone       string                      `json:"timezone"`
+	Clicks         int64                       `json:"clicks"`
+	UniqueVisitors int64                       `json:"unique_visitors"`
+	Buckets        []SummaryBucket             `json:"buckets"`
+	Dimensions     map[string][]DimensionCount `json:"dimensions,omitempty"`
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, which is how the auth middleware tells
+// keys apart from session tokens
+const APIKeyPrefix = "snx_"
+
+// Scopes an API key can be limited to
+const (
+	ScopeURLsRead      = "urls:read"
+	ScopeURLsWrite     = "urls:write"
+	ScopeAnalyticsRead = "analytics:read"
+	ScopeTagsWrite     = "tags:write"
+	ScopeDomainsRead   = "domains:read"
+	ScopeDomainsWrite  = "domains:write"
+)
+
+// APIKeyScopes lists every scope an API key can be given
+var APIKeyScopes = []string{
+	ScopeURLsRead,
+	ScopeURLsWrite,
+	ScopeAnalyticsRead,
+	ScopeTagsWrite,
+	ScopeDomainsRead,
+	ScopeDomainsWrite,
+}
+
+// APIKey is a long-lived credential for programmatic access. Only a hash of
+// the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix is the start of the key, enough to recognise it in a list
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"-"`
+	// Scopes limits what the key can do; empty grants everything the
+	// user can do
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey is a freshly created key together with its secret
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyService defines the interface for API key operations
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, userID string, name string, scopes []string, expiresAt *time.Time) (*NewAPIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	RenameAPIKey(ctx context.Context, id int64, userID string, name string) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64, userID string) error
+	// Authenticate returns the live key matching key and records its use
+	Authenticate(ctx context.Context, key string) (*APIKey, error)
+}
+
+// APIKeyRepository defines the interface for API key storage operations
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByID(ctx context.Context, id int64) (*APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	GetByUserID(ctx context.Context, userID string) ([]APIKey, error)
+	UpdateName(ctx context.Context, id int64, name string) error
+	Revoke(ctx context.Context, id int64, t time.Time) error
+	// TouchLastUsed records that the key was used at t
+	TouchLastUsed(ctx context.Context, id int64, t time.Time) error
+}
+
+// ErrAPIKeyNotFound is returned when an API key is not found
+type ErrAPIKeyNotFound struct {
+	ID int64
+}
+
+func (e *ErrAPIKeyNotFound) Error() string {
+	return fmt.Sprintf("API key %d not found", e.ID)
+}
+
+// ErrInvalidAPIKeyRequest is returned when an API key cannot be created or
+// changed as requested
+type ErrInvalidAPIKeyRequest struct {
+	Reason string
+}
+
+func (e *ErrInvalidAPIKeyRequest) Error() string {
+	return fmt.Sprintf("Invalid API key request: %s", e.Reason)
+}
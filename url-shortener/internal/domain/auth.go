@@ -1,11 +1,40 @@
 package domain
 
+import (
+	"context"
+	"fmt"
+)
+
 // Claims represents the standard JWT claims
 type Claims struct {
 	Subject   string `json:"sub"`
 	ExpiresAt int64  `json:"exp"`
 	IssuedAt  int64  `json:"iat"`
 	TokenID   string `json:"jti"`
+	// APIKeyID is the key the request authenticated with, 0 for sessions
+	APIKeyID int64 `json:"api_key_id,omitempty"`
+	// Scopes limits an API key; sessions and unscoped keys may do anything
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// HasScope reports whether the claims allow acting within scope
+func (c *Claims) HasScope(scope string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies the bearer token of a signed-in user. Rejected
+// tokens yield ErrInvalidToken; other errors mean the token could not be
+// checked.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Claims, error)
 }
 
 // ErrInvalidToken is returned when a token is invalid
@@ -16,3 +45,28 @@ type ErrInvalidToken struct {
 func (e *ErrInvalidToken) Error() string {
 	return e.Message
 }
+
+// OwnershipChecker verifies that a user's role in the workspace owning the
+// resource a request acts on grants the permission it needs. A missing
+// resource yields its not-found error; non-members and members whose role
+// falls short get ErrForbidden.
+type OwnershipChecker interface {
+	CheckURL(ctx context.Context, urlID int64, userID string, perm Permission) error
+	CheckDomain(ctx context.Context, domainID int64, userID string, perm Permission) error
+	// CheckWorkspace returns the ID of the workspace checked; a zero
+	// workspaceID selects userID's personal workspace
+	CheckWorkspace(ctx context.Context, workspaceID int64, userID string, perm Permission) (int64, error)
+	// WorkspaceRole returns userID's role in the workspace, empty for non-members
+	WorkspaceRole(ctx context.Context, workspaceID int64, userID string) (string, error)
+}
+
+// ErrForbidden is returned when a user acts on a resource they have no
+// sufficient role for
+type ErrForbidden struct {
+	Resource string
+	ID       int64
+}
+
+func (e *ErrForbidden) Error() string {
+	return fmt.Sprintf("Access to %s %d is forbidden", e.Resource, e.ID)
+}
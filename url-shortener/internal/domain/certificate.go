@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Certificate is a TLS certificate obtained for a custom domain
+type Certificate struct {
+	Domain string
+	// CertPEM holds the leaf certificate followed by its chain
+	CertPEM   []byte
+	KeyPEM    []byte
+	NotAfter  time.Time
+	UpdatedAt time.Time
+}
+
+// CertificateRepository stores certificates and ACME state in one place so
+// every instance serves the same certificates and challenge responses
+type CertificateRepository interface {
+	GetCertificate(ctx context.Context, domain string) (*Certificate, error)
+	// SaveCertificate stores cert and releases the domain's claim
+	SaveCertificate(ctx context.Context, cert *Certificate) error
+	// ListDomainsNeedingCertificates returns up to limit verified domains
+	// without a certificate valid until t that nobody has claimed
+	ListDomainsNeedingCertificates(ctx context.Context, t time.Time, limit int) ([]string, error)
+	// ClaimCertificate reserves domain for issuance until the given time and
+	// reports whether the claim succeeded
+	ClaimCertificate(ctx context.Context, domain string, until time.Time) (bool, error)
+	// RecordCertificateError keeps domain claimed until retryAt after a
+	// failed issuance
+	RecordCertificateError(ctx context.Context, domain string, reason string, retryAt time.Time) error
+	// EnsureAccountKey stores keyPEM as the account key for directoryURL
+	// unless one exists, and returns the stored key
+	EnsureAccountKey(ctx context.Context, directoryURL string, keyPEM []byte) ([]byte, error)
+	PutChallenge(ctx context.Context, token string, keyAuthorization string) error
+	GetChallenge(ctx context.Context, token string) (string, error)
+	DeleteChallenge(ctx context.Context, token string) error
+}
+
+// ErrCertificateNotFound is returned when no certificate was issued for a domain yet
+type ErrCertificateNotFound struct {
+	Domain string
+}
+
+func (e *ErrCertificateNotFound) Error() string {
+	return fmt.Sprintf("No certificate for %s", e.Domain)
+}
+
+// ErrChallengeNotFound is returned when an ACME challenge token is unknown
+type ErrChallengeNotFound struct {
+	Token string
+}
+
+func (e *ErrChallengeNotFound) Error() string {
+	return fmt.Sprintf("ACME challenge %s not found", e.Token)
+}
@@ -6,31 +6,82 @@ import (
 	"time"
 )
 
+// DomainVerificationPrefix is the label under which a domain's verification
+// TXT record is published, e.g. _snax-verify.go.acme.com
+const DomainVerificationPrefix = "_snax-verify"
+
 // CustomDomain represents a custom domain for URL shortening
 type CustomDomain struct {
-	ID        int64     `json:"id"`
-	Domain    string    `json:"domain"`
-	UserID    string    `json:"user_id"`
-	Verified  bool      `json:"verified"`
-	CreatedAt time.Time `json:"created_at"`
+	ID     int64  `json:"id"`
+	Domain string `json:"domain"`
+	// UserID is the user who registered the domain
+	UserID      string `json:"user_id"`
+	WorkspaceID int64  `json:"workspace_id"`
+	Verified    bool   `json:"verified"`
+	// VerificationToken is the value the TXT record must hold
+	VerificationToken string     `json:"verification_token"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	LastCheckedAt     *time.Time `json:"last_checked_at,omitempty"`
+	// VerificationError explains why the last check failed
+	VerificationError string `json:"verification_error,omitempty"`
+	// RootURL is where requests for the bare domain are redirected
+	RootURL string `json:"root_url,omitempty"`
+	// NotFoundURL is where unknown or expired short codes are redirected
+	NotFoundURL string    `json:"not_found_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CustomDomainUpdate describes a partial edit of a domain's redirect
+// targets. Nil fields are left unchanged and empty strings clear them.
+type CustomDomainUpdate struct {
+	RootURL     *string
+	NotFoundURL *string
+}
+
+// VerificationRecord returns the name of the TXT record proving ownership of the domain
+func (d *CustomDomain) VerificationRecord() string {
+	return DomainVerificationPrefix + "." + d.Domain
 }
 
 // CustomDomainService defines the interface for custom domain operations
 type CustomDomainService interface {
-	RegisterDomain(ctx context.Context, domain string, userID string) (*CustomDomain, error)
-	GetUserDomains(ctx context.Context, userID string) ([]CustomDomain, error)
+	RegisterDomain(ctx context.Context, domain string, userID string, workspaceID int64) (*CustomDomain, error)
+	// GetUserDomains lists the domains of workspaceID, zero selecting
+	// userID's personal workspace
+	GetUserDomains(ctx context.Context, userID string, workspaceID int64) ([]CustomDomain, error)
 	DeleteDomain(ctx context.Context, id int64, userID string) error
-	VerifyDomain(ctx context.Context, id int64) error
+	// VerifyDomain checks the domain's DNS records now and returns the
+	// domain with the outcome recorded
+	VerifyDomain(ctx context.Context, id int64, userID string) (*CustomDomain, error)
+	UpdateDomain(ctx context.Context, id int64, userID string, update CustomDomainUpdate) (*CustomDomain, error)
+	// ResolveHost returns the verified custom domain serving host
+	ResolveHost(ctx context.Context, host string) (*CustomDomain, error)
 }
 
 // CustomDomainRepository defines the interface for custom domain storage operations
 type CustomDomainRepository interface {
-	Create(ctx context.Context, domain *CustomDomain) error
+	// Create stores domain unless its workspace holds quota verified domains
+	// already, leaving no room to verify it
+	Create(ctx context.Context, domain *CustomDomain, quota QuotaLimit) error
 	GetByID(ctx context.Context, id int64) (*CustomDomain, error)
 	GetByDomain(ctx context.Context, domain string) (*CustomDomain, error)
-	GetByUserID(ctx context.Context, userID string) ([]CustomDomain, error)
-	Delete(ctx context.Context, id int64, userID string) error
-	VerifyDomain(ctx context.Context, id int64) error
+	GetByWorkspaceID(ctx context.Context, workspaceID int64) ([]CustomDomain, error)
+	Delete(ctx context.Context, id int64) error
+	// UpdateVerification stores the verification state of domain, unless
+	// that verifies it while its workspace holds quota other verified domains
+	UpdateVerification(ctx context.Context, domain *CustomDomain, quota QuotaLimit) error
+	// UpdateSettings stores the redirect targets of domain
+	UpdateSettings(ctx context.Context, domain *CustomDomain) error
+	// ListVerifiedCheckedBefore returns up to limit verified domains last
+	// checked before t, least recently checked first
+	ListVerifiedCheckedBefore(ctx context.Context, t time.Time, limit int) ([]CustomDomain, error)
+}
+
+// DNSResolver looks up the records that prove ownership of a domain.
+// *net.Resolver implements it.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
 }
 
 // ErrDomainNotFound is returned when a custom domain is not found
@@ -50,3 +101,43 @@ type ErrDomainAlreadyExists struct {
 func (e *ErrDomainAlreadyExists) Error() string {
 	return fmt.Sprintf("Custom domain %s already exists", e.Domain)
 }
+
+// ErrDomainVerificationFailed is returned when a domain's DNS records do not
+// prove ownership
+type ErrDomainVerificationFailed struct {
+	Domain string
+	Reason string
+}
+
+func (e *ErrDomainVerificationFailed) Error() string {
+	return fmt.Sprintf("Custom domain %s could not be verified: %s", e.Domain, e.Reason)
+}
+
+// ErrDomainNotVerified is returned when a domain is used before its
+// ownership was verified
+type ErrDomainNotVerified struct {
+	Domain string
+}
+
+func (e *ErrDomainNotVerified) Error() string {
+	return fmt.Sprintf("Custom domain %s is not verified", e.Domain)
+}
+
+// ErrDomainInUse is returned when a domain cannot be deleted because links
+// are still served on it
+type ErrDomainInUse struct {
+	Domain string
+}
+
+func (e *ErrDomainInUse) Error() string {
+	return fmt.Sprintf("Custom domain %s still has links", e.Domain)
+}
+
+// ErrInvalidDomainSettings is returned when a domain's redirect targets are not acceptable
+type ErrInvalidDomainSettings struct {
+	Reason string
+}
+
+func (e *ErrInvalidDomainSettings) Error() string {
+	return fmt.Sprintf("Invalid domain settings: %s", e.Reason)
+}
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Plans a workspace can be on, from least to most generous
+const (
+	PlanFree     = "free"
+	PlanPro      = "pro"
+	PlanBusiness = "business"
+)
+
+// Plans lists every plan in ascending order
+var Plans = []string{PlanFree, PlanPro, PlanBusiness}
+
+// Unlimited lifts a quota
+const Unlimited = -1
+
+// Quotas reported in ErrQuotaExceeded
+const (
+	QuotaLinks         = "links_per_month"
+	QuotaCustomDomains = "custom_domains"
+	QuotaTags          = "tags"
+	QuotaWorkspaces    = "workspaces"
+)
+
+// Quotas bound what a workspace may create and keep
+type Quotas struct {
+	// LinksPerMonth counts links created in a calendar month (UTC), so
+	// deleting links does not give any back
+	LinksPerMonth int
+	CustomDomains int
+	Tags          int
+	// AnalyticsRetentionDays is how far back analytics are reported
+	AnalyticsRetentionDays int
+	// Workspaces counts the shared workspaces a user created. New
+	// workspaces start on the free plan, so the limit comes from the best
+	// plan among the creator's workspaces.
+	Workspaces int
+}
+
+// planQuotas are the quotas of each plan
+var planQuotas = map[string]Quotas{
+	PlanFree:     {LinksPerMonth: 100, CustomDomains: 1, Tags: 20, AnalyticsRetentionDays: 30, Workspaces: 2},
+	PlanPro:      {LinksPerMonth: 5000, CustomDomains: 5, Tags: 500, AnalyticsRetentionDays: 365, Workspaces: 10},
+	PlanBusiness: {LinksPerMonth: 100000, CustomDomains: 50, Tags: Unlimited, AnalyticsRetentionDays: 730, Workspaces: 50},
+}
+
+// PlanQuotas returns the quotas of plan; unknown plans get the free ones
+func PlanQuotas(plan string) Quotas {
+	if quotas, ok := planQuotas[plan]; ok {
+		return quotas
+	}
+	return planQuotas[PlanFree]
+}
+
+// Limit returns the quota named quota
+func (q Quotas) Limit(quota string) int {
+	switch quota {
+	case QuotaLinks:
+		return q.LinksPerMonth
+	case QuotaCustomDomains:
+		return q.CustomDomains
+	case QuotaTags:
+		return q.Tags
+	case QuotaWorkspaces:
+		return q.Workspaces
+	default:
+		return 0
+	}
+}
+
+// QuotaLimit is one quota of a workspace's plan. The repositories creating
+// what a quota counts take it and check it in the inserting transaction, so
+// concurrent creations cannot both take the last one.
+type QuotaLimit struct {
+	Quota string
+	Plan  string
+	Limit int
+}
+
+// Exceeded returns the error reporting that l is used up
+func (l QuotaLimit) Exceeded() error {
+	return &ErrQuotaExceeded{Quota: l.Quota, Plan: l.Plan, Limit: l.Limit}
+}
+
+// PlanRank orders the plans; unknown plans rank lowest
+func PlanRank(plan string) int {
+	for i, p := range Plans {
+		if p == plan {
+			return i
+		}
+	}
+	return -1
+}
+
+// UsagePeriod returns the calendar month (UTC) t falls in, the period links
+// per month are counted over
+func UsagePeriod(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// QuotaUsage is the consumption of one quota
+type QuotaUsage struct {
+	Used int64 `json:"used"`
+	// Limit is null for unlimited quotas
+	Limit *int `json:"limit"`
+}
+
+// NewQuotaUsage reports used against limit, which may be Unlimited
+func NewQuotaUsage(used int64, limit int) QuotaUsage {
+	if limit == Unlimited {
+		return QuotaUsage{Used: used}
+	}
+	return QuotaUsage{Used: used, Limit: &limit}
+}
+
+// Usage is what a workspace has consumed of its plan
+type Usage struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	Plan        string    `json:"plan"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// Links counts links created during the period
+	Links         QuotaUsage `json:"links"`
+	CustomDomains QuotaUsage `json:"custom_domains"`
+	Tags          QuotaUsage `json:"tags"`
+	// AnalyticsRetentionDays is null when analytics are kept forever
+	AnalyticsRetentionDays *int `json:"analytics_retention_days"`
+}
+
+// WorkspaceUsage holds the usage counters of a workspace
+type WorkspaceUsage struct {
+	LinksCreated  int64
+	CustomDomains int64
+	Tags          int64
+}
+
+// UsageService reports plans and usage
+type UsageService interface {
+	// GetUsage reports the usage of workspaceID, zero selecting userID's
+	// personal workspace
+	GetUsage(ctx context.Context, userID string, workspaceID int64) (*Usage, error)
+	// UserPlan returns the best plan among the workspaces of userID
+	UserPlan(ctx context.Context, userID string) (string, error)
+}
+
+// QuotaChecker enforces the quotas of a workspace's plan. Checks return
+// *ErrQuotaExceeded when the quota is used up.
+type QuotaChecker interface {
+	// ReserveLink counts a link about to be created in the workspace and
+	// returns the start of the usage period it was counted in
+	ReserveLink(ctx context.Context, workspaceID int64) (time.Time, error)
+	// ReleaseLink gives back a link reserved in period for a creation that
+	// failed
+	ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error
+	// DomainQuota returns the custom domain quota of the workspace
+	DomainQuota(ctx context.Context, workspaceID int64) (QuotaLimit, error)
+	// TagQuota returns the tag quota of the workspace
+	TagQuota(ctx context.Context, workspaceID int64) (QuotaLimit, error)
+	// URLTagQuota is TagQuota for the workspace of a URL
+	URLTagQuota(ctx context.Context, urlID int64) (QuotaLimit, error)
+	// RetentionStart returns the oldest time a URL's analytics are
+	// reported from, zero when they are all kept
+	RetentionStart(ctx context.Context, urlID int64) (time.Time, error)
+	// WorkspaceQuota returns how many shared workspaces userID may create
+	WorkspaceQuota(ctx context.Context, userID string) (QuotaLimit, error)
+}
+
+// UsageRepository defines the interface for usage counter storage operations
+type UsageRepository interface {
+	// ReserveLink counts a link in the workspace for the period starting at
+	// period unless limit links were counted already; it reports whether it
+	// did. An Unlimited limit never refuses.
+	ReserveLink(ctx context.Context, workspaceID int64, period time.Time, limit int) (bool, error)
+	ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error
+	// GetUsage returns the links counted for the period starting at period
+	// and the domains and tags the workspace holds
+	GetUsage(ctx context.Context, workspaceID int64, period time.Time) (*WorkspaceUsage, error)
+}
+
+// ErrQuotaExceeded is returned when a workspace's plan does not allow more
+type ErrQuotaExceeded struct {
+	Quota string
+	Plan  string
+	Limit int
+}
+
+func (e *ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("Quota exceeded: the %s plan allows %d %s", e.Plan, e.Limit, strings.ReplaceAll(e.Quota, "_", " "))
+}
+
+// Upgradable reports whether a higher plan raises the quota
+func (e *ErrQuotaExceeded) Upgradable() bool {
+	for _, plan := range Plans[PlanRank(e.Plan)+1:] {
+		limit := PlanQuotas(plan).Limit(e.Quota)
+		if limit == Unlimited || limit > e.Limit {
+			return true
+		}
+	}
+	return false
+}
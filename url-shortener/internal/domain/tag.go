@@ -1,32 +1,123 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
-// Tag represents a URL tag
+// Tag represents a URL tag. Tags belong to a workspace and their names are
+// unique within it.
 type Tag struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID          int64  `json:"id"`
+	WorkspaceID int64  `json:"workspace_id"`
+	Name        string `json:"name"`
+	// Color is a hex color such as #1e90ff
+	Color       string    `json:"color,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TagUsage is a tag with the number of active links carrying it
+type TagUsage struct {
+	Tag
+	URLCount int64 `json:"url_count"`
+}
+
+// TagExpr is a boolean expression over tag names, such as
+// promo AND (summer OR winter) AND NOT archived. Exactly one of Tag, And, Or
+// and Not is set.
+type TagExpr struct {
+	// Tag matches links carrying the tag with this name
+	Tag string
+	And []*TagExpr
+	Or  []*TagExpr
+	Not *TagExpr
+}
+
+// TagUpdate describes a partial edit of a tag. Nil fields are left unchanged
+// and empty strings clear the color and description.
+type TagUpdate struct {
+	Name        *string
+	Color       *string
+	Description *string
 }
 
 // TagService defines the interface for tag operations
 type TagService interface {
-	CreateTag(name string) (*Tag, error)
-	GetTag(id int64) (*Tag, error)
-	GetTagByName(name string) (*Tag, error)
-	GetURLTags(ctx context.Context, urlID int64) ([]Tag, error)
-	AddTagToURL(ctx context.Context, urlID int64, tag string) error
-	RemoveTagFromURL(ctx context.Context, urlID int64, tag string) error
+	// CreateTag creates a tag from the name, color and description of tag
+	CreateTag(ctx context.Context, tag Tag, userID string, workspaceID int64) (*Tag, error)
+	GetTag(ctx context.Context, id int64, userID string) (*Tag, error)
+	GetTagByName(ctx context.Context, name string, userID string, workspaceID int64) (*Tag, error)
+	// ListTags returns the workspace's tags with their link counts
+	ListTags(ctx context.Context, userID string, workspaceID int64) ([]TagUsage, error)
+	UpdateTag(ctx context.Context, id int64, userID string, update TagUpdate) (*Tag, error)
+	// MergeTags moves the links of sourceID onto targetID, deletes sourceID
+	// and returns the target
+	MergeTags(ctx context.Context, sourceID int64, targetID int64, userID string) (*Tag, error)
+	// DeleteTag deletes a tag and removes it from every link
+	DeleteTag(ctx context.Context, id int64, userID string) error
+	// GetURLTags, AddTagToURL and RemoveTagFromURL act on a URL owned by userID
+	GetURLTags(ctx context.Context, urlID int64, userID string) ([]Tag, error)
+	AddTagToURL(ctx context.Context, urlID int64, userID string, tag string) error
+	RemoveTagFromURL(ctx context.Context, urlID int64, userID string, tag string) error
+	// BulkTagURLs adds the add tags to and removes the remove tags from
+	// every URL in urlIDs, all of which must be active links of the workspace
+	BulkTagURLs(ctx context.Context, urlIDs []int64, userID string, workspaceID int64, add []string, remove []string) error
 }
 
 // TagRepository defines the interface for tag storage operations
 type TagRepository interface {
-	Create(tag *Tag) error
-	GetByID(id int64) (*Tag, error)
-	GetByName(name string) (*Tag, error)
-	GetByURLID(urlID int64) ([]Tag, error)
-	AddURLTag(urlID, tagID int64) error
-	RemoveURLTag(urlID, tagID int64) error
-	AddTagToURL(ctx context.Context, urlID int64, tag string) error
+	// Create stores tag unless its workspace holds quota tags already
+	Create(ctx context.Context, tag *Tag, quota QuotaLimit) error
+	GetByID(ctx context.Context, id int64) (*Tag, error)
+	GetByName(ctx context.Context, workspaceID int64, name string) (*Tag, error)
+	ListByWorkspace(ctx context.Context, workspaceID int64) ([]TagUsage, error)
+	Update(ctx context.Context, tag *Tag) error
+	// Merge moves the links of sourceID onto targetID and deletes sourceID
+	Merge(ctx context.Context, sourceID, targetID int64) error
+	Delete(ctx context.Context, id int64) error
+	GetByURLID(ctx context.Context, urlID int64) ([]Tag, error)
+	AddURLTag(ctx context.Context, urlID, tagID int64) error
+	RemoveURLTag(ctx context.Context, urlID, tagID int64) error
+	// AddTagToURL tags a URL, creating the tag in the URL's workspace if
+	// needed and quota allows
+	AddTagToURL(ctx context.Context, urlID int64, tag string, quota QuotaLimit) error
 	RemoveTagFromURL(ctx context.Context, urlID int64, tag string) error
 	GetURLTags(ctx context.Context, urlID int64) ([]Tag, error)
+	// BulkTagURLs tags and untags the workspace's URLs in one transaction,
+	// creating missing tags as far as quota allows. It fails with
+	// ErrURLNotFound and changes nothing unless every URL is an active link
+	// of the workspace.
+	BulkTagURLs(ctx context.Context, workspaceID int64, urlIDs []int64, add []string, remove []string, quota QuotaLimit) error
+}
+
+// ErrTagNotFound is returned when a tag is not found
+type ErrTagNotFound struct {
+	Name string
+}
+
+func (e *ErrTagNotFound) Error() string {
+	if e.Name == "" {
+		return "Tag not found"
+	}
+	return fmt.Sprintf("Tag %s not found", e.Name)
+}
+
+// ErrTagAlreadyExists is returned when a workspace already has a tag with the name
+type ErrTagAlreadyExists struct {
+	Name string
+}
+
+func (e *ErrTagAlreadyExists) Error() string {
+	return fmt.Sprintf("Tag %s already exists", e.Name)
+}
+
+// ErrInvalidTag is returned when a tag's fields are not acceptable
+type ErrInvalidTag struct {
+	Reason string
+}
+
+func (e *ErrInvalidTag) Error() string {
+	return fmt.Sprintf("Invalid tag: %s", e.Reason)
 }
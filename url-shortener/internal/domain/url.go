@@ -16,33 +16,183 @@ type URL struct {
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 	IsActive    bool       `json:"is_active"`
 	ClickCount  int64      `json:"click_count"`
+	// IsCustomAlias is set when the short code was picked by the user
+	IsCustomAlias bool      `json:"is_custom_alias"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int       `json:"version"`
+	// DomainID is the custom domain the link is served on, if any
+	DomainID *int64 `json:"domain_id,omitempty"`
+	// WorkspaceID is the workspace owning the link; nil for anonymous links
+	WorkspaceID *int64 `json:"workspace_id,omitempty"`
+	// PasswordHash is the bcrypt hash of the link's password; empty for
+	// links anyone can follow
+	PasswordHash      string `json:"-"`
+	PasswordProtected bool   `json:"password_protected"`
+}
+
+// Sort orders for URL listings. Click counts keep moving while a listing is
+// paged, so a link whose count changes between pages can be skipped or
+// repeated under URLSortClickCount; its pages are best-effort.
+const (
+	URLSortCreatedAt  = "created_at"
+	URLSortClickCount = "click_count"
+)
+
+// States URL listings can be filtered by
+const (
+	URLStateActive  = "active"
+	URLStateExpired = "expired"
+)
+
+// URLQuery selects one page of a workspace's URLs. Zero-valued filters match everything.
+type URLQuery struct {
+	// UserID is the user listing; WorkspaceID zero selects their personal workspace
+	UserID      string
+	WorkspaceID int64
+	// Tag only matches URLs carrying the tag with this name
+	Tag string
+	// TagExpr only matches URLs whose tags satisfy the expression
+	TagExpr       *TagExpr
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// State is URLStateActive, URLStateExpired or empty for both
+	State string
+	// Domain only matches URLs served on this custom domain
+	Domain string
+	// Search is a case-insensitive substring of the original URL or short code
+	Search    string
+	SortBy    string
+	Ascending bool
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	Limit  int
+}
+
+// URLPage is one page of a URL listing
+type URLPage struct {
+	URLs []URL `json:"urls"`
+	// NextCursor fetches the following page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Bulk actions on the links selected by a URLQuery
+const (
+	// URLBulkDeactivate deactivates links, recording history so each can be rolled back
+	URLBulkDeactivate = "deactivate"
+	// URLBulkExtend moves the expiry of links expiring earlier out to ExpiresAt
+	URLBulkExtend = "extend"
+	// URLBulkDelete deletes links like DeleteURL
+	URLBulkDelete = "delete"
+)
+
+// URLBulkAction is applied to every link a bulk operation selects
+type URLBulkAction struct {
+	Action string
+	// ExpiresAt is the new expiry for URLBulkExtend. Links that expire later
+	// or never are left alone.
+	ExpiresAt *time.Time
+}
+
+// URLBulkResult reports the links a bulk operation changed
+type URLBulkResult struct {
+	Affected int     `json:"affected"`
+	IDs      []int64 `json:"ids"`
+}
+
+// URLUpdate describes a partial edit of a URL. Nil fields are left unchanged.
+type URLUpdate struct {
+	OriginalURL    *string
+	ExpiresAt      *time.Time
+	ClearExpiresAt bool
+	IsActive       *bool
+	Alias          *string
+	// Password protects the link; an empty string removes the protection
+	Password *string
+}
+
+// URLHistory is a snapshot of a URL taken right before it was edited
+type URLHistory struct {
+	ID          int64      `json:"id"`
+	URLID       int64      `json:"url_id"`
+	Version     int        `json:"version"`
+	ShortCode   string     `json:"short_code"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	IsActive    bool       `json:"is_active"`
+	ChangedBy   string     `json:"changed_by"`
+	ChangedAt   time.Time  `json:"changed_at"`
 }
 
 // URLService defines the interface for URL operations
 type URLService interface {
-	CreateShortURL(ctx context.Context, originalURL string, userID string, expiresAt *time.Time) (*URL, error)
+	// CreateShortURL creates the link in workspaceID, or anonymously when
+	// userID is empty. It is served on the workspace's verified custom
+	// domain named domainName, or on the default host when that is empty.
+	// A non-empty password must be entered before the link redirects.
+	CreateShortURL(ctx context.Context, originalURL string, userID string, workspaceID int64, expiresAt *time.Time, alias string, domainName string, password string) (*URL, error)
 	GetURL(ctx context.Context, shortCode string) (*URL, error)
-	ListUserURLs(ctx context.Context, userID string) ([]URL, error)
+	// GetDomainURL retrieves a link served on the custom domain domainID
+	GetDomainURL(ctx context.Context, domainID int64, shortCode string) (*URL, error)
+	ListUserURLs(ctx context.Context, query URLQuery) (*URLPage, error)
 	DeleteURL(ctx context.Context, id int64, userID string) error
-	RecordClick(urlID int64) error
+	RecordClick(ctx context.Context, urlID int64) error
+	// UpdateURL applies update if the URL is still at expectedVersion; zero skips the check
+	UpdateURL(ctx context.Context, id int64, userID string, update URLUpdate, expectedVersion int) (*URL, error)
+	GetURLHistory(ctx context.Context, id int64, userID string) ([]URLHistory, error)
+	RollbackURL(ctx context.Context, id int64, userID string, historyID int64, expectedVersion int) (*URL, error)
+	// BulkUpdateURLs applies action to every active link of the workspace
+	// matching query's Tag or TagExpr, acting as query.UserID. Sorting and
+	// paging fields are ignored.
+	BulkUpdateURLs(ctx context.Context, query URLQuery, action URLBulkAction) (*URLBulkResult, error)
 }
 
 // URLRepository defines the interface for URL storage operations
 type URLRepository interface {
-	Create(url *URL) error
-	GetByShortCode(shortCode string) (*URL, error)
-	GetByUserID(userID string) ([]URL, error)
-	Delete(id int64, userID string) error
-	IncrementClickCount(id int64) error
+	Create(ctx context.Context, url *URL) error
+	// GetByShortCode looks up a link served on the default host
+	GetByShortCode(ctx context.Context, shortCode string) (*URL, error)
+	// GetByDomainShortCode looks up a link served on the custom domain domainID
+	GetByDomainShortCode(ctx context.Context, domainID int64, shortCode string) (*URL, error)
+	// List returns the page of URLs selected by query, newest first unless
+	// query says otherwise. Deactivated URLs are never listed.
+	List(ctx context.Context, query URLQuery) (*URLPage, error)
+	Delete(ctx context.Context, id int64) error
+	IncrementClickCount(ctx context.Context, id int64) error
+	// IncrementClickCounts adds clicks per URL ID in a single statement
+	IncrementClickCounts(ctx context.Context, clicks map[int64]int64) error
+	GetByID(ctx context.Context, id int64) (*URL, error)
+	// Update stores url if its row is still at expectedVersion, recording the
+	// previous state in the history table. On success url.Version and
+	// url.UpdatedAt reflect the new row.
+	Update(ctx context.Context, url *URL, expectedVersion int, changedBy string) error
+	GetHistory(ctx context.Context, urlID int64) ([]URLHistory, error)
+	// BulkUpdate applies action to the active URLs matched by query's
+	// workspace and filters in one transaction and returns them as changed
+	BulkUpdate(ctx context.Context, query URLQuery, action URLBulkAction, changedBy string) ([]URL, error)
+}
+
+// Counter hands out monotonically increasing values, e.g. from a database
+// sequence or a Redis INCR key
+type Counter interface {
+	Next(ctx context.Context) (int64, error)
 }
 
-// ErrURLNotFound is returned when a URL is not found
+// ErrURLNotFound is returned when a URL is not found, looked up by
+// ShortCode or by ID
 type ErrURLNotFound struct {
 	ShortCode string
+	ID        int64
 }
 
 func (e *ErrURLNotFound) Error() string {
-	return fmt.Sprintf("URL with short code %s not found", e.ShortCode)
+	switch {
+	case e.ShortCode != "":
+		return fmt.Sprintf("URL with short code %s not found", e.ShortCode)
+	case e.ID != 0:
+		return fmt.Sprintf("URL %d not found", e.ID)
+	default:
+		return "URL not found"
+	}
 }
 
 // ErrURLExpired is returned when a URL has expired
@@ -53,3 +203,68 @@ type ErrURLExpired struct {
 func (e *ErrURLExpired) Error() string {
 	return fmt.Sprintf("URL with short code %s has expired", e.ShortCode)
 }
+
+// ErrShortCodeConflict is returned when a short code is already in use
+type ErrShortCodeConflict struct {
+	ShortCode string
+}
+
+func (e *ErrShortCodeConflict) Error() string {
+	return fmt.Sprintf("Short code %s is already taken", e.ShortCode)
+}
+
+// ErrInvalidAlias is returned when a requested custom alias is not acceptable
+type ErrInvalidAlias struct {
+	Alias  string
+	Reason string
+}
+
+func (e *ErrInvalidAlias) Error() string {
+	return fmt.Sprintf("Alias %q is invalid: %s", e.Alias, e.Reason)
+}
+
+// ErrInvalidPassword is returned when a link password is not acceptable
+type ErrInvalidPassword struct {
+	Reason string
+}
+
+func (e *ErrInvalidPassword) Error() string {
+	return fmt.Sprintf("Invalid password: %s", e.Reason)
+}
+
+// ErrVersionMismatch is returned when a URL was changed since the client last read it
+type ErrVersionMismatch struct {
+	ID              int64
+	ExpectedVersion int
+}
+
+func (e *ErrVersionMismatch) Error() string {
+	return fmt.Sprintf("URL %d is no longer at version %d", e.ID, e.ExpectedVersion)
+}
+
+// ErrHistoryNotFound is returned when a URL history entry does not exist
+type ErrHistoryNotFound struct {
+	ID int64
+}
+
+func (e *ErrHistoryNotFound) Error() string {
+	return fmt.Sprintf("History entry %d not found", e.ID)
+}
+
+// ErrInvalidQuery is returned when a listing query cannot be served
+type ErrInvalidQuery struct {
+	Reason string
+}
+
+func (e *ErrInvalidQuery) Error() string {
+	return fmt.Sprintf("Invalid query: %s", e.Reason)
+}
+
+// ErrInvalidBulkRequest is returned when a bulk operation cannot be applied
+type ErrInvalidBulkRequest struct {
+	Reason string
+}
+
+func (e *ErrInvalidBulkRequest) Error() string {
+	return fmt.Sprintf("Invalid bulk request: %s", e.Reason)
+}
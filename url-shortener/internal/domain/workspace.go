@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Roles a member can hold in a workspace, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// WorkspaceRoles lists every role a member can be given
+var WorkspaceRoles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleViewer}
+
+// Permission is what a request needs to be allowed to do in a workspace
+type Permission int
+
+const (
+	// PermissionView reads links, domains, tags and analytics
+	PermissionView Permission = iota + 1
+	// PermissionEdit creates, edits and deletes links and their tags
+	PermissionEdit
+	// PermissionManage manages custom domains, members and invitations
+	PermissionManage
+)
+
+// roleRanks orders the roles; a role holds every permission up to its rank
+var roleRanks = map[string]int{
+	RoleViewer: int(PermissionView),
+	RoleEditor: int(PermissionEdit),
+	RoleAdmin:  int(PermissionManage),
+	RoleOwner:  int(PermissionManage) + 1,
+}
+
+// ValidRole reports whether role is one of WorkspaceRoles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows reports whether role grants perm
+func RoleAllows(role string, perm Permission) bool {
+	return roleRanks[role] >= int(perm)
+}
+
+// Workspace groups the links, domains and tags shared by its members. Every
+// user has a personal workspace that cannot be shared.
+type Workspace struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// Plan sets the workspace's quotas
+	Plan string `json:"plan"`
+	// Role is the requesting user's role, set on listings
+	Role string `json:"role,omitempty"`
+}
+
+// WorkspaceMember is a user's membership of a workspace
+type WorkspaceMember struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WorkspaceInvitation lets whoever holds its token join a workspace with
+// the given role. Email only labels the invitation; it is not checked.
+type WorkspaceInvitation struct {
+	ID          int64      `json:"id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	TokenHash   string     `json:"-"`
+	InvitedBy   string     `json:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedBy  *string    `json:"accepted_by,omitempty"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewWorkspaceInvitation is a freshly created invitation. Token is only
+// returned once; afterwards only its hash is known.
+type NewWorkspaceInvitation struct {
+	WorkspaceInvitation
+	Token string `json:"token"`
+}
+
+// WorkspaceService defines the interface for workspace and membership operations
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, userID string, name string) (*Workspace, error)
+	// ListWorkspaces returns the workspaces userID belongs to, creating
+	// their personal workspace on first use
+	ListWorkspaces(ctx context.Context, userID string) ([]Workspace, error)
+	ListMembers(ctx context.Context, workspaceID int64, userID string) ([]WorkspaceMember, error)
+	UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, memberID string, role string) (*WorkspaceMember, error)
+	// RemoveMember removes memberID from the workspace; members may always remove themselves
+	RemoveMember(ctx context.Context, workspaceID int64, userID string, memberID string) error
+	CreateInvitation(ctx context.Context, workspaceID int64, userID string, email string, role string) (*NewWorkspaceInvitation, error)
+	ListInvitations(ctx context.Context, workspaceID int64, userID string) ([]WorkspaceInvitation, error)
+	RevokeInvitation(ctx context.Context, workspaceID int64, invitationID int64, userID string) error
+	// AcceptInvitation adds userID to the workspace the invitation token belongs to
+	AcceptInvitation(ctx context.Context, token string, userID string) (*Workspace, error)
+}
+
+// WorkspaceRepository defines the interface for workspace storage operations
+type WorkspaceRepository interface {
+	// Create stores workspace and makes owner its first member, unless owner
+	// created quota shared workspaces already
+	Create(ctx context.Context, workspace *Workspace, owner string, quota QuotaLimit) error
+	GetByID(ctx context.Context, id int64) (*Workspace, error)
+	// EnsurePersonal returns userID's personal workspace, creating it if needed
+	EnsurePersonal(ctx context.Context, userID string) (*Workspace, error)
+	// ListByUser returns the workspaces userID belongs to with their role set
+	ListByUser(ctx context.Context, userID string) ([]Workspace, error)
+	GetMember(ctx context.Context, workspaceID int64, userID string) (*WorkspaceMember, error)
+	ListMembers(ctx context.Context, workspaceID int64) ([]WorkspaceMember, error)
+	// UpdateMemberRole and RemoveMember fail with ErrLastOwner rather than
+	// leave the workspace without an owner
+	UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, role string) error
+	RemoveMember(ctx context.Context, workspaceID int64, userID string) error
+	CreateInvitation(ctx context.Context, invitation *WorkspaceInvitation) error
+	// ListPendingInvitations returns the invitations not accepted or expired by now
+	ListPendingInvitations(ctx context.Context, workspaceID int64, now time.Time) ([]WorkspaceInvitation, error)
+	DeleteInvitation(ctx context.Context, workspaceID int64, id int64) error
+	// AcceptInvitation marks the pending invitation with tokenHash accepted
+	// by userID and adds them as a member in one transaction
+	AcceptInvitation(ctx context.Context, tokenHash string, userID string, now time.Time) (*WorkspaceInvitation, error)
+}
+
+// ErrWorkspaceNotFound is returned when a workspace is not found
+type ErrWorkspaceNotFound struct {
+	ID int64
+}
+
+func (e *ErrWorkspaceNotFound) Error() string {
+	return fmt.Sprintf("Workspace %d not found", e.ID)
+}
+
+// ErrMemberNotFound is returned when a user is not a member of a workspace
+type ErrMemberNotFound struct {
+	WorkspaceID int64
+	UserID      string
+}
+
+func (e *ErrMemberNotFound) Error() string {
+	return fmt.Sprintf("User %s is not a member of workspace %d", e.UserID, e.WorkspaceID)
+}
+
+// ErrAlreadyMember is returned when an invitation is accepted by a member
+type ErrAlreadyMember struct {
+	WorkspaceID int64
+}
+
+func (e *ErrAlreadyMember) Error() string {
+	return fmt.Sprintf("Already a member of workspace %d", e.WorkspaceID)
+}
+
+// ErrLastOwner is returned when a change would leave a workspace without an owner
+type ErrLastOwner struct {
+	WorkspaceID int64
+}
+
+func (e *ErrLastOwner) Error() string {
+	return fmt.Sprintf("Workspace %d needs at least one owner", e.WorkspaceID)
+}
+
+// ErrInvitationNotFound is returned when an invitation does not exist, was
+// already accepted or has expired
+type ErrInvitationNotFound struct {
+	ID int64
+}
+
+func (e *ErrInvitationNotFound) Error() string {
+	if e.ID == 0 {
+		return "Invitation not found or no longer valid"
+	}
+	return fmt.Sprintf("Invitation %d not found or no longer valid", e.ID)
+}
+
+// ErrInvalidWorkspaceRequest is returned when a workspace change is not acceptable
+type ErrInvalidWorkspaceRequest struct {
+	Reason string
+}
+
+func (e *ErrInvalidWorkspaceRequest) Error() string {
+	return fmt.Sprintf("Invalid workspace request: %s", e.Reason)
+}
@@ -0,0 +1,157 @@
+// Package geoip resolves IP addresses to a location using a local
+// MaxMind-format (.mmdb) database such as GeoLite2-City or GeoLite2-Country.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrNoDatabase is returned by Reload when no database path is configured
+var ErrNoDatabase = errors.New("no GeoIP database configured")
+
+// Location is where an address is registered. Fields the database does not
+// carry, e.g. the city in a country database, are left empty.
+type Location struct {
+	CountryCode string
+	Region      string
+	City        string
+}
+
+// record is the subset of the GeoIP2 schema we read
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Reader looks up addresses in a database file and reopens it when the file
+// is replaced. A Reader without a usable database finds nothing.
+type Reader struct {
+	path string
+
+	mu      sync.RWMutex
+	db      *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// NewReader creates a reader for the database at path. Nothing is opened
+// until Reload is called; an empty path leaves the reader permanently empty.
+func NewReader(path string) *Reader {
+	return &Reader{path: path}
+}
+
+// Lookup returns the location of addr. ok is false when there is no
+// database or the address is not in it.
+func (r *Reader) Lookup(addr netip.Addr) (loc Location, ok bool) {
+	if !addr.IsValid() {
+		return Location{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.db == nil {
+		return Location{}, false
+	}
+
+	var rec record
+	if err := r.db.Lookup(addr.AsSlice(), &rec); err != nil {
+		return Location{}, false
+	}
+
+	loc.CountryCode = rec.Country.ISOCode
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].Names["en"]
+		if loc.Region == "" {
+			loc.Region = rec.Subdivisions[0].ISOCode
+		}
+	}
+	loc.City = rec.City.Names["en"]
+
+	return loc, loc != Location{}
+}
+
+// Reload opens the database if the file changed since it was last loaded.
+// On failure the previously loaded database stays in use.
+func (r *Reader) Reload() error {
+	if r.path == "" {
+		return ErrNoDatabase
+	}
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	unchanged := r.db != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	db, err := maxminddb.Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.db
+	r.db, r.modTime, r.size = db, info.ModTime(), info.Size()
+	r.mu.Unlock()
+
+	// Lookups hold the read lock, so none can still be using old
+	if old != nil {
+		old.Close()
+	}
+
+	return nil
+}
+
+// Watch calls Reload every interval until ctx is done, so a database that is
+// replaced on disk, or appears after startup, is picked up without a restart
+func (r *Reader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[ERROR] reloading GeoIP database %s: %v", r.path, err)
+			}
+		}
+	}
+}
+
+// Close releases the database
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.db == nil {
+		return nil
+	}
+
+	err := r.db.Close()
+	r.db = nil
+	return err
+}
@@ -0,0 +1,109 @@
+package geoip
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCityDB writes a GeoIP2-City style database mapping each network to loc.
+// The file is written next to path and renamed over it, like a real update.
+func writeCityDB(t *testing.T, path string, networks map[string]Location) {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            "GeoIP2-City",
+		RecordSize:              24,
+		IncludeReservedNetworks: true,
+	})
+	require.NoError(t, err)
+
+	for cidr, loc := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+
+		require.NoError(t, tree.Insert(network, mmdbtype.Map{
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String(loc.CountryCode)},
+			"subdivisions": mmdbtype.Slice{mmdbtype.Map{
+				"iso_code": mmdbtype.String("XX"),
+				"names":    mmdbtype.Map{"en": mmdbtype.String(loc.Region)},
+			}},
+			"city": mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(loc.City)}},
+		}))
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	require.NoError(t, err)
+	_, err = tree.WriteTo(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func TestReaderLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeCityDB(t, path, map[string]Location{
+		"81.2.69.0/24": {CountryCode: "GB", Region: "England", City: "London"},
+	})
+
+	r := NewReader(path)
+	require.NoError(t, r.Reload())
+	defer r.Close()
+
+	loc, ok := r.Lookup(netip.MustParseAddr("81.2.69.142"))
+	assert.True(t, ok)
+	assert.Equal(t, Location{CountryCode: "GB", Region: "England", City: "London"}, loc)
+
+	_, ok = r.Lookup(netip.MustParseAddr("8.8.8.8"))
+	assert.False(t, ok)
+}
+
+func TestReaderReloadsReplacedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeCityDB(t, path, map[string]Location{
+		"81.2.69.0/24": {CountryCode: "GB", Region: "England", City: "London"},
+	})
+
+	r := NewReader(path)
+	require.NoError(t, r.Reload())
+	defer r.Close()
+
+	writeCityDB(t, path, map[string]Location{
+		"81.2.69.0/24": {CountryCode: "FR", Region: "Ile-de-France", City: "Paris"},
+	})
+	// Make sure the replacement looks newer even on coarse-grained filesystems
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	require.NoError(t, r.Reload())
+	loc, ok := r.Lookup(netip.MustParseAddr("81.2.69.142"))
+	assert.True(t, ok)
+	assert.Equal(t, "Paris", loc.City)
+}
+
+func TestReaderWithoutDatabase(t *testing.T) {
+	r := NewReader("")
+	assert.ErrorIs(t, r.Reload(), ErrNoDatabase)
+
+	_, ok := r.Lookup(netip.MustParseAddr("81.2.69.142"))
+	assert.False(t, ok)
+
+	// A broken file keeps the reader empty instead of failing lookups
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+	r = NewReader(path)
+	assert.Error(t, r.Reload())
+
+	_, ok = r.Lookup(netip.MustParseAddr("81.2.69.142"))
+	assert.False(t, ok)
+	assert.NoError(t, r.Close())
+}
@@ -0,0 +1,48 @@
+package ingest
+
+import (
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/clientip"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/geoip"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/useragent"
+)
+
+// Enricher fills in derived fields of a visit before it is written. Enrichers
+// run on the writer goroutine, so they add no latency to redirects.
+type Enricher interface {
+	Enrich(visit *domain.Analytics)
+}
+
+// EnricherFunc adapts a function to the Enricher interface
+type EnricherFunc func(visit *domain.Analytics)
+
+// Enrich calls f(visit)
+func (f EnricherFunc) Enrich(visit *domain.Analytics) {
+	f(visit)
+}
+
+// UserAgentEnricher classifies the visit's User-Agent with the embedded rules
+var UserAgentEnricher = EnricherFunc(func(visit *domain.Analytics) {
+	ua := useragent.Parse(visit.UserAgent)
+	visit.DeviceType = ua.DeviceType
+	visit.Browser = ua.Browser
+	visit.OS = ua.OS
+	visit.IsBot = ua.IsBot
+})
+
+// GeoIPEnricher fills in the visit's country, region and city from reader.
+// Visits stay unlocated when the address is unknown or no database is loaded.
+func GeoIPEnricher(reader *geoip.Reader) Enricher {
+	return EnricherFunc(func(visit *domain.Analytics) {
+		addr, ok := clientip.Parse(visit.VisitorIP)
+		if !ok {
+			return
+		}
+
+		if loc, ok := reader.Lookup(addr); ok {
+			visit.CountryCode = loc.CountryCode
+			visit.Region = loc.Region
+			visit.City = loc.City
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrClosed is returned by Shutdown when the pipeline was already shut down
+var ErrClosed = errors.New("ingest pipeline is closed")
+
+// Config tunes the ingestion pipeline
+type Config struct {
+	// QueueSize bounds the number of visits waiting to be written
+	QueueSize int
+	// BatchSize flushes as soon as this many visits are buffered
+	BatchSize int
+	// FlushInterval flushes a partial batch after this long
+	FlushInterval time.Duration
+	// WriteTimeout bounds a single flush including retries
+	WriteTimeout time.Duration
+	// MaxAttempts is how often a failing write is tried before the batch is dropped
+	MaxAttempts int
+}
+
+// DefaultConfig returns the settings used when a field is left zero
+func DefaultConfig() Config {
+	return Config{
+		QueueSize:     10000,
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		WriteTimeout:  10 * time.Second,
+		MaxAttempts:   3,
+	}
+}
+
+// Stats is a snapshot of the pipeline counters
+type Stats struct {
+	Enqueued      uint64 `json:"enqueued"`
+	Dropped       uint64 `json:"dropped"`
+	Written       uint64 `json:"written"`
+	Failed        uint64 `json:"failed"`
+	Batches       uint64 `json:"batches"`
+	QueueDepth    int    `json:"queue_depth"`
+	QueueCapacity int    `json:"queue_capacity"`
+	// Saturation is QueueDepth/QueueCapacity; values near 1 mean visits are
+	// arriving faster than they can be written and will soon be dropped
+	Saturation float64 `json:"saturation"`
+}
+
+// Pipeline buffers visits from redirects in a bounded queue and writes them
+// in batches: visits are copied into analytics and click counts are added
+// with one update per URL per flush. It implements domain.VisitRecorder.
+type Pipeline struct {
+	cfg       Config
+	analytics domain.AnalyticsRepository
+	urls      domain.URLRepository
+	enrichers []Enricher
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan domain.Analytics
+	done   chan struct{}
+
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	written  atomic.Uint64
+	failed   atomic.Uint64
+	batches  atomic.Uint64
+}
+
+// NewPipeline creates a pipeline and starts its writer. Enrichers are applied
+// to every visit, in order, before it is written.
+func NewPipeline(cfg Config, analytics domain.AnalyticsRepository, urls domain.URLRepository, enrichers ...Enricher) *Pipeline {
+	defaults := DefaultConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaults.FlushInterval
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaults.WriteTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+
+	p := &Pipeline{
+		cfg:       cfg,
+		analytics: analytics,
+		urls:      urls,
+		enrichers: enrichers,
+		queue:     make(chan domain.Analytics, cfg.QueueSize),
+		done:      make(chan struct{}),
+	}
+
+	p.registerMetrics()
+	go p.run()
+
+	return p
+}
+
+// Record queues a visit without blocking. When the queue is full or the
+// pipeline is shutting down the visit is dropped and counted.
+func (p *Pipeline) Record(visit domain.Analytics) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return
+	}
+
+	select {
+	case p.queue <- visit:
+		p.enqueued.Add(1)
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Stats returns the current counters
+func (p *Pipeline) Stats() Stats {
+	depth := len(p.queue)
+	capacity := cap(p.queue)
+
+	return Stats{
+		Enqueued:      p.enqueued.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		Failed:        p.failed.Load(),
+		Batches:       p.batches.Load(),
+		QueueDepth:    depth,
+		QueueCapacity: capacity,
+		Saturation:    float64(depth) / float64(capacity),
+	}
+}
+
+// Shutdown stops accepting visits and waits until everything already queued
+// has been written or ctx expires
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run collects visits into batches until the queue is closed and drained
+func (p *Pipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]domain.Analytics, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case visit, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, visit)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes one batch. Analytics rows and click counts are retried
+// separately so a failed count update never duplicates analytics rows.
+func (p *Pipeline) flush(batch []domain.Analytics) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.WriteTimeout)
+	defer cancel()
+
+	p.batches.Add(1)
+
+	for i := range batch {
+		for _, enricher := range p.enrichers {
+			enricher.Enrich(&batch[i])
+		}
+	}
+
+	if err := p.retry(ctx, func() error { return p.analytics.CreateBatch(ctx, batch) }); err != nil {
+		log.Printf("[ERROR] dropping %d visits after failed analytics write: %v", len(batch), err)
+		p.failed.Add(uint64(len(batch)))
+	} else {
+		p.written.Add(uint64(len(batch)))
+	}
+
+	clicks := ClickCounts(batch)
+	if err := p.retry(ctx, func() error { return p.urls.IncrementClickCounts(ctx, clicks) }); err != nil {
+		log.Printf("[ERROR] lost click counts for %d urls: %v", len(clicks), err)
+	}
+}
+
+// retry runs fn up to MaxAttempts times with a short linear backoff
+func (p *Pipeline) retry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= p.cfg.MaxAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == p.cfg.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// ClickCounts aggregates a batch into clicks per URL ID. Bot visits are
+// stored as analytics but do not count as clicks.
+func ClickCounts(batch []domain.Analytics) map[int64]int64 {
+	clicks := make(map[int64]int64)
+	for _, visit := range batch {
+		if visit.IsBot {
+			continue
+		}
+		clicks[visit.URLID]++
+	}
+	return clicks
+}
+
+// registerMetrics exposes the counters through OpenTelemetry
+func (p *Pipeline) registerMetrics() {
+	meter := otel.Meter("url-shortener/ingest")
+
+	enqueued, _ := meter.Int64ObservableCounter("ingest.visits.enqueued")
+	dropped, _ := meter.Int64ObservableCounter("ingest.visits.dropped")
+	written, _ := meter.Int64ObservableCounter("ingest.visits.written")
+	failed, _ := meter.Int64ObservableCounter("ingest.visits.failed")
+	depth, _ := meter.Int64ObservableGauge("ingest.queue.depth")
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := p.Stats()
+		o.ObserveInt64(enqueued, int64(stats.Enqueued))
+		o.ObserveInt64(dropped, int64(stats.Dropped))
+		o.ObserveInt64(written, int64(stats.Written))
+		o.ObserveInt64(failed, int64(stats.Failed))
+		o.ObserveInt64(depth, int64(stats.QueueDepth))
+		return nil
+	}, enqueued, dropped, written, failed, depth)
+	if err != nil {
+		log.Printf("Failed to register ingest metrics: %v", err)
+	}
+}
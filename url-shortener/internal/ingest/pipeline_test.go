@@ -0,0 +1,203 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore records batch writes for both repositories the pipeline uses
+type fakeStore struct {
+	mu          sync.Mutex
+	batches     [][]domain.Analytics
+	clicks      map[int64]int64
+	failBatches int
+	block       chan struct{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{clicks: make(map[int64]int64)}
+}
+
+// Only the batch methods are implemented; the embedded interfaces panic if
+// the pipeline calls anything else
+type fakeAnalyticsRepo struct {
+	domain.AnalyticsRepository
+	store *fakeStore
+}
+
+func (r fakeAnalyticsRepo) CreateBatch(ctx context.Context, visits []domain.Analytics) error {
+	return r.store.CreateBatch(ctx, visits)
+}
+
+type fakeURLRepo struct {
+	domain.URLRepository
+	store *fakeStore
+}
+
+func (r fakeURLRepo) IncrementClickCounts(ctx context.Context, clicks map[int64]int64) error {
+	return r.store.IncrementClickCounts(ctx, clicks)
+}
+
+func (s *fakeStore) CreateBatch(ctx context.Context, visits []domain.Analytics) error {
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failBatches > 0 {
+		s.failBatches--
+		return errors.New("connection reset")
+	}
+	s.batches = append(s.batches, append([]domain.Analytics(nil), visits...))
+	return nil
+}
+
+func (s *fakeStore) IncrementClickCounts(ctx context.Context, clicks map[int64]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, n := range clicks {
+		s.clicks[id] += n
+	}
+	return nil
+}
+
+func (s *fakeStore) snapshot() ([][]domain.Analytics, map[int64]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clicks := make(map[int64]int64, len(s.clicks))
+	for id, n := range s.clicks {
+		clicks[id] = n
+	}
+	return append([][]domain.Analytics(nil), s.batches...), clicks
+}
+
+func newTestPipeline(cfg Config, store *fakeStore, enrichers ...Enricher) *Pipeline {
+	return NewPipeline(cfg, fakeAnalyticsRepo{store: store}, fakeURLRepo{store: store}, enrichers...)
+}
+
+func TestPipelineFlushesOnBatchSize(t *testing.T) {
+	store := newFakeStore()
+	p := newTestPipeline(Config{BatchSize: 3, FlushInterval: time.Hour}, store)
+
+	for _, id := range []int64{1, 2, 1} {
+		p.Record(domain.Analytics{URLID: id})
+	}
+
+	assert.Eventually(t, func() bool {
+		batches, _ := store.snapshot()
+		return len(batches) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	batches, clicks := store.snapshot()
+	assert.Len(t, batches[0], 3)
+	assert.Equal(t, map[int64]int64{1: 2, 2: 1}, clicks)
+
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestPipelineFlushesOnInterval(t *testing.T) {
+	store := newFakeStore()
+	p := newTestPipeline(Config{BatchSize: 100, FlushInterval: 20 * time.Millisecond}, store)
+
+	p.Record(domain.Analytics{URLID: 5})
+
+	assert.Eventually(t, func() bool {
+		_, clicks := store.snapshot()
+		return clicks[5] == 1
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestPipelineDrainsOnShutdown(t *testing.T) {
+	store := newFakeStore()
+	p := newTestPipeline(Config{BatchSize: 100, FlushInterval: time.Hour}, store)
+
+	for i := 0; i < 10; i++ {
+		p.Record(domain.Analytics{URLID: 9})
+	}
+
+	require.NoError(t, p.Shutdown(context.Background()))
+
+	_, clicks := store.snapshot()
+	assert.Equal(t, int64(10), clicks[9])
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(10), stats.Enqueued)
+	assert.Equal(t, uint64(10), stats.Written)
+
+	// Late visits are counted as dropped instead of panicking on a closed queue
+	p.Record(domain.Analytics{URLID: 9})
+	assert.Equal(t, uint64(1), p.Stats().Dropped)
+	assert.ErrorIs(t, p.Shutdown(context.Background()), ErrClosed)
+}
+
+func TestPipelineDropsWhenQueueFull(t *testing.T) {
+	store := newFakeStore()
+	store.block = make(chan struct{})
+	p := newTestPipeline(Config{QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour}, store)
+
+	// The first visit is taken by the writer, which then blocks in CreateBatch
+	p.Record(domain.Analytics{URLID: 1})
+	assert.Eventually(t, func() bool { return len(p.queue) == 0 }, time.Second, time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		p.Record(domain.Analytics{URLID: 1})
+	}
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(3), stats.Enqueued)
+	assert.Equal(t, uint64(3), stats.Dropped)
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 1.0, stats.Saturation)
+
+	close(store.block)
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestPipelineRetriesFailedWrites(t *testing.T) {
+	store := newFakeStore()
+	store.failBatches = 1
+	p := newTestPipeline(Config{BatchSize: 1, FlushInterval: time.Hour}, store)
+
+	p.Record(domain.Analytics{URLID: 3})
+	require.NoError(t, p.Shutdown(context.Background()))
+
+	batches, clicks := store.snapshot()
+	assert.Len(t, batches, 1)
+	assert.Equal(t, int64(1), clicks[3])
+	assert.Zero(t, p.Stats().Failed)
+}
+
+func TestPipelineEnrichesVisitsAndSkipsBotClicks(t *testing.T) {
+	store := newFakeStore()
+	p := newTestPipeline(Config{BatchSize: 100, FlushInterval: time.Hour}, store, UserAgentEnricher)
+
+	p.Record(domain.Analytics{URLID: 7, UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"})
+	p.Record(domain.Analytics{URLID: 7, UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"})
+	p.Record(domain.Analytics{URLID: 7, UserAgent: "facebookexternalhit/1.1"})
+	require.NoError(t, p.Shutdown(context.Background()))
+
+	batches, clicks := store.snapshot()
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 3)
+	assert.Equal(t, "mobile", batches[0][0].DeviceType)
+	assert.Equal(t, "Safari", batches[0][0].Browser)
+	assert.Equal(t, "iOS", batches[0][0].OS)
+	assert.True(t, batches[0][1].IsBot)
+	assert.Equal(t, "bot", batches[0][2].DeviceType)
+
+	// Bot visits are stored but only the human one is a click
+	assert.Equal(t, int64(1), clicks[7])
+}
@@ -0,0 +1,120 @@
+// Package linkpass guards password protected links. Passwords are stored as
+// bcrypt hashes, and a visitor who entered the right one gets a signed
+// cookie that lets them through until it expires.
+package linkpass
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bounds on link passwords; bcrypt ignores everything past 72 bytes
+const (
+	MinLength = 4
+	MaxLength = 72
+)
+
+// Hash returns the bcrypt hash of password
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Check reports whether password matches hash
+func Check(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Cookies issues and checks the cookies that unlock protected links. A
+// cookie is bound to one link and to its password hash, so changing the
+// password locks out everyone who unlocked the old one.
+type Cookies struct {
+	secret []byte
+	ttl    time.Duration
+	secure bool
+	now    func() time.Time
+}
+
+// NewCookies signs cookies valid for ttl with secret. An empty secret picks
+// a random one, which only holds while the process runs and is not shared
+// with other instances. Cookies are Secure on TLS connections, and always
+// when secure is set, as it must be when TLS ends at a proxy.
+func NewCookies(secret []byte, ttl time.Duration, secure bool) *Cookies {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Sprintf("linkpass: reading random secret: %v", err))
+		}
+	}
+
+	return &Cookies{
+		secret: secret,
+		ttl:    ttl,
+		secure: secure,
+		now:    time.Now,
+	}
+}
+
+// cookieName is the cookie unlocking the link urlID
+func cookieName(urlID int64) string {
+	return "snax_unlock_" + strconv.FormatInt(urlID, 10)
+}
+
+// sign returns the signature of a cookie for urlID and passwordHash
+// expiring at expiry (Unix seconds)
+func (c *Cookies) sign(urlID int64, passwordHash string, expiry int64) string {
+	mac := hmac.New(sha256.New, c.secret)
+	fmt.Fprintf(mac, "%d|%d|%s", urlID, expiry, passwordHash)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue sets the cookie unlocking urlID on the path of r
+func (c *Cookies) Issue(w http.ResponseWriter, r *http.Request, urlID int64, passwordHash string) {
+	expires := c.now().Add(c.ttl)
+	expiry := expires.Unix()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName(urlID),
+		Value:    strconv.FormatInt(expiry, 10) + "." + c.sign(urlID, passwordHash, expiry),
+		Path:     r.URL.Path,
+		Expires:  expires,
+		MaxAge:   int(c.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   c.secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Unlocked reports whether r carries a valid, unexpired cookie for urlID
+// protected by passwordHash
+func (c *Cookies) Unlocked(r *http.Request, urlID int64, passwordHash string) bool {
+	cookie, err := r.Cookie(cookieName(urlID))
+	if err != nil {
+		return false
+	}
+
+	value, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || expiry <= c.now().Unix() {
+		return false
+	}
+
+	want := c.sign(urlID, passwordHash, expiry)
+	return subtle.ConstantTimeCompare([]byte(signature), []byte(want)) == 1
+}
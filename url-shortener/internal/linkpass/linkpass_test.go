@@ -0,0 +1,145 @@
+package linkpass
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAndCheck(t *testing.T) {
+	hash, err := Hash("s3cret")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, "s3cret", hash)
+	assert.True(t, Check(hash, "s3cret"))
+	assert.False(t, Check(hash, "wrong"))
+	assert.False(t, Check("", "s3cret"))
+}
+
+func TestCookies(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cookies := NewCookies([]byte("secret"), time.Hour, false)
+	cookies.now = func() time.Time { return now }
+
+	w := httptest.NewRecorder()
+	cookies.Issue(w, httptest.NewRequest(http.MethodPost, "/public/r/abc", nil), 1, "hash")
+	issued := w.Result().Cookies()
+	require.Len(t, issued, 1)
+	assert.Equal(t, "snax_unlock_1", issued[0].Name)
+	assert.Equal(t, "/public/r/abc", issued[0].Path)
+	assert.True(t, issued[0].HttpOnly)
+	assert.False(t, issued[0].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, issued[0].SameSite)
+
+	tests := []struct {
+		name     string
+		cookie   *http.Cookie
+		urlID    int64
+		hash     string
+		elapsed  time.Duration
+		secret   string
+		unlocked bool
+	}{
+		{
+			name:     "Valid Cookie",
+			cookie:   issued[0],
+			urlID:    1,
+			hash:     "hash",
+			unlocked: true,
+		},
+		{
+			name:  "No Cookie",
+			urlID: 1,
+			hash:  "hash",
+		},
+		{
+			name:    "Expired",
+			cookie:  issued[0],
+			urlID:   1,
+			hash:    "hash",
+			elapsed: time.Hour,
+		},
+		{
+			name:   "Password Changed",
+			cookie: issued[0],
+			urlID:  1,
+			hash:   "other",
+		},
+		{
+			name:   "Other Link",
+			cookie: &http.Cookie{Name: "snax_unlock_2", Value: issued[0].Value},
+			urlID:  2,
+			hash:   "hash",
+		},
+		{
+			name:   "Forged Expiry",
+			cookie: &http.Cookie{Name: "snax_unlock_1", Value: "9999999999." + issued[0].Value[len("1700003600."):]},
+			urlID:  1,
+			hash:   "hash",
+		},
+		{
+			name:   "Malformed",
+			cookie: &http.Cookie{Name: "snax_unlock_1", Value: "garbage"},
+			urlID:  1,
+			hash:   "hash",
+		},
+		{
+			name:   "Other Secret",
+			cookie: issued[0],
+			urlID:  1,
+			hash:   "hash",
+			secret: "another",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := "secret"
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+			cookies := NewCookies([]byte(secret), time.Hour, false)
+			cookies.now = func() time.Time { return now.Add(tt.elapsed) }
+
+			r := httptest.NewRequest(http.MethodGet, "/public/r/abc", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+
+			assert.Equal(t, tt.unlocked, cookies.Unlocked(r, tt.urlID, tt.hash))
+		})
+	}
+}
+
+func TestCookiesSecure(t *testing.T) {
+	tests := []struct {
+		name   string
+		secure bool
+		tls    bool
+		want   bool
+	}{
+		{name: "Plain HTTP", want: false},
+		{name: "TLS Connection", tls: true, want: true},
+		{name: "TLS At A Proxy", secure: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/public/r/abc", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+
+			w := httptest.NewRecorder()
+			NewCookies([]byte("secret"), time.Hour, tt.secure).Issue(w, r, 1, "hash")
+			issued := w.Result().Cookies()
+			require.Len(t, issued, 1)
+			assert.Equal(t, tt.want, issued[0].Secure)
+		})
+	}
+}
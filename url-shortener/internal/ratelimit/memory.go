@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryKeys bounds the clients a MemoryLimiter tracks
+const DefaultMemoryKeys = 100000
+
+// memoryEntry is the state of one key: the admitted request times of a
+// sliding window or the tokens of a bucket
+type memoryEntry struct {
+	times     []time.Time
+	tokens    float64
+	counted   time.Time
+	expiresAt time.Time
+}
+
+// MemoryLimiter applies policies with counters held in process, so each
+// instance counts only the requests it serves. It tracks at most maxKeys
+// clients; beyond that, idle ones are forgotten first.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	maxKeys int
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+// NewMemoryLimiter creates an in-process limiter tracking up to maxKeys
+// clients; 0 uses DefaultMemoryKeys
+func NewMemoryLimiter(maxKeys int) *MemoryLimiter {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMemoryKeys
+	}
+
+	return &MemoryLimiter{
+		maxKeys: maxKeys,
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Allow counts a request by key against policy
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, policy Policy) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	key = string(policy.Algorithm) + ":" + key
+	entry, ok := l.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		l.makeRoom(now)
+		entry = &memoryEntry{tokens: float64(policy.Capacity()), counted: now}
+		l.entries[key] = entry
+	}
+
+	switch policy.Algorithm {
+	case SlidingWindow:
+		return l.slidingWindow(entry, policy, now), nil
+	case TokenBucket:
+		return l.tokenBucket(entry, policy, now), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+	}
+}
+
+func (l *MemoryLimiter) slidingWindow(entry *memoryEntry, policy Policy, now time.Time) *Result {
+	start := now.Add(-policy.Window)
+	kept := entry.times[:0]
+	for _, t := range entry.times {
+		if t.After(start) {
+			kept = append(kept, t)
+		}
+	}
+	entry.times = kept
+
+	result := &Result{Limit: policy.Limit}
+	if len(entry.times) < policy.Limit {
+		entry.times = append(entry.times, now)
+		result.Allowed = true
+	}
+
+	result.Remaining = policy.Limit - len(entry.times)
+	result.Reset = entry.times[0].Add(policy.Window).Sub(now)
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	entry.expiresAt = now.Add(result.Reset)
+
+	return result
+}
+
+func (l *MemoryLimiter) tokenBucket(entry *memoryEntry, policy Policy, now time.Time) *Result {
+	capacity := float64(policy.Capacity())
+	perToken := float64(policy.Window) / float64(policy.Limit)
+
+	if now.After(entry.counted) {
+		entry.tokens = math.Min(capacity, entry.tokens+float64(now.Sub(entry.counted))/perToken)
+		entry.counted = now
+	}
+
+	result := &Result{Limit: policy.Capacity()}
+	if entry.tokens >= 1 {
+		entry.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - entry.tokens) * perToken))
+	}
+
+	result.Remaining = int(entry.tokens)
+	result.Reset = time.Duration(math.Ceil((capacity - entry.tokens) * perToken))
+	entry.expiresAt = now.Add(result.Reset)
+
+	return result
+}
+
+// makeRoom drops expired entries when the limiter is full and, if that frees
+// less than a tenth of it, arbitrary ones, so a flood of new clients does not
+// sweep the map on every request
+func (l *MemoryLimiter) makeRoom(now time.Time) {
+	if len(l.entries) < l.maxKeys {
+		return
+	}
+
+	for key, entry := range l.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(l.entries, key)
+		}
+	}
+
+	target := l.maxKeys - max(l.maxKeys/10, 1)
+	for key := range l.entries {
+		if len(l.entries) <= target {
+			break
+		}
+		delete(l.entries, key)
+	}
+}
@@ -0,0 +1,260 @@
+// Package ratelimit limits request rates with counters shared through Redis.
+// A Policy picks the algorithm: a sliding-window log, which never admits more
+// than Limit requests in any Window, or a token bucket, which refills Limit
+// tokens per Window and absorbs bursts up to Burst.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Algorithm selects how a policy counts requests
+type Algorithm string
+
+const (
+	SlidingWindow Algorithm = "sliding_window"
+	TokenBucket   Algorithm = "token_bucket"
+)
+
+// Scope selects what a policy's counter is keyed on
+type Scope string
+
+const (
+	// ScopeIP counts requests per client address
+	ScopeIP Scope = "ip"
+	// ScopeUser counts requests per authenticated user
+	ScopeUser Scope = "user"
+	// ScopeLink counts requests per short link
+	ScopeLink Scope = "link"
+)
+
+// Policy is one rate limit
+type Policy struct {
+	Algorithm Algorithm
+	// Limit is the number of requests allowed per Window. Token buckets
+	// refill at this rate.
+	Limit  int
+	Window time.Duration
+	// Burst is the token bucket capacity; 0 uses Limit. Sliding windows
+	// ignore it.
+	Burst int
+	Scope Scope
+}
+
+// Capacity is the most requests the policy admits at once
+func (p Policy) Capacity() int {
+	if p.Algorithm == TokenBucket && p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+func (p Policy) validate() error {
+	if p.Algorithm != SlidingWindow && p.Algorithm != TokenBucket {
+		return fmt.Errorf("algorithm must be %s or %s", SlidingWindow, TokenBucket)
+	}
+	if p.Limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+	if p.Window < time.Millisecond {
+		return fmt.Errorf("window must be at least 1ms")
+	}
+	if p.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if p.Scope != ScopeIP && p.Scope != ScopeUser && p.Scope != ScopeLink {
+		return fmt.Errorf("scope must be %s, %s or %s", ScopeIP, ScopeUser, ScopeLink)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads a policy such as
+// {"algorithm": "token_bucket", "limit": 10, "window": "1m", "burst": 20, "scope": "user"}
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Algorithm Algorithm `json:"algorithm"`
+		Limit     int       `json:"limit"`
+		Window    string    `json:"window"`
+		Burst     int       `json:"burst"`
+		Scope     Scope     `json:"scope"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	window, err := time.ParseDuration(raw.Window)
+	if err != nil {
+		return fmt.Errorf("window: %v", err)
+	}
+
+	*p = Policy{
+		Algorithm: raw.Algorithm,
+		Limit:     raw.Limit,
+		Window:    window,
+		Burst:     raw.Burst,
+		Scope:     raw.Scope,
+	}
+	return nil
+}
+
+// GroupPolicies are the limits of one route group
+type GroupPolicies struct {
+	// Guest applies to unauthenticated requests and is always keyed on
+	// the client address. Nil lets guests through.
+	Guest *Policy `json:"guest"`
+	// User applies to authenticated requests. Nil lets users through.
+	User *Policy `json:"user"`
+	// Plans override User for users on the named plan
+	Plans map[string]*Policy `json:"plans"`
+	// Link applies per link in groups acting on one, on top of the client
+	// policy. Nil leaves links unlimited.
+	Link *Policy `json:"link"`
+}
+
+// Policies maps route groups to their limits
+type Policies map[string]GroupPolicies
+
+// Route groups the router limits
+const (
+	// GroupShorten covers link creation, public and private
+	GroupShorten = "shorten"
+	// GroupAPI covers every authenticated API request
+	GroupAPI = "api"
+	// GroupUnlock covers password attempts on protected links
+	GroupUnlock = "unlock"
+)
+
+// DefaultPolicies are used when no policy file is configured: five links a
+// minute for guests and ten a minute for users, and ten password attempts
+// per client and thirty per link every fifteen minutes, as sliding windows
+func DefaultPolicies() Policies {
+	return Policies{
+		GroupShorten: {
+			Guest: &Policy{Algorithm: SlidingWindow, Limit: 5, Window: time.Minute, Scope: ScopeIP},
+			User:  &Policy{Algorithm: SlidingWindow, Limit: 10, Window: time.Minute, Scope: ScopeUser},
+		},
+		GroupUnlock: {
+			Guest: &Policy{Algorithm: SlidingWindow, Limit: 10, Window: 15 * time.Minute, Scope: ScopeIP},
+			Link:  &Policy{Algorithm: SlidingWindow, Limit: 30, Window: 15 * time.Minute, Scope: ScopeLink},
+		},
+	}
+}
+
+// For returns the policy of group for a guest (userID "") or a user on plan.
+// It returns nil when the group does not limit such requests.
+func (p Policies) For(group, userID, plan string) *Policy {
+	g, ok := p[group]
+	if !ok {
+		return nil
+	}
+	if userID == "" {
+		return g.Guest
+	}
+	if policy, ok := g.Plans[plan]; ok && plan != "" {
+		return policy
+	}
+	return g.User
+}
+
+// HasPlans reports whether group overrides the user policy for some plan
+func (p Policies) HasPlans(group string) bool {
+	return len(p[group].Plans) > 0
+}
+
+// Validate checks every policy and fills in default scopes
+func (p Policies) Validate() error {
+	for group, g := range p {
+		if g.Guest != nil {
+			if g.Guest.Scope == "" {
+				g.Guest.Scope = ScopeIP
+			}
+			if g.Guest.Scope != ScopeIP {
+				return fmt.Errorf("rate limit %s.guest: scope must be %s", group, ScopeIP)
+			}
+			if err := g.Guest.validate(); err != nil {
+				return fmt.Errorf("rate limit %s.guest: %v", group, err)
+			}
+		}
+
+		users := map[string]*Policy{"user": g.User}
+		for plan, policy := range g.Plans {
+			users["plans."+plan] = policy
+		}
+		for name, policy := range users {
+			if policy == nil {
+				continue
+			}
+			if policy.Scope == "" {
+				policy.Scope = ScopeUser
+			}
+			if policy.Scope == ScopeLink {
+				return fmt.Errorf("rate limit %s.%s: scope must be %s or %s", group, name, ScopeIP, ScopeUser)
+			}
+			if err := policy.validate(); err != nil {
+				return fmt.Errorf("rate limit %s.%s: %v", group, name, err)
+			}
+		}
+
+		if g.Link != nil {
+			if g.Link.Scope == "" {
+				g.Link.Scope = ScopeLink
+			}
+			if g.Link.Scope != ScopeLink {
+				return fmt.Errorf("rate limit %s.link: scope must be %s", group, ScopeLink)
+			}
+			if err := g.Link.validate(); err != nil {
+				return fmt.Errorf("rate limit %s.link: %v", group, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadPolicies reads policies by route group from a JSON file such as
+//
+//	{"shorten": {"guest": {...}, "user": {...}, "plans": {"pro": {...}}}}
+//
+// An empty path returns DefaultPolicies.
+func LoadPolicies(path string) (Policies, error) {
+	if path == "" {
+		return DefaultPolicies(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit policies: %v", err)
+	}
+
+	var policies Policies
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limit policies: %v", err)
+	}
+	if err := policies.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// Result is the outcome of a request against a policy
+type Result struct {
+	Allowed bool
+	// Limit is the policy's capacity and Remaining what is left of it
+	Limit     int
+	Remaining int
+	// Reset is how long until the full capacity is available again
+	Reset time.Duration
+	// RetryAfter is how long a rejected client should wait
+	RetryAfter time.Duration
+	// Skipped is set when the request was admitted without being counted
+	Skipped bool
+}
+
+// Limiter counts a request by key against a policy
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (*Result, error)
+}
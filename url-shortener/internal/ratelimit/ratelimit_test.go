@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter(t *testing.T) (*RedisLimiter, *time.Time) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRedisLimiter(client)
+	limiter.now = func() time.Time { return now }
+
+	return limiter, &now
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter(t)
+	policy := Policy{Algorithm: SlidingWindow, Limit: 3, Window: time.Minute, Scope: ScopeIP}
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+		*now = now.Add(10 * time.Second)
+	}
+
+	// The first request is still within the window
+	result, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+
+	// Another client has its own window
+	result, err = limiter.Allow(ctx, "ip:5.6.7.8", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Once the first request leaves the window one more is admitted
+	*now = now.Add(30 * time.Second)
+	result, err = limiter.Allow(ctx, "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 10*time.Second, result.Reset)
+}
+
+func TestSlidingWindowHasNoBoundaryBurst(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter(t)
+	policy := Policy{Algorithm: SlidingWindow, Limit: 5, Window: time.Minute, Scope: ScopeIP}
+
+	// A fixed per-minute counter would admit a full minute's worth on each
+	// side of the boundary
+	*now = time.Date(2026, 1, 1, 12, 0, 59, 0, time.UTC)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			*now = now.Add(2 * time.Second)
+		}
+		result, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		require.NoError(t, err)
+		if result.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed)
+}
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter(t)
+	policy := Policy{Algorithm: TokenBucket, Limit: 60, Window: time.Minute, Burst: 3, Scope: ScopeUser}
+
+	// The burst is admitted at once
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "user:abc", policy)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, err := limiter.Allow(ctx, "user:abc", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// One token a second comes back
+	*now = now.Add(1500 * time.Millisecond)
+	result, err = limiter.Allow(ctx, "user:abc", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = limiter.Allow(ctx, "user:abc", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	// The bucket never holds more than the burst
+	*now = now.Add(time.Hour)
+	result, err = limiter.Allow(ctx, "user:abc", policy)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestPoliciesFor(t *testing.T) {
+	guest := &Policy{Algorithm: SlidingWindow, Limit: 5, Window: time.Minute, Scope: ScopeIP}
+	user := &Policy{Algorithm: TokenBucket, Limit: 10, Window: time.Minute, Scope: ScopeUser}
+	pro := &Policy{Algorithm: TokenBucket, Limit: 100, Window: time.Minute, Scope: ScopeUser}
+	policies := Policies{"shorten": {Guest: guest, User: user, Plans: map[string]*Policy{"pro": pro}}}
+
+	assert.Same(t, guest, policies.For("shorten", "", ""))
+	assert.Same(t, user, policies.For("shorten", "abc", ""))
+	assert.Same(t, user, policies.For("shorten", "abc", "free"))
+	assert.Same(t, pro, policies.For("shorten", "abc", "pro"))
+	assert.Nil(t, policies.For("api", "abc", "pro"))
+}
+
+func TestLoadPolicies(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "policies.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	policies, err := LoadPolicies("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPolicies(), policies)
+
+	policies, err = LoadPolicies(write(`{
+		"shorten": {
+			"guest": {"algorithm": "sliding_window", "limit": 5, "window": "1m"},
+			"user": {"algorithm": "token_bucket", "limit": 10, "window": "1m", "burst": 20},
+			"plans": {"pro": {"algorithm": "token_bucket", "limit": 100, "window": "1m", "scope": "ip"}}
+		},
+		"api": {"user": {"algorithm": "sliding_window", "limit": 600, "window": "1m"}},
+		"unlock": {"link": {"algorithm": "sliding_window", "limit": 30, "window": "15m"}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Algorithm: SlidingWindow, Limit: 5, Window: time.Minute, Scope: ScopeIP}, policies["shorten"].Guest)
+	assert.Equal(t, &Policy{Algorithm: TokenBucket, Limit: 10, Window: time.Minute, Burst: 20, Scope: ScopeUser}, policies["shorten"].User)
+	assert.Equal(t, ScopeIP, policies["shorten"].Plans["pro"].Scope)
+	assert.Nil(t, policies["api"].Guest)
+	assert.Equal(t, &Policy{Algorithm: SlidingWindow, Limit: 30, Window: 15 * time.Minute, Scope: ScopeLink}, policies["unlock"].Link)
+
+	_, err = LoadPolicies(write(`{"shorten": {"guest": {"algorithm": "sliding_window", "limit": 5, "window": "1m", "scope": "user"}}}`))
+	assert.EqualError(t, err, "rate limit shorten.guest: scope must be ip")
+
+	_, err = LoadPolicies(write(`{"unlock": {"link": {"algorithm": "sliding_window", "limit": 5, "window": "1m", "scope": "ip"}}}`))
+	assert.EqualError(t, err, "rate limit unlock.link: scope must be link")
+
+	_, err = LoadPolicies(write(`{"shorten": {"user": {"algorithm": "sliding_window", "limit": 5, "window": "1m", "scope": "link"}}}`))
+	assert.EqualError(t, err, "rate limit shorten.user: scope must be ip or user")
+
+	_, err = LoadPolicies(write(`{"shorten": {"user": {"algorithm": "leaky_bucket", "limit": 5, "window": "1m"}}}`))
+	assert.EqualError(t, err, "rate limit shorten.user: algorithm must be sliding_window or token_bucket")
+
+	_, err = LoadPolicies(write(`{"shorten": {"user": {"algorithm": "token_bucket", "limit": 5, "window": "soon"}}}`))
+	assert.ErrorContains(t, err, "failed to parse rate limit policies")
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces rate limit counters
+const keyPrefix = "ratelimit:"
+
+// slidingWindowScript keeps the times of the requests admitted in the last
+// window in a sorted set, admitting a request while there are fewer than
+// limit.
+//
+// KEYS[1] the sorted set
+// ARGV    now (ms), window (ms), limit, a unique member for this request
+// Returns allowed (0 or 1), remaining, reset (ms), retry after (ms)
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+	redis.call('PEXPIRE', KEYS[1], reset)
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+
+return {allowed, limit - count, reset, retry}
+`)
+
+// tokenBucketScript keeps a bucket's tokens and when they were counted in a
+// hash. The bucket holds up to capacity tokens and refills limit tokens
+// per window; a request takes one.
+//
+// KEYS[1] the hash
+// ARGV    now (ms), window (ms), limit, capacity
+// Returns allowed (0 or 1), remaining, reset (ms), retry after (ms)
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local capacity = tonumber(ARGV[4])
+local rate = limit / window
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+// RedisLimiter counts requests in Redis so every instance shares the limits.
+// Request times come from the instance clock.
+type RedisLimiter struct {
+	client redis.Scripter
+	now    func() time.Time
+}
+
+// NewRedisLimiter creates a limiter storing counters in client
+func NewRedisLimiter(client redis.Scripter) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Allow counts a request by key against policy. Counters of different
+// algorithms are kept apart, so a policy can change algorithm in place.
+func (l *RedisLimiter) Allow(ctx context.Context, key string, policy Policy) (*Result, error) {
+	now := l.now().UnixMilli()
+	window := policy.Window.Milliseconds()
+	redisKey := keyPrefix + string(policy.Algorithm) + ":" + key
+
+	var reply []int64
+	var err error
+	switch policy.Algorithm {
+	case SlidingWindow:
+		member := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+		reply, err = slidingWindowScript.Run(ctx, l.client, []string{redisKey}, now, window, policy.Limit, member).Int64Slice()
+	case TokenBucket:
+		reply, err = tokenBucketScript.Run(ctx, l.client, []string{redisKey}, now, window, policy.Limit, policy.Capacity()).Int64Slice()
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+
+	return &Result{
+		Allowed:    reply[0] == 1,
+		Limit:      policy.Capacity(),
+		Remaining:  int(max(reply[1], 0)),
+		Reset:      time.Duration(reply[2]) * time.Millisecond,
+		RetryAfter: time.Duration(reply[3]) * time.Millisecond,
+	}, nil
+}
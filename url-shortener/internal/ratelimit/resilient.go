@@ -0,0 +1,300 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// FailureMode decides what happens to requests while Redis is unhealthy
+type FailureMode string
+
+const (
+	// FailLocal counts requests in process, so limits apply per instance
+	FailLocal FailureMode = "local"
+	// FailOpen admits every request
+	FailOpen FailureMode = "open"
+	// FailClosed rejects every request with ErrUnavailable
+	FailClosed FailureMode = "closed"
+)
+
+// Circuit states reported in Stats
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ResilientConfig tunes a ResilientLimiter
+type ResilientConfig struct {
+	Mode FailureMode
+	// FailureThreshold is how many Redis errors in a row open the circuit
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before Redis is tried again
+	Cooldown time.Duration
+	// Timeout bounds each Redis call
+	Timeout time.Duration
+	// LocalKeys bounds the clients the in-process limiter tracks
+	LocalKeys int
+}
+
+// DefaultResilientConfig returns the settings used for zero fields
+func DefaultResilientConfig() ResilientConfig {
+	return ResilientConfig{
+		Mode:             FailLocal,
+		FailureThreshold: 5,
+		Cooldown:         10 * time.Second,
+		Timeout:          100 * time.Millisecond,
+		LocalKeys:        DefaultMemoryKeys,
+	}
+}
+
+// ErrUnavailable is returned in FailClosed mode while Redis is unhealthy
+type ErrUnavailable struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrUnavailable) Error() string {
+	return "Rate limiter unavailable"
+}
+
+// Stats are the counters of a ResilientLimiter
+type Stats struct {
+	// Circuit is closed while Redis is used, open while the fallback is and
+	// half_open while Redis is being tried again
+	Circuit  string `json:"circuit"`
+	Allowed  uint64 `json:"allowed"`
+	Rejected uint64 `json:"rejected"`
+	// RedisErrors counts failed Redis calls
+	RedisErrors uint64 `json:"redis_errors"`
+	// FallbackActivations counts how often the circuit opened
+	FallbackActivations uint64 `json:"fallback_activations"`
+	// FallbackRequests counts requests decided without Redis
+	FallbackRequests uint64 `json:"fallback_requests"`
+}
+
+// ResilientLimiter puts a circuit breaker in front of a Redis limiter. After
+// FailureThreshold errors in a row it stops calling Redis for Cooldown and
+// decides requests according to Mode; then a single request probes Redis
+// and closes the circuit again if it succeeds.
+type ResilientLimiter struct {
+	redis Limiter
+	local *MemoryLimiter
+	cfg   ResilientConfig
+	now   func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	allowed     atomic.Uint64
+	rejected    atomic.Uint64
+	redisErrors atomic.Uint64
+	activations atomic.Uint64
+	fallbacks   atomic.Uint64
+}
+
+// NewResilientLimiter wraps redis with a circuit breaker and a fallback
+func NewResilientLimiter(redis Limiter, cfg ResilientConfig) *ResilientLimiter {
+	defaults := DefaultResilientConfig()
+	if cfg.Mode == "" {
+		cfg.Mode = defaults.Mode
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaults.FailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaults.Cooldown
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+
+	l := &ResilientLimiter{
+		redis: redis,
+		local: NewMemoryLimiter(cfg.LocalKeys),
+		cfg:   cfg,
+		now:   time.Now,
+	}
+	l.registerMetrics()
+
+	return l
+}
+
+// ParseFailureMode checks that s names a FailureMode
+func ParseFailureMode(s string) (FailureMode, error) {
+	switch mode := FailureMode(s); mode {
+	case FailLocal, FailOpen, FailClosed:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("failure mode must be %s, %s or %s", FailLocal, FailOpen, FailClosed)
+	}
+}
+
+// Allow counts a request in Redis, or with the fallback while the circuit is open
+func (l *ResilientLimiter) Allow(ctx context.Context, key string, policy Policy) (*Result, error) {
+	if !l.acquire() {
+		return l.fallback(ctx, key, policy)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	result, err := l.redis.Allow(callCtx, key, policy)
+	cancel()
+
+	if err != nil {
+		// The client going away says nothing about Redis
+		if ctx.Err() != nil {
+			l.release()
+			return nil, ctx.Err()
+		}
+
+		l.redisErrors.Add(1)
+		l.failed()
+		return l.fallback(ctx, key, policy)
+	}
+
+	l.succeeded()
+	l.count(result)
+	return result, nil
+}
+
+// fallback decides a request without Redis
+func (l *ResilientLimiter) fallback(ctx context.Context, key string, policy Policy) (*Result, error) {
+	l.fallbacks.Add(1)
+
+	switch l.cfg.Mode {
+	case FailOpen:
+		l.allowed.Add(1)
+		return &Result{Allowed: true, Skipped: true}, nil
+	case FailClosed:
+		l.rejected.Add(1)
+		return nil, &ErrUnavailable{RetryAfter: l.retryAfter()}
+	default:
+		result, err := l.local.Allow(ctx, key, policy)
+		if err != nil {
+			return nil, err
+		}
+		l.count(result)
+		return result, nil
+	}
+}
+
+func (l *ResilientLimiter) count(result *Result) {
+	if result.Allowed {
+		l.allowed.Add(1)
+	} else {
+		l.rejected.Add(1)
+	}
+}
+
+// acquire reports whether Redis may be called: always while the circuit is
+// closed, never while it is open, and for one probe at a time once the
+// cooldown has passed
+func (l *ResilientLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.openUntil.IsZero() {
+		return true
+	}
+	if l.now().Before(l.openUntil) || l.probing {
+		return false
+	}
+
+	l.probing = true
+	return true
+}
+
+// release gives up a probe that did not reach a verdict
+func (l *ResilientLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.probing = false
+}
+
+func (l *ResilientLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failures = 0
+	l.openUntil = time.Time{}
+	l.probing = false
+}
+
+// failed opens the circuit once the threshold is reached or a probe fails
+func (l *ResilientLimiter) failed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failures++
+	wasClosed := l.openUntil.IsZero()
+	if !wasClosed || l.failures >= l.cfg.FailureThreshold {
+		l.openUntil = l.now().Add(l.cfg.Cooldown)
+		if wasClosed {
+			l.activations.Add(1)
+		}
+	}
+	l.probing = false
+}
+
+// retryAfter is how long until Redis is tried again
+func (l *ResilientLimiter) retryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return max(l.openUntil.Sub(l.now()), time.Second)
+}
+
+// Stats returns the current counters
+func (l *ResilientLimiter) Stats() Stats {
+	l.mu.Lock()
+	circuit := CircuitClosed
+	if !l.openUntil.IsZero() {
+		circuit = CircuitOpen
+		if !l.now().Before(l.openUntil) {
+			circuit = CircuitHalfOpen
+		}
+	}
+	l.mu.Unlock()
+
+	return Stats{
+		Circuit:             circuit,
+		Allowed:             l.allowed.Load(),
+		Rejected:            l.rejected.Load(),
+		RedisErrors:         l.redisErrors.Load(),
+		FallbackActivations: l.activations.Load(),
+		FallbackRequests:    l.fallbacks.Load(),
+	}
+}
+
+// registerMetrics exposes the counters through OpenTelemetry
+func (l *ResilientLimiter) registerMetrics() {
+	meter := otel.Meter("url-shortener/ratelimit")
+
+	allowed, _ := meter.Int64ObservableCounter("ratelimit.requests.allowed")
+	rejected, _ := meter.Int64ObservableCounter("ratelimit.requests.rejected")
+	redisErrors, _ := meter.Int64ObservableCounter("ratelimit.redis.errors")
+	activations, _ := meter.Int64ObservableCounter("ratelimit.fallback.activations")
+	fallbacks, _ := meter.Int64ObservableCounter("ratelimit.fallback.requests")
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := l.Stats()
+		o.ObserveInt64(allowed, int64(stats.Allowed))
+		o.ObserveInt64(rejected, int64(stats.Rejected))
+		o.ObserveInt64(redisErrors, int64(stats.RedisErrors))
+		o.ObserveInt64(activations, int64(stats.FallbackActivations))
+		o.ObserveInt64(fallbacks, int64(stats.FallbackRequests))
+		return nil
+	}, allowed, rejected, redisErrors, activations, fallbacks)
+	if err != nil {
+		log.Printf("Failed to register rate limit metrics: %v", err)
+	}
+}
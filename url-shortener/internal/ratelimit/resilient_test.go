@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResilientLimiter(t *testing.T, mode FailureMode) (*ResilientLimiter, *miniredis.Miniredis, *time.Time) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	redisLimiter := NewRedisLimiter(client)
+	redisLimiter.now = clock
+	limiter := NewResilientLimiter(redisLimiter, ResilientConfig{Mode: mode, FailureThreshold: 2, Cooldown: 10 * time.Second, Timeout: time.Second})
+	limiter.now = clock
+	limiter.local.now = clock
+
+	return limiter, mr, &now
+}
+
+func TestResilientLimiterFallsBackToLocalLimits(t *testing.T) {
+	ctx := context.Background()
+	limiter, mr, now := newTestResilientLimiter(t, FailLocal)
+	policy := Policy{Algorithm: SlidingWindow, Limit: 2, Window: time.Minute, Scope: ScopeIP}
+
+	result, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, CircuitClosed, limiter.Stats().Circuit)
+
+	// Redis goes down: requests are still decided, by the local limiter
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	for i := 0; i < 2; i++ {
+		result, err = limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err = limiter.Allow(ctx, "ip:1.2.3.4", policy)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	stats := limiter.Stats()
+	assert.Equal(t, CircuitOpen, stats.Circuit)
+	assert.Equal(t, uint64(2), stats.RedisErrors)
+	assert.Equal(t, uint64(1), stats.FallbackActivations)
+	assert.Equal(t, uint64(3), stats.FallbackRequests)
+	assert.Equal(t, uint64(3), stats.Allowed)
+	assert.Equal(t, uint64(1), stats.Rejected)
+
+	// While the circuit is open Redis is left alone
+	mr.SetError("")
+	*now = now.Add(5 * time.Second)
+	_, err = limiter.Allow(ctx, "ip:5.6.7.8", policy)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), limiter.Stats().FallbackRequests)
+	assert.False(t, mr.Exists("ratelimit:sliding_window:ip:5.6.7.8"))
+
+	// After the cooldown a probe finds Redis back and closes the circuit
+	*now = now.Add(5 * time.Second)
+	assert.Equal(t, CircuitHalfOpen, limiter.Stats().Circuit)
+	result, err = limiter.Allow(ctx, "ip:5.6.7.8", policy)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.True(t, mr.Exists("ratelimit:sliding_window:ip:5.6.7.8"))
+	assert.Equal(t, CircuitClosed, limiter.Stats().Circuit)
+	assert.Equal(t, uint64(4), limiter.Stats().FallbackRequests)
+}
+
+func TestResilientLimiterFailedProbeReopens(t *testing.T) {
+	ctx := context.Background()
+	limiter, mr, now := newTestResilientLimiter(t, FailLocal)
+	policy := Policy{Algorithm: TokenBucket, Limit: 10, Window: time.Minute, Scope: ScopeUser}
+
+	mr.SetError("ERR down")
+	for i := 0; i < 2; i++ {
+		_, err := limiter.Allow(ctx, "user:abc", policy)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, CircuitOpen, limiter.Stats().Circuit)
+
+	*now = now.Add(10 * time.Second)
+	_, err := limiter.Allow(ctx, "user:abc", policy)
+	require.NoError(t, err)
+
+	stats := limiter.Stats()
+	assert.Equal(t, CircuitOpen, stats.Circuit)
+	assert.Equal(t, uint64(3), stats.RedisErrors)
+	assert.Equal(t, uint64(1), stats.FallbackActivations)
+}
+
+func TestResilientLimiterFailureModes(t *testing.T) {
+	ctx := context.Background()
+	policy := Policy{Algorithm: SlidingWindow, Limit: 1, Window: time.Minute, Scope: ScopeIP}
+
+	t.Run("Open", func(t *testing.T) {
+		limiter, mr, _ := newTestResilientLimiter(t, FailOpen)
+		mr.SetError("ERR down")
+
+		for i := 0; i < 5; i++ {
+			result, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+			assert.True(t, result.Skipped)
+		}
+		assert.Equal(t, uint64(5), limiter.Stats().Allowed)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		limiter, mr, now := newTestResilientLimiter(t, FailClosed)
+		mr.SetError("ERR down")
+
+		for i := 0; i < 2; i++ {
+			_, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+			assert.IsType(t, &ErrUnavailable{}, err)
+		}
+
+		*now = now.Add(4 * time.Second)
+		_, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		assert.Equal(t, &ErrUnavailable{RetryAfter: 6 * time.Second}, err)
+		assert.Equal(t, uint64(3), limiter.Stats().Rejected)
+	})
+}
+
+func TestResilientLimiterIgnoresCanceledRequests(t *testing.T) {
+	limiter, _, _ := newTestResilientLimiter(t, FailLocal)
+	policy := Policy{Algorithm: SlidingWindow, Limit: 1, Window: time.Minute, Scope: ScopeIP}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+
+	stats := limiter.Stats()
+	assert.Equal(t, CircuitClosed, stats.Circuit)
+	assert.Equal(t, uint64(0), stats.RedisErrors)
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewMemoryLimiter(2)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	window := Policy{Algorithm: SlidingWindow, Limit: 2, Window: time.Minute, Scope: ScopeIP}
+	bucket := Policy{Algorithm: TokenBucket, Limit: 60, Window: time.Minute, Burst: 1, Scope: ScopeUser}
+
+	for _, want := range []bool{true, true, false} {
+		result, err := limiter.Allow(ctx, "ip:1.2.3.4", window)
+		require.NoError(t, err)
+		assert.Equal(t, want, result.Allowed)
+	}
+
+	result, err := limiter.Allow(ctx, "user:abc", bucket)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = limiter.Allow(ctx, "user:abc", bucket)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	// A third client evicts one of the two tracked
+	_, err = limiter.Allow(ctx, "ip:5.6.7.8", window)
+	require.NoError(t, err)
+	assert.Len(t, limiter.entries, 2)
+
+	// Once the window has passed the client is admitted again
+	now = now.Add(time.Minute)
+	result, err = limiter.Allow(ctx, "ip:1.2.3.4", window)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
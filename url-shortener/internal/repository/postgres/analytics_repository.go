@@ -2,17 +2,19 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
 type analyticsRepository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
 // NewAnalyticsRepository creates a new PostgreSQL analytics repository
-func NewAnalyticsRepository(db *pgx.Conn) domain.AnalyticsRepository {
+func NewAnalyticsRepository(db *pgxpool.Pool) domain.AnalyticsRepository {
 	return &analyticsRepository{
 		db: db,
 	}
@@ -20,19 +22,39 @@ func NewAnalyticsRepository(db *pgx.Conn) domain.AnalyticsRepository {
 
 func (r *analyticsRepository) Create(ctx context.Context, analytics *domain.Analytics) error {
 	err := r.db.QueryRow(ctx,
-		`INSERT INTO analytics (url_id, visitor_ip, user_agent, referer, country_code, device_type)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		`INSERT INTO analytics (url_id, visitor_ip, user_agent, referer, country_code, device_type, timestamp, browser, os, is_bot, region, city)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, CURRENT_TIMESTAMP), $8, $9, $10, $11, $12)
 		RETURNING id, timestamp`,
 		analytics.URLID, analytics.VisitorIP, analytics.UserAgent, analytics.Referer,
-		analytics.CountryCode, analytics.DeviceType,
+		nullString(analytics.CountryCode), analytics.DeviceType, nullTime(analytics.Timestamp),
+		nullString(analytics.Browser), nullString(analytics.OS), analytics.IsBot,
+		nullString(analytics.Region), nullString(analytics.City),
 	).Scan(&analytics.ID, &analytics.Timestamp)
 
 	return err
 }
 
+func (r *analyticsRepository) CreateBatch(ctx context.Context, visits []domain.Analytics) error {
+	_, err := r.db.CopyFrom(ctx,
+		pgx.Identifier{"analytics"},
+		[]string{"url_id", "visitor_ip", "user_agent", "referer", "timestamp", "country_code", "device_type", "browser", "os", "is_bot", "region", "city"},
+		pgx.CopyFromSlice(len(visits), func(i int) ([]any, error) {
+			v := visits[i]
+			return []any{
+				v.URLID, nullString(v.VisitorIP), nullString(v.UserAgent), nullString(v.Referer),
+				nullTime(v.Timestamp), nullString(v.CountryCode), nullString(v.DeviceType),
+				nullString(v.Browser), nullString(v.OS), v.IsBot, nullString(v.Region), nullString(v.City),
+			}, nil
+		}),
+	)
+	return err
+}
+
 func (r *analyticsRepository) GetByURLID(ctx context.Context, urlID int64) ([]domain.Analytics, error) {
 	rows, err := r.db.Query(ctx,
-		`SELECT id, url_id, visitor_ip, user_agent, referer, timestamp, country_code, device_type
+		`SELECT id, url_id, COALESCE(visitor_ip, ''), COALESCE(user_agent, ''), COALESCE(referer, ''), timestamp,
+			COALESCE(country_code, ''), COALESCE(device_type, ''), COALESCE(browser, ''), COALESCE(os, ''), is_bot,
+			COALESCE(region, ''), COALESCE(city, '')
 		FROM analytics WHERE url_id = $1 ORDER BY timestamp DESC`,
 		urlID,
 	)
@@ -46,7 +68,8 @@ func (r *analyticsRepository) GetByURLID(ctx context.Context, urlID int64) ([]do
 		var a domain.Analytics
 		err := rows.Scan(
 			&a.ID, &a.URLID, &a.VisitorIP, &a.UserAgent, &a.Referer,
-			&a.Timestamp, &a.CountryCode, &a.DeviceType,
+			&a.Timestamp, &a.CountryCode, &a.DeviceType, &a.Browser, &a.OS, &a.IsBot,
+			&a.Region, &a.City,
 		)
 		if err != nil {
 			return nil, err
@@ -56,3 +79,19 @@ func (r *analyticsRepository) GetByURLID(ctx context.Context, urlID int64) ([]do
 
 	return analytics, nil
 }
+
+// nullTime maps the zero time to NULL so column defaults apply
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullString maps the empty string to NULL
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
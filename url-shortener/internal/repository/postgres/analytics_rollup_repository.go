@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/rollup"
+)
+
+// rollupSettleDelay is how long a visit must have been written before it is
+// rolled up. Ingest batches are bounded by their write timeout, so after this
+// long no batch holding lower IDs can still be uncommitted.
+const rollupSettleDelay = time.Minute
+
+// rollupState names the analytics_rollup_state row of the hourly rollup
+const rollupState = "hourly"
+
+// rollupLockKey is the advisory lock held while aggregating, so only one
+// instance aggregates at a time
+const rollupLockKey int64 = 0x736e61785f726f6c
+
+type analyticsRollupRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAnalyticsRollupRepository creates a new PostgreSQL analytics rollup repository
+func NewAnalyticsRollupRepository(db *pgxpool.Pool) domain.AnalyticsRollupRepository {
+	return &analyticsRollupRepository{
+		db: db,
+	}
+}
+
+func (r *analyticsRollupRepository) AggregateVisits(ctx context.Context, limit int) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, rollupLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		// Another instance is aggregating
+		return 0, nil
+	}
+
+	var lastID int64
+	err = tx.QueryRow(ctx,
+		`SELECT last_id FROM analytics_rollup_state WHERE name = $1`,
+		rollupState,
+	).Scan(&lastID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Stop before the first visit that has not settled yet so none is skipped
+	rows, err := tx.Query(ctx,
+		`SELECT id, COALESCE(url_id, 0), COALESCE(timestamp, ingested_at), COALESCE(visitor_ip, ''), COALESCE(user_agent, ''),
+			COALESCE(referer, ''), COALESCE(country_code, ''), COALESCE(device_type, ''), COALESCE(browser, ''), is_bot
+		FROM analytics
+		WHERE id > $1 AND id < COALESCE(
+			(SELECT MIN(id) FROM analytics WHERE id > $1 AND ingested_at >= NOW() - $2 * INTERVAL '1 second'),
+			9223372036854775807)
+		ORDER BY id
+		LIMIT $3`,
+		lastID, rollupSettleDelay.Seconds(), limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var visits []domain.Analytics
+	processed := 0
+	for rows.Next() {
+		var v domain.Analytics
+		err := rows.Scan(&v.ID, &v.URLID, &v.Timestamp, &v.VisitorIP, &v.UserAgent,
+			&v.Referer, &v.CountryCode, &v.DeviceType, &v.Browser, &v.IsBot)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		processed++
+		lastID = v.ID
+		if v.URLID != 0 {
+			visits = append(visits, v)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if processed == 0 {
+		return 0, nil
+	}
+
+	existing, err := r.rollupsForVisits(ctx, tx, visits)
+	if err != nil {
+		return 0, err
+	}
+
+	changed, err := rollup.Fold(existing, visits)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(changed) > 0 {
+		urlIDs := make([]int64, len(changed))
+		buckets := make([]time.Time, len(changed))
+		dimensions := make([]string, len(changed))
+		values := make([]string, len(changed))
+		clicks := make([]int64, len(changed))
+		visitors := make([][]byte, len(changed))
+		for i, c := range changed {
+			urlIDs[i], buckets[i], dimensions[i], values[i], clicks[i], visitors[i] =
+				c.URLID, c.Bucket, c.Dimension, c.Value, c.Clicks, c.Visitors
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO analytics_rollup_hourly (url_id, bucket, dimension, value, clicks, visitors)
+			SELECT * FROM unnest($1::bigint[], $2::timestamptz[], $3::text[], $4::text[], $5::bigint[], $6::bytea[])
+			ON CONFLICT (url_id, dimension, bucket, value)
+			DO UPDATE SET clicks = EXCLUDED.clicks, visitors = EXCLUDED.visitors`,
+			urlIDs, buckets, dimensions, values, clicks, visitors,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE analytics_rollup_state SET last_id = $2, updated_at = NOW() WHERE name = $1`,
+		rollupState, lastID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return processed, tx.Commit(ctx)
+}
+
+// rollupsForVisits loads the existing rollups of every URL and hour in visits
+func (r *analyticsRollupRepository) rollupsForVisits(ctx context.Context, tx pgx.Tx, visits []domain.Analytics) ([]domain.AnalyticsRollup, error) {
+	type urlHour struct {
+		urlID  int64
+		bucket time.Time
+	}
+
+	seen := make(map[urlHour]struct{})
+	var urlIDs []int64
+	var buckets []time.Time
+	for _, v := range visits {
+		key := urlHour{v.URLID, v.Timestamp.UTC().Truncate(time.Hour)}
+		if _, ok := seen[key]; ok || v.IsBot {
+			continue
+		}
+		seen[key] = struct{}{}
+		urlIDs = append(urlIDs, key.urlID)
+		buckets = append(buckets, key.bucket)
+	}
+	if len(urlIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT url_id, bucket, dimension, value, clicks, visitors
+		FROM analytics_rollup_hourly
+		WHERE (url_id, bucket) IN (SELECT * FROM unnest($1::bigint[], $2::timestamptz[]))`,
+		urlIDs, buckets,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRollups(rows)
+}
+
+func (r *analyticsRollupRepository) GetRollups(ctx context.Context, urlID int64, from, to time.Time, dimensions []string) ([]domain.AnalyticsRollup, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT url_id, bucket, dimension, value, clicks, visitors
+		FROM analytics_rollup_hourly
+		WHERE url_id = $1 AND dimension = ANY($2) AND bucket >= $3 AND bucket < $4`,
+		urlID, append([]string{domain.DimensionTotal}, dimensions...), from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRollups(rows)
+}
+
+func scanRollups(rows pgx.Rows) ([]domain.AnalyticsRollup, error) {
+	defer rows.Close()
+
+	var rollups []domain.AnalyticsRollup
+	for rows.Next() {
+		var r domain.AnalyticsRollup
+		if err := rows.Scan(&r.URLID, &r.Bucket, &r.Dimension, &r.Value, &r.Clicks, &r.Visitors); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+
+	return rollups, rows.Err()
+}
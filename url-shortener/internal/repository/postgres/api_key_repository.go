@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// apiKeyColumns lists the columns scanned by scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+type apiKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates a new PostgreSQL API key repository
+func NewAPIKeyRepository(db *pgxpool.Pool) internalDomain.APIKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+func scanAPIKey(row pgx.Row, k *internalDomain.APIKey) error {
+	return row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &k.Scopes,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *internalDomain.APIKey) error {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return r.db.QueryRow(ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, scopes, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *apiKeyRepository) GetByID(ctx context.Context, id int64) (*internalDomain.APIKey, error) {
+	return r.getOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id, id)
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*internalDomain.APIKey, error) {
+	return r.getOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, 0, keyHash)
+}
+
+func (r *apiKeyRepository) getOne(ctx context.Context, query string, id int64, arg any) (*internalDomain.APIKey, error) {
+	k := &internalDomain.APIKey{}
+	err := scanAPIKey(r.db.QueryRow(ctx, query, arg), k)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrAPIKeyNotFound{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (r *apiKeyRepository) GetByUserID(ctx context.Context, userID string) ([]internalDomain.APIKey, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE user_id = $1
+		ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []internalDomain.APIKey{}
+	for rows.Next() {
+		var k internalDomain.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) UpdateName(ctx context.Context, id int64, name string) error {
+	result, err := r.db.Exec(ctx, `UPDATE api_keys SET name = $2 WHERE id = $1`, id, name)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return &internalDomain.ErrAPIKeyNotFound{ID: id}
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id int64, t time.Time) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`,
+		id, t,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return &internalDomain.ErrAPIKeyNotFound{ID: id}
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) TouchLastUsed(ctx context.Context, id int64, t time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET last_used_at = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`,
+		id, t,
+	)
+	return err
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+type certificateRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewCertificateRepository creates a new PostgreSQL certificate repository
+func NewCertificateRepository(db *pgxpool.Pool) domain.CertificateRepository {
+	return &certificateRepository{
+		db: db,
+	}
+}
+
+func (r *certificateRepository) GetCertificate(ctx context.Context, domainName string) (*domain.Certificate, error) {
+	cert := &domain.Certificate{}
+	err := r.db.QueryRow(ctx,
+		`SELECT domain, cert_pem, key_pem, not_after, updated_at
+		FROM tls_certificates
+		WHERE domain = $1 AND cert_pem IS NOT NULL`,
+		domainName,
+	).Scan(&cert.Domain, &cert.CertPEM, &cert.KeyPEM, &cert.NotAfter, &cert.UpdatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrCertificateNotFound{Domain: domainName}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func (r *certificateRepository) SaveCertificate(ctx context.Context, cert *domain.Certificate) error {
+	return r.db.QueryRow(ctx,
+		`INSERT INTO tls_certificates (domain, cert_pem, key_pem, not_after, claimed_until, last_error, updated_at)
+		VALUES ($1, $2, $3, $4, NULL, NULL, NOW())
+		ON CONFLICT (domain) DO UPDATE
+		SET cert_pem = EXCLUDED.cert_pem, key_pem = EXCLUDED.key_pem, not_after = EXCLUDED.not_after,
+			claimed_until = NULL, last_error = NULL, updated_at = NOW()
+		RETURNING updated_at`,
+		cert.Domain, cert.CertPEM, cert.KeyPEM, cert.NotAfter,
+	).Scan(&cert.UpdatedAt)
+}
+
+func (r *certificateRepository) ListDomainsNeedingCertificates(ctx context.Context, t time.Time, limit int) ([]string, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT d.domain
+		FROM custom_domains d
+		LEFT JOIN tls_certificates c ON c.domain = d.domain
+		WHERE d.verified
+			AND (c.not_after IS NULL OR c.not_after < $1)
+			AND (c.claimed_until IS NULL OR c.claimed_until < NOW())
+		ORDER BY c.not_after NULLS FIRST
+		LIMIT $2`,
+		t, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+func (r *certificateRepository) ClaimCertificate(ctx context.Context, domainName string, until time.Time) (bool, error) {
+	result, err := r.db.Exec(ctx,
+		`INSERT INTO tls_certificates (domain, claimed_until)
+		VALUES ($1, $2)
+		ON CONFLICT (domain) DO UPDATE
+		SET claimed_until = EXCLUDED.claimed_until, updated_at = NOW()
+		WHERE tls_certificates.claimed_until IS NULL OR tls_certificates.claimed_until < NOW()`,
+		domainName, until,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *certificateRepository) RecordCertificateError(ctx context.Context, domainName string, reason string, retryAt time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE tls_certificates
+		SET claimed_until = $2, last_error = $3, updated_at = NOW()
+		WHERE domain = $1`,
+		domainName, retryAt, reason,
+	)
+	return err
+}
+
+func (r *certificateRepository) EnsureAccountKey(ctx context.Context, directoryURL string, keyPEM []byte) ([]byte, error) {
+	// The no-op update makes RETURNING yield the row another instance stored first
+	var stored []byte
+	err := r.db.QueryRow(ctx,
+		`INSERT INTO acme_accounts (directory_url, key_pem)
+		VALUES ($1, $2)
+		ON CONFLICT (directory_url) DO UPDATE SET directory_url = EXCLUDED.directory_url
+		RETURNING key_pem`,
+		directoryURL, keyPEM,
+	).Scan(&stored)
+
+	return stored, err
+}
+
+func (r *certificateRepository) PutChallenge(ctx context.Context, token string, keyAuthorization string) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO acme_challenges (token, key_authorization)
+		VALUES ($1, $2)
+		ON CONFLICT (token) DO UPDATE SET key_authorization = EXCLUDED.key_authorization`,
+		token, keyAuthorization,
+	)
+	return err
+}
+
+func (r *certificateRepository) GetChallenge(ctx context.Context, token string) (string, error) {
+	var keyAuthorization string
+	err := r.db.QueryRow(ctx,
+		`SELECT key_authorization FROM acme_challenges WHERE token = $1`,
+		token,
+	).Scan(&keyAuthorization)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", &domain.ErrChallengeNotFound{Token: token}
+	}
+
+	return keyAuthorization, err
+}
+
+func (r *certificateRepository) DeleteChallenge(ctx context.Context, token string) error {
+	_, err := r.db.Exec(ctx,
+		`DELETE FROM acme_challenges WHERE token = $1`,
+		token,
+	)
+	return err
+}
@@ -2,41 +2,84 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
+// customDomainColumns lists the columns scanned by scanCustomDomain
+const customDomainColumns = `id, domain, user_id, workspace_id, COALESCE(verified, false), verification_token,
+	verified_at, last_checked_at, COALESCE(verification_error, ''), COALESCE(root_url, ''),
+	COALESCE(not_found_url, ''), created_at`
+
 type customDomainRepository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
 // NewCustomDomainRepository creates a new PostgreSQL custom domain repository
-func NewCustomDomainRepository(db *pgx.Conn) internalDomain.CustomDomainRepository {
+func NewCustomDomainRepository(db *pgxpool.Pool) internalDomain.CustomDomainRepository {
 	return &customDomainRepository{
 		db: db,
 	}
 }
 
-func (r *customDomainRepository) Create(ctx context.Context, domain *internalDomain.CustomDomain) error {
-	err := r.db.QueryRow(ctx,
-		`INSERT INTO custom_domains (domain, user_id, verified)
-		VALUES ($1, $2, $3)
+func scanCustomDomain(row pgx.Row, d *internalDomain.CustomDomain) error {
+	return row.Scan(&d.ID, &d.Domain, &d.UserID, &d.WorkspaceID, &d.Verified, &d.VerificationToken,
+		&d.VerifiedAt, &d.LastCheckedAt, &d.VerificationError, &d.RootURL, &d.NotFoundURL, &d.CreatedAt)
+}
+
+func (r *customDomainRepository) Create(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if quota.Limit != internalDomain.Unlimited {
+		if err := lockWorkspaceQuotas(ctx, tx, domain.WorkspaceID); err != nil {
+			return err
+		}
+
+		var held int
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM custom_domains WHERE workspace_id = $1 AND verified`,
+			domain.WorkspaceID,
+		).Scan(&held)
+		if err != nil {
+			return err
+		}
+		if held >= quota.Limit {
+			return quota.Exceeded()
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO custom_domains (domain, user_id, workspace_id, verified, verification_token)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at`,
-		domain.Domain, domain.UserID, domain.Verified,
+		domain.Domain, domain.UserID, domain.WorkspaceID, domain.Verified, domain.VerificationToken,
 	).Scan(&domain.ID, &domain.CreatedAt)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit(ctx)
 }
 
 func (r *customDomainRepository) GetByID(ctx context.Context, id int64) (*internalDomain.CustomDomain, error) {
 	d := &internalDomain.CustomDomain{}
-	err := r.db.QueryRow(ctx,
-		`SELECT id, domain, user_id, verified, created_at
+	err := scanCustomDomain(r.db.QueryRow(ctx,
+		`SELECT `+customDomainColumns+`
 		FROM custom_domains WHERE id = $1`,
 		id,
-	).Scan(&d.ID, &d.Domain, &d.UserID, &d.Verified, &d.CreatedAt)
+	), d)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrDomainNotFound{Domain: ""}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -46,12 +89,15 @@ func (r *customDomainRepository) GetByID(ctx context.Context, id int64) (*intern
 
 func (r *customDomainRepository) GetByDomain(ctx context.Context, domain string) (*internalDomain.CustomDomain, error) {
 	d := &internalDomain.CustomDomain{}
-	err := r.db.QueryRow(ctx,
-		`SELECT id, domain, user_id, verified, created_at
+	err := scanCustomDomain(r.db.QueryRow(ctx,
+		`SELECT `+customDomainColumns+`
 		FROM custom_domains WHERE domain = $1`,
 		domain,
-	).Scan(&d.ID, &d.Domain, &d.UserID, &d.Verified, &d.CreatedAt)
+	), d)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrDomainNotFound{Domain: domain}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -59,52 +105,120 @@ func (r *customDomainRepository) GetByDomain(ctx context.Context, domain string)
 	return d, nil
 }
 
-func (r *customDomainRepository) GetByUserID(ctx context.Context, userID string) ([]internalDomain.CustomDomain, error) {
+func (r *customDomainRepository) GetByWorkspaceID(ctx context.Context, workspaceID int64) ([]internalDomain.CustomDomain, error) {
 	rows, err := r.db.Query(ctx,
-		`SELECT id, domain, user_id, verified, created_at
-		FROM custom_domains WHERE user_id = $1
+		`SELECT `+customDomainColumns+`
+		FROM custom_domains WHERE workspace_id = $1
 		ORDER BY created_at DESC`,
-		userID,
+		workspaceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCustomDomains(rows)
+}
+
+func (r *customDomainRepository) ListVerifiedCheckedBefore(ctx context.Context, t time.Time, limit int) ([]internalDomain.CustomDomain, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+customDomainColumns+`
+		FROM custom_domains
+		WHERE verified AND (last_checked_at IS NULL OR last_checked_at < $1)
+		ORDER BY last_checked_at NULLS FIRST
+		LIMIT $2`,
+		t, limit,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	return scanCustomDomains(rows)
+}
+
+func scanCustomDomains(rows pgx.Rows) ([]internalDomain.CustomDomain, error) {
 	defer rows.Close()
 
 	var domains []internalDomain.CustomDomain
 	for rows.Next() {
 		var d internalDomain.CustomDomain
-		err := rows.Scan(&d.ID, &d.Domain, &d.UserID, &d.Verified, &d.CreatedAt)
-		if err != nil {
+		if err := scanCustomDomain(rows, &d); err != nil {
 			return nil, err
 		}
 		domains = append(domains, d)
 	}
 
-	return domains, nil
+	return domains, rows.Err()
+}
+
+func (r *customDomainRepository) UpdateVerification(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Only verified domains count against the quota
+	if domain.Verified && quota.Limit != internalDomain.Unlimited {
+		if err := lockWorkspaceQuotas(ctx, tx, domain.WorkspaceID); err != nil {
+			return err
+		}
+
+		var held int
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM custom_domains WHERE workspace_id = $1 AND verified AND id <> $2`,
+			domain.WorkspaceID, domain.ID,
+		).Scan(&held)
+		if err != nil {
+			return err
+		}
+		if held >= quota.Limit {
+			return quota.Exceeded()
+		}
+	}
+
+	result, err := tx.Exec(ctx,
+		`UPDATE custom_domains
+		SET verified = $2, verified_at = $3, last_checked_at = $4, verification_error = NULLIF($5, '')
+		WHERE id = $1`,
+		domain.ID, domain.Verified, domain.VerifiedAt, domain.LastCheckedAt, domain.VerificationError,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return &internalDomain.ErrDomainNotFound{Domain: domain.Domain}
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *customDomainRepository) VerifyDomain(ctx context.Context, id int64) error {
+func (r *customDomainRepository) UpdateSettings(ctx context.Context, domain *internalDomain.CustomDomain) error {
 	result, err := r.db.Exec(ctx,
-		`UPDATE custom_domains SET verified = true WHERE id = $2`,
-		id,
+		`UPDATE custom_domains
+		SET root_url = NULLIF($2, ''), not_found_url = NULLIF($3, '')
+		WHERE id = $1`,
+		domain.ID, domain.RootURL, domain.NotFoundURL,
 	)
 	if err != nil {
 		return err
 	}
 
 	if result.RowsAffected() == 0 {
-		return &internalDomain.ErrDomainNotFound{Domain: ""}
+		return &internalDomain.ErrDomainNotFound{Domain: domain.Domain}
 	}
 
 	return nil
 }
 
-func (r *customDomainRepository) Delete(ctx context.Context, id int64, userID string) error {
+func (r *customDomainRepository) Delete(ctx context.Context, id int64) error {
 	result, err := r.db.Exec(ctx,
-		`DELETE FROM custom_domains WHERE id = $1 AND user_id = $2`,
-		id, userID,
+		`DELETE FROM custom_domains WHERE id = $1`,
+		id,
 	)
+	if isForeignKeyViolation(err) {
+		return &internalDomain.ErrDomainInUse{Domain: ""}
+	}
 	if err != nil {
 		return err
 	}
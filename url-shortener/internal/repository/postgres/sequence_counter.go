@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Sequences used as short code counters
+const (
+	// URLIDSequence backs urls.id, so its values can be used as row IDs
+	URLIDSequence = "urls_id_seq"
+	// ShortCodeSequence is a standalone sequence for counter-based short codes
+	ShortCodeSequence = "short_code_seq"
+)
+
+type sequenceCounter struct {
+	db       *pgxpool.Pool
+	sequence string
+}
+
+// NewSequenceCounter creates a counter backed by a PostgreSQL sequence
+func NewSequenceCounter(db *pgxpool.Pool, sequence string) domain.Counter {
+	return &sequenceCounter{
+		db:       db,
+		sequence: sequence,
+	}
+}
+
+func (c *sequenceCounter) Next(ctx context.Context) (int64, error) {
+	var n int64
+	err := c.db.QueryRow(ctx, `SELECT nextval($1::regclass)`, c.sequence).Scan(&n)
+	return n, err
+}
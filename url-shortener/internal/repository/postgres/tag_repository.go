@@ -2,38 +2,98 @@ package postgres
 
 import (
 	"context"
+	"errors"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
 type tagRepository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
 // NewTagRepository creates a new PostgreSQL tag repository
-func NewTagRepository(db *pgx.Conn) domain.TagRepository {
+func NewTagRepository(db *pgxpool.Pool) domain.TagRepository {
 	return &tagRepository{
 		db: db,
 	}
 }
 
-func (r *tagRepository) Create(tag *domain.Tag) error {
-	err := r.db.QueryRow(context.Background(),
-		`INSERT INTO tags (name) VALUES ($1) RETURNING id`,
-		tag.Name,
-	).Scan(&tag.ID)
+// tagColumns lists the columns scanned by scanTag, in order
+const tagColumns = `tags.id, tags.workspace_id, tags.name, COALESCE(tags.color, ''), COALESCE(tags.description, ''), tags.created_at`
 
-	return err
+func scanTag(row pgx.Row, tag *domain.Tag, extra ...any) error {
+	dest := append([]any{&tag.ID, &tag.WorkspaceID, &tag.Name, &tag.Color, &tag.Description, &tag.CreatedAt}, extra...)
+	return row.Scan(dest...)
+}
+
+// checkTagQuota verifies the workspace has room for the tags among names
+// it does not hold yet; tags it holds can be used freely. It locks the
+// workspace until tx ends, so the tags are counted and created atomically.
+func checkTagQuota(ctx context.Context, tx pgx.Tx, workspaceID int64, names []string, quota domain.QuotaLimit) error {
+	if quota.Limit == domain.Unlimited || len(names) == 0 {
+		return nil
+	}
+	if err := lockWorkspaceQuotas(ctx, tx, workspaceID); err != nil {
+		return err
+	}
+
+	var held, missing int64
+	err := tx.QueryRow(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM tags WHERE workspace_id = $1),
+			(SELECT COUNT(DISTINCT n.name) FROM unnest($2::text[]) AS n(name)
+			WHERE NOT EXISTS (SELECT 1 FROM tags t WHERE t.workspace_id = $1 AND t.name = n.name))`,
+		workspaceID, names,
+	).Scan(&held, &missing)
+	if err != nil {
+		return err
+	}
+	if missing > 0 && held+missing > int64(quota.Limit) {
+		return quota.Exceeded()
+	}
+
+	return nil
 }
 
-func (r *tagRepository) GetByID(id int64) (*domain.Tag, error) {
+func (r *tagRepository) Create(ctx context.Context, tag *domain.Tag, quota domain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkTagQuota(ctx, tx, tag.WorkspaceID, []string{tag.Name}, quota); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO tags (workspace_id, name, color, description)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		RETURNING id, created_at`,
+		tag.WorkspaceID, tag.Name, tag.Color, tag.Description,
+	).Scan(&tag.ID, &tag.CreatedAt)
+	if isUniqueViolation(err) {
+		return &domain.ErrTagAlreadyExists{Name: tag.Name}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *tagRepository) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
 	tag := &domain.Tag{}
-	err := r.db.QueryRow(context.Background(),
-		`SELECT id, name FROM tags WHERE id = $1`,
+	err := scanTag(r.db.QueryRow(ctx,
+		`SELECT `+tagColumns+` FROM tags WHERE id = $1`,
 		id,
-	).Scan(&tag.ID, &tag.Name)
+	), tag)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrTagNotFound{}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -41,13 +101,16 @@ func (r *tagRepository) GetByID(id int64) (*domain.Tag, error) {
 	return tag, nil
 }
 
-func (r *tagRepository) GetByName(name string) (*domain.Tag, error) {
+func (r *tagRepository) GetByName(ctx context.Context, workspaceID int64, name string) (*domain.Tag, error) {
 	tag := &domain.Tag{}
-	err := r.db.QueryRow(context.Background(),
-		`SELECT id, name FROM tags WHERE name = $1`,
-		name,
-	).Scan(&tag.ID, &tag.Name)
+	err := scanTag(r.db.QueryRow(ctx,
+		`SELECT `+tagColumns+` FROM tags WHERE workspace_id = $1 AND name = $2`,
+		workspaceID, name,
+	), tag)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrTagNotFound{Name: name}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,11 +118,103 @@ func (r *tagRepository) GetByName(name string) (*domain.Tag, error) {
 	return tag, nil
 }
 
-func (r *tagRepository) GetByURLID(urlID int64) ([]domain.Tag, error) {
-	rows, err := r.db.Query(context.Background(),
-		`SELECT t.id, t.name FROM tags t
-		JOIN url_tags ut ON ut.tag_id = t.id
-		WHERE ut.url_id = $1`,
+func (r *tagRepository) ListByWorkspace(ctx context.Context, workspaceID int64) ([]domain.TagUsage, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+tagColumns+`, COUNT(urls.id)
+		FROM tags
+		LEFT JOIN url_tags ut ON ut.tag_id = tags.id
+		LEFT JOIN urls ON urls.id = ut.url_id AND urls.is_active
+		WHERE tags.workspace_id = $1
+		GROUP BY tags.id
+		ORDER BY tags.name`,
+		workspaceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []domain.TagUsage{}
+	for rows.Next() {
+		var tag domain.TagUsage
+		if err := scanTag(rows, &tag.Tag, &tag.URLCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (r *tagRepository) Update(ctx context.Context, tag *domain.Tag) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE tags
+		SET name = $2, color = NULLIF($3, ''), description = NULLIF($4, '')
+		WHERE id = $1`,
+		tag.ID, tag.Name, tag.Color, tag.Description,
+	)
+	if isUniqueViolation(err) {
+		return &domain.ErrTagAlreadyExists{Name: tag.Name}
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return &domain.ErrTagNotFound{Name: tag.Name}
+	}
+
+	return nil
+}
+
+func (r *tagRepository) Merge(ctx context.Context, sourceID, targetID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Links carrying both tags keep a single one
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO url_tags (url_id, tag_id)
+		SELECT url_id, $2 FROM url_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`,
+		sourceID, targetID,
+	); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, sourceID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return &domain.ErrTagNotFound{}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *tagRepository) Delete(ctx context.Context, id int64) error {
+	// url_tags rows go with the tag
+	result, err := r.db.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return &domain.ErrTagNotFound{}
+	}
+
+	return nil
+}
+
+func (r *tagRepository) GetByURLID(ctx context.Context, urlID int64) ([]domain.Tag, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+tagColumns+` FROM tags
+		JOIN url_tags ut ON ut.tag_id = tags.id
+		WHERE ut.url_id = $1
+		ORDER BY tags.name`,
 		urlID,
 	)
 	if err != nil {
@@ -70,18 +225,18 @@ func (r *tagRepository) GetByURLID(urlID int64) ([]domain.Tag, error) {
 	var tags []domain.Tag
 	for rows.Next() {
 		var tag domain.Tag
-		err := rows.Scan(&tag.ID, &tag.Name)
+		err := scanTag(rows, &tag)
 		if err != nil {
 			return nil, err
 		}
 		tags = append(tags, tag)
 	}
 
-	return tags, nil
+	return tags, rows.Err()
 }
 
-func (r *tagRepository) AddURLTag(urlID, tagID int64) error {
-	_, err := r.db.Exec(context.Background(),
+func (r *tagRepository) AddURLTag(ctx context.Context, urlID, tagID int64) error {
+	_, err := r.db.Exec(ctx,
 		`INSERT INTO url_tags (url_id, tag_id) VALUES ($1, $2)
 		ON CONFLICT DO NOTHING`,
 		urlID, tagID,
@@ -89,40 +244,145 @@ func (r *tagRepository) AddURLTag(urlID, tagID int64) error {
 	return err
 }
 
-func (r *tagRepository) RemoveURLTag(urlID, tagID int64) error {
-	_, err := r.db.Exec(context.Background(),
+func (r *tagRepository) RemoveURLTag(ctx context.Context, urlID, tagID int64) error {
+	_, err := r.db.Exec(ctx,
 		`DELETE FROM url_tags WHERE url_id = $1 AND tag_id = $2`,
 		urlID, tagID,
 	)
 	return err
 }
 
-func (r *tagRepository) AddTagToURL(ctx context.Context, urlID int64, tagName string) error {
-	// First get or create the tag
-	tag, err := r.GetByName(tagName)
+func (r *tagRepository) AddTagToURL(ctx context.Context, urlID int64, tagName string, quota domain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		// Create new tag if it doesn't exist
-		tag = &domain.Tag{Name: tagName}
-		if err := r.Create(tag); err != nil {
-			return err
-		}
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var workspaceID int64
+	err = tx.QueryRow(ctx,
+		`SELECT workspace_id FROM urls WHERE id = $1 AND workspace_id IS NOT NULL`,
+		urlID,
+	).Scan(&workspaceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &domain.ErrURLNotFound{ID: urlID}
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkTagQuota(ctx, tx, workspaceID, []string{tagName}, quota); err != nil {
+		return err
+	}
+
+	// Get or create the tag in the URL's workspace. The no-op update makes
+	// RETURNING see a tag created concurrently.
+	var tagID int64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO tags (workspace_id, name) VALUES ($1, $2)
+		ON CONFLICT (workspace_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`,
+		workspaceID, tagName,
+	).Scan(&tagID)
+	if err != nil {
+		return err
 	}
 
 	// Add the tag to URL
-	return r.AddURLTag(urlID, tag.ID)
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO url_tags (url_id, tag_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		urlID, tagID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *tagRepository) RemoveTagFromURL(ctx context.Context, urlID int64, tagName string) error {
-	// Get the tag
-	tag, err := r.GetByName(tagName)
+	var tagID int64
+	err := r.db.QueryRow(ctx,
+		`SELECT tags.id FROM tags
+		JOIN urls ON urls.workspace_id = tags.workspace_id
+		WHERE urls.id = $1 AND tags.name = $2`,
+		urlID, tagName,
+	).Scan(&tagID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &domain.ErrTagNotFound{Name: tagName}
+	}
 	if err != nil {
 		return err
 	}
 
 	// Remove the tag from URL
-	return r.RemoveURLTag(urlID, tag.ID)
+	return r.RemoveURLTag(ctx, urlID, tagID)
+}
+
+func (r *tagRepository) BulkTagURLs(ctx context.Context, workspaceID int64, urlIDs []int64, add []string, remove []string, quota domain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The workspace is locked before the links, the order AddTagToURL takes
+	// them in
+	if err := checkTagQuota(ctx, tx, workspaceID, add, quota); err != nil {
+		return err
+	}
+
+	// Lock the links so none is deleted or moved halfway through
+	var found int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM (
+			SELECT id FROM urls WHERE workspace_id = $1 AND id = ANY($2) AND is_active FOR UPDATE
+		) locked`,
+		workspaceID, urlIDs,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(urlIDs) {
+		return &domain.ErrURLNotFound{}
+	}
+
+	if len(add) > 0 {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO tags (workspace_id, name)
+			SELECT $1, name FROM unnest($2::text[]) name
+			ON CONFLICT (workspace_id, name) DO NOTHING`,
+			workspaceID, add,
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO url_tags (url_id, tag_id)
+			SELECT u.id, t.id FROM unnest($2::bigint[]) u(id)
+			CROSS JOIN tags t
+			WHERE t.workspace_id = $1 AND t.name = ANY($3)
+			ON CONFLICT DO NOTHING`,
+			workspaceID, urlIDs, add,
+		); err != nil {
+			return err
+		}
+	}
+
+	if len(remove) > 0 {
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM url_tags
+			USING tags t
+			WHERE t.id = url_tags.tag_id AND t.workspace_id = $1 AND t.name = ANY($3)
+				AND url_tags.url_id = ANY($2)`,
+			workspaceID, urlIDs, remove,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *tagRepository) GetURLTags(ctx context.Context, urlID int64) ([]domain.Tag, error) {
-	return r.GetByURLID(urlID)
+	return r.GetByURLID(ctx, urlID)
 }
@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// urlCursor is the keyset position after the last row of a page. The sort
+// is recorded so a cursor cannot be replayed against a different ordering.
+// Positions by click count are taken from a column that changes under the
+// cursor, so links clicked between pages may be skipped or seen twice.
+type urlCursor struct {
+	SortBy     string    `json:"s"`
+	Ascending  bool      `json:"a,omitempty"`
+	CreatedAt  time.Time `json:"t"`
+	ClickCount int64     `json:"c"`
+	ID         int64     `json:"i"`
+}
+
+func encodeURLCursor(cursor urlCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeURLCursor(s string) (urlCursor, error) {
+	var cursor urlCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// urlFilter accumulates the conditions and arguments of a statement on urls
+type urlFilter struct {
+	where []string
+	args  []any
+}
+
+// arg binds v and returns its placeholder
+func (f *urlFilter) arg(v any) string {
+	f.args = append(f.args, v)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+func (f *urlFilter) sql() string {
+	return strings.Join(f.where, " AND ")
+}
+
+// newURLFilter selects the workspace's active URLs matching query's filters
+func newURLFilter(query domain.URLQuery) *urlFilter {
+	f := &urlFilter{}
+	f.where = append(f.where, "workspace_id = "+f.arg(query.WorkspaceID), "is_active = true")
+
+	if query.Tag != "" {
+		f.where = append(f.where, f.hasTag(query.Tag))
+	}
+	if query.TagExpr != nil {
+		f.where = append(f.where, f.tagExpr(query.TagExpr))
+	}
+	if query.CreatedAfter != nil {
+		f.where = append(f.where, "created_at >= "+f.arg(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		f.where = append(f.where, "created_at < "+f.arg(*query.CreatedBefore))
+	}
+	switch query.State {
+	case domain.URLStateActive:
+		f.where = append(f.where, "(expires_at IS NULL OR expires_at > NOW())")
+	case domain.URLStateExpired:
+		f.where = append(f.where, "expires_at <= NOW()")
+	}
+	if query.Domain != "" {
+		f.where = append(f.where, "domain_id IN (SELECT id FROM custom_domains WHERE domain = "+f.arg(query.Domain)+")")
+	}
+	if query.Search != "" {
+		pattern := f.arg("%" + escapeLike(query.Search) + "%")
+		f.where = append(f.where, "(original_url ILIKE "+pattern+" OR short_code ILIKE "+pattern+")")
+	}
+
+	return f
+}
+
+// hasTag matches URLs carrying the tag named name
+func (f *urlFilter) hasTag(name string) string {
+	return `EXISTS (SELECT 1 FROM url_tags ut JOIN tags t ON t.id = ut.tag_id
+			WHERE ut.url_id = urls.id AND t.name = ` + f.arg(name) + `)`
+}
+
+// tagExpr translates expr into a condition on urls
+func (f *urlFilter) tagExpr(expr *domain.TagExpr) string {
+	switch {
+	case expr.Not != nil:
+		return "NOT " + f.tagExpr(expr.Not)
+	case len(expr.And) > 0:
+		return f.tagExprs(expr.And, " AND ")
+	case len(expr.Or) > 0:
+		return f.tagExprs(expr.Or, " OR ")
+	default:
+		return f.hasTag(expr.Tag)
+	}
+}
+
+func (f *urlFilter) tagExprs(exprs []*domain.TagExpr, operator string) string {
+	conditions := make([]string, len(exprs))
+	for i, expr := range exprs {
+		conditions[i] = f.tagExpr(expr)
+	}
+	return "(" + strings.Join(conditions, operator) + ")"
+}
+
+// List pages through a workspace's active URLs using keyset pagination on the
+// sort column with the ID as tie breaker
+func (r *urlRepository) List(ctx context.Context, query domain.URLQuery) (*domain.URLPage, error) {
+	f := newURLFilter(query)
+
+	// The sort column is interpolated, so only known columns get through
+	sortBy := query.SortBy
+	switch sortBy {
+	case "":
+		sortBy = domain.URLSortCreatedAt
+	case domain.URLSortCreatedAt, domain.URLSortClickCount:
+	default:
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("unknown sort %q", sortBy)}
+	}
+	direction, comparison := "DESC", "<"
+	if query.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeURLCursor(query.Cursor)
+		if err != nil || cursor.SortBy != sortBy || cursor.Ascending != query.Ascending {
+			return nil, &domain.ErrInvalidQuery{Reason: "cursor does not belong to this listing"}
+		}
+
+		var position any = cursor.CreatedAt
+		if sortBy == domain.URLSortClickCount {
+			position = cursor.ClickCount
+		}
+		f.where = append(f.where, fmt.Sprintf("(%s, id) %s (%s, %s)", sortBy, comparison, f.arg(position), f.arg(cursor.ID)))
+	}
+
+	// One extra row tells us whether there is a next page
+	sql := `SELECT ` + urlColumns + `
+		FROM urls WHERE ` + f.sql() +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortBy, direction, direction, f.arg(query.Limit+1))
+
+	rows, err := r.db.Query(ctx, sql, f.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &domain.URLPage{URLs: make([]domain.URL, 0, query.Limit+1)}
+	for rows.Next() {
+		var url domain.URL
+		if err := scanURL(rows, &url); err != nil {
+			return nil, err
+		}
+		page.URLs = append(page.URLs, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.URLs) > query.Limit {
+		page.URLs = page.URLs[:query.Limit]
+		last := page.URLs[len(page.URLs)-1]
+		page.NextCursor = encodeURLCursor(urlCursor{
+			SortBy:     sortBy,
+			Ascending:  query.Ascending,
+			CreatedAt:  last.CreatedAt,
+			ClickCount: last.ClickCount,
+			ID:         last.ID,
+		})
+	}
+
+	return page, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
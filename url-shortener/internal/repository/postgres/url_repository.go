@@ -2,42 +2,86 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
+// urlColumns is the column list scanned by scanURL
+const urlColumns = `id, short_code, original_url, user_id, click_count, expires_at, created_at, is_active,
+		is_custom_alias, updated_at, version, domain_id, workspace_id, COALESCE(password_hash, '')`
+
 type urlRepository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
 // NewURLRepository creates a new PostgreSQL URL repository
-func NewURLRepository(db *pgx.Conn) domain.URLRepository {
+func NewURLRepository(db *pgxpool.Pool) domain.URLRepository {
 	return &urlRepository{
 		db: db,
 	}
 }
 
-func (r *urlRepository) Create(url *domain.URL) error {
-	err := r.db.QueryRow(context.Background(),
-		`INSERT INTO urls (short_code, original_url, user_id, expires_at, created_at, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id`,
-		url.ShortCode, url.OriginalURL, url.UserID, url.ExpiresAt, url.CreatedAt, url.IsActive,
-	).Scan(&url.ID)
+// scanURL scans a row selected with urlColumns
+func scanURL(row pgx.Row, url *domain.URL) error {
+	err := row.Scan(&url.ID, &url.ShortCode, &url.OriginalURL, &url.UserID, &url.ClickCount,
+		&url.ExpiresAt, &url.CreatedAt, &url.IsActive, &url.IsCustomAlias, &url.UpdatedAt, &url.Version, &url.DomainID,
+		&url.WorkspaceID, &url.PasswordHash)
+	url.PasswordProtected = url.PasswordHash != ""
+	return err
+}
+
+// Create inserts url. A non-zero url.ID is used as the row ID, which lets
+// generators that encode the ID reserve it from urls_id_seq beforehand.
+func (r *urlRepository) Create(ctx context.Context, url *domain.URL) error {
+	err := r.db.QueryRow(ctx,
+		`INSERT INTO urls (id, short_code, original_url, user_id, expires_at, created_at, is_active, is_custom_alias, updated_at, domain_id, workspace_id, password_hash)
+		VALUES (COALESCE(NULLIF($1::bigint, 0), nextval('urls_id_seq')), $2, $3, $4, $5, $6, $7, $8, $6, $9, $10, NULLIF($11, ''))
+		RETURNING id, updated_at, version`,
+		url.ID, url.ShortCode, url.OriginalURL, url.UserID, url.ExpiresAt, url.CreatedAt, url.IsActive, url.IsCustomAlias, url.DomainID, url.WorkspaceID, url.PasswordHash,
+	).Scan(&url.ID, &url.UpdatedAt, &url.Version)
+
+	if isUniqueViolation(err) {
+		return &domain.ErrShortCodeConflict{ShortCode: url.ShortCode}
+	}
 
 	return err
 }
 
-func (r *urlRepository) GetByShortCode(shortCode string) (*domain.URL, error) {
+func (r *urlRepository) GetByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
 	url := &domain.URL{}
-	err := r.db.QueryRow(context.Background(),
-		`SELECT id, short_code, original_url, user_id, click_count, expires_at, created_at, is_active
-		FROM urls WHERE short_code = $1`,
+	err := scanURL(r.db.QueryRow(ctx,
+		`SELECT `+urlColumns+`
+		FROM urls WHERE short_code = $1 AND domain_id IS NULL`,
 		shortCode,
-	).Scan(&url.ID, &url.ShortCode, &url.OriginalURL, &url.UserID, &url.ClickCount,
-		&url.ExpiresAt, &url.CreatedAt, &url.IsActive)
+	), url)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+func (r *urlRepository) GetByDomainShortCode(ctx context.Context, domainID int64, shortCode string) (*domain.URL, error) {
+	url := &domain.URL{}
+	err := scanURL(r.db.QueryRow(ctx,
+		`SELECT `+urlColumns+`
+		FROM urls WHERE domain_id = $1 AND short_code = $2`,
+		domainID, shortCode,
+	), url)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -45,51 +89,233 @@ func (r *urlRepository) GetByShortCode(shortCode string) (*domain.URL, error) {
 	return url, nil
 }
 
-func (r *urlRepository) GetByUserID(userID string) ([]domain.URL, error) {
-	rows, err := r.db.Query(context.Background(),
-		`SELECT id, short_code, original_url, user_id, click_count, expires_at, created_at, is_active
-		FROM urls WHERE user_id = $1 AND is_active = true ORDER BY created_at DESC`,
-		userID,
+func (r *urlRepository) GetByID(ctx context.Context, id int64) (*domain.URL, error) {
+	url := &domain.URL{}
+	err := scanURL(r.db.QueryRow(ctx,
+		`SELECT `+urlColumns+`
+		FROM urls WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	), url)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &domain.ErrURLNotFound{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+func (r *urlRepository) Update(ctx context.Context, url *domain.URL, expectedVersion int, changedBy string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Snapshot the current row; matching nothing means someone else won the
+	// race, including a delete that landed since the caller read the row
+	result, err := tx.Exec(ctx,
+		`INSERT INTO url_history (url_id, version, short_code, original_url, expires_at, is_active, changed_by)
+		SELECT id, version, short_code, original_url, expires_at, is_active, $3
+		FROM urls WHERE id = $1 AND version = $2 AND deleted_at IS NULL`,
+		url.ID, expectedVersion, changedBy,
 	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return &domain.ErrVersionMismatch{ID: url.ID, ExpectedVersion: expectedVersion}
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE urls
+		SET short_code = $3, original_url = $4, expires_at = $5, is_active = $6, password_hash = NULLIF($7, ''),
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND version = $2
+		RETURNING version, updated_at`,
+		url.ID, expectedVersion, url.ShortCode, url.OriginalURL, url.ExpiresAt, url.IsActive, url.PasswordHash,
+	).Scan(&url.Version, &url.UpdatedAt)
+	if isUniqueViolation(err) {
+		return &domain.ErrShortCodeConflict{ShortCode: url.ShortCode}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BulkUpdate locks the URLs matched by query, snapshots them into the history
+// unless they are being deleted, and applies action to all of them at once
+func (r *urlRepository) BulkUpdate(ctx context.Context, query domain.URLQuery, action domain.URLBulkAction, changedBy string) ([]domain.URL, error) {
+	f := newURLFilter(query)
+
+	var set string
+	switch action.Action {
+	case domain.URLBulkDeactivate:
+		set = "is_active = false, version = version + 1"
+	case domain.URLBulkExtend:
+		f.where = append(f.where, "expires_at < "+f.arg(action.ExpiresAt))
+		set = "expires_at = $2, version = version + 1"
+	case domain.URLBulkDelete:
+		set = "is_active = false, deleted_at = NOW()"
+	default:
+		return nil, fmt.Errorf("unknown bulk action %q", action.Action)
+	}
+
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var urls []domain.URL
+	rows, err := tx.Query(ctx, `SELECT id FROM urls WHERE `+f.sql()+` ORDER BY id FOR UPDATE`, f.args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []domain.URL{}, tx.Commit(ctx)
+	}
+
+	if action.Action != domain.URLBulkDelete {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO url_history (url_id, version, short_code, original_url, expires_at, is_active, changed_by)
+			SELECT id, version, short_code, original_url, expires_at, is_active, $2
+			FROM urls WHERE id = ANY($1)`,
+			ids, changedBy,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []any{ids}
+	if action.Action == domain.URLBulkExtend {
+		args = append(args, action.ExpiresAt)
+	}
+	rows, err = tx.Query(ctx,
+		`UPDATE urls SET `+set+`, updated_at = NOW()
+		WHERE id = ANY($1)
+		RETURNING `+urlColumns,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]domain.URL, 0, len(ids))
 	for rows.Next() {
 		var url domain.URL
-		err := rows.Scan(&url.ID, &url.ShortCode, &url.OriginalURL, &url.UserID,
-			&url.ClickCount, &url.ExpiresAt, &url.CreatedAt, &url.IsActive)
-		if err != nil {
+		if err := scanURL(rows, &url); err != nil {
+			rows.Close()
 			return nil, err
 		}
 		urls = append(urls, url)
 	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, tx.Commit(ctx)
+}
+
+func (r *urlRepository) GetHistory(ctx context.Context, urlID int64) ([]domain.URLHistory, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id, url_id, version, short_code, original_url, expires_at, is_active, changed_by, changed_at
+		FROM url_history WHERE url_id = $1 ORDER BY version DESC`,
+		urlID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return urls, nil
+	var history []domain.URLHistory
+	for rows.Next() {
+		var h domain.URLHistory
+		err := rows.Scan(&h.ID, &h.URLID, &h.Version, &h.ShortCode, &h.OriginalURL,
+			&h.ExpiresAt, &h.IsActive, &h.ChangedBy, &h.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
 }
 
-func (r *urlRepository) Delete(id int64, userID string) error {
-	result, err := r.db.Exec(context.Background(),
-		`UPDATE urls SET is_active = false WHERE id = $1 AND user_id = $2`,
-		id, userID,
+func (r *urlRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE urls SET is_active = false, deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+		id,
 	)
 	if err != nil {
 		return err
 	}
 
 	if result.RowsAffected() == 0 {
-		return &domain.ErrURLNotFound{ShortCode: ""}
+		return &domain.ErrURLNotFound{ID: id}
 	}
 
 	return nil
 }
 
-func (r *urlRepository) IncrementClickCount(id int64) error {
-	_, err := r.db.Exec(context.Background(),
+func (r *urlRepository) IncrementClickCount(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx,
 		`UPDATE urls SET click_count = click_count + 1 WHERE id = $1`,
 		id,
 	)
 	return err
 }
+
+func (r *urlRepository) IncrementClickCounts(ctx context.Context, clicks map[int64]int64) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	// Sorted so concurrent flushes lock rows in the same order
+	ids := make([]int64, 0, len(clicks))
+	for id := range clicks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	counts := make([]int64, len(ids))
+	for i, id := range ids {
+		counts[i] = clicks[id]
+	}
+
+	_, err := r.db.Exec(ctx,
+		`UPDATE urls SET click_count = urls.click_count + c.clicks
+		FROM unnest($1::bigint[], $2::bigint[]) AS c(id, clicks)
+		WHERE urls.id = c.id`,
+		ids, counts,
+	)
+	return err
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a PostgreSQL foreign key violation
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
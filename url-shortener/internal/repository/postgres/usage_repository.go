@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+type usageRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewUsageRepository creates a new PostgreSQL usage repository
+func NewUsageRepository(db *pgxpool.Pool) domain.UsageRepository {
+	return &usageRepository{
+		db: db,
+	}
+}
+
+// ReserveLink checks and bumps the counter in one statement, so concurrent
+// creations cannot both take the last link of a quota
+func (r *usageRepository) ReserveLink(ctx context.Context, workspaceID int64, period time.Time, limit int) (bool, error) {
+	if limit == 0 {
+		return false, nil
+	}
+
+	var count int
+	err := r.db.QueryRow(ctx,
+		`INSERT INTO workspace_usage (workspace_id, period, links_created)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (workspace_id, period) DO UPDATE
+		SET links_created = workspace_usage.links_created + 1
+		WHERE $3::int < 0 OR workspace_usage.links_created < $3::int
+		RETURNING links_created`,
+		workspaceID, period, limit,
+	).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *usageRepository) ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE workspace_usage SET links_created = links_created - 1
+		WHERE workspace_id = $1 AND period = $2 AND links_created > 0`,
+		workspaceID, period,
+	)
+	return err
+}
+
+func (r *usageRepository) GetUsage(ctx context.Context, workspaceID int64, period time.Time) (*domain.WorkspaceUsage, error) {
+	usage := &domain.WorkspaceUsage{}
+	err := r.db.QueryRow(ctx,
+		`SELECT
+			COALESCE((SELECT links_created FROM workspace_usage WHERE workspace_id = $1 AND period = $2), 0),
+			(SELECT COUNT(*) FROM custom_domains WHERE workspace_id = $1 AND verified),
+			(SELECT COUNT(*) FROM tags WHERE workspace_id = $1)`,
+		workspaceID, period,
+	).Scan(&usage.LinksCreated, &usage.CustomDomains, &usage.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// lockWorkspaceQuotas locks the workspace row until tx ends. Insertions
+// counted against a quota take the lock before counting, so they run one
+// after the other and each sees the rows of those before it. NO KEY UPDATE
+// leaves the foreign keys pointing at the workspace free to insert.
+func lockWorkspaceQuotas(ctx context.Context, tx pgx.Tx, workspaceID int64) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM workspaces WHERE id = $1 FOR NO KEY UPDATE`, workspaceID)
+	return err
+}
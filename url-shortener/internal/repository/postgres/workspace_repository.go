@@ -0,0 +1,367 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// personalWorkspaceName names the workspace every user starts with
+const personalWorkspaceName = "Personal"
+
+// workspaceInvitationColumns lists the columns scanned by scanWorkspaceInvitation
+const workspaceInvitationColumns = `id, workspace_id, email, role, token_hash, invited_by, expires_at,
+	accepted_by, accepted_at, created_at`
+
+type workspaceRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewWorkspaceRepository creates a new PostgreSQL workspace repository
+func NewWorkspaceRepository(db *pgxpool.Pool) internalDomain.WorkspaceRepository {
+	return &workspaceRepository{
+		db: db,
+	}
+}
+
+func scanWorkspaceInvitation(row pgx.Row, inv *internalDomain.WorkspaceInvitation) error {
+	return row.Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy,
+		&inv.ExpiresAt, &inv.AcceptedBy, &inv.AcceptedAt, &inv.CreatedAt)
+}
+
+func (r *workspaceRepository) Create(ctx context.Context, workspace *internalDomain.Workspace, owner string, quota internalDomain.QuotaLimit) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if !workspace.Personal && quota.Limit != internalDomain.Unlimited {
+		// The owner may have no workspace row to lock yet, so their
+		// creations are serialized on a lock keyed by the user instead
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('workspaces'), hashtext($1))`, owner); err != nil {
+			return err
+		}
+
+		var held int
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM workspaces WHERE created_by = $1 AND NOT personal`,
+			owner,
+		).Scan(&held)
+		if err != nil {
+			return err
+		}
+		if held >= quota.Limit {
+			return quota.Exceeded()
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO workspaces (name, personal, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, plan, created_at`,
+		workspace.Name, workspace.Personal, workspace.CreatedBy,
+	).Scan(&workspace.ID, &workspace.Plan, &workspace.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)`,
+		workspace.ID, owner, internalDomain.RoleOwner,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *workspaceRepository) GetByID(ctx context.Context, id int64) (*internalDomain.Workspace, error) {
+	w := &internalDomain.Workspace{}
+	err := r.db.QueryRow(ctx,
+		`SELECT id, name, personal, plan, created_by, created_at FROM workspaces WHERE id = $1`,
+		id,
+	).Scan(&w.ID, &w.Name, &w.Personal, &w.Plan, &w.CreatedBy, &w.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrWorkspaceNotFound{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// EnsurePersonal relies on the partial unique index on personal workspaces,
+// so concurrent first requests of a user end up with the same workspace
+func (r *workspaceRepository) EnsurePersonal(ctx context.Context, userID string) (*internalDomain.Workspace, error) {
+	w := &internalDomain.Workspace{Role: internalDomain.RoleOwner}
+	err := r.db.QueryRow(ctx,
+		`SELECT id, name, personal, plan, created_by, created_at
+		FROM workspaces WHERE created_by = $1 AND personal`,
+		userID,
+	).Scan(&w.ID, &w.Name, &w.Personal, &w.Plan, &w.CreatedBy, &w.CreatedAt)
+	if err == nil {
+		return w, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO workspaces (name, personal, created_by)
+		VALUES ($1, true, $2)
+		ON CONFLICT (created_by) WHERE personal DO NOTHING`,
+		personalWorkspaceName, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`SELECT id, name, personal, plan, created_by, created_at
+		FROM workspaces WHERE created_by = $1 AND personal`,
+		userID,
+	).Scan(&w.ID, &w.Name, &w.Personal, &w.Plan, &w.CreatedBy, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		w.ID, userID, internalDomain.RoleOwner,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, tx.Commit(ctx)
+}
+
+func (r *workspaceRepository) ListByUser(ctx context.Context, userID string) ([]internalDomain.Workspace, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT w.id, w.name, w.personal, w.plan, w.created_by, w.created_at, m.role
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.personal DESC, w.name, w.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []internalDomain.Workspace{}
+	for rows.Next() {
+		var w internalDomain.Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.Personal, &w.Plan, &w.CreatedBy, &w.CreatedAt, &w.Role); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+
+	return workspaces, rows.Err()
+}
+
+func (r *workspaceRepository) GetMember(ctx context.Context, workspaceID int64, userID string) (*internalDomain.WorkspaceMember, error) {
+	m := &internalDomain.WorkspaceMember{}
+	err := r.db.QueryRow(ctx,
+		`SELECT workspace_id, user_id, role, created_at
+		FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, userID,
+	).Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrMemberNotFound{WorkspaceID: workspaceID, UserID: userID}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (r *workspaceRepository) ListMembers(ctx context.Context, workspaceID int64) ([]internalDomain.WorkspaceMember, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT workspace_id, user_id, role, created_at
+		FROM workspace_members WHERE workspace_id = $1
+		ORDER BY created_at, user_id`,
+		workspaceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []internalDomain.WorkspaceMember{}
+	for rows.Next() {
+		var m internalDomain.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+func (r *workspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, role string) error {
+	return r.changeMember(ctx, workspaceID, userID, role != internalDomain.RoleOwner,
+		`UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, userID, role)
+}
+
+func (r *workspaceRepository) RemoveMember(ctx context.Context, workspaceID int64, userID string) error {
+	return r.changeMember(ctx, workspaceID, userID, true,
+		`DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, userID)
+}
+
+// changeMember runs query against one membership. When the change may drop
+// an owner, the workspace row is locked first so two owners demoting each
+// other concurrently cannot both succeed.
+func (r *workspaceRepository) changeMember(ctx context.Context, workspaceID int64, userID string, dropsOwner bool, query string, args ...any) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `SELECT id FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &internalDomain.ErrWorkspaceNotFound{ID: workspaceID}
+	}
+	if err != nil {
+		return err
+	}
+
+	var role string
+	var owners int
+	err = tx.QueryRow(ctx,
+		`SELECT role, (SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1 AND role = 'owner')
+		FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceID, userID,
+	).Scan(&role, &owners)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &internalDomain.ErrMemberNotFound{WorkspaceID: workspaceID, UserID: userID}
+	}
+	if err != nil {
+		return err
+	}
+
+	if dropsOwner && role == internalDomain.RoleOwner && owners == 1 {
+		return &internalDomain.ErrLastOwner{WorkspaceID: workspaceID}
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *workspaceRepository) CreateInvitation(ctx context.Context, invitation *internalDomain.WorkspaceInvitation) error {
+	return r.db.QueryRow(ctx,
+		`INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		invitation.WorkspaceID, invitation.Email, invitation.Role, invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+}
+
+func (r *workspaceRepository) ListPendingInvitations(ctx context.Context, workspaceID int64, now time.Time) ([]internalDomain.WorkspaceInvitation, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+workspaceInvitationColumns+`
+		FROM workspace_invitations
+		WHERE workspace_id = $1 AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC`,
+		workspaceID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []internalDomain.WorkspaceInvitation{}
+	for rows.Next() {
+		var inv internalDomain.WorkspaceInvitation
+		if err := scanWorkspaceInvitation(rows, &inv); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+func (r *workspaceRepository) DeleteInvitation(ctx context.Context, workspaceID int64, id int64) error {
+	result, err := r.db.Exec(ctx,
+		`DELETE FROM workspace_invitations WHERE id = $1 AND workspace_id = $2 AND accepted_at IS NULL`,
+		id, workspaceID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return &internalDomain.ErrInvitationNotFound{ID: id}
+	}
+
+	return nil
+}
+
+// AcceptInvitation claims the invitation with a conditional update, so a
+// token can only ever be used once
+func (r *workspaceRepository) AcceptInvitation(ctx context.Context, tokenHash string, userID string, now time.Time) (*internalDomain.WorkspaceInvitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	inv := &internalDomain.WorkspaceInvitation{}
+	err = scanWorkspaceInvitation(tx.QueryRow(ctx,
+		`UPDATE workspace_invitations
+		SET accepted_by = $2, accepted_at = $3
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $3
+		RETURNING `+workspaceInvitationColumns,
+		tokenHash, userID, now,
+	), inv)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &internalDomain.ErrInvitationNotFound{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(ctx,
+		`INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		inv.WorkspaceID, userID, inv.Role,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Rolling back leaves the invitation for whoever it was meant for
+	if result.RowsAffected() == 0 {
+		return nil, &internalDomain.ErrAlreadyMember{WorkspaceID: inv.WorkspaceID}
+	}
+
+	return inv, tx.Commit(ctx)
+}
@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// ShortCodeCounterKey is the Redis key used for counter-based short codes
+const ShortCodeCounterKey = "shortcode:counter"
+
+type counter struct {
+	client *redis.Client
+	key    string
+}
+
+// NewCounter creates a counter backed by Redis INCR on key
+func NewCounter(client *redis.Client, key string) domain.Counter {
+	return &counter{
+		client: client,
+		key:    key,
+	}
+}
+
+func (c *counter) Next(ctx context.Context) (int64, error) {
+	return c.client.Incr(ctx, c.key).Result()
+}
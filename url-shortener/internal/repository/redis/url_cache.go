@@ -0,0 +1,347 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// URLCacheChannel carries the cache keys of lookups that must be dropped
+const URLCacheChannel = "url-cache:invalidate"
+
+// urlCacheKeyPrefix prefixes the Redis key of every cached short code lookup
+const urlCacheKeyPrefix = "url:shortcode:"
+
+// urlCacheTombstone replaces invalidated entries for invalidationGrace. A
+// lookup that read the row before the write committed may still be on its
+// way to fill the cache; the tombstone turns such fills away so the stale
+// row is not served for a whole TTL. Lookups in flight for longer than the
+// grace period can still fill, and are bounded by the TTL as before.
+const (
+	urlCacheTombstone = "invalidated"
+	invalidationGrace = 5 * time.Second
+)
+
+// fillScript stores a lookup result unless the key holds a tombstone
+var fillScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[3] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// cacheKey identifies a short code lookup: the bare short code on the
+// default host, "<domain ID>/<short code>" on a custom domain. Short codes
+// never contain "/", so the two cannot collide.
+func cacheKey(domainID *int64, shortCode string) string {
+	if domainID == nil {
+		return shortCode
+	}
+	return strconv.FormatInt(*domainID, 10) + "/" + shortCode
+}
+
+// cachedURL is a URL as stored in Redis. The password hash is hidden from
+// JSON responses, so it is carried next to the URL instead.
+type cachedURL struct {
+	*domain.URL
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// URLCacheConfig tunes the short code cache
+type URLCacheConfig struct {
+	// TTL is how long a lookup stays in Redis
+	TTL time.Duration
+	// NegativeTTL is how long an unknown short code is remembered
+	NegativeTTL time.Duration
+	// LocalSize is the number of lookups kept in process; 0 disables the local cache
+	LocalSize int
+	// LocalTTL bounds how stale a local entry can get if an invalidation is missed
+	LocalTTL time.Duration
+}
+
+// URLCache is a URLRepository decorator that caches short code lookups in
+// Redis and optionally in an in-process LRU. Writes through the cache
+// invalidate the affected short codes on every instance via pub/sub.
+// Entries never outlive the URL's expires_at, and the cached URL still
+// carries it so expiry is enforced by the service as usual.
+type URLCache struct {
+	domain.URLRepository
+
+	client *redis.Client
+	cfg    URLCacheConfig
+	local  *lru
+	pubsub *redis.PubSub
+	done   chan struct{}
+	now    func() time.Time
+}
+
+// NewURLCache wraps next with a cache. When the local cache is enabled it
+// subscribes to URLCacheChannel; call Close to unsubscribe.
+func NewURLCache(ctx context.Context, next domain.URLRepository, client *redis.Client, cfg URLCacheConfig) (*URLCache, error) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 10 * time.Minute
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = 30 * time.Second
+	}
+	if cfg.LocalTTL <= 0 {
+		cfg.LocalTTL = 30 * time.Second
+	}
+
+	c := &URLCache{
+		URLRepository: next,
+		client:        client,
+		cfg:           cfg,
+		now:           time.Now,
+	}
+
+	if cfg.LocalSize > 0 {
+		c.local = newLRU(cfg.LocalSize)
+		c.pubsub = client.Subscribe(ctx, URLCacheChannel)
+
+		// Wait for the subscription so no invalidation is missed after we return
+		if _, err := c.pubsub.Receive(ctx); err != nil {
+			c.pubsub.Close()
+			return nil, err
+		}
+
+		c.done = make(chan struct{})
+		go c.listen()
+	}
+
+	return c, nil
+}
+
+// Close stops listening for invalidations
+func (c *URLCache) Close() error {
+	if c.pubsub == nil {
+		return nil
+	}
+
+	err := c.pubsub.Close()
+	<-c.done
+	return err
+}
+
+// listen drops local entries announced on URLCacheChannel
+func (c *URLCache) listen() {
+	defer close(c.done)
+
+	for msg := range c.pubsub.Channel() {
+		c.local.remove(msg.Payload)
+	}
+}
+
+// GetByShortCode serves lookups from the local cache, then Redis, then the
+// wrapped repository. Redis errors fall through so redirects keep working.
+func (c *URLCache) GetByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
+	return c.lookup(ctx, cacheKey(nil, shortCode), shortCode, func() (*domain.URL, error) {
+		return c.URLRepository.GetByShortCode(ctx, shortCode)
+	})
+}
+
+// GetByDomainShortCode caches custom domain lookups like GetByShortCode
+func (c *URLCache) GetByDomainShortCode(ctx context.Context, domainID int64, shortCode string) (*domain.URL, error) {
+	return c.lookup(ctx, cacheKey(&domainID, shortCode), shortCode, func() (*domain.URL, error) {
+		return c.URLRepository.GetByDomainShortCode(ctx, domainID, shortCode)
+	})
+}
+
+// lookup serves key from the caches, calling fetch on a miss
+func (c *URLCache) lookup(ctx context.Context, key, shortCode string, fetch func() (*domain.URL, error)) (*domain.URL, error) {
+	now := c.now()
+
+	if c.local != nil {
+		if entry, ok := c.local.get(key, now); ok {
+			return cachedResult(entry.url, shortCode)
+		}
+	}
+
+	data, err := c.client.Get(ctx, urlCacheKeyPrefix+key).Bytes()
+	switch {
+	case err == nil && string(data) == urlCacheTombstone:
+		// Recently invalidated: read through without caching
+	case err == nil:
+		var entry *cachedURL
+		if err := json.Unmarshal(data, &entry); err == nil {
+			var url *domain.URL
+			if entry != nil && entry.URL != nil {
+				url = entry.URL
+				url.PasswordHash = entry.PasswordHash
+			}
+			c.storeLocal(key, url, now)
+			return cachedResult(url, shortCode)
+		}
+		log.Printf("[ERROR] corrupt url cache entry for %s: %v", key, err)
+	case !errors.Is(err, redis.Nil):
+		log.Printf("[ERROR] url cache lookup for %s failed: %v", key, err)
+	}
+
+	url, err := fetch()
+	var notFound *domain.ErrURLNotFound
+	if errors.As(err, &notFound) {
+		c.store(ctx, key, nil, now)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(ctx, key, url, now)
+	return url, nil
+}
+
+// Create drops a remembered miss for the new short code
+func (c *URLCache) Create(ctx context.Context, url *domain.URL) error {
+	if err := c.URLRepository.Create(ctx, url); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, cacheKey(url.DomainID, url.ShortCode))
+	return nil
+}
+
+// Update invalidates both the previous and the new short code, since an
+// alias change may replace a remembered miss
+func (c *URLCache) Update(ctx context.Context, url *domain.URL, expectedVersion int, changedBy string) error {
+	previous, err := c.URLRepository.GetByID(ctx, url.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.URLRepository.Update(ctx, url, expectedVersion, changedBy); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, cacheKey(previous.DomainID, previous.ShortCode), cacheKey(url.DomainID, url.ShortCode))
+	return nil
+}
+
+// Delete invalidates the short code of the deactivated URL
+func (c *URLCache) Delete(ctx context.Context, id int64) error {
+	// Deleted rows are hidden from GetByID, so look the short code up first
+	url, err := c.URLRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.URLRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, cacheKey(url.DomainID, url.ShortCode))
+	return nil
+}
+
+// BulkUpdate invalidates the short codes of every URL the update changed
+func (c *URLCache) BulkUpdate(ctx context.Context, query domain.URLQuery, action domain.URLBulkAction, changedBy string) ([]domain.URL, error) {
+	urls, err := c.URLRepository.BulkUpdate(ctx, query, action, changedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(urls) > 0 {
+		keys := make([]string, len(urls))
+		for i, url := range urls {
+			keys[i] = cacheKey(url.DomainID, url.ShortCode)
+		}
+		c.invalidate(ctx, keys...)
+	}
+
+	return urls, nil
+}
+
+// store caches a lookup result; a nil url records a miss. Results are not
+// cached while the key holds a tombstone.
+func (c *URLCache) store(ctx context.Context, key string, url *domain.URL, now time.Time) {
+	var entry *cachedURL
+	if url != nil {
+		entry = &cachedURL{URL: url, PasswordHash: url.PasswordHash}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[ERROR] could not encode url cache entry for %s: %v", key, err)
+		return
+	}
+
+	ttl := max(c.ttl(url, now, c.cfg.TTL).Milliseconds(), 1)
+	stored, err := fillScript.Run(ctx, c.client, []string{urlCacheKeyPrefix + key}, data, ttl, urlCacheTombstone).Int()
+	if err != nil {
+		log.Printf("[ERROR] url cache write for %s failed: %v", key, err)
+	} else if stored == 0 {
+		return
+	}
+
+	c.storeLocal(key, url, now)
+}
+
+func (c *URLCache) storeLocal(key string, url *domain.URL, now time.Time) {
+	if c.local == nil {
+		return
+	}
+
+	c.local.add(&lruEntry{
+		key:       key,
+		url:       url,
+		expiresAt: now.Add(c.ttl(url, now, c.cfg.LocalTTL)),
+	})
+}
+
+// ttl caps limit so misses use NegativeTTL and entries end when the URL expires
+func (c *URLCache) ttl(url *domain.URL, now time.Time, limit time.Duration) time.Duration {
+	if url == nil {
+		return min(limit, c.cfg.NegativeTTL)
+	}
+
+	if url.ExpiresAt != nil {
+		remaining := url.ExpiresAt.Sub(now)
+		if remaining <= 0 {
+			// Already expired: keep it briefly like a miss
+			return min(limit, c.cfg.NegativeTTL)
+		}
+		return min(limit, remaining)
+	}
+
+	return limit
+}
+
+// invalidate replaces keys in Redis with tombstones and drops them from the
+// local cache of every instance
+func (c *URLCache) invalidate(ctx context.Context, keys ...string) {
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Set(ctx, urlCacheKeyPrefix+key, urlCacheTombstone, invalidationGrace)
+		if c.local != nil {
+			c.local.remove(key)
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[ERROR] url cache invalidation failed: %v", err)
+	}
+
+	for _, key := range keys {
+		if err := c.client.Publish(ctx, URLCacheChannel, key).Err(); err != nil {
+			log.Printf("[ERROR] url cache invalidation for %s was not published: %v", key, err)
+		}
+	}
+}
+
+// cachedResult turns a cached entry into the repository result. Callers get
+// a copy so they cannot modify the cached URL.
+func cachedResult(url *domain.URL, shortCode string) (*domain.URL, error) {
+	if url == nil {
+		return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
+	}
+
+	result := *url
+	return &result, nil
+}
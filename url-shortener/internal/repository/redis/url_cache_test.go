@@ -0,0 +1,323 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeURLRepo stores URLs by ID and counts short code lookups
+type fakeURLRepo struct {
+	domain.URLRepository
+	urls    map[int64]*domain.URL
+	deleted map[int64]bool
+	lookups int
+	// onLookup runs after a short code lookup read its row
+	onLookup func()
+}
+
+func newFakeURLRepo(urls ...*domain.URL) *fakeURLRepo {
+	repo := &fakeURLRepo{urls: make(map[int64]*domain.URL), deleted: make(map[int64]bool)}
+	for _, url := range urls {
+		repo.urls[url.ID] = url
+	}
+	return repo
+}
+
+func (r *fakeURLRepo) GetByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
+	r.lookups++
+	for _, url := range r.urls {
+		if url.ShortCode == shortCode && url.DomainID == nil {
+			result := *url
+			if r.onLookup != nil {
+				r.onLookup()
+			}
+			return &result, nil
+		}
+	}
+	return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
+}
+
+func (r *fakeURLRepo) GetByDomainShortCode(ctx context.Context, domainID int64, shortCode string) (*domain.URL, error) {
+	r.lookups++
+	for _, url := range r.urls {
+		if url.ShortCode == shortCode && url.DomainID != nil && *url.DomainID == domainID {
+			result := *url
+			return &result, nil
+		}
+	}
+	return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
+}
+
+func (r *fakeURLRepo) GetByID(ctx context.Context, id int64) (*domain.URL, error) {
+	url, ok := r.urls[id]
+	if !ok || r.deleted[id] {
+		return nil, &domain.ErrURLNotFound{ID: id}
+	}
+	result := *url
+	return &result, nil
+}
+
+func (r *fakeURLRepo) Create(ctx context.Context, url *domain.URL) error {
+	stored := *url
+	r.urls[url.ID] = &stored
+	return nil
+}
+
+func (r *fakeURLRepo) Update(ctx context.Context, url *domain.URL, expectedVersion int, changedBy string) error {
+	stored := *url
+	r.urls[url.ID] = &stored
+	return nil
+}
+
+// Delete is soft like the database's: short codes still resolve, IDs do not
+func (r *fakeURLRepo) Delete(ctx context.Context, id int64) error {
+	r.urls[id].IsActive = false
+	r.deleted[id] = true
+	return nil
+}
+
+// BulkUpdate deactivates every URL; the filters are the database's business
+func (r *fakeURLRepo) BulkUpdate(ctx context.Context, query domain.URLQuery, action domain.URLBulkAction, changedBy string) ([]domain.URL, error) {
+	var changed []domain.URL
+	for _, url := range r.urls {
+		url.IsActive = false
+		changed = append(changed, *url)
+	}
+	return changed, nil
+}
+
+func newTestCache(t *testing.T, mr *miniredis.Miniredis, repo domain.URLRepository, cfg URLCacheConfig) *URLCache {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cache, err := NewURLCache(context.Background(), repo, client, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { cache.Close() })
+
+	return cache
+}
+
+func TestURLCacheReadThrough(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://example.com", IsActive: true})
+	cache := newTestCache(t, mr, repo, URLCacheConfig{})
+
+	for i := 0; i < 3; i++ {
+		url, err := cache.GetByShortCode(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", url.OriginalURL)
+	}
+	assert.Equal(t, 1, repo.lookups)
+	assert.True(t, mr.Exists(urlCacheKeyPrefix+"abc"))
+	assert.Equal(t, 10*time.Minute, mr.TTL(urlCacheKeyPrefix+"abc"))
+}
+
+func TestURLCacheRemembersMisses(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo()
+	cache := newTestCache(t, mr, repo, URLCacheConfig{NegativeTTL: 5 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.GetByShortCode(ctx, "nope")
+		assert.IsType(t, &domain.ErrURLNotFound{}, err)
+	}
+	assert.Equal(t, 1, repo.lookups)
+	assert.Equal(t, 5*time.Second, mr.TTL(urlCacheKeyPrefix+"nope"))
+
+	// Creating the short code replaces the remembered miss
+	require.NoError(t, cache.Create(ctx, &domain.URL{ID: 2, ShortCode: "nope", IsActive: true}))
+	url, err := cache.GetByShortCode(ctx, "nope")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), url.ID)
+}
+
+func TestURLCacheInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "old", OriginalURL: "https://a.example", IsActive: true, IsCustomAlias: true})
+	cache := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10})
+
+	_, err := cache.GetByShortCode(ctx, "old")
+	require.NoError(t, err)
+	_, err = cache.GetByShortCode(ctx, "new")
+	require.Error(t, err)
+
+	// Renaming drops both the old entry and the remembered miss for the new alias
+	require.NoError(t, cache.Update(ctx, &domain.URL{ID: 1, ShortCode: "new", OriginalURL: "https://b.example", IsActive: true}, 1, "user"))
+	_, err = cache.GetByShortCode(ctx, "old")
+	assert.IsType(t, &domain.ErrURLNotFound{}, err)
+	url, err := cache.GetByShortCode(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.example", url.OriginalURL)
+
+	require.NoError(t, cache.Delete(ctx, 1))
+	url, err = cache.GetByShortCode(ctx, "new")
+	require.NoError(t, err)
+	assert.False(t, url.IsActive)
+
+	// Deleted links can no longer be edited or deleted again
+	var notFound *domain.ErrURLNotFound
+	assert.ErrorAs(t, cache.Delete(ctx, 1), &notFound)
+}
+
+func TestURLCacheInvalidatesOnBulkUpdates(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	domainID := int64(5)
+	repo := newFakeURLRepo(
+		&domain.URL{ID: 1, ShortCode: "one", IsActive: true},
+		&domain.URL{ID: 2, ShortCode: "two", IsActive: true, DomainID: &domainID},
+	)
+	cache := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10})
+
+	_, err := cache.GetByShortCode(ctx, "one")
+	require.NoError(t, err)
+	_, err = cache.GetByDomainShortCode(ctx, domainID, "two")
+	require.NoError(t, err)
+
+	urls, err := cache.BulkUpdate(ctx, domain.URLQuery{Tag: "promo"}, domain.URLBulkAction{Action: domain.URLBulkDelete}, "user")
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	url, err := cache.GetByShortCode(ctx, "one")
+	require.NoError(t, err)
+	assert.False(t, url.IsActive)
+	url, err = cache.GetByDomainShortCode(ctx, domainID, "two")
+	require.NoError(t, err)
+	assert.False(t, url.IsActive)
+	assert.Equal(t, 4, repo.lookups)
+}
+
+func TestURLCachePubSubDropsLocalEntries(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://a.example", IsActive: true})
+	writer := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10})
+	reader := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10, LocalTTL: time.Hour})
+
+	_, err := reader.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Update(ctx, &domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://b.example", IsActive: true}, 1, "user"))
+
+	assert.Eventually(t, func() bool {
+		url, err := reader.GetByShortCode(ctx, "abc")
+		return err == nil && url.OriginalURL == "https://b.example"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestURLCacheRespectsExpiry(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Now()
+	expiresAt := now.Add(time.Minute)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "abc", IsActive: true, ExpiresAt: &expiresAt})
+	cache := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10, LocalTTL: time.Hour})
+	cache.now = func() time.Time { return now }
+
+	url, err := cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	require.NotNil(t, url.ExpiresAt)
+	assert.Equal(t, time.Minute, mr.TTL(urlCacheKeyPrefix+"abc"))
+
+	// Once expires_at passes neither cache keeps serving the entry
+	now = now.Add(2 * time.Minute)
+	mr.FastForward(2 * time.Minute)
+	_, err = cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 2, repo.lookups)
+}
+
+func TestURLCacheSeparatesDomains(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	domainID := int64(7)
+	repo := newFakeURLRepo(
+		&domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://default.example", IsActive: true},
+		&domain.URL{ID: 2, ShortCode: "abc", OriginalURL: "https://acme.example", IsActive: true, DomainID: &domainID},
+	)
+	cache := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10})
+
+	url, err := cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://default.example", url.OriginalURL)
+
+	url, err = cache.GetByDomainShortCode(ctx, domainID, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://acme.example", url.OriginalURL)
+	assert.True(t, mr.Exists(urlCacheKeyPrefix+"7/abc"))
+
+	// Editing the domain's link leaves the default host's entry alone
+	updated := &domain.URL{ID: 2, ShortCode: "abc", OriginalURL: "https://new.example", IsActive: true, DomainID: &domainID}
+	require.NoError(t, cache.Update(ctx, updated, 1, "user"))
+	tombstone, _ := mr.Get(urlCacheKeyPrefix + "7/abc")
+	assert.Equal(t, urlCacheTombstone, tombstone)
+	entry, _ := mr.Get(urlCacheKeyPrefix + "abc")
+	assert.NotEqual(t, urlCacheTombstone, entry)
+
+	url, err = cache.GetByDomainShortCode(ctx, domainID, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example", url.OriginalURL)
+
+	url, err = cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://default.example", url.OriginalURL)
+	assert.Equal(t, 3, repo.lookups)
+}
+
+func TestURLCacheKeepsPasswordHash(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://example.com", IsActive: true, PasswordHash: "hash", PasswordProtected: true})
+	cache := newTestCache(t, mr, repo, URLCacheConfig{})
+
+	// The first lookup fills Redis, the second is served from it
+	for i := 0; i < 2; i++ {
+		url, err := cache.GetByShortCode(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "hash", url.PasswordHash)
+		assert.True(t, url.PasswordProtected)
+	}
+	assert.Equal(t, 1, repo.lookups)
+}
+
+func TestURLCacheRefusesStaleFills(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	repo := newFakeURLRepo(&domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://a.example", IsActive: true})
+	cache := newTestCache(t, mr, repo, URLCacheConfig{LocalSize: 10, LocalTTL: time.Hour})
+
+	// The link is edited after the lookup read the old row but before it
+	// filled the cache
+	repo.onLookup = func() {
+		repo.onLookup = nil
+		require.NoError(t, cache.Update(ctx, &domain.URL{ID: 1, ShortCode: "abc", OriginalURL: "https://b.example", IsActive: true}, 1, "user"))
+	}
+	url, err := cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.example", url.OriginalURL)
+
+	url, err = cache.GetByShortCode(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.example", url.OriginalURL)
+
+	// Once the tombstone expires lookups are cached again
+	mr.FastForward(invalidationGrace)
+	for i := 0; i < 2; i++ {
+		url, err = cache.GetByShortCode(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://b.example", url.OriginalURL)
+	}
+	assert.Equal(t, 3, repo.lookups)
+}
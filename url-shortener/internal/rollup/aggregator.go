@@ -0,0 +1,65 @@
+package rollup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Aggregator periodically folds new visits into the hourly rollups. Several
+// instances may run one; the repository makes sure only one works at a time.
+type Aggregator struct {
+	repo      domain.AnalyticsRollupRepository
+	interval  time.Duration
+	batchSize int
+}
+
+// NewAggregator creates an aggregator that catches up every interval,
+// reading at most batchSize visits per transaction
+func NewAggregator(repo domain.AnalyticsRollupRepository, interval time.Duration, batchSize int) *Aggregator {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	return &Aggregator{
+		repo:      repo,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run aggregates until ctx is done
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.CatchUp(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[ERROR] analytics rollup failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CatchUp aggregates batches until no settled visits are left and returns
+// how many visits it processed
+func (a *Aggregator) CatchUp(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := a.repo.AggregateVisits(ctx, a.batchSize)
+		total += n
+		if err != nil || n < a.batchSize {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package rollup maintains hourly analytics rollups and turns them into
+// bucketed summaries, so reporting never scans raw visits.
+package rollup
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Dimensions lists every dimension rollups are kept for
+var Dimensions = []string{
+	domain.DimensionCountry,
+	domain.DimensionDevice,
+	domain.DimensionReferer,
+	domain.DimensionBrowser,
+}
+
+// maxValueLength matches analytics_rollup_hourly.value VARCHAR(255)
+const maxValueLength = 255
+
+type rollupKey struct {
+	urlID     int64
+	bucket    time.Time
+	dimension string
+	value     string
+}
+
+type rollupValue struct {
+	clicks   int64
+	visitors *Sketch
+}
+
+// Fold adds visits to the existing rollups of the same URLs and hours and
+// returns every rollup that changed. Bot visits are skipped, like they are
+// for click counts.
+func Fold(existing []domain.AnalyticsRollup, visits []domain.Analytics) ([]domain.AnalyticsRollup, error) {
+	rollups := make(map[rollupKey]*rollupValue)
+	changed := make(map[rollupKey]struct{})
+
+	for _, r := range existing {
+		sketch := NewSketch()
+		if err := sketch.UnmarshalBinary(r.Visitors); err != nil {
+			return nil, err
+		}
+		rollups[rollupKey{r.URLID, r.Bucket.UTC(), r.Dimension, r.Value}] = &rollupValue{clicks: r.Clicks, visitors: sketch}
+	}
+
+	for _, visit := range visits {
+		if visit.IsBot {
+			continue
+		}
+
+		bucket := visit.Timestamp.UTC().Truncate(time.Hour)
+		visitor := HashVisitor(visit.VisitorIP + "\x00" + visit.UserAgent)
+
+		for dimension, value := range dimensionValues(visit) {
+			key := rollupKey{visit.URLID, bucket, dimension, value}
+			r, ok := rollups[key]
+			if !ok {
+				r = &rollupValue{visitors: NewSketch()}
+				rollups[key] = r
+			}
+			r.clicks++
+			r.visitors.Add(visitor)
+			changed[key] = struct{}{}
+		}
+	}
+
+	result := make([]domain.AnalyticsRollup, 0, len(changed))
+	for key := range changed {
+		r := rollups[key]
+		visitors, err := r.visitors.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, domain.AnalyticsRollup{
+			URLID:     key.urlID,
+			Bucket:    key.bucket,
+			Dimension: key.dimension,
+			Value:     key.value,
+			Clicks:    r.clicks,
+			Visitors:  visitors,
+		})
+	}
+
+	return result, nil
+}
+
+// dimensionValues returns the value of every rolled up dimension for visit
+func dimensionValues(visit domain.Analytics) map[string]string {
+	return map[string]string{
+		domain.DimensionTotal:   "",
+		domain.DimensionCountry: truncate(visit.CountryCode),
+		domain.DimensionDevice:  truncate(visit.DeviceType),
+		domain.DimensionReferer: truncate(RefererHost(visit.Referer)),
+		domain.DimensionBrowser: truncate(visit.Browser),
+	}
+}
+
+// RefererHost reduces a Referer header to its lower-cased host without
+// "www.", or "" for direct visits and unparseable values
+func RefererHost(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// truncate cuts s to maxValueLength characters. VARCHAR counts characters,
+// and cutting bytes could split a rune that Postgres then rejects.
+func truncate(s string) string {
+	if len(s) <= maxValueLength {
+		return s
+	}
+	runes := 0
+	for i := range s {
+		if runes == maxValueLength {
+			return s[:i]
+		}
+		runes++
+	}
+	return s
+}
+
+// BucketStart returns the start of the bucket containing t in loc
+func BucketStart(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch bucket {
+	case domain.BucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case domain.BucketWeek:
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket returns the start of the bucket after the one starting at start
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case domain.BucketHour:
+		return start.Add(time.Hour)
+	case domain.BucketWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// BucketCount returns how many buckets the range of query spans, counting
+// no further than max+1
+func BucketCount(query domain.SummaryQuery, max int) int {
+	n := 0
+	for start := BucketStart(query.From, query.Bucket, query.Location); start.Before(query.To) && n <= max; start = nextBucket(start, query.Bucket) {
+		n++
+	}
+	return n
+}
+
+// Summarize merges hourly rollups into the buckets and dimensions of query.
+// Rollup hours are assigned to the bucket they start in, so for time zones
+// with a non-whole-hour offset hourly buckets are approximate.
+func Summarize(rollups []domain.AnalyticsRollup, query domain.SummaryQuery) (*domain.AnalyticsSummary, error) {
+	summary := &domain.AnalyticsSummary{
+		URLID:    query.URLID,
+		From:     query.From.In(query.Location),
+		To:       query.To.In(query.Location),
+		Bucket:   query.Bucket,
+		Timezone: query.Location.String(),
+		Buckets:  []domain.SummaryBucket{},
+	}
+
+	// Every bucket is reported, including empty ones
+	index := make(map[time.Time]int)
+	var bucketSketches []*Sketch
+	for start := BucketStart(query.From, query.Bucket, query.Location); start.Before(query.To); start = nextBucket(start, query.Bucket) {
+		index[start] = len(summary.Buckets)
+		summary.Buckets = append(summary.Buckets, domain.SummaryBucket{Start: start})
+		bucketSketches = append(bucketSketches, NewSketch())
+	}
+
+	total := NewSketch()
+	values := make(map[string]map[string]*rollupValue)
+
+	for _, r := range rollups {
+		if r.Bucket.Before(query.From) || !r.Bucket.Before(query.To) {
+			continue
+		}
+
+		sketch := NewSketch()
+		if err := sketch.UnmarshalBinary(r.Visitors); err != nil {
+			return nil, err
+		}
+
+		if r.Dimension == domain.DimensionTotal {
+			i, ok := index[BucketStart(r.Bucket, query.Bucket, query.Location)]
+			if !ok {
+				continue
+			}
+			summary.Buckets[i].Clicks += r.Clicks
+			bucketSketches[i].Merge(sketch)
+			summary.Clicks += r.Clicks
+			total.Merge(sketch)
+			continue
+		}
+
+		if values[r.Dimension] == nil {
+			values[r.Dimension] = make(map[string]*rollupValue)
+		}
+		v, ok := values[r.Dimension][r.Value]
+		if !ok {
+			v = &rollupValue{visitors: NewSketch()}
+			values[r.Dimension][r.Value] = v
+		}
+		v.clicks += r.Clicks
+		v.visitors.Merge(sketch)
+	}
+
+	for i := range summary.Buckets {
+		if summary.Buckets[i].Clicks > 0 {
+			summary.Buckets[i].UniqueVisitors = bucketSketches[i].Estimate()
+		}
+	}
+	if summary.Clicks > 0 {
+		summary.UniqueVisitors = total.Estimate()
+	}
+
+	if len(query.Dimensions) > 0 {
+		summary.Dimensions = make(map[string][]domain.DimensionCount, len(query.Dimensions))
+	}
+	for _, dimension := range query.Dimensions {
+		counts := []domain.DimensionCount{}
+		for value, v := range values[dimension] {
+			counts = append(counts, domain.DimensionCount{
+				Value:          value,
+				Clicks:         v.clicks,
+				UniqueVisitors: v.visitors.Estimate(),
+			})
+		}
+
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Clicks != counts[j].Clicks {
+				return counts[i].Clicks > counts[j].Clicks
+			}
+			return counts[i].Value < counts[j].Value
+		})
+		if query.Limit > 0 && len(counts) > query.Limit {
+			counts = counts[:query.Limit]
+		}
+
+		summary.Dimensions[dimension] = counts
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,152 @@
+package rollup
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findRollup(rollups []domain.AnalyticsRollup, dimension, value string) *domain.AnalyticsRollup {
+	for i := range rollups {
+		if rollups[i].Dimension == dimension && rollups[i].Value == value {
+			return &rollups[i]
+		}
+	}
+	return nil
+}
+
+func TestFold(t *testing.T) {
+	hour := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	visits := []domain.Analytics{
+		{URLID: 1, VisitorIP: "1.1.1.1", UserAgent: "a", Timestamp: hour.Add(5 * time.Minute), CountryCode: "US", Referer: "https://www.Google.com/search"},
+		{URLID: 1, VisitorIP: "1.1.1.1", UserAgent: "a", Timestamp: hour.Add(10 * time.Minute), CountryCode: "US"},
+		{URLID: 1, VisitorIP: "2.2.2.2", UserAgent: "b", Timestamp: hour.Add(20 * time.Minute), CountryCode: "DE"},
+		{URLID: 1, VisitorIP: "3.3.3.3", UserAgent: "bot", Timestamp: hour.Add(30 * time.Minute), CountryCode: "US", IsBot: true},
+	}
+
+	rollups, err := Fold(nil, visits)
+	require.NoError(t, err)
+
+	total := findRollup(rollups, domain.DimensionTotal, "")
+	require.NotNil(t, total)
+	assert.Equal(t, hour, total.Bucket)
+	assert.Equal(t, int64(3), total.Clicks)
+
+	us := findRollup(rollups, domain.DimensionCountry, "US")
+	require.NotNil(t, us)
+	assert.Equal(t, int64(2), us.Clicks)
+
+	google := findRollup(rollups, domain.DimensionReferer, "google.com")
+	require.NotNil(t, google)
+	assert.Equal(t, int64(1), google.Clicks)
+	assert.NotNil(t, findRollup(rollups, domain.DimensionReferer, ""))
+
+	// Folding more visits into the stored rollups accumulates them
+	more := []domain.Analytics{
+		{URLID: 1, VisitorIP: "4.4.4.4", UserAgent: "c", Timestamp: hour.Add(40 * time.Minute), CountryCode: "FR"},
+	}
+	rollups, err = Fold(rollups, more)
+	require.NoError(t, err)
+
+	total = findRollup(rollups, domain.DimensionTotal, "")
+	require.NotNil(t, total)
+	assert.Equal(t, int64(4), total.Clicks)
+
+	sketch := NewSketch()
+	require.NoError(t, sketch.UnmarshalBinary(total.Visitors))
+	assert.Equal(t, int64(3), sketch.Estimate())
+
+	// Only changed rollups are returned
+	assert.Nil(t, findRollup(rollups, domain.DimensionCountry, "US"))
+
+	// Long values are cut to whole characters, never mid-rune
+	host := strings.Repeat("ü", 300) + ".example"
+	rollups, err = Fold(nil, []domain.Analytics{
+		{URLID: 1, VisitorIP: "5.5.5.5", UserAgent: "d", Timestamp: hour, Referer: "https://" + host + "/"},
+	})
+	require.NoError(t, err)
+
+	long := findRollup(rollups, domain.DimensionReferer, host[:len("ü")*maxValueLength])
+	require.NotNil(t, long)
+	assert.True(t, utf8.ValidString(long.Value))
+	assert.Equal(t, maxValueLength, utf8.RuneCountInString(long.Value))
+}
+
+func TestRefererHost(t *testing.T) {
+	assert.Equal(t, "news.ycombinator.com", RefererHost("https://news.ycombinator.com/item?id=1"))
+	assert.Equal(t, "example.com", RefererHost("http://WWW.Example.com:8080/"))
+	assert.Equal(t, "", RefererHost(""))
+	assert.Equal(t, "", RefererHost("::not a url"))
+}
+
+func TestBucketStart(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	// Wednesday 2024-03-06 20:30 UTC is Thursday 03:30 in Jakarta
+	ts := time.Date(2024, 3, 6, 20, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 3, 6, 20, 0, 0, 0, time.UTC), BucketStart(ts, domain.BucketHour, time.UTC))
+	assert.Equal(t, time.Date(2024, 3, 7, 0, 0, 0, 0, jakarta), BucketStart(ts, domain.BucketDay, jakarta))
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, jakarta), BucketStart(ts, domain.BucketWeek, jakarta))
+}
+
+func TestSummarize(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	visit := func(hour int, ip, country string) domain.Analytics {
+		return domain.Analytics{
+			URLID:       1,
+			VisitorIP:   ip,
+			Timestamp:   time.Date(2024, 3, 4, hour, 15, 0, 0, time.UTC),
+			CountryCode: country,
+		}
+	}
+	// 18:00 UTC is already the next day in Jakarta (UTC+7)
+	rollups, err := Fold(nil, []domain.Analytics{
+		visit(1, "1.1.1.1", "ID"),
+		visit(2, "1.1.1.1", "ID"),
+		visit(18, "2.2.2.2", "SG"),
+		visit(18, "3.3.3.3", "ID"),
+	})
+	require.NoError(t, err)
+
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, jakarta)
+	summary, err := Summarize(rollups, domain.SummaryQuery{
+		URLID:      1,
+		From:       from,
+		To:         from.AddDate(0, 0, 3),
+		Bucket:     domain.BucketDay,
+		Location:   jakarta,
+		Dimensions: []string{domain.DimensionCountry},
+		Limit:      1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Asia/Jakarta", summary.Timezone)
+	assert.Equal(t, int64(4), summary.Clicks)
+	assert.Equal(t, int64(3), summary.UniqueVisitors)
+
+	// Empty buckets are reported too
+	require.Len(t, summary.Buckets, 3)
+	assert.Equal(t, domain.SummaryBucket{Start: from, Clicks: 2, UniqueVisitors: 1}, summary.Buckets[0])
+	assert.Equal(t, domain.SummaryBucket{Start: from.AddDate(0, 0, 1), Clicks: 2, UniqueVisitors: 2}, summary.Buckets[1])
+	assert.Equal(t, domain.SummaryBucket{Start: from.AddDate(0, 0, 2)}, summary.Buckets[2])
+
+	assert.Equal(t, []domain.DimensionCount{{Value: "ID", Clicks: 3, UniqueVisitors: 2}}, summary.Dimensions[domain.DimensionCountry])
+}
+
+func TestBucketCount(t *testing.T) {
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	query := domain.SummaryQuery{From: from, To: from.AddDate(0, 0, 30), Bucket: domain.BucketHour, Location: time.UTC}
+	assert.Equal(t, 720, BucketCount(query, 1000))
+	assert.Equal(t, 101, BucketCount(query, 100))
+
+	query.Bucket = domain.BucketWeek
+	assert.Equal(t, 5, BucketCount(query, 1000))
+}
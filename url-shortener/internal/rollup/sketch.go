@@ -0,0 +1,151 @@
+package rollup
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// sketchPrecision gives 2^10 registers: a standard error of about 3% for
+// at most 1 KiB per sketch
+const (
+	sketchPrecision = 10
+	sketchRegisters = 1 << sketchPrecision
+)
+
+// Encodings of a marshalled sketch
+const (
+	sketchSparse byte = 1
+	sketchDense  byte = 2
+)
+
+var errInvalidSketch = errors.New("invalid visitor sketch")
+
+// Sketch is a HyperLogLog counter of distinct visitors. Sketches of
+// different hours merge losslessly, which is what lets unique visitors be
+// reported over any range from hourly rollups.
+type Sketch struct {
+	registers [sketchRegisters]uint8
+}
+
+// NewSketch returns an empty sketch
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+// HashVisitor derives the value added to a sketch for a visitor
+func HashVisitor(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	// FNV's high bits are weak for short keys; finish with the splitmix64 mixer
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add records a visitor hash
+func (s *Sketch) Add(hash uint64) {
+	index := hash >> (64 - sketchPrecision)
+	// The guard bit caps the rank for hashes whose remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(hash<<sketchPrecision|1<<(sketchPrecision-1))) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge folds other into s
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct visitors added
+func (s *Sketch) Estimate() int64 {
+	const m = float64(sketchRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch, listing only the set registers while
+// that is smaller than the full register array
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, r := range s.registers {
+		if r != 0 {
+			set++
+		}
+	}
+
+	if 3*set < sketchRegisters {
+		data := make([]byte, 1, 1+3*set)
+		data[0] = sketchSparse
+		for i, r := range s.registers {
+			if r != 0 {
+				data = append(data, byte(i>>8), byte(i), r)
+			}
+		}
+		return data, nil
+	}
+
+	data := make([]byte, 1+sketchRegisters)
+	data[0] = sketchDense
+	copy(data[1:], s.registers[:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	*s = Sketch{}
+	if len(data) == 0 {
+		return errInvalidSketch
+	}
+
+	switch data[0] {
+	case sketchSparse:
+		pairs := data[1:]
+		if len(pairs)%3 != 0 {
+			return errInvalidSketch
+		}
+		for i := 0; i < len(pairs); i += 3 {
+			index := int(pairs[i])<<8 | int(pairs[i+1])
+			if index >= sketchRegisters {
+				return errInvalidSketch
+			}
+			s.registers[index] = pairs[i+2]
+		}
+	case sketchDense:
+		if len(data) != 1+sketchRegisters {
+			return errInvalidSketch
+		}
+		copy(s.registers[:], data[1:])
+	default:
+		return errInvalidSketch
+	}
+
+	return nil
+}
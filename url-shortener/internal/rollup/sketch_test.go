@@ -0,0 +1,72 @@
+package rollup
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchEstimate(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 200000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			s := NewSketch()
+			for i := 0; i < n; i++ {
+				// Adding every visitor twice must not change the estimate
+				s.Add(HashVisitor(fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+				s.Add(HashVisitor(fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+			}
+
+			got := float64(s.Estimate())
+			assert.LessOrEqual(t, math.Abs(got-float64(n)), math.Max(1, 0.1*float64(n)), "estimate %v for %d visitors", got, n)
+		})
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b, both := NewSketch(), NewSketch(), NewSketch()
+	for i := 0; i < 3000; i++ {
+		h := HashVisitor(fmt.Sprint("visitor-", i))
+		if i < 2000 {
+			a.Add(h)
+		}
+		if i >= 1000 {
+			b.Add(h)
+		}
+		both.Add(h)
+	}
+
+	a.Merge(b)
+	assert.Equal(t, both.Estimate(), a.Estimate())
+}
+
+func TestSketchMarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 10, 5000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			s := NewSketch()
+			for i := 0; i < n; i++ {
+				s.Add(HashVisitor(fmt.Sprint("visitor-", i)))
+			}
+
+			data, err := s.MarshalBinary()
+			require.NoError(t, err)
+			if n <= 10 {
+				assert.Equal(t, sketchSparse, data[0])
+			} else {
+				assert.Equal(t, sketchDense, data[0])
+			}
+
+			decoded := NewSketch()
+			require.NoError(t, decoded.UnmarshalBinary(data))
+			assert.Equal(t, s, decoded)
+		})
+	}
+}
+
+func TestSketchUnmarshalInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, {9}, {sketchSparse, 0}, {sketchSparse, 0xff, 0xff, 1}, {sketchDense, 1}} {
+		assert.Error(t, NewSketch().UnmarshalBinary(data))
+	}
+}
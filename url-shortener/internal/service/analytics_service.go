@@ -2,38 +2,163 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/rollup"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/useragent"
+)
+
+const (
+	// DefaultDimensionLimit is the number of values reported per dimension
+	// when a summary query does not specify one
+	DefaultDimensionLimit = 10
+	// MaxDimensionLimit caps the values reported per dimension
+	MaxDimensionLimit = 100
+	// MaxSummaryBuckets caps the number of buckets a summary may span
+	MaxSummaryBuckets = 1000
 )
 
 type AnalyticsService struct {
-	repo domain.AnalyticsRepository
+	repo    domain.AnalyticsRepository
+	rollups domain.AnalyticsRollupRepository
+	owners  domain.OwnershipChecker
+	quotas  domain.QuotaChecker
 }
 
-// New creates a new analytics service
-func NewAnalyticsService(repo domain.AnalyticsRepository) domain.AnalyticsService {
+// New creates a new analytics service. Analytics are reported as far back
+// as the plan of the URL's workspace retains them.
+func NewAnalyticsService(repo domain.AnalyticsRepository, rollups domain.AnalyticsRollupRepository, owners domain.OwnershipChecker, quotas domain.QuotaChecker) domain.AnalyticsService {
 	return &AnalyticsService{
-		repo: repo,
+		repo:    repo,
+		rollups: rollups,
+		owners:  owners,
+		quotas:  quotas,
 	}
 }
 
 // RecordVisit records a new visit to a URL
-func (s *AnalyticsService) RecordVisit(ctx context.Context, urlID int64, visitorIP, userAgent, referer string) error {
+func (s *AnalyticsService) RecordVisit(ctx context.Context, urlID int64, visitorIP, userAgent, referer string, visitedAt time.Time) error {
+	if visitedAt.IsZero() {
+		visitedAt = time.Now()
+	}
+
+	ua := useragent.Parse(userAgent)
 	analytics := &domain.Analytics{
-		URLID:       urlID,
-		VisitorIP:   visitorIP,
-		UserAgent:   userAgent,
-		Referer:     referer,
-		Timestamp:   time.Now(),
-		CountryCode: "Unknown", // This could be enhanced with IP geolocation
-		DeviceType:  "Unknown", // This could be enhanced with user agent parsing
+		URLID:      urlID,
+		VisitorIP:  visitorIP,
+		UserAgent:  userAgent,
+		Referer:    referer,
+		Timestamp:  visitedAt,
+		DeviceType: ua.DeviceType,
+		Browser:    ua.Browser,
+		OS:         ua.OS,
+		IsBot:      ua.IsBot,
 	}
 
 	return s.repo.Create(ctx, analytics)
 }
 
 // GetURLAnalytics retrieves analytics for a specific URL
-func (s *AnalyticsService) GetURLAnalytics(ctx context.Context, urlID int64) ([]domain.Analytics, error) {
-	return s.repo.GetByURLID(ctx, urlID)
+func (s *AnalyticsService) GetURLAnalytics(ctx context.Context, urlID int64, userID string) ([]domain.Analytics, error) {
+	if err := s.owners.CheckURL(ctx, urlID, userID, domain.PermissionView); err != nil {
+		return nil, err
+	}
+
+	start, err := s.quotas.RetentionStart(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	visits, err := s.repo.GetByURLID(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	retained := visits[:0]
+	for _, visit := range visits {
+		if !visit.Timestamp.Before(start) {
+			retained = append(retained, visit)
+		}
+	}
+
+	return retained, nil
+}
+
+// GetURLSummary reports a URL's clicks and unique visitors per time bucket,
+// optionally broken down by dimensions, from the hourly rollups
+func (s *AnalyticsService) GetURLSummary(ctx context.Context, query domain.SummaryQuery) (*domain.AnalyticsSummary, error) {
+	switch query.Bucket {
+	case "":
+		query.Bucket = domain.BucketDay
+	case domain.BucketHour, domain.BucketDay, domain.BucketWeek:
+	default:
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("unknown bucket %q", query.Bucket)}
+	}
+
+	seen := make(map[string]bool, len(query.Dimensions))
+	dimensions := make([]string, 0, len(query.Dimensions))
+	for _, dimension := range query.Dimensions {
+		if !isRolledUp(dimension) {
+			return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("unknown dimension %q", dimension)}
+		}
+		if !seen[dimension] {
+			seen[dimension] = true
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	query.Dimensions = dimensions
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = DefaultDimensionLimit
+	case query.Limit < 0 || query.Limit > MaxDimensionLimit:
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("limit must be between 1 and %d", MaxDimensionLimit)}
+	}
+
+	if query.Location == nil {
+		query.Location = time.UTC
+	}
+	if !query.From.Before(query.To) {
+		return nil, &domain.ErrInvalidQuery{Reason: "from must be before to"}
+	}
+
+	// Report whole buckets
+	query.From = rollup.BucketStart(query.From, query.Bucket, query.Location)
+	if rollup.BucketCount(query, MaxSummaryBuckets) > MaxSummaryBuckets {
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("range spans more than %d buckets", MaxSummaryBuckets)}
+	}
+
+	if err := s.owners.CheckURL(ctx, query.URLID, query.UserID, domain.PermissionView); err != nil {
+		return nil, err
+	}
+
+	// Older buckets are beyond the plan's retention
+	start, err := s.quotas.RetentionStart(ctx, query.URLID)
+	if err != nil {
+		return nil, err
+	}
+	if query.From.Before(start) {
+		query.From = rollup.BucketStart(start, query.Bucket, query.Location)
+		if !query.From.Before(query.To) {
+			return nil, &domain.ErrInvalidQuery{Reason: "range is older than the plan retains analytics"}
+		}
+	}
+
+	rollups, err := s.rollups.GetRollups(ctx, query.URLID, query.From, query.To, query.Dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	return rollup.Summarize(rollups, query)
+}
+
+func isRolledUp(dimension string) bool {
+	for _, d := range rollup.Dimensions {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/rollup"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -20,6 +21,11 @@ func (m *MockAnalyticsRepository) Create(ctx context.Context, analytics *domain.
 	return args.Error(0)
 }
 
+func (m *MockAnalyticsRepository) CreateBatch(ctx context.Context, visits []domain.Analytics) error {
+	args := m.Called(ctx, visits)
+	return args.Error(0)
+}
+
 func (m *MockAnalyticsRepository) GetByURLID(ctx context.Context, urlID int64) ([]domain.Analytics, error) {
 	args := m.Called(ctx, urlID)
 	if args.Get(0) == nil {
@@ -28,9 +34,27 @@ func (m *MockAnalyticsRepository) GetByURLID(ctx context.Context, urlID int64) (
 	return args.Get(0).([]domain.Analytics), args.Error(1)
 }
 
+// MockAnalyticsRollupRepository is a mock implementation of AnalyticsRollupRepository
+type MockAnalyticsRollupRepository struct {
+	mock.Mock
+}
+
+func (m *MockAnalyticsRollupRepository) AggregateVisits(ctx context.Context, limit int) (int, error) {
+	args := m.Called(ctx, limit)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAnalyticsRollupRepository) GetRollups(ctx context.Context, urlID int64, from, to time.Time, dimensions []string) ([]domain.AnalyticsRollup, error) {
+	args := m.Called(ctx, urlID, from, to, dimensions)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.AnalyticsRollup), args.Error(1)
+}
+
 func TestRecordVisit(t *testing.T) {
 	mockRepo := new(MockAnalyticsRepository)
-	service := NewAnalyticsService(mockRepo)
+	service := NewAnalyticsService(mockRepo, new(MockAnalyticsRollupRepository), new(MockOwnershipChecker), unlimitedQuotas())
 	ctx := context.Background()
 
 	tests := []struct {
@@ -71,7 +95,7 @@ func TestRecordVisit(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
 			tt.mockSetup()
 
-			err := service.RecordVisit(ctx, tt.urlID, tt.visitorIP, tt.userAgent, tt.referer)
+			err := service.RecordVisit(ctx, tt.urlID, tt.visitorIP, tt.userAgent, tt.referer, time.Now())
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -83,7 +107,8 @@ func TestRecordVisit(t *testing.T) {
 
 func TestGetURLAnalytics(t *testing.T) {
 	mockRepo := new(MockAnalyticsRepository)
-	service := NewAnalyticsService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewAnalyticsService(mockRepo, new(MockAnalyticsRollupRepository), mockOwners, unlimitedQuotas())
 	ctx := context.Background()
 
 	now := time.Now()
@@ -120,6 +145,7 @@ func TestGetURLAnalytics(t *testing.T) {
 			name:  "Success",
 			urlID: 1,
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
 				mockRepo.On("GetByURLID", ctx, int64(1)).Return(analytics, nil)
 			},
 			wantErr: false,
@@ -128,18 +154,28 @@ func TestGetURLAnalytics(t *testing.T) {
 			name:  "Repository Error",
 			urlID: 1,
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
 				mockRepo.On("GetByURLID", ctx, int64(1)).Return(nil, assert.AnError)
 			},
 			wantErr: true,
 		},
+		{
+			name:  "Not Owner",
+			urlID: 1,
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(&domain.ErrForbidden{Resource: "URL", ID: 1})
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			result, err := service.GetURLAnalytics(ctx, tt.urlID)
+			result, err := service.GetURLAnalytics(ctx, tt.urlID, "user123")
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, result)
@@ -160,3 +196,173 @@ func TestGetURLAnalytics(t *testing.T) {
 		})
 	}
 }
+
+func TestGetURLSummary(t *testing.T) {
+	mockRollups := new(MockAnalyticsRollupRepository)
+	mockOwners := new(MockOwnershipChecker)
+	mockQuotas := new(MockQuotaChecker)
+	service := NewAnalyticsService(new(MockAnalyticsRepository), mockRollups, mockOwners, mockQuotas)
+	ctx := context.Background()
+
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	visitors, err := rollup.NewSketch().MarshalBinary()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		query      domain.SummaryQuery
+		mockSetup  func()
+		wantErr    bool
+		wantBucket int
+	}{
+		{
+			name: "Success",
+			query: domain.SummaryQuery{
+				URLID:      1,
+				UserID:     "user123",
+				From:       day.Add(5 * time.Hour),
+				To:         day.AddDate(0, 0, 2),
+				Dimensions: []string{domain.DimensionCountry, domain.DimensionCountry},
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
+				// From is aligned to the start of its bucket and dimensions are deduplicated
+				mockRollups.On("GetRollups", ctx, int64(1), day, day.AddDate(0, 0, 2), []string{domain.DimensionCountry}).
+					Return([]domain.AnalyticsRollup{
+						{URLID: 1, Bucket: day.Add(time.Hour), Clicks: 3, Visitors: visitors},
+					}, nil)
+			},
+			wantErr:    false,
+			wantBucket: 2,
+		},
+		{
+			name: "Clamped To Plan Retention",
+			query: domain.SummaryQuery{
+				URLID:      1,
+				UserID:     "user123",
+				From:       day,
+				To:         day.AddDate(0, 0, 2),
+				Dimensions: []string{domain.DimensionCountry},
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
+				mockQuotas.ExpectedCalls = nil
+				mockQuotas.On("RetentionStart", ctx, int64(1)).Return(day.Add(30*time.Hour), nil)
+				mockRollups.On("GetRollups", ctx, int64(1), day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), []string{domain.DimensionCountry}).
+					Return([]domain.AnalyticsRollup{
+						{URLID: 1, Bucket: day.Add(25 * time.Hour), Clicks: 3, Visitors: visitors},
+					}, nil)
+			},
+			wantErr:    false,
+			wantBucket: 1,
+		},
+		{
+			name: "Older Than Plan Retention",
+			query: domain.SummaryQuery{
+				URLID:  1,
+				UserID: "user123",
+				From:   day,
+				To:     day.AddDate(0, 0, 1),
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
+				mockQuotas.ExpectedCalls = nil
+				mockQuotas.On("RetentionStart", ctx, int64(1)).Return(day.AddDate(0, 0, 3), nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown Bucket",
+			query: domain.SummaryQuery{
+				URLID:  1,
+				From:   day,
+				To:     day.AddDate(0, 0, 1),
+				Bucket: "month",
+			},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name: "Unknown Dimension",
+			query: domain.SummaryQuery{
+				URLID:      1,
+				From:       day,
+				To:         day.AddDate(0, 0, 1),
+				Dimensions: []string{"visitor_ip"},
+			},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name: "Empty Range",
+			query: domain.SummaryQuery{
+				URLID: 1,
+				From:  day,
+				To:    day,
+			},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name: "Too Many Buckets",
+			query: domain.SummaryQuery{
+				URLID:  1,
+				From:   day,
+				To:     day.AddDate(1, 0, 0),
+				Bucket: domain.BucketHour,
+			},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name: "Repository Error",
+			query: domain.SummaryQuery{
+				URLID:  1,
+				UserID: "user123",
+				From:   day,
+				To:     day.AddDate(0, 0, 1),
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
+				mockRollups.On("GetRollups", ctx, int64(1), day, day.AddDate(0, 0, 1), []string{}).Return(nil, assert.AnError)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Not Owner",
+			query: domain.SummaryQuery{
+				URLID:  1,
+				UserID: "user456",
+				From:   day,
+				To:     day.AddDate(0, 0, 1),
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user456", domain.PermissionView).Return(&domain.ErrForbidden{Resource: "URL", ID: 1})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRollups.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockQuotas.ExpectedCalls = nil
+			mockQuotas.On("RetentionStart", ctx, int64(1)).Return(time.Time{}, nil)
+			tt.mockSetup()
+
+			summary, err := service.GetURLSummary(ctx, tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, summary)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, domain.BucketDay, summary.Bucket)
+				assert.Equal(t, "UTC", summary.Timezone)
+				assert.Len(t, summary.Buckets, tt.wantBucket)
+				assert.Equal(t, int64(3), summary.Clicks)
+				assert.Contains(t, summary.Dimensions, domain.DimensionCountry)
+			}
+		})
+	}
+}
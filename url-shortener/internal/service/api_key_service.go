@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+const (
+	// apiKeySecretBytes is the entropy of a key; it is high enough for an
+	// unsalted SHA-256 to be a safe way to store keys
+	apiKeySecretBytes = 32
+
+	// apiKeyPrefixLength is how much of a key is kept in the clear, "snx_"
+	// included
+	apiKeyPrefixLength = 12
+
+	// maxAPIKeyNameLength matches api_keys.name VARCHAR(100)
+	maxAPIKeyNameLength = 100
+
+	// lastUsedResolution bounds how often a key's last use is written, so
+	// busy keys do not cost a write per request
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyService struct {
+	repo internalDomain.APIKeyRepository
+	now  func() time.Time
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(repo internalDomain.APIKeyRepository) internalDomain.APIKeyService {
+	return &APIKeyService{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// hashAPIKey returns the stored form of key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates a key for userID. The returned secret is not stored
+// and cannot be retrieved later.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID string, name string, scopes []string, expiresAt *time.Time) (*internalDomain.NewAPIKey, error) {
+	name, err := validateAPIKeyName(name)
+	if err != nil {
+		return nil, err
+	}
+	scopes, err = validateScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return nil, &internalDomain.ErrInvalidAPIKeyRequest{Reason: "expires_at must be in the future"}
+	}
+
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := internalDomain.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := internalDomain.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   hashAPIKey(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &internalDomain.NewAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys returns every key of userID, revoked ones included
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]internalDomain.APIKey, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// RenameAPIKey changes the name of a key owned by userID
+func (s *APIKeyService) RenameAPIKey(ctx context.Context, id int64, userID string, name string) (*internalDomain.APIKey, error) {
+	name, err := validateAPIKeyName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.ownedKey(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateName(ctx, id, name); err != nil {
+		return nil, err
+	}
+
+	key.Name = name
+	return key, nil
+}
+
+// RevokeAPIKey stops a key owned by userID from authenticating. The key is
+// kept so requests it made can still be attributed.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id int64, userID string) error {
+	if _, err := s.ownedKey(ctx, id, userID); err != nil {
+		return err
+	}
+
+	return s.repo.Revoke(ctx, id, s.now())
+}
+
+// Authenticate returns the live key matching key
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*internalDomain.APIKey, error) {
+	if !strings.HasPrefix(key, internalDomain.APIKeyPrefix) {
+		return nil, &internalDomain.ErrInvalidToken{Message: "Invalid API key"}
+	}
+
+	apiKey, err := s.repo.GetByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		if _, ok := err.(*internalDomain.ErrAPIKeyNotFound); ok {
+			return nil, &internalDomain.ErrInvalidToken{Message: "Invalid API key"}
+		}
+		return nil, err
+	}
+
+	now := s.now()
+	if apiKey.RevokedAt != nil {
+		return nil, &internalDomain.ErrInvalidToken{Message: "API key revoked"}
+	}
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now) {
+		return nil, &internalDomain.ErrInvalidToken{Message: "API key expired"}
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		// A failed write only costs the key's usage record, not the request
+		if err := s.repo.TouchLastUsed(ctx, apiKey.ID, now); err != nil {
+			log.Printf("[ERROR] recording use of API key %d: %v", apiKey.ID, err)
+		} else {
+			apiKey.LastUsedAt = &now
+		}
+	}
+
+	return apiKey, nil
+}
+
+// ownedKey loads a key and verifies that userID owns it
+func (s *APIKeyService) ownedKey(ctx context.Context, id int64, userID string) (*internalDomain.APIKey, error) {
+	key, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.UserID != userID {
+		return nil, &internalDomain.ErrForbidden{Resource: "API key", ID: id}
+	}
+
+	return key, nil
+}
+
+func validateAPIKeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", &internalDomain.ErrInvalidAPIKeyRequest{Reason: "name is required"}
+	}
+	if len(name) > maxAPIKeyNameLength {
+		return "", &internalDomain.ErrInvalidAPIKeyRequest{Reason: "name is too long"}
+	}
+	return name, nil
+}
+
+// validateScopes rejects unknown scopes and drops duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	known := make(map[string]bool, len(internalDomain.APIKeyScopes))
+	for _, scope := range internalDomain.APIKeyScopes {
+		known[scope] = true
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	valid := []string{}
+	for _, scope := range scopes {
+		if !known[scope] {
+			return nil, &internalDomain.ErrInvalidAPIKeyRequest{Reason: "unknown scope " + scope}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	return valid, nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAPIKeyRepository is a mock implementation of APIKeyRepository
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *internalDomain.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) GetByID(ctx context.Context, id int64) (*internalDomain.APIKey, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*internalDomain.APIKey, error) {
+	args := m.Called(ctx, keyHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetByUserID(ctx context.Context, userID string) ([]internalDomain.APIKey, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) UpdateName(ctx context.Context, id int64, name string) error {
+	args := m.Called(ctx, id, name)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) Revoke(ctx context.Context, id int64, t time.Time) error {
+	args := m.Called(ctx, id, t)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) TouchLastUsed(ctx context.Context, id int64, t time.Time) error {
+	args := m.Called(ctx, id, t)
+	return args.Error(0)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	service := NewAPIKeyService(mockRepo)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		keyName    string
+		scopes     []string
+		expiresAt  *time.Time
+		mockSetup  func()
+		wantScopes []string
+		wantErr    error
+	}{
+		{
+			name:    "Success",
+			keyName: "  ci  ",
+			scopes:  []string{internalDomain.ScopeURLsWrite, internalDomain.ScopeAnalyticsRead, internalDomain.ScopeURLsWrite},
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(key *internalDomain.APIKey) bool {
+					return key.UserID == "user123" && key.Name == "ci" && len(key.KeyHash) == 64
+				})).Return(nil)
+			},
+			wantScopes: []string{internalDomain.ScopeURLsWrite, internalDomain.ScopeAnalyticsRead},
+		},
+		{
+			name:    "Unscoped",
+			keyName: "deploy",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.Anything).Return(nil)
+			},
+			wantScopes: []string{},
+		},
+		{
+			name:      "Missing Name",
+			keyName:   " ",
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidAPIKeyRequest{},
+		},
+		{
+			name:      "Unknown Scope",
+			keyName:   "ci",
+			scopes:    []string{"urls:delete"},
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidAPIKeyRequest{},
+		},
+		{
+			name:      "Expiry In The Past",
+			keyName:   "ci",
+			expiresAt: &past,
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidAPIKeyRequest{},
+		},
+		{
+			name:    "Repository Error",
+			keyName: "ci",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.Anything).Return(assert.AnError)
+			},
+			wantErr: assert.AnError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			tt.mockSetup()
+
+			key, err := service.CreateAPIKey(ctx, "user123", tt.keyName, tt.scopes, tt.expiresAt)
+			if tt.wantErr != nil {
+				assert.IsType(t, tt.wantErr, err)
+				assert.Nil(t, key)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(key.Key, internalDomain.APIKeyPrefix))
+			assert.Equal(t, key.Key[:len(key.Prefix)], key.Prefix)
+			assert.Equal(t, hashAPIKey(key.Key), key.KeyHash)
+			assert.Equal(t, tt.wantScopes, key.Scopes)
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	service := NewAPIKeyService(mockRepo).(*APIKeyService)
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	recently := now.Add(-10 * time.Second)
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+	key := "snx_secret"
+
+	tests := []struct {
+		name      string
+		key       string
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name: "Records First Use",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(&internalDomain.APIKey{ID: 1, UserID: "user123"}, nil)
+				mockRepo.On("TouchLastUsed", ctx, int64(1), now).Return(nil).Once()
+			},
+		},
+		{
+			name: "Recently Used",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(&internalDomain.APIKey{ID: 1, LastUsedAt: &recently}, nil)
+			},
+		},
+		{
+			name: "Last Use Not Recorded",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(&internalDomain.APIKey{ID: 1, LastUsedAt: &lastWeek}, nil)
+				mockRepo.On("TouchLastUsed", ctx, int64(1), now).Return(assert.AnError)
+			},
+		},
+		{
+			name: "Revoked",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(&internalDomain.APIKey{ID: 1, RevokedAt: &recently}, nil)
+			},
+			wantErr: &internalDomain.ErrInvalidToken{},
+		},
+		{
+			name: "Expired",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(&internalDomain.APIKey{ID: 1, ExpiresAt: &recently}, nil)
+			},
+			wantErr: &internalDomain.ErrInvalidToken{},
+		},
+		{
+			name: "Unknown Key",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(nil, &internalDomain.ErrAPIKeyNotFound{})
+			},
+			wantErr: &internalDomain.ErrInvalidToken{},
+		},
+		{
+			name:      "Not An API Key",
+			key:       "eyJhbGciOi",
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidToken{},
+		},
+		{
+			name: "Repository Error",
+			key:  key,
+			mockSetup: func() {
+				mockRepo.On("GetByHash", ctx, hashAPIKey(key)).Return(nil, assert.AnError)
+			},
+			wantErr: assert.AnError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+			tt.mockSetup()
+
+			apiKey, err := service.Authenticate(ctx, tt.key)
+			if tt.wantErr != nil {
+				assert.IsType(t, tt.wantErr, err)
+				assert.Nil(t, apiKey)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, apiKey)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	service := NewAPIKeyService(mockRepo)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name: "Owner",
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&internalDomain.APIKey{ID: 1, UserID: "user123"}, nil)
+				mockRepo.On("Revoke", ctx, int64(1), mock.Anything).Return(nil)
+			},
+		},
+		{
+			name: "Not Owner",
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&internalDomain.APIKey{ID: 1, UserID: "another-user"}, nil)
+			},
+			wantErr: &internalDomain.ErrForbidden{},
+		},
+		{
+			name: "Not Found",
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(nil, &internalDomain.ErrAPIKeyNotFound{ID: 1})
+			},
+			wantErr: &internalDomain.ErrAPIKeyNotFound{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+			tt.mockSetup()
+
+			err := service.RevokeAPIKey(ctx, 1, "user123")
+			if tt.wantErr != nil {
+				assert.IsType(t, tt.wantErr, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -2,55 +2,215 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/dnsverify"
 	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
 type CustomDomainService struct {
-	repo internalDomain.CustomDomainRepository
+	repo     internalDomain.CustomDomainRepository
+	owners   internalDomain.OwnershipChecker
+	verifier *dnsverify.Verifier
+	quotas   internalDomain.QuotaChecker
+	hosts    *hostCache
 }
 
 // New creates a new custom domain service
-func NewCustomDomainService(repo internalDomain.CustomDomainRepository) internalDomain.CustomDomainService {
+func NewCustomDomainService(repo internalDomain.CustomDomainRepository, owners internalDomain.OwnershipChecker, verifier *dnsverify.Verifier, quotas internalDomain.QuotaChecker) internalDomain.CustomDomainService {
 	return &CustomDomainService{
-		repo: repo,
+		repo:     repo,
+		owners:   owners,
+		verifier: verifier,
+		quotas:   quotas,
+		hosts:    newHostCache(),
 	}
 }
 
-// RegisterDomain registers a new custom domain
-func (s *CustomDomainService) RegisterDomain(ctx context.Context, domain string, userID string) (*internalDomain.CustomDomain, error) {
+// normalizeDomain lower-cases a domain name and drops a trailing dot
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// RegisterDomain registers a new custom domain in a workspace userID
+// manages, within the domains its plan allows
+func (s *CustomDomainService) RegisterDomain(ctx context.Context, domain string, userID string, workspaceID int64) (*internalDomain.CustomDomain, error) {
+	domain = normalizeDomain(domain)
+
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if domain already exists
 	existingDomain, err := s.repo.GetByDomain(ctx, domain)
 	if err == nil && existingDomain != nil {
 		return nil, &internalDomain.ErrDomainAlreadyExists{Domain: domain}
 	}
 
+	quota, err := s.quotas.DomainQuota(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := dnsverify.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
 	customDomain := &internalDomain.CustomDomain{
-		Domain:    domain,
-		UserID:    userID,
-		Verified:  false,
-		CreatedAt: time.Now(),
+		Domain:            domain,
+		UserID:            userID,
+		WorkspaceID:       workspaceID,
+		Verified:          false,
+		VerificationToken: token,
+		CreatedAt:         time.Now(),
 	}
 
-	if err := s.repo.Create(ctx, customDomain); err != nil {
+	if err := s.repo.Create(ctx, customDomain, quota); err != nil {
 		return nil, err
 	}
 
 	return customDomain, nil
 }
 
-// GetUserDomains retrieves all domains for a user
-func (s *CustomDomainService) GetUserDomains(ctx context.Context, userID string) ([]internalDomain.CustomDomain, error) {
-	return s.repo.GetByUserID(ctx, userID)
+// GetUserDomains retrieves all domains of a workspace userID can view
+func (s *CustomDomainService) GetUserDomains(ctx context.Context, userID string, workspaceID int64) ([]internalDomain.CustomDomain, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByWorkspaceID(ctx, workspaceID)
 }
 
 // DeleteDomain deletes a custom domain
 func (s *CustomDomainService) DeleteDomain(ctx context.Context, id int64, userID string) error {
-	return s.repo.Delete(ctx, id, userID)
+	if err := s.owners.CheckDomain(ctx, id, userID, internalDomain.PermissionManage); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	// Deletes are rare; forgetting every host saves looking up the name
+	s.hosts.clear()
+	return nil
 }
 
-// VerifyDomain marks a domain as verified
-func (s *CustomDomainService) VerifyDomain(ctx context.Context, id int64) error {
-	return s.repo.VerifyDomain(ctx, id)
+// VerifyDomain checks that the domain publishes its verification token in a
+// TXT record or points at the edge host, and records the outcome
+func (s *CustomDomainService) VerifyDomain(ctx context.Context, id int64, userID string) (*internalDomain.CustomDomain, error) {
+	if err := s.owners.CheckDomain(ctx, id, userID, internalDomain.PermissionManage); err != nil {
+		return nil, err
+	}
+
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	checkErr := s.verifier.Apply(ctx, d)
+
+	// Only verified domains count against the quota, so verifying is where
+	// it is enforced
+	quota := internalDomain.QuotaLimit{Limit: internalDomain.Unlimited}
+	if d.Verified {
+		if quota, err = s.quotas.DomainQuota(ctx, d.WorkspaceID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.UpdateVerification(ctx, d, quota); err != nil {
+		return nil, err
+	}
+	s.hosts.remove(d.Domain)
+	if checkErr != nil {
+		return nil, checkErr
+	}
+
+	return d, nil
+}
+
+// UpdateDomain changes where a domain redirects its bare host and unknown
+// short codes
+func (s *CustomDomainService) UpdateDomain(ctx context.Context, id int64, userID string, update internalDomain.CustomDomainUpdate) (*internalDomain.CustomDomain, error) {
+	if err := s.owners.CheckDomain(ctx, id, userID, internalDomain.PermissionManage); err != nil {
+		return nil, err
+	}
+
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.RootURL != nil {
+		if err := validateRedirectTarget("root_url", *update.RootURL); err != nil {
+			return nil, err
+		}
+		d.RootURL = *update.RootURL
+	}
+	if update.NotFoundURL != nil {
+		if err := validateRedirectTarget("not_found_url", *update.NotFoundURL); err != nil {
+			return nil, err
+		}
+		d.NotFoundURL = *update.NotFoundURL
+	}
+
+	if err := s.repo.UpdateSettings(ctx, d); err != nil {
+		return nil, err
+	}
+	s.hosts.remove(d.Domain)
+
+	return d, nil
+}
+
+// validateRedirectTarget accepts empty targets, which clear the setting,
+// and absolute http(s) URLs
+func validateRedirectTarget(field, target string) error {
+	if target == "" {
+		return nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &internalDomain.ErrInvalidDomainSettings{Reason: field + " must be an absolute http or https URL"}
+	}
+
+	return nil
+}
+
+// ResolveHost returns the verified custom domain serving host. Results,
+// including misses, are cached so redirects do not query the database.
+func (s *CustomDomainService) ResolveHost(ctx context.Context, host string) (*internalDomain.CustomDomain, error) {
+	host = normalizeDomain(host)
+
+	if d, ok := s.hosts.get(host); ok {
+		if d == nil {
+			return nil, &internalDomain.ErrDomainNotFound{Domain: host}
+		}
+		return d, nil
+	}
+
+	d, err := s.repo.GetByDomain(ctx, host)
+	var notFound *internalDomain.ErrDomainNotFound
+	if errors.As(err, &notFound) {
+		s.hosts.set(host, nil)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Unverified domains are not served until their owner proves control
+	if !d.Verified {
+		s.hosts.set(host, nil)
+		return nil, &internalDomain.ErrDomainNotFound{Domain: host}
+	}
+
+	s.hosts.set(host, d)
+	return d, nil
 }
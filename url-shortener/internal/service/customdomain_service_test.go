@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/dnsverify"
 	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockCustomDomainRepository is a mock implementation of CustomDomainRepository
@@ -15,8 +19,8 @@ type MockCustomDomainRepository struct {
 	mock.Mock
 }
 
-func (m *MockCustomDomainRepository) Create(ctx context.Context, domain *internalDomain.CustomDomain) error {
-	args := m.Called(ctx, domain)
+func (m *MockCustomDomainRepository) Create(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	args := m.Called(ctx, domain, quota)
 	return args.Error(0)
 }
 
@@ -36,28 +40,44 @@ func (m *MockCustomDomainRepository) GetByDomain(ctx context.Context, domain str
 	return args.Get(0).(*internalDomain.CustomDomain), args.Error(1)
 }
 
-func (m *MockCustomDomainRepository) GetByUserID(ctx context.Context, userID string) ([]internalDomain.CustomDomain, error) {
-	args := m.Called(ctx, userID)
+func (m *MockCustomDomainRepository) GetByWorkspaceID(ctx context.Context, workspaceID int64) ([]internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, workspaceID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]internalDomain.CustomDomain), args.Error(1)
 }
 
-func (m *MockCustomDomainRepository) Delete(ctx context.Context, id int64, userID string) error {
-	args := m.Called(ctx, id, userID)
+func (m *MockCustomDomainRepository) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockCustomDomainRepository) VerifyDomain(ctx context.Context, id int64) error {
-	args := m.Called(ctx, id)
+func (m *MockCustomDomainRepository) UpdateVerification(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	args := m.Called(ctx, domain, quota)
 	return args.Error(0)
 }
 
+func (m *MockCustomDomainRepository) UpdateSettings(ctx context.Context, domain *internalDomain.CustomDomain) error {
+	args := m.Called(ctx, domain)
+	return args.Error(0)
+}
+
+func (m *MockCustomDomainRepository) ListVerifiedCheckedBefore(ctx context.Context, t time.Time, limit int) ([]internalDomain.CustomDomain, error) {
+	args := m.Called(ctx, t, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.CustomDomain), args.Error(1)
+}
+
 func TestRegisterDomain(t *testing.T) {
 	mockRepo := new(MockCustomDomainRepository)
-	service := NewCustomDomainService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	mockQuotas := new(MockQuotaChecker)
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(dnsverify.NewFakeResolver(), ""), mockQuotas)
 	ctx := context.Background()
+	freeDomains := internalDomain.QuotaLimit{Quota: internalDomain.QuotaCustomDomains, Plan: internalDomain.PlanFree, Limit: 1}
 
 	tests := []struct {
 		name      string
@@ -71,18 +91,31 @@ func TestRegisterDomain(t *testing.T) {
 			domain: "example.com",
 			userID: "user123",
 			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
 				mockRepo.On("GetByDomain", ctx, "example.com").Return(nil, &internalDomain.ErrDomainNotFound{Domain: "example.com"})
 				mockRepo.On("Create", ctx, mock.MatchedBy(func(domain *internalDomain.CustomDomain) bool {
-					return domain.Domain == "example.com" && domain.UserID == "user123" && !domain.Verified
-				})).Return(nil)
+					return domain.Domain == "example.com" && domain.UserID == "user123" && domain.WorkspaceID == 7 &&
+						!domain.Verified && len(domain.VerificationToken) == 32
+				}), freeDomains).Return(nil)
 			},
 			wantErr: false,
 		},
+		{
+			name:   "Role Cannot Manage Domains",
+			domain: "example.com",
+			userID: "user123",
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).
+					Return(int64(0), &internalDomain.ErrForbidden{Resource: "workspace", ID: 7})
+			},
+			wantErr: true,
+		},
 		{
 			name:   "Domain Already Exists",
 			domain: "existing.com",
 			userID: "user123",
 			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
 				mockRepo.On("GetByDomain", ctx, "existing.com").Return(&internalDomain.CustomDomain{
 					ID:     1,
 					Domain: "existing.com",
@@ -91,15 +124,28 @@ func TestRegisterDomain(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:   "Plan Allows No More Domains",
+			domain: "example.com",
+			userID: "user123",
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetByDomain", ctx, "example.com").Return(nil, &internalDomain.ErrDomainNotFound{Domain: "example.com"})
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.CustomDomain"), freeDomains).
+					Return(freeDomains.Exceeded())
+			},
+			wantErr: true,
+		},
 		{
 			name:   "Repository Error",
 			domain: "example.com",
 			userID: "user123",
 			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
 				mockRepo.On("GetByDomain", ctx, "example.com").Return(nil, &internalDomain.ErrDomainNotFound{Domain: "example.com"})
 				mockRepo.On("Create", ctx, mock.MatchedBy(func(domain *internalDomain.CustomDomain) bool {
 					return domain.Domain == "example.com" && domain.UserID == "user123" && !domain.Verified
-				})).Return(assert.AnError)
+				}), freeDomains).Return(assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -108,9 +154,12 @@ func TestRegisterDomain(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockQuotas.ExpectedCalls = nil
+			mockQuotas.On("DomainQuota", ctx, int64(7)).Return(freeDomains, nil)
 			tt.mockSetup()
 
-			domain, err := service.RegisterDomain(ctx, tt.domain, tt.userID)
+			domain, err := service.RegisterDomain(ctx, tt.domain, tt.userID, 0)
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, domain)
@@ -125,9 +174,158 @@ func TestRegisterDomain(t *testing.T) {
 	}
 }
 
+// lockedDomainRepository stores domains like the PostgreSQL repository,
+// counting the verified domains of the workspace and writing under one lock
+type lockedDomainRepository struct {
+	internalDomain.CustomDomainRepository
+	mu      sync.Mutex
+	domains []internalDomain.CustomDomain
+}
+
+func (r *lockedDomainRepository) GetByDomain(ctx context.Context, domain string) (*internalDomain.CustomDomain, error) {
+	return nil, &internalDomain.ErrDomainNotFound{Domain: domain}
+}
+
+func (r *lockedDomainRepository) GetByID(ctx context.Context, id int64) (*internalDomain.CustomDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.domains {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, &internalDomain.ErrDomainNotFound{}
+}
+
+// verified counts the verified domains of workspaceID other than exceptID
+func (r *lockedDomainRepository) verified(workspaceID, exceptID int64) int {
+	held := 0
+	for _, d := range r.domains {
+		if d.WorkspaceID == workspaceID && d.Verified && (exceptID == 0 || d.ID != exceptID) {
+			held++
+		}
+	}
+	return held
+}
+
+func (r *lockedDomainRepository) Create(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if quota.Limit != internalDomain.Unlimited && r.verified(domain.WorkspaceID, 0) >= quota.Limit {
+		return quota.Exceeded()
+	}
+
+	domain.ID = int64(len(r.domains) + 1)
+	r.domains = append(r.domains, *domain)
+	return nil
+}
+
+func (r *lockedDomainRepository) UpdateVerification(ctx context.Context, domain *internalDomain.CustomDomain, quota internalDomain.QuotaLimit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if domain.Verified && quota.Limit != internalDomain.Unlimited && r.verified(domain.WorkspaceID, domain.ID) >= quota.Limit {
+		return quota.Exceeded()
+	}
+
+	for i := range r.domains {
+		if r.domains[i].ID == domain.ID {
+			r.domains[i] = *domain
+			return nil
+		}
+	}
+	return &internalDomain.ErrDomainNotFound{Domain: domain.Domain}
+}
+
+func TestVerifyDomainsConcurrently(t *testing.T) {
+	repo := &lockedDomainRepository{}
+	mockOwners := new(MockOwnershipChecker)
+	mockQuotas := new(MockQuotaChecker)
+	resolver := dnsverify.NewFakeResolver()
+	service := NewCustomDomainService(repo, mockOwners, dnsverify.NewVerifier(resolver, ""), mockQuotas)
+	ctx := context.Background()
+	pro := internalDomain.QuotaLimit{Quota: internalDomain.QuotaCustomDomains, Plan: internalDomain.PlanPro, Limit: 5}
+
+	mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+	mockOwners.On("CheckDomain", ctx, mock.Anything, "user123", internalDomain.PermissionManage).Return(nil)
+	mockQuotas.On("DomainQuota", ctx, int64(7)).Return(pro, nil)
+
+	const attempts = 20
+	ids := make([]int64, attempts)
+	for i := range attempts {
+		name := fmt.Sprintf("d%d.example.com", i)
+		d, err := service.RegisterDomain(ctx, name, "user123", 0)
+		assert.NoError(t, err)
+		resolver.SetTXT("_snax-verify."+name, d.VerificationToken)
+		ids[i] = d.ID
+	}
+
+	// Verifications racing for the domains of the plan get exactly the quota
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = service.VerifyDomain(ctx, ids[i], "user123")
+		}()
+	}
+	wg.Wait()
+
+	verified := 0
+	for _, err := range errs {
+		if err == nil {
+			verified++
+			continue
+		}
+		assert.IsType(t, &internalDomain.ErrQuotaExceeded{}, err)
+	}
+	assert.Equal(t, pro.Limit, verified)
+	assert.Equal(t, pro.Limit, repo.verified(7, 0))
+}
+
+func TestDomainQuotaCountsVerifiedDomains(t *testing.T) {
+	repo := &lockedDomainRepository{}
+	mockOwners := new(MockOwnershipChecker)
+	mockQuotas := new(MockQuotaChecker)
+	resolver := dnsverify.NewFakeResolver()
+	service := NewCustomDomainService(repo, mockOwners, dnsverify.NewVerifier(resolver, ""), mockQuotas)
+	ctx := context.Background()
+	free := internalDomain.QuotaLimit{Quota: internalDomain.QuotaCustomDomains, Plan: internalDomain.PlanFree, Limit: 1}
+
+	mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+	mockOwners.On("CheckDomain", ctx, mock.Anything, "user123", internalDomain.PermissionManage).Return(nil)
+	mockQuotas.On("DomainQuota", ctx, int64(7)).Return(free, nil)
+
+	// Unverified domains leave the quota to the next one
+	first, err := service.RegisterDomain(ctx, "go.acme.com", "user123", 0)
+	require.NoError(t, err)
+	second, err := service.RegisterDomain(ctx, "links.acme.com", "user123", 0)
+	require.NoError(t, err)
+
+	// Verifying takes the quota
+	resolver.SetTXT("_snax-verify.go.acme.com", first.VerificationToken)
+	_, err = service.VerifyDomain(ctx, first.ID, "user123")
+	require.NoError(t, err)
+
+	// So the other domain cannot be verified, nor another one registered
+	resolver.SetTXT("_snax-verify.links.acme.com", second.VerificationToken)
+	_, err = service.VerifyDomain(ctx, second.ID, "user123")
+	assert.IsType(t, &internalDomain.ErrQuotaExceeded{}, err)
+	_, err = service.RegisterDomain(ctx, "www.acme.com", "user123", 0)
+	assert.IsType(t, &internalDomain.ErrQuotaExceeded{}, err)
+
+	// Re-verifying the verified domain keeps it
+	_, err = service.VerifyDomain(ctx, first.ID, "user123")
+	assert.NoError(t, err)
+}
+
 func TestGetUserDomains(t *testing.T) {
 	mockRepo := new(MockCustomDomainRepository)
-	service := NewCustomDomainService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(dnsverify.NewFakeResolver(), ""), unlimitedQuotas())
 	ctx := context.Background()
 
 	now := time.Now()
@@ -158,7 +356,8 @@ func TestGetUserDomains(t *testing.T) {
 			name:   "Success",
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("GetByUserID", ctx, "user123").Return(domains, nil)
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionView).Return(int64(7), nil)
+				mockRepo.On("GetByWorkspaceID", ctx, int64(7)).Return(domains, nil)
 			},
 			wantErr: false,
 		},
@@ -166,7 +365,8 @@ func TestGetUserDomains(t *testing.T) {
 			name:   "Repository Error",
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("GetByUserID", ctx, "user123").Return(nil, assert.AnError)
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", internalDomain.PermissionView).Return(int64(7), nil)
+				mockRepo.On("GetByWorkspaceID", ctx, int64(7)).Return(nil, assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -175,9 +375,10 @@ func TestGetUserDomains(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			result, err := service.GetUserDomains(ctx, tt.userID)
+			result, err := service.GetUserDomains(ctx, tt.userID, 0)
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, result)
@@ -198,7 +399,8 @@ func TestGetUserDomains(t *testing.T) {
 
 func TestDeleteDomain(t *testing.T) {
 	mockRepo := new(MockCustomDomainRepository)
-	service := NewCustomDomainService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(dnsverify.NewFakeResolver(), ""), unlimitedQuotas())
 	ctx := context.Background()
 
 	tests := []struct {
@@ -213,16 +415,28 @@ func TestDeleteDomain(t *testing.T) {
 			id:     1,
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("Delete", ctx, int64(1), "user123").Return(nil)
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("Delete", ctx, int64(1)).Return(nil)
 			},
 			wantErr: false,
 		},
+		{
+			name:   "Role Cannot Manage Domains",
+			id:     1,
+			userID: "user123",
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).
+					Return(&internalDomain.ErrForbidden{Resource: "domain", ID: 1})
+			},
+			wantErr: true,
+		},
 		{
 			name:   "Repository Error",
 			id:     1,
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("Delete", ctx, int64(1), "user123").Return(assert.AnError)
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("Delete", ctx, int64(1)).Return(assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -231,6 +445,7 @@ func TestDeleteDomain(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
 			err := service.DeleteDomain(ctx, tt.id, tt.userID)
@@ -245,44 +460,244 @@ func TestDeleteDomain(t *testing.T) {
 
 func TestVerifyDomain(t *testing.T) {
 	mockRepo := new(MockCustomDomainRepository)
-	service := NewCustomDomainService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	resolver := dnsverify.NewFakeResolver()
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(resolver, "edge.snax.link"), unlimitedQuotas())
 	ctx := context.Background()
 
+	pending := func() *internalDomain.CustomDomain {
+		return &internalDomain.CustomDomain{ID: 1, Domain: "go.acme.com", UserID: "user123", VerificationToken: "token123"}
+	}
+
+	tests := []struct {
+		name         string
+		records      func()
+		mockSetup    func()
+		wantErr      bool
+		wantVerified bool
+	}{
+		{
+			name: "TXT Record",
+			records: func() {
+				resolver.SetTXT("_snax-verify.go.acme.com", "other", "token123")
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(pending(), nil)
+				mockRepo.On("UpdateVerification", ctx, mock.MatchedBy(func(d *internalDomain.CustomDomain) bool {
+					return d.Verified && d.VerifiedAt != nil && d.LastCheckedAt != nil && d.VerificationError == ""
+				}), unlimitedQuota).Return(nil)
+			},
+			wantErr:      false,
+			wantVerified: true,
+		},
+		{
+			name: "CNAME To Edge",
+			records: func() {
+				resolver.SetCNAME("go.acme.com", "EDGE.snax.link")
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(pending(), nil)
+				mockRepo.On("UpdateVerification", ctx, mock.MatchedBy(func(d *internalDomain.CustomDomain) bool {
+					return d.Verified
+				}), unlimitedQuota).Return(nil)
+			},
+			wantErr:      false,
+			wantVerified: true,
+		},
+		{
+			name: "Missing Records",
+			records: func() {
+				resolver.SetTXT("_snax-verify.go.acme.com", "wrong-token")
+				resolver.SetCNAME("go.acme.com", "elsewhere.example.com")
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(pending(), nil)
+				mockRepo.On("UpdateVerification", ctx, mock.MatchedBy(func(d *internalDomain.CustomDomain) bool {
+					return !d.Verified && d.LastCheckedAt != nil && d.VerificationError != ""
+				}), mock.Anything).Return(nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Not Owner",
+			records: func() {},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(&internalDomain.ErrForbidden{Resource: "domain", ID: 1})
+			},
+			wantErr: true,
+		},
+		{
+			name: "Repository Error",
+			records: func() {
+				resolver.SetTXT("_snax-verify.go.acme.com", "token123")
+			},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(pending(), nil)
+				mockRepo.On("UpdateVerification", ctx, mock.Anything, mock.Anything).Return(assert.AnError)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			resolver.SetTXT("_snax-verify.go.acme.com")
+			resolver.SetCNAME("go.acme.com", "")
+			tt.records()
+			tt.mockSetup()
+
+			d, err := service.VerifyDomain(ctx, 1, "user123")
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, d)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantVerified, d.Verified)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateDomain(t *testing.T) {
+	mockRepo := new(MockCustomDomainRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(dnsverify.NewFakeResolver(), ""), unlimitedQuotas())
+	ctx := context.Background()
+
+	stored := func() *internalDomain.CustomDomain {
+		return &internalDomain.CustomDomain{ID: 1, Domain: "go.acme.com", UserID: "user123", Verified: true, RootURL: "https://acme.com"}
+	}
+	str := func(s string) *string { return &s }
+
 	tests := []struct {
 		name      string
-		id        int64
+		update    internalDomain.CustomDomainUpdate
 		mockSetup func()
 		wantErr   bool
+		errType   interface{}
 	}{
 		{
-			name: "Success",
-			id:   1,
+			name:   "Success",
+			update: internalDomain.CustomDomainUpdate{NotFoundURL: str("https://acme.com/404")},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(stored(), nil)
+				mockRepo.On("UpdateSettings", ctx, mock.MatchedBy(func(d *internalDomain.CustomDomain) bool {
+					return d.RootURL == "https://acme.com" && d.NotFoundURL == "https://acme.com/404"
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:   "Clear Root URL",
+			update: internalDomain.CustomDomainUpdate{RootURL: str("")},
 			mockSetup: func() {
-				mockRepo.On("VerifyDomain", ctx, int64(1)).Return(nil)
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(stored(), nil)
+				mockRepo.On("UpdateSettings", ctx, mock.MatchedBy(func(d *internalDomain.CustomDomain) bool {
+					return d.RootURL == ""
+				})).Return(nil)
 			},
 			wantErr: false,
 		},
 		{
-			name: "Repository Error",
-			id:   1,
+			name:   "Relative URL",
+			update: internalDomain.CustomDomainUpdate{RootURL: str("/home")},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(stored(), nil)
+			},
+			wantErr: true,
+			errType: &internalDomain.ErrInvalidDomainSettings{},
+		},
+		{
+			name:   "Unsupported Scheme",
+			update: internalDomain.CustomDomainUpdate{NotFoundURL: str("javascript:alert(1)")},
+			mockSetup: func() {
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(stored(), nil)
+			},
+			wantErr: true,
+			errType: &internalDomain.ErrInvalidDomainSettings{},
+		},
+		{
+			name:   "Not Owner",
+			update: internalDomain.CustomDomainUpdate{RootURL: str("https://acme.com")},
 			mockSetup: func() {
-				mockRepo.On("VerifyDomain", ctx, int64(1)).Return(assert.AnError)
+				mockOwners.On("CheckDomain", ctx, int64(1), "user123", internalDomain.PermissionManage).Return(&internalDomain.ErrForbidden{Resource: "domain", ID: 1})
 			},
 			wantErr: true,
+			errType: &internalDomain.ErrForbidden{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			err := service.VerifyDomain(ctx, tt.id)
+			d, err := service.UpdateDomain(ctx, 1, "user123", tt.update)
 			if tt.wantErr {
 				assert.Error(t, err)
+				assert.Nil(t, d)
+				if tt.errType != nil {
+					assert.IsType(t, tt.errType, err)
+				}
 			} else {
 				assert.NoError(t, err)
+				assert.NotNil(t, d)
 			}
+			mockRepo.AssertExpectations(t)
 		})
 	}
 }
+
+func TestResolveHost(t *testing.T) {
+	mockRepo := new(MockCustomDomainRepository)
+	mockOwners := new(MockOwnershipChecker)
+	resolver := dnsverify.NewFakeResolver()
+	service := NewCustomDomainService(mockRepo, mockOwners, dnsverify.NewVerifier(resolver, ""), unlimitedQuotas())
+	ctx := context.Background()
+
+	verified := &internalDomain.CustomDomain{ID: 1, Domain: "go.acme.com", UserID: "user123", Verified: true, VerificationToken: "token123"}
+	pending := &internalDomain.CustomDomain{ID: 2, Domain: "links.other.com", UserID: "user456", VerificationToken: "token456"}
+
+	mockRepo.On("GetByDomain", ctx, "go.acme.com").Return(verified, nil).Once()
+	mockRepo.On("GetByDomain", ctx, "links.other.com").Return(pending, nil).Once()
+	mockRepo.On("GetByDomain", ctx, "unknown.com").Return(nil, &internalDomain.ErrDomainNotFound{Domain: "unknown.com"}).Once()
+
+	// Repeated lookups, including misses, are served from the cache
+	for i := 0; i < 2; i++ {
+		d, err := service.ResolveHost(ctx, "Go.Acme.com")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.ID)
+
+		_, err = service.ResolveHost(ctx, "links.other.com")
+		assert.IsType(t, &internalDomain.ErrDomainNotFound{}, err)
+
+		_, err = service.ResolveHost(ctx, "unknown.com")
+		assert.IsType(t, &internalDomain.ErrDomainNotFound{}, err)
+	}
+	mockRepo.AssertExpectations(t)
+
+	// Verifying a domain makes it resolvable at once
+	resolver.SetTXT("_snax-verify.links.other.com", "token456")
+	mockOwners.On("CheckDomain", ctx, int64(2), "user456", internalDomain.PermissionManage).Return(nil)
+	mockRepo.On("GetByID", ctx, int64(2)).Return(pending, nil)
+	mockRepo.On("UpdateVerification", ctx, mock.Anything, mock.Anything).Return(nil)
+	_, err := service.VerifyDomain(ctx, 2, "user456")
+	assert.NoError(t, err)
+
+	mockRepo.On("GetByDomain", ctx, "links.other.com").Return(pending, nil).Once()
+	d, err := service.ResolveHost(ctx, "links.other.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), d.ID)
+}
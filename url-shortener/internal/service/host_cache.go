@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// hostCacheTTL bounds how long a host resolution is reused. Changes made
+// through this instance apply at once; other instances pick them up within
+// the TTL.
+const hostCacheTTL = time.Minute
+
+// hostCacheSize caps the number of remembered hosts. Host headers are
+// client controlled, so misses must not grow the cache without bound.
+const hostCacheSize = 10000
+
+type hostCacheEntry struct {
+	// domain is nil when no verified domain serves the host
+	domain    *internalDomain.CustomDomain
+	expiresAt time.Time
+}
+
+// hostCache remembers which verified custom domain serves a host
+type hostCache struct {
+	mu      sync.Mutex
+	entries map[string]hostCacheEntry
+	now     func() time.Time
+}
+
+func newHostCache() *hostCache {
+	return &hostCache{
+		entries: make(map[string]hostCacheEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns a copy of the cached domain for host; ok is false when host
+// is not cached or its entry is stale
+func (c *hostCache) get(host string) (d *internalDomain.CustomDomain, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[host]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, host)
+		return nil, false
+	}
+
+	if entry.domain == nil {
+		return nil, true
+	}
+	result := *entry.domain
+	return &result, true
+}
+
+// set caches d for host; a nil d records that no verified domain serves it
+func (c *hostCache) set(host string, d *internalDomain.CustomDomain) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= hostCacheSize {
+		c.entries = make(map[string]hostCacheEntry)
+	}
+
+	entry := hostCacheEntry{expiresAt: c.now().Add(hostCacheTTL)}
+	if d != nil {
+		stored := *d
+		entry.domain = &stored
+	}
+	c.entries[host] = entry
+}
+
+// remove forgets host
+func (c *hostCache) remove(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, host)
+}
+
+// clear forgets every host
+func (c *hostCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]hostCacheEntry)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+type OwnershipChecker struct {
+	urls       domain.URLRepository
+	domains    domain.CustomDomainRepository
+	workspaces domain.WorkspaceRepository
+}
+
+// NewOwnershipChecker creates the permission check shared by the services
+// acting on a workspace's URLs and domains
+func NewOwnershipChecker(urls domain.URLRepository, domains domain.CustomDomainRepository, workspaces domain.WorkspaceRepository) domain.OwnershipChecker {
+	return &OwnershipChecker{
+		urls:       urls,
+		domains:    domains,
+		workspaces: workspaces,
+	}
+}
+
+// CheckURL verifies that userID may act on the URL with perm
+func (c *OwnershipChecker) CheckURL(ctx context.Context, urlID int64, userID string, perm domain.Permission) error {
+	url, err := c.urls.GetByID(ctx, urlID)
+	if err != nil {
+		return err
+	}
+
+	// Anonymous links belong to nobody, so nobody gets to see them
+	notFound := &domain.ErrURLNotFound{ID: urlID}
+	if url.WorkspaceID == nil {
+		return notFound
+	}
+
+	return c.check(ctx, *url.WorkspaceID, userID, perm, "URL", urlID, notFound)
+}
+
+// CheckDomain verifies that userID may act on the custom domain with perm
+func (c *OwnershipChecker) CheckDomain(ctx context.Context, domainID int64, userID string, perm domain.Permission) error {
+	d, err := c.domains.GetByID(ctx, domainID)
+	if err != nil {
+		return err
+	}
+
+	return c.check(ctx, d.WorkspaceID, userID, perm, "domain", domainID, &domain.ErrDomainNotFound{})
+}
+
+// CheckWorkspace verifies that userID may act in the workspace with perm
+func (c *OwnershipChecker) CheckWorkspace(ctx context.Context, workspaceID int64, userID string, perm domain.Permission) (int64, error) {
+	if workspaceID == 0 {
+		w, err := c.workspaces.EnsurePersonal(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		return w.ID, nil
+	}
+
+	if err := c.check(ctx, workspaceID, userID, perm, "workspace", workspaceID, &domain.ErrWorkspaceNotFound{ID: workspaceID}); err != nil {
+		return 0, err
+	}
+
+	return workspaceID, nil
+}
+
+// WorkspaceRole returns userID's role in the workspace, empty for non-members
+func (c *OwnershipChecker) WorkspaceRole(ctx context.Context, workspaceID int64, userID string) (string, error) {
+	m, err := c.workspaces.GetMember(ctx, workspaceID, userID)
+	var notMember *domain.ErrMemberNotFound
+	if errors.As(err, &notMember) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return m.Role, nil
+}
+
+// check returns notFound to non-members, so they cannot tell the resource
+// exists, and ErrForbidden to members whose role does not allow perm
+func (c *OwnershipChecker) check(ctx context.Context, workspaceID int64, userID string, perm domain.Permission, resource string, id int64, notFound error) error {
+	role, err := c.WorkspaceRole(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role == "" {
+		return notFound
+	}
+	if !domain.RoleAllows(role, perm) {
+		return &domain.ErrForbidden{Resource: resource, ID: id}
+	}
+
+	return nil
+}
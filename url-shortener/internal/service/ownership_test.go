@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockOwnershipChecker is a mock implementation of OwnershipChecker
+type MockOwnershipChecker struct {
+	mock.Mock
+}
+
+func (m *MockOwnershipChecker) CheckURL(ctx context.Context, urlID int64, userID string, perm domain.Permission) error {
+	args := m.Called(ctx, urlID, userID, perm)
+	return args.Error(0)
+}
+
+func (m *MockOwnershipChecker) CheckDomain(ctx context.Context, domainID int64, userID string, perm domain.Permission) error {
+	args := m.Called(ctx, domainID, userID, perm)
+	return args.Error(0)
+}
+
+func (m *MockOwnershipChecker) CheckWorkspace(ctx context.Context, workspaceID int64, userID string, perm domain.Permission) (int64, error) {
+	args := m.Called(ctx, workspaceID, userID, perm)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOwnershipChecker) WorkspaceRole(ctx context.Context, workspaceID int64, userID string) (string, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.String(0), args.Error(1)
+}
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, domain.RoleAllows(domain.RoleViewer, domain.PermissionView))
+	assert.False(t, domain.RoleAllows(domain.RoleViewer, domain.PermissionEdit))
+	assert.True(t, domain.RoleAllows(domain.RoleEditor, domain.PermissionEdit))
+	assert.False(t, domain.RoleAllows(domain.RoleEditor, domain.PermissionManage))
+	assert.True(t, domain.RoleAllows(domain.RoleAdmin, domain.PermissionManage))
+	assert.True(t, domain.RoleAllows(domain.RoleOwner, domain.PermissionManage))
+	assert.False(t, domain.RoleAllows("", domain.PermissionView))
+}
+
+func TestOwnershipCheckURL(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockWorkspaces := new(MockWorkspaceRepository)
+	checker := NewOwnershipChecker(mockURLRepo, new(MockCustomDomainRepository), mockWorkspaces)
+	ctx := context.Background()
+	workspaceID := int64(7)
+
+	tests := []struct {
+		name      string
+		userID    string
+		perm      domain.Permission
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name:   "Editor Edits",
+			userID: "user123",
+			perm:   domain.PermissionEdit,
+			mockSetup: func() {
+				mockURLRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, WorkspaceID: &workspaceID}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleEditor}, nil)
+			},
+		},
+		{
+			name:   "Viewer Edits",
+			userID: "user123",
+			perm:   domain.PermissionEdit,
+			mockSetup: func() {
+				mockURLRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, WorkspaceID: &workspaceID}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleViewer}, nil)
+			},
+			wantErr: &domain.ErrForbidden{Resource: "URL", ID: 1},
+		},
+		{
+			name:   "Not A Member",
+			userID: "user456",
+			perm:   domain.PermissionView,
+			mockSetup: func() {
+				mockURLRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, WorkspaceID: &workspaceID}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user456").Return(nil, &domain.ErrMemberNotFound{WorkspaceID: 7, UserID: "user456"})
+			},
+			wantErr: &domain.ErrURLNotFound{ID: 1},
+		},
+		{
+			name:   "Anonymous Link",
+			userID: "user123",
+			perm:   domain.PermissionView,
+			mockSetup: func() {
+				mockURLRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1}, nil)
+			},
+			wantErr: &domain.ErrURLNotFound{ID: 1},
+		},
+		{
+			name:   "Not Found",
+			userID: "user123",
+			perm:   domain.PermissionView,
+			mockSetup: func() {
+				mockURLRepo.On("GetByID", ctx, int64(1)).Return(nil, &domain.ErrURLNotFound{})
+			},
+			wantErr: &domain.ErrURLNotFound{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockURLRepo.ExpectedCalls = nil
+			mockWorkspaces.ExpectedCalls = nil
+			tt.mockSetup()
+
+			err := checker.CheckURL(ctx, 1, tt.userID, tt.perm)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestOwnershipCheckDomain(t *testing.T) {
+	mockDomainRepo := new(MockCustomDomainRepository)
+	mockWorkspaces := new(MockWorkspaceRepository)
+	checker := NewOwnershipChecker(new(MockURLRepository), mockDomainRepo, mockWorkspaces)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		userID    string
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name:   "Admin",
+			userID: "user123",
+			mockSetup: func() {
+				mockDomainRepo.On("GetByID", ctx, int64(1)).Return(&domain.CustomDomain{ID: 1, WorkspaceID: 7}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleAdmin}, nil)
+			},
+		},
+		{
+			name:   "Editor",
+			userID: "user123",
+			mockSetup: func() {
+				mockDomainRepo.On("GetByID", ctx, int64(1)).Return(&domain.CustomDomain{ID: 1, WorkspaceID: 7}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleEditor}, nil)
+			},
+			wantErr: &domain.ErrForbidden{Resource: "domain", ID: 1},
+		},
+		{
+			name:   "Not A Member",
+			userID: "user456",
+			mockSetup: func() {
+				mockDomainRepo.On("GetByID", ctx, int64(1)).Return(&domain.CustomDomain{ID: 1, Domain: "go.acme.com", WorkspaceID: 7}, nil)
+				mockWorkspaces.On("GetMember", ctx, int64(7), "user456").Return(nil, &domain.ErrMemberNotFound{WorkspaceID: 7, UserID: "user456"})
+			},
+			wantErr: &domain.ErrDomainNotFound{},
+		},
+		{
+			name:   "Not Found",
+			userID: "user123",
+			mockSetup: func() {
+				mockDomainRepo.On("GetByID", ctx, int64(1)).Return(nil, &domain.ErrDomainNotFound{})
+			},
+			wantErr: &domain.ErrDomainNotFound{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDomainRepo.ExpectedCalls = nil
+			mockWorkspaces.ExpectedCalls = nil
+			tt.mockSetup()
+
+			err := checker.CheckDomain(ctx, 1, tt.userID, domain.PermissionManage)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestOwnershipCheckWorkspace(t *testing.T) {
+	mockWorkspaces := new(MockWorkspaceRepository)
+	checker := NewOwnershipChecker(new(MockURLRepository), new(MockCustomDomainRepository), mockWorkspaces)
+	ctx := context.Background()
+
+	t.Run("Personal Workspace", func(t *testing.T) {
+		mockWorkspaces.ExpectedCalls = nil
+		mockWorkspaces.On("EnsurePersonal", ctx, "user123").Return(&domain.Workspace{ID: 3, Personal: true}, nil)
+
+		id, err := checker.CheckWorkspace(ctx, 0, "user123", domain.PermissionManage)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), id)
+	})
+
+	t.Run("Member", func(t *testing.T) {
+		mockWorkspaces.ExpectedCalls = nil
+		mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleViewer}, nil)
+
+		id, err := checker.CheckWorkspace(ctx, 7, "user123", domain.PermissionView)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), id)
+	})
+
+	t.Run("Insufficient Role", func(t *testing.T) {
+		mockWorkspaces.ExpectedCalls = nil
+		mockWorkspaces.On("GetMember", ctx, int64(7), "user123").Return(&domain.WorkspaceMember{Role: domain.RoleViewer}, nil)
+
+		_, err := checker.CheckWorkspace(ctx, 7, "user123", domain.PermissionEdit)
+		assert.Equal(t, &domain.ErrForbidden{Resource: "workspace", ID: 7}, err)
+	})
+
+	t.Run("Not A Member", func(t *testing.T) {
+		mockWorkspaces.ExpectedCalls = nil
+		mockWorkspaces.On("GetMember", ctx, int64(7), "user456").Return(nil, &domain.ErrMemberNotFound{WorkspaceID: 7, UserID: "user456"})
+
+		_, err := checker.CheckWorkspace(ctx, 7, "user456", domain.PermissionView)
+		assert.Equal(t, &domain.ErrWorkspaceNotFound{ID: 7}, err)
+	})
+}
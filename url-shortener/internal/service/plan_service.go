@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// PlanService enforces the quotas of workspace plans and reports usage. It
+// is both the domain.QuotaChecker handed to the services creating links,
+// domains and tags and the domain.UsageService behind the usage endpoint.
+type PlanService struct {
+	repo       domain.UsageRepository
+	workspaces domain.WorkspaceRepository
+	urls       domain.URLRepository
+	owners     domain.OwnershipChecker
+	now        func() time.Time
+}
+
+// NewPlanService creates a new plan service
+func NewPlanService(repo domain.UsageRepository, workspaces domain.WorkspaceRepository, urls domain.URLRepository, owners domain.OwnershipChecker) *PlanService {
+	return &PlanService{
+		repo:       repo,
+		workspaces: workspaces,
+		urls:       urls,
+		owners:     owners,
+		now:        time.Now,
+	}
+}
+
+// plan returns the plan of a workspace
+func (s *PlanService) plan(ctx context.Context, workspaceID int64) (string, error) {
+	w, err := s.workspaces.GetByID(ctx, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	return w.Plan, nil
+}
+
+// ReserveLink counts a link against the workspace's monthly quota and
+// returns the period it was counted in
+func (s *PlanService) ReserveLink(ctx context.Context, workspaceID int64) (time.Time, error) {
+	plan, err := s.plan(ctx, workspaceID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	limit := domain.PlanQuotas(plan).LinksPerMonth
+	period, _ := domain.UsagePeriod(s.now())
+	ok, err := s.repo.ReserveLink(ctx, workspaceID, period, limit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, &domain.ErrQuotaExceeded{Quota: domain.QuotaLinks, Plan: plan, Limit: limit}
+	}
+
+	return period, nil
+}
+
+// ReleaseLink gives back a link reserved by ReserveLink. The period comes
+// from the reservation, so a creation failing across a month boundary
+// releases the link where it was counted.
+func (s *PlanService) ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error {
+	return s.repo.ReleaseLink(ctx, workspaceID, period)
+}
+
+// quota returns the limit named quota of the workspace's plan. The
+// repositories enforce it where they insert, so concurrent creations are
+// counted one after the other.
+func (s *PlanService) quota(ctx context.Context, workspaceID int64, quota string) (domain.QuotaLimit, error) {
+	plan, err := s.plan(ctx, workspaceID)
+	if err != nil {
+		return domain.QuotaLimit{}, err
+	}
+
+	return domain.QuotaLimit{Quota: quota, Plan: plan, Limit: domain.PlanQuotas(plan).Limit(quota)}, nil
+}
+
+// DomainQuota returns the custom domain quota of the workspace
+func (s *PlanService) DomainQuota(ctx context.Context, workspaceID int64) (domain.QuotaLimit, error) {
+	return s.quota(ctx, workspaceID, domain.QuotaCustomDomains)
+}
+
+// TagQuota returns the tag quota of the workspace; tags it holds already
+// can be used freely
+func (s *PlanService) TagQuota(ctx context.Context, workspaceID int64) (domain.QuotaLimit, error) {
+	return s.quota(ctx, workspaceID, domain.QuotaTags)
+}
+
+// URLTagQuota returns the tag quota of the workspace of a URL
+func (s *PlanService) URLTagQuota(ctx context.Context, urlID int64) (domain.QuotaLimit, error) {
+	url, err := s.urls.GetByID(ctx, urlID)
+	if err != nil {
+		return domain.QuotaLimit{}, err
+	}
+
+	// Anonymous links cannot be tagged at all
+	if url.WorkspaceID == nil {
+		return domain.QuotaLimit{Quota: domain.QuotaTags, Limit: domain.Unlimited}, nil
+	}
+
+	return s.TagQuota(ctx, *url.WorkspaceID)
+}
+
+// RetentionStart returns the oldest time the plan of a URL's workspace
+// reports analytics from
+func (s *PlanService) RetentionStart(ctx context.Context, urlID int64) (time.Time, error) {
+	url, err := s.urls.GetByID(ctx, urlID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	plan := domain.PlanFree
+	if url.WorkspaceID != nil {
+		if plan, err = s.plan(ctx, *url.WorkspaceID); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	days := domain.PlanQuotas(plan).AnalyticsRetentionDays
+	if days == domain.Unlimited {
+		return time.Time{}, nil
+	}
+
+	return s.now().AddDate(0, 0, -days), nil
+}
+
+// WorkspaceQuota returns how many shared workspaces userID may create.
+// Those workspaces start on the free plan with quotas of their own, so the
+// limit follows the creator's best plan rather than any one workspace.
+func (s *PlanService) WorkspaceQuota(ctx context.Context, userID string) (domain.QuotaLimit, error) {
+	plan, err := s.UserPlan(ctx, userID)
+	if err != nil {
+		return domain.QuotaLimit{}, err
+	}
+
+	return domain.QuotaLimit{Quota: domain.QuotaWorkspaces, Plan: plan, Limit: domain.PlanQuotas(plan).Workspaces}, nil
+}
+
+// GetUsage reports the consumption of a workspace userID can view
+func (s *PlanService) GetUsage(ctx context.Context, userID string, workspaceID int64) (*domain.Usage, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.plan(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := domain.UsagePeriod(s.now())
+	counters, err := s.repo.GetUsage(ctx, workspaceID, start)
+	if err != nil {
+		return nil, err
+	}
+
+	quotas := domain.PlanQuotas(plan)
+	usage := &domain.Usage{
+		WorkspaceID:   workspaceID,
+		Plan:          plan,
+		PeriodStart:   start,
+		PeriodEnd:     end,
+		Links:         domain.NewQuotaUsage(counters.LinksCreated, quotas.LinksPerMonth),
+		CustomDomains: domain.NewQuotaUsage(counters.CustomDomains, quotas.CustomDomains),
+		Tags:          domain.NewQuotaUsage(counters.Tags, quotas.Tags),
+	}
+	if quotas.AnalyticsRetentionDays != domain.Unlimited {
+		usage.AnalyticsRetentionDays = &quotas.AnalyticsRetentionDays
+	}
+
+	return usage, nil
+}
+
+// UserPlan returns the best plan among the workspaces userID belongs to,
+// free when there are none
+func (s *PlanService) UserPlan(ctx context.Context, userID string) (string, error) {
+	workspaces, err := s.workspaces.ListByUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	best := domain.PlanFree
+	for _, w := range workspaces {
+		if domain.PlanRank(w.Plan) > domain.PlanRank(best) {
+			best = w.Plan
+		}
+	}
+
+	return best, nil
+}
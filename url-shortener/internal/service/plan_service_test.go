@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockQuotaChecker is a mock implementation of QuotaChecker
+type MockQuotaChecker struct {
+	mock.Mock
+}
+
+func (m *MockQuotaChecker) ReserveLink(ctx context.Context, workspaceID int64) (time.Time, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockQuotaChecker) ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error {
+	args := m.Called(ctx, workspaceID, period)
+	return args.Error(0)
+}
+
+func (m *MockQuotaChecker) DomainQuota(ctx context.Context, workspaceID int64) (domain.QuotaLimit, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).(domain.QuotaLimit), args.Error(1)
+}
+
+func (m *MockQuotaChecker) TagQuota(ctx context.Context, workspaceID int64) (domain.QuotaLimit, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).(domain.QuotaLimit), args.Error(1)
+}
+
+func (m *MockQuotaChecker) URLTagQuota(ctx context.Context, urlID int64) (domain.QuotaLimit, error) {
+	args := m.Called(ctx, urlID)
+	return args.Get(0).(domain.QuotaLimit), args.Error(1)
+}
+
+func (m *MockQuotaChecker) RetentionStart(ctx context.Context, urlID int64) (time.Time, error) {
+	args := m.Called(ctx, urlID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockQuotaChecker) WorkspaceQuota(ctx context.Context, userID string) (domain.QuotaLimit, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(domain.QuotaLimit), args.Error(1)
+}
+
+// unlimitedQuota is the quota unlimitedQuotas hands to repositories
+var unlimitedQuota = domain.QuotaLimit{Limit: domain.Unlimited}
+
+// unlimitedQuotas returns a quota checker that allows everything
+func unlimitedQuotas() *MockQuotaChecker {
+	m := new(MockQuotaChecker)
+	m.On("ReserveLink", mock.Anything, mock.Anything).Return(time.Time{}, nil).Maybe()
+	m.On("ReleaseLink", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	m.On("DomainQuota", mock.Anything, mock.Anything).Return(unlimitedQuota, nil).Maybe()
+	m.On("TagQuota", mock.Anything, mock.Anything).Return(unlimitedQuota, nil).Maybe()
+	m.On("URLTagQuota", mock.Anything, mock.Anything).Return(unlimitedQuota, nil).Maybe()
+	m.On("RetentionStart", mock.Anything, mock.Anything).Return(time.Time{}, nil).Maybe()
+	m.On("WorkspaceQuota", mock.Anything, mock.Anything).Return(unlimitedQuota, nil).Maybe()
+	return m
+}
+
+// MockUsageRepository is a mock implementation of UsageRepository
+type MockUsageRepository struct {
+	mock.Mock
+}
+
+func (m *MockUsageRepository) ReserveLink(ctx context.Context, workspaceID int64, period time.Time, limit int) (bool, error) {
+	args := m.Called(ctx, workspaceID, period, limit)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUsageRepository) ReleaseLink(ctx context.Context, workspaceID int64, period time.Time) error {
+	args := m.Called(ctx, workspaceID, period)
+	return args.Error(0)
+}
+
+func (m *MockUsageRepository) GetUsage(ctx context.Context, workspaceID int64, period time.Time) (*domain.WorkspaceUsage, error) {
+	args := m.Called(ctx, workspaceID, period)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WorkspaceUsage), args.Error(1)
+}
+
+func newTestPlanService() (*PlanService, *MockUsageRepository, *MockWorkspaceRepository, *MockURLRepository, *MockOwnershipChecker) {
+	mockRepo := new(MockUsageRepository)
+	mockWorkspaces := new(MockWorkspaceRepository)
+	mockURLs := new(MockURLRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewPlanService(mockRepo, mockWorkspaces, mockURLs, mockOwners)
+	service.now = func() time.Time { return time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC) }
+	return service, mockRepo, mockWorkspaces, mockURLs, mockOwners
+}
+
+func TestErrQuotaExceeded(t *testing.T) {
+	err := &domain.ErrQuotaExceeded{Quota: domain.QuotaLinks, Plan: domain.PlanFree, Limit: 100}
+	assert.Equal(t, "Quota exceeded: the free plan allows 100 links per month", err.Error())
+	assert.True(t, err.Upgradable())
+
+	// Nothing is above business
+	err = &domain.ErrQuotaExceeded{Quota: domain.QuotaLinks, Plan: domain.PlanBusiness, Limit: 100000}
+	assert.False(t, err.Upgradable())
+}
+
+func TestReserveLink(t *testing.T) {
+	service, mockRepo, mockWorkspaces, _, _ := newTestPlanService()
+	ctx := context.Background()
+	period := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantErr   bool
+		errType   interface{}
+	}{
+		{
+			name: "Within Quota",
+			mockSetup: func() {
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanPro}, nil)
+				mockRepo.On("ReserveLink", ctx, int64(3), period, 5000).Return(true, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "Quota Used Up",
+			mockSetup: func() {
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanFree}, nil)
+				mockRepo.On("ReserveLink", ctx, int64(3), period, 100).Return(false, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrQuotaExceeded{},
+		},
+		{
+			name: "Workspace Not Found",
+			mockSetup: func() {
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(nil, &domain.ErrWorkspaceNotFound{ID: 3})
+			},
+			wantErr: true,
+			errType: &domain.ErrWorkspaceNotFound{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockWorkspaces.ExpectedCalls = nil
+			tt.mockSetup()
+
+			reserved, err := service.ReserveLink(ctx, 3)
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.errType != nil {
+					assert.IsType(t, tt.errType, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, period, reserved)
+			}
+		})
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	service, _, mockWorkspaces, mockURLs, _ := newTestPlanService()
+	ctx := context.Background()
+	workspaceID := int64(3)
+
+	tests := []struct {
+		name      string
+		quota     func() (domain.QuotaLimit, error)
+		mockSetup func()
+		want      domain.QuotaLimit
+	}{
+		{
+			name:  "Domains",
+			quota: func() (domain.QuotaLimit, error) { return service.DomainQuota(ctx, 3) },
+			mockSetup: func() {
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanFree}, nil)
+			},
+			want: domain.QuotaLimit{Quota: domain.QuotaCustomDomains, Plan: domain.PlanFree, Limit: 1},
+		},
+		{
+			name:  "Tags",
+			quota: func() (domain.QuotaLimit, error) { return service.TagQuota(ctx, 3) },
+			mockSetup: func() {
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanPro}, nil)
+			},
+			want: domain.QuotaLimit{Quota: domain.QuotaTags, Plan: domain.PlanPro, Limit: 500},
+		},
+		{
+			name:  "Unlimited Tags",
+			quota: func() (domain.QuotaLimit, error) { return service.URLTagQuota(ctx, 1) },
+			mockSetup: func() {
+				mockURLs.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, WorkspaceID: &workspaceID}, nil)
+				mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanBusiness}, nil)
+			},
+			want: domain.QuotaLimit{Quota: domain.QuotaTags, Plan: domain.PlanBusiness, Limit: domain.Unlimited},
+		},
+		{
+			name:  "Anonymous Link",
+			quota: func() (domain.QuotaLimit, error) { return service.URLTagQuota(ctx, 1) },
+			mockSetup: func() {
+				mockURLs.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1}, nil)
+			},
+			want: domain.QuotaLimit{Quota: domain.QuotaTags, Limit: domain.Unlimited},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockWorkspaces.ExpectedCalls = nil
+			mockURLs.ExpectedCalls = nil
+			tt.mockSetup()
+
+			quota, err := tt.quota()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, quota)
+		})
+	}
+}
+
+func TestRetentionStart(t *testing.T) {
+	service, _, mockWorkspaces, mockURLs, _ := newTestPlanService()
+	ctx := context.Background()
+	workspaceID := int64(3)
+
+	mockURLs.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, WorkspaceID: &workspaceID}, nil)
+	mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanFree}, nil)
+
+	start, err := service.RetentionStart(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 12, 9, 0, 0, 0, time.UTC), start)
+}
+
+func TestGetUsage(t *testing.T) {
+	service, mockRepo, mockWorkspaces, _, mockOwners := newTestPlanService()
+	ctx := context.Background()
+	period := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionView).Return(int64(3), nil)
+	mockWorkspaces.On("GetByID", ctx, int64(3)).Return(&domain.Workspace{ID: 3, Plan: domain.PlanBusiness}, nil)
+	mockRepo.On("GetUsage", ctx, int64(3), period).Return(&domain.WorkspaceUsage{LinksCreated: 42, CustomDomains: 2, Tags: 7}, nil)
+
+	usage, err := service.GetUsage(ctx, "user123", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), usage.WorkspaceID)
+	assert.Equal(t, domain.PlanBusiness, usage.Plan)
+	assert.Equal(t, period, usage.PeriodStart)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), usage.PeriodEnd)
+	assert.Equal(t, int64(42), usage.Links.Used)
+	assert.Equal(t, 100000, *usage.Links.Limit)
+	assert.Equal(t, 50, *usage.CustomDomains.Limit)
+	assert.Nil(t, usage.Tags.Limit)
+	assert.Equal(t, 730, *usage.AnalyticsRetentionDays)
+}
+
+func TestUserPlan(t *testing.T) {
+	service, _, mockWorkspaces, _, _ := newTestPlanService()
+	ctx := context.Background()
+
+	mockWorkspaces.On("ListByUser", ctx, "user123").Return([]domain.Workspace{
+		{ID: 3, Plan: domain.PlanFree},
+		{ID: 4, Plan: domain.PlanPro},
+	}, nil)
+	mockWorkspaces.On("ListByUser", ctx, "user456").Return([]domain.Workspace{}, nil)
+
+	plan, err := service.UserPlan(ctx, "user123")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PlanPro, plan)
+
+	plan, err = service.UserPlan(ctx, "user456")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PlanFree, plan)
+
+	// Shared workspaces are limited by the best plan of their creator
+	quota, err := service.WorkspaceQuota(ctx, "user123")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.QuotaLimit{Quota: domain.QuotaWorkspaces, Plan: domain.PlanPro, Limit: 10}, quota)
+}
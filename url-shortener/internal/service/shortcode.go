@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// Short code strategies selectable through config
+const (
+	ShortCodeStrategyRandom  = "random"
+	ShortCodeStrategyCounter = "counter"
+	ShortCodeStrategyHashids = "hashids"
+)
+
+// DefaultShortCodeAlphabet is the base64url alphabet the original generator used
+const DefaultShortCodeAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// DefaultShortCodeLength is the length of generated short codes unless configured otherwise
+const DefaultShortCodeLength = 8
+
+// maxShortCodeLength matches urls.short_code VARCHAR(10)
+const maxShortCodeLength = 10
+
+// ShortCodeGenerator assigns a short code to a URL before it is persisted
+type ShortCodeGenerator interface {
+	// Generate sets url.ShortCode. Strategies that derive the code from the
+	// row ID also reserve that ID by setting url.ID.
+	Generate(ctx context.Context, url *domain.URL) error
+}
+
+// ShortCodeConfig describes how short codes should be generated
+type ShortCodeConfig struct {
+	Strategy string
+	Length   int
+	Alphabet string
+	// Readable strips '-' and '_' from the alphabet so codes are easier to
+	// read aloud and select with a double click
+	Readable bool
+	// Salt shuffles the alphabet and the ID permutation for hashids
+	Salt string
+}
+
+// NewShortCodeGenerator builds the generator selected by cfg. Counter and
+// hashids strategies need a counter; hashids expects it to hand out URL row IDs.
+func NewShortCodeGenerator(cfg ShortCodeConfig, counter domain.Counter) (ShortCodeGenerator, error) {
+	alphabet, err := normalizeAlphabet(cfg.Alphabet, cfg.Readable)
+	if err != nil {
+		return nil, err
+	}
+
+	length := cfg.Length
+	if length == 0 {
+		length = DefaultShortCodeLength
+	}
+	if length < 1 || length > maxShortCodeLength {
+		return nil, fmt.Errorf("short code length must be between 1 and %d, got %d", maxShortCodeLength, length)
+	}
+
+	switch cfg.Strategy {
+	case "", ShortCodeStrategyRandom:
+		return NewRandomShortCodeGenerator(alphabet, length), nil
+	case ShortCodeStrategyCounter:
+		if counter == nil {
+			return nil, fmt.Errorf("short code strategy %q requires a counter", cfg.Strategy)
+		}
+		return NewCounterShortCodeGenerator(counter, alphabet, length), nil
+	case ShortCodeStrategyHashids:
+		if counter == nil {
+			return nil, fmt.Errorf("short code strategy %q requires a counter", cfg.Strategy)
+		}
+		return NewHashidsShortCodeGenerator(counter, alphabet, length, cfg.Salt), nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", cfg.Strategy)
+	}
+}
+
+// normalizeAlphabet applies defaults and validates a configured alphabet
+func normalizeAlphabet(alphabet string, readable bool) (string, error) {
+	if alphabet == "" {
+		alphabet = DefaultShortCodeAlphabet
+	}
+	if readable {
+		alphabet = strings.NewReplacer("-", "", "_", "").Replace(alphabet)
+	}
+
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !aliasPattern.MatchString(string(c)) {
+			return "", fmt.Errorf("short code alphabet contains unsupported character %q", c)
+		}
+		if _, dup := seen[c]; dup {
+			return "", fmt.Errorf("short code alphabet contains duplicate character %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+
+	if len(alphabet) < 2 {
+		return "", fmt.Errorf("short code alphabet needs at least 2 characters")
+	}
+
+	return alphabet, nil
+}
+
+// RandomShortCodeGenerator picks every character uniformly at random.
+// Collisions are possible and are handled by retrying in URLService.
+type RandomShortCodeGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewRandomShortCodeGenerator creates a generator of random fixed-length codes
+func NewRandomShortCodeGenerator(alphabet string, length int) *RandomShortCodeGenerator {
+	return &RandomShortCodeGenerator{
+		alphabet: alphabet,
+		length:   length,
+	}
+}
+
+// Generate sets a random short code on url
+func (g *RandomShortCodeGenerator) Generate(ctx context.Context, url *domain.URL) error {
+	size := big.NewInt(int64(len(g.alphabet)))
+	code := make([]byte, g.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return err
+		}
+		code[i] = g.alphabet[n.Int64()]
+	}
+
+	url.ShortCode = string(code)
+	return nil
+}
+
+// CounterShortCodeGenerator encodes the next value of a counter in the
+// alphabet, left-padded to the configured length
+type CounterShortCodeGenerator struct {
+	counter  domain.Counter
+	alphabet string
+	length   int
+}
+
+// NewCounterShortCodeGenerator creates a generator backed by a monotonically increasing counter
+func NewCounterShortCodeGenerator(counter domain.Counter, alphabet string, length int) *CounterShortCodeGenerator {
+	return &CounterShortCodeGenerator{
+		counter:  counter,
+		alphabet: alphabet,
+		length:   length,
+	}
+}
+
+// Generate sets the short code for the next counter value on url
+func (g *CounterShortCodeGenerator) Generate(ctx context.Context, url *domain.URL) error {
+	n, err := g.counter.Next(ctx)
+	if err != nil {
+		return err
+	}
+
+	code, err := encodeBase(big.NewInt(n), g.alphabet, g.length)
+	if err != nil {
+		return err
+	}
+
+	url.ShortCode = code
+	return nil
+}
+
+// HashidsShortCodeGenerator derives the short code from the URL row ID.
+// IDs are permuted and encoded with a salt-shuffled alphabet so consecutive
+// links do not get guessable, consecutive codes.
+type HashidsShortCodeGenerator struct {
+	ids       domain.Counter
+	alphabet  string
+	minLength int
+	salt      []byte
+}
+
+// NewHashidsShortCodeGenerator creates a generator that encodes row IDs drawn from ids
+func NewHashidsShortCodeGenerator(ids domain.Counter, alphabet string, minLength int, salt string) *HashidsShortCodeGenerator {
+	return &HashidsShortCodeGenerator{
+		ids:       ids,
+		alphabet:  shuffleAlphabet(alphabet, salt),
+		minLength: minLength,
+		salt:      []byte(salt),
+	}
+}
+
+// Generate reserves the next row ID and sets it along with its encoded short code on url
+func (g *HashidsShortCodeGenerator) Generate(ctx context.Context, url *domain.URL) error {
+	id, err := g.ids.Next(ctx)
+	if err != nil {
+		return err
+	}
+
+	code, err := g.Encode(id)
+	if err != nil {
+		return err
+	}
+
+	url.ID = id
+	url.ShortCode = code
+	return nil
+}
+
+// Encode returns the short code for a row ID
+func (g *HashidsShortCodeGenerator) Encode(id int64) (string, error) {
+	if id < 0 {
+		return "", fmt.Errorf("cannot encode negative id %d", id)
+	}
+
+	base := big.NewInt(int64(len(g.alphabet)))
+	n := big.NewInt(id)
+
+	// Find the smallest width that can hold the ID, then permute the ID
+	// within [0, base^width) so that every width stays a bijection
+	width := g.minLength
+	space := new(big.Int).Exp(base, big.NewInt(int64(width)), nil)
+	for n.Cmp(space) >= 0 {
+		width++
+		space.Mul(space, base)
+	}
+
+	mul, add := g.permutation(space)
+	permuted := new(big.Int).Mul(n, mul)
+	permuted.Add(permuted, add)
+	permuted.Mod(permuted, space)
+
+	return encodeBase(permuted, g.alphabet, width)
+}
+
+// permutation derives an affine bijection x -> (mul*x + add) mod space from the salt
+func (g *HashidsShortCodeGenerator) permutation(space *big.Int) (*big.Int, *big.Int) {
+	sum := sha256.Sum256(append([]byte("snax-hashids:"), g.salt...))
+	mul := new(big.Int).SetUint64(binary.BigEndian.Uint64(sum[0:8]))
+	add := new(big.Int).SetUint64(binary.BigEndian.Uint64(sum[8:16]))
+	mul.Mod(mul, space)
+	add.Mod(add, space)
+
+	// mul must be coprime with space for the mapping to be invertible
+	one := big.NewInt(1)
+	gcd := new(big.Int)
+	for mul.Sign() == 0 || gcd.GCD(nil, nil, mul, space).Cmp(one) != 0 {
+		mul.Add(mul, one)
+		mul.Mod(mul, space)
+	}
+
+	return mul, add
+}
+
+// shuffleAlphabet deterministically reorders alphabet using salt
+func shuffleAlphabet(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	chars := []byte(alphabet)
+	seed := sha256.Sum256([]byte(salt))
+	for i := len(chars) - 1; i > 0; i-- {
+		seed = sha256.Sum256(seed[:])
+		j := int(binary.BigEndian.Uint64(seed[:8]) % uint64(i+1))
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+
+	return string(chars)
+}
+
+// encodeBase writes n in the given alphabet, left-padded to at least width characters
+func encodeBase(n *big.Int, alphabet string, width int) (string, error) {
+	if n.Sign() < 0 {
+		return "", fmt.Errorf("cannot encode negative value %s", n)
+	}
+
+	base := big.NewInt(int64(len(alphabet)))
+	value := new(big.Int).Set(n)
+	digit := new(big.Int)
+
+	var out []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, base, digit)
+		out = append(out, alphabet[digit.Int64()])
+	}
+	for len(out) < width {
+		out = append(out, alphabet[0])
+	}
+
+	if len(out) > maxShortCodeLength {
+		return "", fmt.Errorf("short code for %s exceeds %d characters", n, maxShortCodeLength)
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out), nil
+}
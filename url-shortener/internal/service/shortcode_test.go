@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCounter counts up from start
+type fakeCounter struct {
+	next int64
+}
+
+func (c *fakeCounter) Next(ctx context.Context) (int64, error) {
+	n := c.next
+	c.next++
+	return n, nil
+}
+
+func TestNewShortCodeGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ShortCodeConfig
+		counter domain.Counter
+		wantErr bool
+	}{
+		{name: "Default Random", cfg: ShortCodeConfig{}},
+		{name: "Counter", cfg: ShortCodeConfig{Strategy: ShortCodeStrategyCounter}, counter: &fakeCounter{}},
+		{name: "Hashids", cfg: ShortCodeConfig{Strategy: ShortCodeStrategyHashids, Salt: "pepper"}, counter: &fakeCounter{}},
+		{name: "Counter Without Counter", cfg: ShortCodeConfig{Strategy: ShortCodeStrategyCounter}, wantErr: true},
+		{name: "Unknown Strategy", cfg: ShortCodeConfig{Strategy: "uuid"}, wantErr: true},
+		{name: "Too Long", cfg: ShortCodeConfig{Length: 11}, wantErr: true},
+		{name: "Bad Alphabet", cfg: ShortCodeConfig{Alphabet: "ab/c"}, wantErr: true},
+		{name: "Duplicate Alphabet", cfg: ShortCodeConfig{Alphabet: "abca"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewShortCodeGenerator(tt.cfg, tt.counter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, gen)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, gen)
+			}
+		})
+	}
+}
+
+func TestRandomShortCodeGenerator(t *testing.T) {
+	gen, err := NewShortCodeGenerator(ShortCodeConfig{Length: 6, Readable: true}, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		url := &domain.URL{}
+		require.NoError(t, gen.Generate(context.Background(), url))
+		assert.Len(t, url.ShortCode, 6)
+		assert.False(t, strings.ContainsAny(url.ShortCode, "-_"))
+		assert.Zero(t, url.ID)
+	}
+}
+
+func TestCounterShortCodeGenerator(t *testing.T) {
+	gen := NewCounterShortCodeGenerator(&fakeCounter{next: 0}, "0123456789", 3)
+	ctx := context.Background()
+
+	var codes []string
+	for i := 0; i < 3; i++ {
+		url := &domain.URL{}
+		require.NoError(t, gen.Generate(ctx, url))
+		codes = append(codes, url.ShortCode)
+	}
+	assert.Equal(t, []string{"000", "001", "002"}, codes)
+
+	url := &domain.URL{}
+	gen = NewCounterShortCodeGenerator(&fakeCounter{next: 12345}, "0123456789", 3)
+	require.NoError(t, gen.Generate(ctx, url))
+	assert.Equal(t, "12345", url.ShortCode)
+}
+
+func TestHashidsShortCodeGenerator(t *testing.T) {
+	alphabet, err := normalizeAlphabet("", true)
+	require.NoError(t, err)
+
+	gen := NewHashidsShortCodeGenerator(&fakeCounter{next: 1}, alphabet, 4, "pepper")
+
+	seen := make(map[string]int64)
+	for id := int64(1); id <= 20000; id++ {
+		code, err := gen.Encode(id)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, len(code), 4)
+		if other, dup := seen[code]; dup {
+			t.Fatalf("ids %d and %d both encode to %s", other, id, code)
+		}
+		seen[code] = id
+	}
+
+	// Codes must not simply count up like the counter strategy
+	first, _ := gen.Encode(1)
+	second, _ := gen.Encode(2)
+	assert.NotEqual(t, first[:len(first)-1], second[:len(second)-1])
+
+	// Different salts give different codes
+	other := NewHashidsShortCodeGenerator(&fakeCounter{}, alphabet, 4, "salt")
+	otherFirst, _ := other.Encode(1)
+	assert.NotEqual(t, first, otherFirst)
+
+	// Generate reserves the row ID alongside the code
+	url := &domain.URL{}
+	require.NoError(t, gen.Generate(context.Background(), url))
+	assert.Equal(t, int64(1), url.ID)
+	assert.Equal(t, first, url.ShortCode)
+}
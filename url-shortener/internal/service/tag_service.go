@@ -3,61 +3,314 @@ package service
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
 )
 
+const (
+	// maxTagNameLength matches tags.name VARCHAR(50)
+	maxTagNameLength = 50
+
+	// maxTagDescriptionLength matches tags.description VARCHAR(200)
+	maxTagDescriptionLength = 200
+
+	// MaxBulkURLs bounds the links one bulk tag operation touches
+	MaxBulkURLs = 1000
+
+	// maxBulkTags bounds the tags one bulk operation adds or removes
+	maxBulkTags = 20
+)
+
+// tagColorPattern matches hex colors such as #1e90ff
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 type TagService struct {
-	repo domain.TagRepository
+	repo   domain.TagRepository
+	owners domain.OwnershipChecker
+	quotas domain.QuotaChecker
 }
 
 // New creates a new tag service
-func NewTagService(repo domain.TagRepository) domain.TagService {
+func NewTagService(repo domain.TagRepository, owners domain.OwnershipChecker, quotas domain.QuotaChecker) domain.TagService {
 	return &TagService{
-		repo: repo,
+		repo:   repo,
+		owners: owners,
+		quotas: quotas,
 	}
 }
 
-// CreateTag creates a new tag
-func (s *TagService) CreateTag(name string) (*domain.Tag, error) {
-	// Check if tag already exists
-	existingTag, err := s.repo.GetByName(name)
-	if err == nil && existingTag != nil {
-		return nil, fmt.Errorf("tag already exists: %s", name)
+// normalizeTagName trims name and checks that it fits in a tag
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", &domain.ErrInvalidTag{Reason: "name is required"}
+	}
+	if len(name) > maxTagNameLength {
+		return "", &domain.ErrInvalidTag{Reason: "name must be at most 50 characters"}
 	}
 
-	tag := &domain.Tag{
-		Name: name,
+	return name, nil
+}
+
+// validateTagDetails checks a tag's color and description and lowercases the color
+func validateTagDetails(tag *domain.Tag) error {
+	if tag.Color != "" && !tagColorPattern.MatchString(tag.Color) {
+		return &domain.ErrInvalidTag{Reason: "color must be a hex color such as #1e90ff"}
+	}
+	if len(tag.Description) > maxTagDescriptionLength {
+		return &domain.ErrInvalidTag{Reason: "description must be at most 200 characters"}
 	}
 
-	if err := s.repo.Create(tag); err != nil {
+	tag.Color = strings.ToLower(tag.Color)
+	return nil
+}
+
+// CreateTag creates a new tag in the workspace
+func (s *TagService) CreateTag(ctx context.Context, tag domain.Tag, userID string, workspaceID int64) (*domain.Tag, error) {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return nil, err
+	}
+	tag.Name = name
+	if err := validateTagDetails(&tag); err != nil {
 		return nil, err
 	}
 
-	return tag, nil
+	workspaceID, err = s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+	tag.ID = 0
+	tag.WorkspaceID = workspaceID
+
+	quota, err := s.quotas.TagQuota(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, &tag, quota); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
 }
 
 // GetTag retrieves a tag by ID
-func (s *TagService) GetTag(id int64) (*domain.Tag, error) {
-	return s.repo.GetByID(id)
+func (s *TagService) GetTag(ctx context.Context, id int64, userID string) (*domain.Tag, error) {
+	return s.getOwnedTag(ctx, id, userID, domain.PermissionView)
 }
 
-// GetTagByName retrieves a tag by name
-func (s *TagService) GetTagByName(name string) (*domain.Tag, error) {
-	return s.repo.GetByName(name)
+// GetTagByName retrieves a tag of the workspace by name
+func (s *TagService) GetTagByName(ctx context.Context, name string, userID string, workspaceID int64) (*domain.Tag, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByName(ctx, workspaceID, strings.TrimSpace(name))
+}
+
+// ListTags returns the workspace's tags by name with the number of active
+// links carrying each
+func (s *TagService) ListTags(ctx context.Context, userID string, workspaceID int64) ([]domain.TagUsage, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListByWorkspace(ctx, workspaceID)
+}
+
+// UpdateTag renames a tag or changes its color or description
+func (s *TagService) UpdateTag(ctx context.Context, id int64, userID string, update domain.TagUpdate) (*domain.Tag, error) {
+	tag, err := s.getOwnedTag(ctx, id, userID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		name, err := normalizeTagName(*update.Name)
+		if err != nil {
+			return nil, err
+		}
+		tag.Name = name
+	}
+	if update.Color != nil {
+		tag.Color = *update.Color
+	}
+	if update.Description != nil {
+		tag.Description = *update.Description
+	}
+	if err := validateTagDetails(tag); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// MergeTags moves the links of sourceID onto targetID and deletes sourceID.
+// Both tags must belong to the same workspace.
+func (s *TagService) MergeTags(ctx context.Context, sourceID int64, targetID int64, userID string) (*domain.Tag, error) {
+	if sourceID == targetID {
+		return nil, &domain.ErrInvalidTag{Reason: "a tag cannot be merged into itself"}
+	}
+
+	source, err := s.getOwnedTag(ctx, sourceID, userID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.getOwnedTag(ctx, targetID, userID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if source.WorkspaceID != target.WorkspaceID {
+		return nil, &domain.ErrInvalidTag{Reason: "tags must belong to the same workspace"}
+	}
+
+	if err := s.repo.Merge(ctx, source.ID, target.ID); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// DeleteTag deletes a tag and removes it from every link
+func (s *TagService) DeleteTag(ctx context.Context, id int64, userID string) error {
+	if _, err := s.getOwnedTag(ctx, id, userID, domain.PermissionEdit); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// getOwnedTag loads a tag, hiding it from users outside its workspace and
+// refusing members whose role does not grant perm
+func (s *TagService) getOwnedTag(ctx context.Context, id int64, userID string, perm domain.Permission) (*domain.Tag, error) {
+	tag, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.owners.WorkspaceRole(ctx, tag.WorkspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, &domain.ErrTagNotFound{}
+	}
+	if !domain.RoleAllows(role, perm) {
+		return nil, &domain.ErrForbidden{Resource: "tag", ID: id}
+	}
+
+	return tag, nil
 }
 
 // GetURLTags retrieves all tags for a URL
-func (s *TagService) GetURLTags(ctx context.Context, urlID int64) ([]domain.Tag, error) {
+func (s *TagService) GetURLTags(ctx context.Context, urlID int64, userID string) ([]domain.Tag, error) {
+	if err := s.owners.CheckURL(ctx, urlID, userID, domain.PermissionView); err != nil {
+		return nil, err
+	}
+
 	return s.repo.GetURLTags(ctx, urlID)
 }
 
-// AddTagToURL adds a tag to a URL
-func (s *TagService) AddTagToURL(ctx context.Context, urlID int64, tag string) error {
-	return s.repo.AddTagToURL(ctx, urlID, tag)
+// AddTagToURL adds a tag to a URL, creating it in the URL's workspace if needed
+func (s *TagService) AddTagToURL(ctx context.Context, urlID int64, userID string, tag string) error {
+	name, err := normalizeTagName(tag)
+	if err != nil {
+		return err
+	}
+
+	if err := s.owners.CheckURL(ctx, urlID, userID, domain.PermissionEdit); err != nil {
+		return err
+	}
+	quota, err := s.quotas.URLTagQuota(ctx, urlID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.AddTagToURL(ctx, urlID, name, quota)
 }
 
 // RemoveTagFromURL removes a tag from a URL
-func (s *TagService) RemoveTagFromURL(ctx context.Context, urlID int64, tag string) error {
-	return s.repo.RemoveTagFromURL(ctx, urlID, tag)
+func (s *TagService) RemoveTagFromURL(ctx context.Context, urlID int64, userID string, tag string) error {
+	if err := s.owners.CheckURL(ctx, urlID, userID, domain.PermissionEdit); err != nil {
+		return err
+	}
+
+	return s.repo.RemoveTagFromURL(ctx, urlID, strings.TrimSpace(tag))
+}
+
+// BulkTagURLs adds and removes tags on many links of the workspace at once.
+// Either every link is changed or none is.
+func (s *TagService) BulkTagURLs(ctx context.Context, urlIDs []int64, userID string, workspaceID int64, add []string, remove []string) error {
+	if len(urlIDs) == 0 {
+		return &domain.ErrInvalidBulkRequest{Reason: "url_ids is required"}
+	}
+	if len(urlIDs) > MaxBulkURLs {
+		return &domain.ErrInvalidBulkRequest{Reason: fmt.Sprintf("at most %d url_ids are allowed", MaxBulkURLs)}
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return &domain.ErrInvalidBulkRequest{Reason: "add or remove is required"}
+	}
+	if len(add) > maxBulkTags || len(remove) > maxBulkTags {
+		return &domain.ErrInvalidBulkRequest{Reason: fmt.Sprintf("at most %d tags can be added or removed at once", maxBulkTags)}
+	}
+
+	ids := make([]int64, 0, len(urlIDs))
+	seen := make(map[int64]bool, len(urlIDs))
+	for _, id := range urlIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	addNames, err := normalizeTagNames(add)
+	if err != nil {
+		return err
+	}
+	removeNames, err := normalizeTagNames(remove)
+	if err != nil {
+		return err
+	}
+	for _, name := range removeNames {
+		if slices.Contains(addNames, name) {
+			return &domain.ErrInvalidBulkRequest{Reason: fmt.Sprintf("tag %s cannot be both added and removed", name)}
+		}
+	}
+
+	workspaceID, err = s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionEdit)
+	if err != nil {
+		return err
+	}
+	quota, err := s.quotas.TagQuota(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.BulkTagURLs(ctx, workspaceID, ids, addNames, removeNames, quota)
+}
+
+// normalizeTagNames normalizes every name, dropping duplicates
+func normalizeTagNames(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name, err := normalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+
+	return normalized, nil
 }
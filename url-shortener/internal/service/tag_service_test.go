@@ -14,47 +14,69 @@ type MockTagRepository struct {
 	mock.Mock
 }
 
-func (m *MockTagRepository) Create(tag *domain.Tag) error {
-	args := m.Called(tag)
+func (m *MockTagRepository) Create(ctx context.Context, tag *domain.Tag, quota domain.QuotaLimit) error {
+	args := m.Called(ctx, tag, quota)
 	return args.Error(0)
 }
 
-func (m *MockTagRepository) GetByID(id int64) (*domain.Tag, error) {
-	args := m.Called(id)
+func (m *MockTagRepository) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.Tag), args.Error(1)
 }
 
-func (m *MockTagRepository) GetByName(name string) (*domain.Tag, error) {
-	args := m.Called(name)
+func (m *MockTagRepository) GetByName(ctx context.Context, workspaceID int64, name string) (*domain.Tag, error) {
+	args := m.Called(ctx, workspaceID, name)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.Tag), args.Error(1)
 }
 
-func (m *MockTagRepository) GetByURLID(urlID int64) ([]domain.Tag, error) {
-	args := m.Called(urlID)
+func (m *MockTagRepository) ListByWorkspace(ctx context.Context, workspaceID int64) ([]domain.TagUsage, error) {
+	args := m.Called(ctx, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.TagUsage), args.Error(1)
+}
+
+func (m *MockTagRepository) Update(ctx context.Context, tag *domain.Tag) error {
+	args := m.Called(ctx, tag)
+	return args.Error(0)
+}
+
+func (m *MockTagRepository) Merge(ctx context.Context, sourceID, targetID int64) error {
+	args := m.Called(ctx, sourceID, targetID)
+	return args.Error(0)
+}
+
+func (m *MockTagRepository) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+func (m *MockTagRepository) GetByURLID(ctx context.Context, urlID int64) ([]domain.Tag, error) {
+	args := m.Called(ctx, urlID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]domain.Tag), args.Error(1)
 }
 
-func (m *MockTagRepository) AddURLTag(urlID, tagID int64) error {
-	args := m.Called(urlID, tagID)
+func (m *MockTagRepository) AddURLTag(ctx context.Context, urlID, tagID int64) error {
+	args := m.Called(ctx, urlID, tagID)
 	return args.Error(0)
 }
 
-func (m *MockTagRepository) RemoveURLTag(urlID, tagID int64) error {
-	args := m.Called(urlID, tagID)
+func (m *MockTagRepository) RemoveURLTag(ctx context.Context, urlID, tagID int64) error {
+	args := m.Called(ctx, urlID, tagID)
 	return args.Error(0)
 }
 
-func (m *MockTagRepository) AddTagToURL(ctx context.Context, urlID int64, tag string) error {
-	args := m.Called(ctx, urlID, tag)
+func (m *MockTagRepository) AddTagToURL(ctx context.Context, urlID int64, tag string, quota domain.QuotaLimit) error {
+	args := m.Called(ctx, urlID, tag, quota)
 	return args.Error(0)
 }
 
@@ -71,60 +93,77 @@ func (m *MockTagRepository) GetURLTags(ctx context.Context, urlID int64) ([]doma
 	return args.Get(0).([]domain.Tag), args.Error(1)
 }
 
+func (m *MockTagRepository) BulkTagURLs(ctx context.Context, workspaceID int64, urlIDs []int64, add []string, remove []string, quota domain.QuotaLimit) error {
+	args := m.Called(ctx, workspaceID, urlIDs, add, remove, quota)
+	return args.Error(0)
+}
+
 func TestCreateTag(t *testing.T) {
 	mockRepo := new(MockTagRepository)
-	service := NewTagService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
 
 	tests := []struct {
 		name      string
-		tagName   string
+		tag       domain.Tag
 		mockSetup func()
-		wantErr   bool
+		want      *domain.Tag
+		wantErr   error
 	}{
 		{
-			name:    "Success",
-			tagName: "test-tag",
+			name: "Success",
+			tag:  domain.Tag{Name: " promo ", Color: "#1E90FF", Description: "Campaign links"},
 			mockSetup: func() {
-				mockRepo.On("GetByName", "test-tag").Return(nil, assert.AnError)
-				mockRepo.On("Create", mock.AnythingOfType("*domain.Tag")).Return(nil)
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionEdit).Return(int64(3), nil)
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.Tag"), unlimitedQuota).Return(nil)
 			},
-			wantErr: false,
+			want: &domain.Tag{WorkspaceID: 3, Name: "promo", Color: "#1e90ff", Description: "Campaign links"},
 		},
 		{
-			name:    "Tag Already Exists",
-			tagName: "existing-tag",
+			name: "Tag Already Exists",
+			tag:  domain.Tag{Name: "promo"},
 			mockSetup: func() {
-				mockRepo.On("GetByName", "existing-tag").Return(&domain.Tag{
-					ID:   1,
-					Name: "existing-tag",
-				}, nil)
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionEdit).Return(int64(3), nil)
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.Tag"), unlimitedQuota).Return(&domain.ErrTagAlreadyExists{Name: "promo"})
 			},
-			wantErr: true,
+			wantErr: &domain.ErrTagAlreadyExists{Name: "promo"},
 		},
 		{
-			name:    "Repository Error",
-			tagName: "test-tag",
+			name:      "Empty Name",
+			tag:       domain.Tag{Name: "  "},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidTag{Reason: "name is required"},
+		},
+		{
+			name:      "Invalid Color",
+			tag:       domain.Tag{Name: "promo", Color: "blue"},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidTag{Reason: "color must be a hex color such as #1e90ff"},
+		},
+		{
+			name: "Viewer",
+			tag:  domain.Tag{Name: "promo"},
 			mockSetup: func() {
-				mockRepo.On("GetByName", "test-tag").Return(nil, assert.AnError)
-				mockRepo.On("Create", mock.AnythingOfType("*domain.Tag")).Return(assert.AnError)
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionEdit).Return(int64(0), &domain.ErrForbidden{Resource: "workspace", ID: 3})
 			},
-			wantErr: true,
+			wantErr: &domain.ErrForbidden{Resource: "workspace", ID: 3},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			tag, err := service.CreateTag(tt.tagName)
-			if tt.wantErr {
-				assert.Error(t, err)
+			tag, err := service.CreateTag(ctx, tt.tag, "user123", 0)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
 				assert.Nil(t, tag)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, tag)
-				assert.Equal(t, tt.tagName, tag.Name)
+				assert.Equal(t, tt.want, tag)
 			}
 		})
 	}
@@ -132,56 +171,225 @@ func TestCreateTag(t *testing.T) {
 
 func TestGetTag(t *testing.T) {
 	mockRepo := new(MockTagRepository)
-	service := NewTagService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
 
 	tests := []struct {
 		name      string
 		tagID     int64
 		mockSetup func()
-		wantErr   bool
+		wantErr   error
 	}{
 		{
 			name:  "Success",
 			tagID: 1,
 			mockSetup: func() {
-				mockRepo.On("GetByID", int64(1)).Return(&domain.Tag{
-					ID:   1,
-					Name: "test-tag",
-				}, nil)
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.Tag{ID: 1, WorkspaceID: 3, Name: "test-tag"}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleViewer, nil)
 			},
-			wantErr: false,
 		},
 		{
 			name:  "Tag Not Found",
 			tagID: 2,
 			mockSetup: func() {
-				mockRepo.On("GetByID", int64(2)).Return(nil, assert.AnError)
+				mockRepo.On("GetByID", ctx, int64(2)).Return(nil, &domain.ErrTagNotFound{})
 			},
-			wantErr: true,
+			wantErr: &domain.ErrTagNotFound{},
+		},
+		{
+			name:  "Other Workspace",
+			tagID: 1,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.Tag{ID: 1, WorkspaceID: 4, Name: "test-tag"}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(4), "user123").Return("", nil)
+			},
+			wantErr: &domain.ErrTagNotFound{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			tag, err := service.GetTag(tt.tagID)
-			if tt.wantErr {
-				assert.Error(t, err)
+			tag, err := service.GetTag(ctx, tt.tagID, "user123")
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
 				assert.Nil(t, tag)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, tag)
 				assert.Equal(t, tt.tagID, tag.ID)
 			}
 		})
 	}
 }
 
+func TestListTags(t *testing.T) {
+	mockRepo := new(MockTagRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", domain.PermissionView).Return(int64(7), nil)
+	mockRepo.On("ListByWorkspace", ctx, int64(7)).Return([]domain.TagUsage{
+		{Tag: domain.Tag{ID: 1, WorkspaceID: 7, Name: "promo"}, URLCount: 4},
+	}, nil)
+
+	tags, err := service.ListTags(ctx, "user123", 7)
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+	assert.Equal(t, int64(4), tags[0].URLCount)
+}
+
+func TestUpdateTag(t *testing.T) {
+	mockRepo := new(MockTagRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	name := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		update    domain.TagUpdate
+		role      string
+		mockSetup func()
+		want      *domain.Tag
+		wantErr   error
+	}{
+		{
+			name:   "Rename",
+			update: domain.TagUpdate{Name: name("summer")},
+			role:   domain.RoleEditor,
+			mockSetup: func() {
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.Tag")).Return(nil)
+			},
+			want: &domain.Tag{ID: 1, WorkspaceID: 3, Name: "summer", Color: "#ff0000"},
+		},
+		{
+			name:   "Clear Color",
+			update: domain.TagUpdate{Color: name("")},
+			role:   domain.RoleEditor,
+			mockSetup: func() {
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.Tag")).Return(nil)
+			},
+			want: &domain.Tag{ID: 1, WorkspaceID: 3, Name: "promo"},
+		},
+		{
+			name:   "Name Taken",
+			update: domain.TagUpdate{Name: name("summer")},
+			role:   domain.RoleEditor,
+			mockSetup: func() {
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.Tag")).Return(&domain.ErrTagAlreadyExists{Name: "summer"})
+			},
+			wantErr: &domain.ErrTagAlreadyExists{Name: "summer"},
+		},
+		{
+			name:      "Viewer",
+			update:    domain.TagUpdate{Name: name("summer")},
+			role:      domain.RoleViewer,
+			mockSetup: func() {},
+			wantErr:   &domain.ErrForbidden{Resource: "tag", ID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.Tag{ID: 1, WorkspaceID: 3, Name: "promo", Color: "#ff0000"}, nil)
+			mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(tt.role, nil)
+			tt.mockSetup()
+
+			tag, err := service.UpdateTag(ctx, 1, "user123", tt.update)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, tag)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, tag)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	mockRepo := new(MockTagRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		targetID  int64
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name:     "Success",
+			targetID: 2,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(2)).Return(&domain.Tag{ID: 2, WorkspaceID: 3, Name: "sale"}, nil)
+				mockRepo.On("Merge", ctx, int64(1), int64(2)).Return(nil)
+			},
+		},
+		{
+			name:     "Other Workspace",
+			targetID: 2,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(2)).Return(&domain.Tag{ID: 2, WorkspaceID: 4, Name: "sale"}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(4), "user123").Return(domain.RoleOwner, nil)
+			},
+			wantErr: &domain.ErrInvalidTag{Reason: "tags must belong to the same workspace"},
+		},
+		{
+			name:      "Into Itself",
+			targetID:  1,
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidTag{Reason: "a tag cannot be merged into itself"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.Tag{ID: 1, WorkspaceID: 3, Name: "promo"}, nil)
+			mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+			tt.mockSetup()
+
+			tag, err := service.MergeTags(ctx, 1, tt.targetID, "user123")
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, tag)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.targetID, tag.ID)
+			}
+		})
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	mockRepo := new(MockTagRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.Tag{ID: 1, WorkspaceID: 3, Name: "promo"}, nil)
+	mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+	mockRepo.On("Delete", ctx, int64(1)).Return(nil)
+
+	assert.NoError(t, service.DeleteTag(ctx, 1, "user123"))
+	mockRepo.AssertCalled(t, "Delete", ctx, int64(1))
+}
+
 func TestGetURLTags(t *testing.T) {
 	mockRepo := new(MockTagRepository)
-	service := NewTagService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
 	ctx := context.Background()
 
 	tags := []domain.Tag{
@@ -199,6 +407,7 @@ func TestGetURLTags(t *testing.T) {
 			name:  "Success",
 			urlID: 1,
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
 				mockRepo.On("GetURLTags", ctx, int64(1)).Return(tags, nil)
 			},
 			wantErr: false,
@@ -207,18 +416,28 @@ func TestGetURLTags(t *testing.T) {
 			name:  "Repository Error",
 			urlID: 1,
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(nil)
 				mockRepo.On("GetURLTags", ctx, int64(1)).Return(nil, assert.AnError)
 			},
 			wantErr: true,
 		},
+		{
+			name:  "Not Owner",
+			urlID: 1,
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionView).Return(&domain.ErrForbidden{Resource: "URL", ID: 1})
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			result, err := service.GetURLTags(ctx, tt.urlID)
+			result, err := service.GetURLTags(ctx, tt.urlID, "user123")
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, result)
@@ -237,7 +456,8 @@ func TestGetURLTags(t *testing.T) {
 
 func TestAddTagToURL(t *testing.T) {
 	mockRepo := new(MockTagRepository)
-	service := NewTagService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
 	ctx := context.Background()
 
 	tests := []struct {
@@ -252,7 +472,8 @@ func TestAddTagToURL(t *testing.T) {
 			urlID: 1,
 			tag:   "test-tag",
 			mockSetup: func() {
-				mockRepo.On("AddTagToURL", ctx, int64(1), "test-tag").Return(nil)
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(nil)
+				mockRepo.On("AddTagToURL", ctx, int64(1), "test-tag", unlimitedQuota).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -261,7 +482,17 @@ func TestAddTagToURL(t *testing.T) {
 			urlID: 1,
 			tag:   "test-tag",
 			mockSetup: func() {
-				mockRepo.On("AddTagToURL", ctx, int64(1), "test-tag").Return(assert.AnError)
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(nil)
+				mockRepo.On("AddTagToURL", ctx, int64(1), "test-tag", unlimitedQuota).Return(assert.AnError)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "Not Owner",
+			urlID: 1,
+			tag:   "test-tag",
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(&domain.ErrForbidden{Resource: "URL", ID: 1})
 			},
 			wantErr: true,
 		},
@@ -270,9 +501,10 @@ func TestAddTagToURL(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			err := service.AddTagToURL(ctx, tt.urlID, tt.tag)
+			err := service.AddTagToURL(ctx, tt.urlID, "user123", tt.tag)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -284,7 +516,8 @@ func TestAddTagToURL(t *testing.T) {
 
 func TestRemoveTagFromURL(t *testing.T) {
 	mockRepo := new(MockTagRepository)
-	service := NewTagService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
 	ctx := context.Background()
 
 	tests := []struct {
@@ -299,6 +532,7 @@ func TestRemoveTagFromURL(t *testing.T) {
 			urlID: 1,
 			tag:   "test-tag",
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(nil)
 				mockRepo.On("RemoveTagFromURL", ctx, int64(1), "test-tag").Return(nil)
 			},
 			wantErr: false,
@@ -308,18 +542,29 @@ func TestRemoveTagFromURL(t *testing.T) {
 			urlID: 1,
 			tag:   "test-tag",
 			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(nil)
 				mockRepo.On("RemoveTagFromURL", ctx, int64(1), "test-tag").Return(assert.AnError)
 			},
 			wantErr: true,
 		},
+		{
+			name:  "Not Owner",
+			urlID: 1,
+			tag:   "test-tag",
+			mockSetup: func() {
+				mockOwners.On("CheckURL", ctx, int64(1), "user123", domain.PermissionEdit).Return(&domain.ErrForbidden{Resource: "URL", ID: 1})
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
 			tt.mockSetup()
 
-			err := service.RemoveTagFromURL(ctx, tt.urlID, tt.tag)
+			err := service.RemoveTagFromURL(ctx, tt.urlID, "user123", tt.tag)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -328,3 +573,78 @@ func TestRemoveTagFromURL(t *testing.T) {
 		})
 	}
 }
+
+func TestBulkTagURLs(t *testing.T) {
+	mockRepo := new(MockTagRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewTagService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		urlIDs    []int64
+		add       []string
+		remove    []string
+		mockSetup func()
+		wantErr   error
+	}{
+		{
+			name:   "Success",
+			urlIDs: []int64{1, 2, 1},
+			add:    []string{" summer ", "summer"},
+			remove: []string{"draft"},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", domain.PermissionEdit).Return(int64(7), nil)
+				mockRepo.On("BulkTagURLs", ctx, int64(7), []int64{1, 2}, []string{"summer"}, []string{"draft"}, unlimitedQuota).Return(nil)
+			},
+		},
+		{
+			name:   "Link Outside Workspace",
+			urlIDs: []int64{1, 99},
+			add:    []string{"summer"},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", domain.PermissionEdit).Return(int64(7), nil)
+				mockRepo.On("BulkTagURLs", ctx, int64(7), []int64{1, 99}, []string{"summer"}, []string{}, unlimitedQuota).Return(&domain.ErrURLNotFound{})
+			},
+			wantErr: &domain.ErrURLNotFound{},
+		},
+		{
+			name:      "No URLs",
+			add:       []string{"summer"},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: "url_ids is required"},
+		},
+		{
+			name:      "Nothing To Do",
+			urlIDs:    []int64{1},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: "add or remove is required"},
+		},
+		{
+			name:      "Added And Removed",
+			urlIDs:    []int64{1},
+			add:       []string{"summer"},
+			remove:    []string{"summer "},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: "tag summer cannot be both added and removed"},
+		},
+		{
+			name:      "Invalid Tag",
+			urlIDs:    []int64{1},
+			add:       []string{""},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidTag{Reason: "name is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			tt.mockSetup()
+
+			err := service.BulkTagURLs(ctx, tt.urlIDs, "user123", 7, tt.add, tt.remove)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -2,43 +2,109 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
 )
 
+const (
+	minAliasLength = 3
+	maxAliasLength = maxShortCodeLength
+
+	// maxShortCodeAttempts bounds how often a generated code is retried
+	// after colliding with an existing one
+	maxShortCodeAttempts = 5
+
+	// DefaultListLimit and MaxListLimit bound the page size of URL listings
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases are path segments and words that must never be handed out
+// as custom aliases because they clash with routes or look official
+var reservedAliases = map[string]struct{}{
+	"health":  {},
+	"public":  {},
+	"private": {},
+	"r":       {},
+	"api":     {},
+	"admin":   {},
+	"metrics": {},
+	"static":  {},
+	"assets":  {},
+	"login":   {},
+	"logout":  {},
+	"signup":  {},
+	"www":     {},
+}
+
 type URLService struct {
-	repo domain.URLRepository
+	repo      domain.URLRepository
+	domains   domain.CustomDomainRepository
+	owners    domain.OwnershipChecker
+	generator ShortCodeGenerator
+	quotas    domain.QuotaChecker
 }
 
-// New creates a new URL service
-func NewURLService(repo domain.URLRepository) domain.URLService {
+// New creates a new URL service. A nil generator falls back to random
+// codes with the default alphabet and length.
+func NewURLService(repo domain.URLRepository, domains domain.CustomDomainRepository, owners domain.OwnershipChecker, generator ShortCodeGenerator, quotas domain.QuotaChecker) domain.URLService {
+	if generator == nil {
+		generator = NewRandomShortCodeGenerator(DefaultShortCodeAlphabet, DefaultShortCodeLength)
+	}
+
 	return &URLService{
-		repo: repo,
+		repo:      repo,
+		domains:   domains,
+		owners:    owners,
+		generator: generator,
+		quotas:    quotas,
 	}
 }
 
-// generateShortCode generates a random short code for URLs
-func generateShortCode() (string, error) {
-	b := make([]byte, 6)
-	_, err := rand.Read(b)
-	if err != nil {
-		return "", err
+// validateAlias checks a user supplied alias against the allowed alphabet,
+// length limits and the reserved word list
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return &domain.ErrInvalidAlias{Alias: alias, Reason: "must be between 3 and 10 characters"}
+	}
+
+	if !aliasPattern.MatchString(alias) {
+		return &domain.ErrInvalidAlias{Alias: alias, Reason: "may only contain letters, digits, '-' and '_'"}
 	}
-	return base64.URLEncoding.EncodeToString(b)[:8], nil
+
+	if _, reserved := reservedAliases[strings.ToLower(alias)]; reserved {
+		return &domain.ErrInvalidAlias{Alias: alias, Reason: "is reserved"}
+	}
+
+	return nil
 }
 
-// CreateShortURL creates a new shortened URL
-func (s *URLService) CreateShortURL(ctx context.Context, originalURL string, userID string, expiresAt *time.Time) (*domain.URL, error) {
-	shortCode, err := generateShortCode()
-	if err != nil {
-		return nil, err
+// hashPassword validates a link password and returns its hash
+func hashPassword(password string) (string, error) {
+	if len(password) < linkpass.MinLength || len(password) > linkpass.MaxLength {
+		return "", &domain.ErrInvalidPassword{Reason: fmt.Sprintf("must be between %d and %d bytes", linkpass.MinLength, linkpass.MaxLength)}
 	}
 
+	return linkpass.Hash(password)
+}
+
+// CreateShortURL creates a new shortened URL. When alias is non-empty it is
+// used as the short code instead of a generated one. When domainName is
+// non-empty the link is served on that custom domain, which must be
+// verified and belong to the same workspace. Links created in a workspace
+// count against its plan's monthly quota. A non-empty password protects the
+// link.
+func (s *URLService) CreateShortURL(ctx context.Context, originalURL string, userID string, workspaceID int64, expiresAt *time.Time, alias string, domainName string, password string) (*domain.URL, error) {
 	url := &domain.URL{
-		ShortCode:   shortCode,
 		OriginalURL: originalURL,
 		UserID:      userID,
 		CreatedAt:   time.Now(),
@@ -46,20 +112,121 @@ func (s *URLService) CreateShortURL(ctx context.Context, originalURL string, use
 		IsActive:    true,
 	}
 
-	if err := s.repo.Create(url); err != nil {
+	// Anonymous links belong to no workspace
+	if userID != "" {
+		id, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, domain.PermissionEdit)
+		if err != nil {
+			return nil, err
+		}
+		url.WorkspaceID = &id
+	}
+
+	if domainName != "" {
+		d, err := s.domains.GetByDomain(ctx, normalizeDomain(domainName))
+		if err != nil {
+			return nil, err
+		}
+		// Other workspaces' domains look like they do not exist
+		if url.WorkspaceID == nil || d.WorkspaceID != *url.WorkspaceID {
+			return nil, &domain.ErrDomainNotFound{Domain: d.Domain}
+		}
+		if !d.Verified {
+			return nil, &domain.ErrDomainNotVerified{Domain: d.Domain}
+		}
+		url.DomainID = &d.ID
+	}
+
+	if alias != "" {
+		if err := validateAlias(alias); err != nil {
+			return nil, err
+		}
+	}
+
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		url.PasswordHash = hash
+		url.PasswordProtected = true
+	}
+
+	if url.WorkspaceID == nil {
+		return s.create(ctx, url, alias)
+	}
+
+	period, err := s.quotas.ReserveLink(ctx, *url.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.create(ctx, url, alias)
+	if err != nil {
+		if releaseErr := s.quotas.ReleaseLink(ctx, *url.WorkspaceID, period); releaseErr != nil {
+			log.Printf("[ERROR] releasing link quota of workspace %d: %v", *url.WorkspaceID, releaseErr)
+		}
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// create stores url under alias, or under a generated short code when
+// alias is empty
+func (s *URLService) create(ctx context.Context, url *domain.URL, alias string) (*domain.URL, error) {
+	if alias != "" {
+		url.ShortCode = alias
+		url.IsCustomAlias = true
+
+		if err := s.repo.Create(ctx, url); err != nil {
+			return nil, err
+		}
+		return url, nil
+	}
+
+	// Generated codes may collide with existing ones; draw a fresh code on
+	// every unique violation until the attempts run out
+	var err error
+	for attempt := 0; attempt < maxShortCodeAttempts; attempt++ {
+		url.ID = 0
+		if err = s.generator.Generate(ctx, url); err != nil {
+			return nil, err
+		}
+
+		err = s.repo.Create(ctx, url)
+		var conflict *domain.ErrShortCodeConflict
+		if !errors.As(err, &conflict) {
+			break
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
 	return url, nil
 }
 
-// GetURL retrieves a URL by its short code
+// GetURL retrieves a URL served on the default host by its short code
 func (s *URLService) GetURL(ctx context.Context, shortCode string) (*domain.URL, error) {
-	url, err := s.repo.GetByShortCode(shortCode)
+	url, err := s.repo.GetByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return servable(url, shortCode)
+}
+
+// GetDomainURL retrieves a URL served on a custom domain by its short code
+func (s *URLService) GetDomainURL(ctx context.Context, domainID int64, shortCode string) (*domain.URL, error) {
+	url, err := s.repo.GetByDomainShortCode(ctx, domainID, shortCode)
 	if err != nil {
 		return nil, err
 	}
 
+	return servable(url, shortCode)
+}
+
+// servable hides deactivated URLs and rejects expired ones
+func servable(url *domain.URL, shortCode string) (*domain.URL, error) {
 	if url == nil {
 		return nil, &domain.ErrURLNotFound{ShortCode: shortCode}
 	}
@@ -75,17 +242,201 @@ func (s *URLService) GetURL(ctx context.Context, shortCode string) (*domain.URL,
 	return url, nil
 }
 
-// ListUserURLs retrieves all URLs for a given user
-func (s *URLService) ListUserURLs(ctx context.Context, userID string) ([]domain.URL, error) {
-	return s.repo.GetByUserID(userID)
+// ListUserURLs retrieves one page of the URLs in a workspace the user can view
+func (s *URLService) ListUserURLs(ctx context.Context, query domain.URLQuery) (*domain.URLPage, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+	if query.Limit < 1 || query.Limit > MaxListLimit {
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("limit must be between 1 and %d", MaxListLimit)}
+	}
+
+	switch query.SortBy {
+	case "":
+		query.SortBy = domain.URLSortCreatedAt
+	case domain.URLSortCreatedAt, domain.URLSortClickCount:
+	default:
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("sort must be %q or %q", domain.URLSortCreatedAt, domain.URLSortClickCount)}
+	}
+
+	switch query.State {
+	case "", domain.URLStateActive, domain.URLStateExpired:
+	default:
+		return nil, &domain.ErrInvalidQuery{Reason: fmt.Sprintf("state must be %q or %q", domain.URLStateActive, domain.URLStateExpired)}
+	}
+
+	if query.CreatedAfter != nil && query.CreatedBefore != nil && !query.CreatedAfter.Before(*query.CreatedBefore) {
+		return nil, &domain.ErrInvalidQuery{Reason: "created_after must be before created_before"}
+	}
+
+	query.Search = strings.TrimSpace(query.Search)
+
+	workspaceID, err := s.owners.CheckWorkspace(ctx, query.WorkspaceID, query.UserID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	query.WorkspaceID = workspaceID
+
+	return s.repo.List(ctx, query)
+}
+
+// BulkUpdateURLs deactivates, extends or deletes every active link of the
+// workspace carrying query.Tag or matching query.TagExpr in one transaction
+func (s *URLService) BulkUpdateURLs(ctx context.Context, query domain.URLQuery, action domain.URLBulkAction) (*domain.URLBulkResult, error) {
+	switch action.Action {
+	case domain.URLBulkDeactivate, domain.URLBulkDelete:
+		action.ExpiresAt = nil
+	case domain.URLBulkExtend:
+		if action.ExpiresAt == nil || !action.ExpiresAt.After(time.Now()) {
+			return nil, &domain.ErrInvalidBulkRequest{Reason: "expires_at must be in the future"}
+		}
+	default:
+		return nil, &domain.ErrInvalidBulkRequest{Reason: fmt.Sprintf("action must be %q, %q or %q", domain.URLBulkDeactivate, domain.URLBulkExtend, domain.URLBulkDelete)}
+	}
+
+	// Only tags select links, so a bulk operation never sweeps a whole workspace
+	query.Tag = strings.TrimSpace(query.Tag)
+	if query.Tag == "" && query.TagExpr == nil {
+		return nil, &domain.ErrInvalidBulkRequest{Reason: "tag or tags is required"}
+	}
+	query = domain.URLQuery{
+		UserID:      query.UserID,
+		WorkspaceID: query.WorkspaceID,
+		Tag:         query.Tag,
+		TagExpr:     query.TagExpr,
+	}
+
+	workspaceID, err := s.owners.CheckWorkspace(ctx, query.WorkspaceID, query.UserID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+	query.WorkspaceID = workspaceID
+
+	urls, err := s.repo.BulkUpdate(ctx, query, action, query.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.URLBulkResult{Affected: len(urls), IDs: make([]int64, len(urls))}
+	for i, url := range urls {
+		result.IDs[i] = url.ID
+	}
+
+	return result, nil
 }
 
-// DeleteURL deletes a URL by its ID and user ID
+// DeleteURL deletes a URL if userID may edit its workspace's links
 func (s *URLService) DeleteURL(ctx context.Context, id int64, userID string) error {
-	return s.repo.Delete(id, userID)
+	if _, err := s.getOwnedURL(ctx, id, userID, domain.PermissionEdit); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// getOwnedURL loads a URL, hiding it from users outside its workspace and
+// refusing members whose role does not grant perm
+func (s *URLService) getOwnedURL(ctx context.Context, id int64, userID string, perm domain.Permission) (*domain.URL, error) {
+	url, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	role := ""
+	if url.WorkspaceID != nil {
+		role, err = s.owners.WorkspaceRole(ctx, *url.WorkspaceID, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if role == "" {
+		return nil, &domain.ErrURLNotFound{ID: id}
+	}
+	if !domain.RoleAllows(role, perm) {
+		return nil, &domain.ErrForbidden{Resource: "URL", ID: id}
+	}
+
+	return url, nil
+}
+
+// UpdateURL edits a URL if userID may edit its workspace's links. The short
+// code can only be changed on links that already use a custom alias, since
+// generated codes may have been shared already.
+func (s *URLService) UpdateURL(ctx context.Context, id int64, userID string, update domain.URLUpdate, expectedVersion int) (*domain.URL, error) {
+	url, err := s.getOwnedURL(ctx, id, userID, domain.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && expectedVersion != url.Version {
+		return nil, &domain.ErrVersionMismatch{ID: id, ExpectedVersion: expectedVersion}
+	}
+
+	if update.OriginalURL != nil {
+		url.OriginalURL = *update.OriginalURL
+	}
+	if update.ClearExpiresAt {
+		url.ExpiresAt = nil
+	} else if update.ExpiresAt != nil {
+		url.ExpiresAt = update.ExpiresAt
+	}
+	if update.IsActive != nil {
+		url.IsActive = *update.IsActive
+	}
+	if update.Alias != nil && *update.Alias != url.ShortCode {
+		if !url.IsCustomAlias {
+			return nil, &domain.ErrInvalidAlias{Alias: *update.Alias, Reason: "only links created with a custom alias can change it"}
+		}
+		if err := validateAlias(*update.Alias); err != nil {
+			return nil, err
+		}
+		url.ShortCode = *update.Alias
+	}
+	if update.Password != nil {
+		url.PasswordHash = ""
+		if *update.Password != "" {
+			if url.PasswordHash, err = hashPassword(*update.Password); err != nil {
+				return nil, err
+			}
+		}
+		url.PasswordProtected = url.PasswordHash != ""
+	}
+
+	if err := s.repo.Update(ctx, url, url.Version, userID); err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// GetURLHistory lists previous versions of a URL userID can view, newest first
+func (s *URLService) GetURLHistory(ctx context.Context, id int64, userID string) ([]domain.URLHistory, error) {
+	if _, err := s.getOwnedURL(ctx, id, userID, domain.PermissionView); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetHistory(ctx, id)
+}
+
+// RollbackURL restores the destination recorded in a history entry. The
+// rollback is itself an edit, so it can be rolled back too.
+func (s *URLService) RollbackURL(ctx context.Context, id int64, userID string, historyID int64, expectedVersion int) (*domain.URL, error) {
+	history, err := s.GetURLHistory(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range history {
+		if h.ID == historyID {
+			return s.UpdateURL(ctx, id, userID, domain.URLUpdate{OriginalURL: &h.OriginalURL}, expectedVersion)
+		}
+	}
+
+	return nil, &domain.ErrHistoryNotFound{ID: historyID}
 }
 
 // RecordClick increments the click count for a URL
-func (s *URLService) RecordClick(urlID int64) error {
-	return s.repo.IncrementClickCount(urlID)
+func (s *URLService) RecordClick(ctx context.Context, urlID int64) error {
+	return s.repo.IncrementClickCount(ctx, urlID)
 }
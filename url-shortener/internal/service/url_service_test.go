@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/linkpass"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -15,49 +17,102 @@ type MockURLRepository struct {
 	mock.Mock
 }
 
-func (m *MockURLRepository) Create(url *domain.URL) error {
-	args := m.Called(url)
+func (m *MockURLRepository) Create(ctx context.Context, url *domain.URL) error {
+	args := m.Called(ctx, url)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) GetByShortCode(shortCode string) (*domain.URL, error) {
-	args := m.Called(shortCode)
+func (m *MockURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
+	args := m.Called(ctx, shortCode)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.URL), args.Error(1)
 }
 
-func (m *MockURLRepository) GetByUserID(userID string) ([]domain.URL, error) {
-	args := m.Called(userID)
+func (m *MockURLRepository) GetByDomainShortCode(ctx context.Context, domainID int64, shortCode string) (*domain.URL, error) {
+	args := m.Called(ctx, domainID, shortCode)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]domain.URL), args.Error(1)
+	return args.Get(0).(*domain.URL), args.Error(1)
+}
+
+func (m *MockURLRepository) List(ctx context.Context, query domain.URLQuery) (*domain.URLPage, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.URLPage), args.Error(1)
+}
+
+func (m *MockURLRepository) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockURLRepository) IncrementClickCount(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
 }
 
-func (m *MockURLRepository) Delete(id int64, userID string) error {
-	args := m.Called(id, userID)
+func (m *MockURLRepository) IncrementClickCounts(ctx context.Context, clicks map[int64]int64) error {
+	args := m.Called(ctx, clicks)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) IncrementClickCount(id int64) error {
-	args := m.Called(id)
+func (m *MockURLRepository) GetByID(ctx context.Context, id int64) (*domain.URL, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.URL), args.Error(1)
+}
+
+func (m *MockURLRepository) Update(ctx context.Context, url *domain.URL, expectedVersion int, changedBy string) error {
+	args := m.Called(ctx, url, expectedVersion, changedBy)
 	return args.Error(0)
 }
 
+func (m *MockURLRepository) GetHistory(ctx context.Context, urlID int64) ([]domain.URLHistory, error) {
+	args := m.Called(ctx, urlID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.URLHistory), args.Error(1)
+}
+
+func (m *MockURLRepository) BulkUpdate(ctx context.Context, query domain.URLQuery, action domain.URLBulkAction, changedBy string) ([]domain.URL, error) {
+	args := m.Called(ctx, query, action, changedBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.URL), args.Error(1)
+}
+
 func TestCreateShortURL(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	mockDomains := new(MockCustomDomainRepository)
+	mockOwners := new(MockOwnershipChecker)
+	mockQuotas := new(MockQuotaChecker)
+	service := NewURLService(mockRepo, mockDomains, mockOwners, nil, mockQuotas)
 	ctx := context.Background()
+	period := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name        string
 		originalURL string
 		userID      string
+		workspaceID int64
 		expiresAt   *time.Time
+		alias       string
+		domainName  string
+		password    string
 		mockSetup   func()
 		wantErr     bool
+		errType     interface{}
+		// released is whether the reserved link is given back
+		released bool
 	}{
 		{
 			name:        "Success",
@@ -65,7 +120,7 @@ func TestCreateShortURL(t *testing.T) {
 			userID:      "user123",
 			expiresAt:   nil,
 			mockSetup: func() {
-				mockRepo.On("Create", mock.AnythingOfType("*domain.URL")).Return(nil)
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -75,26 +130,221 @@ func TestCreateShortURL(t *testing.T) {
 			userID:      "user123",
 			expiresAt:   nil,
 			mockSetup: func() {
-				mockRepo.On("Create", mock.AnythingOfType("*domain.URL")).Return(assert.AnError)
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(assert.AnError)
+			},
+			wantErr:  true,
+			released: true,
+		},
+		{
+			name:        "Monthly Quota Used Up",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			mockSetup: func() {
+				mockQuotas.ExpectedCalls = nil
+				mockQuotas.On("ReserveLink", ctx, int64(3)).
+					Return(time.Time{}, &domain.ErrQuotaExceeded{Quota: domain.QuotaLinks, Plan: domain.PlanFree, Limit: 100})
+			},
+			wantErr: true,
+			errType: &domain.ErrQuotaExceeded{},
+		},
+		{
+			name:        "Retries On Short Code Collision",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(&domain.ErrShortCodeConflict{}).Twice()
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(nil).Once()
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Gives Up After Repeated Collisions",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(&domain.ErrShortCodeConflict{}).Times(maxShortCodeAttempts)
+			},
+			wantErr:  true,
+			errType:  &domain.ErrShortCodeConflict{},
+			released: true,
+		},
+		{
+			name:        "Custom Alias",
+			originalURL: "https://example.com/summer",
+			userID:      "user123",
+			alias:       "summer-24",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(url *domain.URL) bool {
+					return url.ShortCode == "summer-24"
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Alias Too Long",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			alias:       "summer-sale-2024",
+			mockSetup:   func() {},
+			wantErr:     true,
+			errType:     &domain.ErrInvalidAlias{},
+		},
+		{
+			name:        "Alias Invalid Characters",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			alias:       "sale/2024",
+			mockSetup:   func() {},
+			wantErr:     true,
+			errType:     &domain.ErrInvalidAlias{},
+		},
+		{
+			name:        "Alias Reserved",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			alias:       "Health",
+			mockSetup:   func() {},
+			wantErr:     true,
+			errType:     &domain.ErrInvalidAlias{},
+		},
+		{
+			name:        "Alias Taken",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			alias:       "taken",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.URL")).Return(&domain.ErrShortCodeConflict{ShortCode: "taken"})
+			},
+			wantErr:  true,
+			errType:  &domain.ErrShortCodeConflict{},
+			released: true,
+		},
+		{
+			name:        "Custom Domain",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			alias:       "promo",
+			domainName:  "Go.Acme.com.",
+			mockSetup: func() {
+				mockDomains.On("GetByDomain", ctx, "go.acme.com").Return(&domain.CustomDomain{ID: 7, Domain: "go.acme.com", WorkspaceID: 3, Verified: true}, nil)
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(url *domain.URL) bool {
+					return url.ShortCode == "promo" && url.DomainID != nil && *url.DomainID == 7
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Custom Domain Not Verified",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			domainName:  "go.acme.com",
+			mockSetup: func() {
+				mockDomains.On("GetByDomain", ctx, "go.acme.com").Return(&domain.CustomDomain{ID: 7, Domain: "go.acme.com", WorkspaceID: 3}, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrDomainNotVerified{},
+		},
+		{
+			name:        "Custom Domain Of Another Workspace",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			domainName:  "go.acme.com",
+			mockSetup: func() {
+				mockDomains.On("GetByDomain", ctx, "go.acme.com").Return(&domain.CustomDomain{ID: 7, Domain: "go.acme.com", WorkspaceID: 9, Verified: true}, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrDomainNotFound{},
+		},
+		{
+			name:        "Custom Domain Not Found",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			domainName:  "go.acme.com",
+			mockSetup: func() {
+				mockDomains.On("GetByDomain", ctx, "go.acme.com").Return(nil, &domain.ErrDomainNotFound{Domain: "go.acme.com"})
+			},
+			wantErr: true,
+			errType: &domain.ErrDomainNotFound{},
+		},
+		{
+			name:        "Workspace Role Cannot Edit",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			workspaceID: 9,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(9), "user123", domain.PermissionEdit).
+					Return(int64(0), &domain.ErrForbidden{Resource: "workspace", ID: 9})
 			},
 			wantErr: true,
+			errType: &domain.ErrForbidden{},
+		},
+		{
+			name:        "Anonymous",
+			originalURL: "https://example.com",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(url *domain.URL) bool {
+					return url.WorkspaceID == nil
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Password Protected",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			password:    "open-sesame",
+			mockSetup: func() {
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(url *domain.URL) bool {
+					return url.PasswordProtected && url.PasswordHash != "open-sesame" && linkpass.Check(url.PasswordHash, "open-sesame")
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Password Too Short",
+			originalURL: "https://example.com",
+			userID:      "user123",
+			password:    "abc",
+			mockSetup:   func() {},
+			wantErr:     true,
+			errType:     &domain.ErrInvalidPassword{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockDomains.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			// Without a workspace header links go to the personal workspace
+			mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionEdit).Return(int64(3), nil)
+			mockQuotas.ExpectedCalls = nil
+			mockQuotas.Calls = nil
+			mockQuotas.On("ReserveLink", ctx, int64(3)).Return(period, nil)
+			mockQuotas.On("ReleaseLink", ctx, int64(3), period).Return(nil)
 			tt.mockSetup()
 
-			url, err := service.CreateShortURL(ctx, tt.originalURL, tt.userID, tt.expiresAt)
+			url, err := service.CreateShortURL(ctx, tt.originalURL, tt.userID, tt.workspaceID, tt.expiresAt, tt.alias, tt.domainName, tt.password)
+			// Links are released in the period they were reserved in
+			if tt.released {
+				mockQuotas.AssertCalled(t, "ReleaseLink", ctx, int64(3), period)
+			} else {
+				mockQuotas.AssertNotCalled(t, "ReleaseLink", ctx, int64(3), period)
+			}
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, url)
+				if tt.errType != nil {
+					assert.IsType(t, tt.errType, err)
+				}
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, url)
 				assert.Equal(t, tt.originalURL, url.OriginalURL)
 				assert.Equal(t, tt.userID, url.UserID)
+				if tt.alias != "" {
+					assert.Equal(t, tt.alias, url.ShortCode)
+				}
 			}
 		})
 	}
@@ -102,7 +352,7 @@ func TestCreateShortURL(t *testing.T) {
 
 func TestGetURL(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	service := NewURLService(mockRepo, nil, nil, nil, unlimitedQuotas())
 	ctx := context.Background()
 
 	now := time.Now()
@@ -120,7 +370,7 @@ func TestGetURL(t *testing.T) {
 			name:      "Success",
 			shortCode: "abc123",
 			mockSetup: func() {
-				mockRepo.On("GetByShortCode", "abc123").Return(&domain.URL{
+				mockRepo.On("GetByShortCode", ctx, "abc123").Return(&domain.URL{
 					ShortCode:   "abc123",
 					OriginalURL: "https://example.com",
 					ExpiresAt:   &futureTime,
@@ -133,7 +383,7 @@ func TestGetURL(t *testing.T) {
 			name:      "URL Not Found",
 			shortCode: "notfound",
 			mockSetup: func() {
-				mockRepo.On("GetByShortCode", "notfound").Return(nil, &domain.ErrURLNotFound{ShortCode: "notfound"})
+				mockRepo.On("GetByShortCode", ctx, "notfound").Return(nil, &domain.ErrURLNotFound{ShortCode: "notfound"})
 			},
 			wantErr: true,
 			errType: &domain.ErrURLNotFound{},
@@ -142,7 +392,7 @@ func TestGetURL(t *testing.T) {
 			name:      "URL Expired",
 			shortCode: "expired",
 			mockSetup: func() {
-				mockRepo.On("GetByShortCode", "expired").Return(&domain.URL{
+				mockRepo.On("GetByShortCode", ctx, "expired").Return(&domain.URL{
 					ShortCode:   "expired",
 					OriginalURL: "https://example.com",
 					ExpiresAt:   &expiredTime,
@@ -175,33 +425,174 @@ func TestGetURL(t *testing.T) {
 	}
 }
 
+func TestGetDomainURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	service := NewURLService(mockRepo, nil, nil, nil, unlimitedQuotas())
+	ctx := context.Background()
+
+	expiredTime := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		shortCode string
+		mockSetup func()
+		wantErr   bool
+		errType   interface{}
+	}{
+		{
+			name:      "Success",
+			shortCode: "promo",
+			mockSetup: func() {
+				mockRepo.On("GetByDomainShortCode", ctx, int64(7), "promo").Return(&domain.URL{
+					ShortCode:   "promo",
+					OriginalURL: "https://example.com",
+					IsActive:    true,
+				}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "URL Not Found",
+			shortCode: "notfound",
+			mockSetup: func() {
+				mockRepo.On("GetByDomainShortCode", ctx, int64(7), "notfound").Return(nil, &domain.ErrURLNotFound{ShortCode: "notfound"})
+			},
+			wantErr: true,
+			errType: &domain.ErrURLNotFound{},
+		},
+		{
+			name:      "URL Deactivated",
+			shortCode: "gone",
+			mockSetup: func() {
+				mockRepo.On("GetByDomainShortCode", ctx, int64(7), "gone").Return(&domain.URL{ShortCode: "gone", IsActive: false}, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrURLNotFound{},
+		},
+		{
+			name:      "URL Expired",
+			shortCode: "expired",
+			mockSetup: func() {
+				mockRepo.On("GetByDomainShortCode", ctx, int64(7), "expired").Return(&domain.URL{
+					ShortCode: "expired",
+					ExpiresAt: &expiredTime,
+					IsActive:  true,
+				}, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrURLExpired{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			tt.mockSetup()
+
+			url, err := service.GetDomainURL(ctx, 7, tt.shortCode)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, url)
+				if tt.errType != nil {
+					assert.IsType(t, tt.errType, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.shortCode, url.ShortCode)
+			}
+		})
+	}
+}
+
 func TestListUserURLs(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewURLService(mockRepo, nil, mockOwners, nil, unlimitedQuotas())
 	ctx := context.Background()
 
+	after := time.Now().Add(-time.Hour)
+	before := time.Now()
+
 	tests := []struct {
 		name      string
-		userID    string
+		query     domain.URLQuery
 		mockSetup func()
 		wantErr   bool
 	}{
 		{
-			name:   "Success",
-			userID: "user123",
+			name:  "Success With Defaults",
+			query: domain.URLQuery{UserID: "user123"},
 			mockSetup: func() {
-				mockRepo.On("GetByUserID", "user123").Return([]domain.URL{
+				mockRepo.On("List", ctx, domain.URLQuery{
+					UserID:      "user123",
+					WorkspaceID: 3,
+					SortBy:      domain.URLSortCreatedAt,
+					Limit:       DefaultListLimit,
+				}).Return(&domain.URLPage{URLs: []domain.URL{
 					{ID: 1, ShortCode: "abc123", UserID: "user123"},
 					{ID: 2, ShortCode: "def456", UserID: "user123"},
-				}, nil)
+				}, NextCursor: "next"}, nil)
 			},
 			wantErr: false,
 		},
 		{
-			name:   "Repository Error",
-			userID: "user123",
+			name: "Filters Are Passed Through",
+			query: domain.URLQuery{
+				UserID:        "user123",
+				Tag:           "promo",
+				State:         domain.URLStateExpired,
+				CreatedAfter:  &after,
+				CreatedBefore: &before,
+				Search:        " example ",
+				SortBy:        domain.URLSortClickCount,
+				Limit:         10,
+			},
 			mockSetup: func() {
-				mockRepo.On("GetByUserID", "user123").Return(nil, assert.AnError)
+				mockRepo.On("List", ctx, mock.MatchedBy(func(q domain.URLQuery) bool {
+					return q.Tag == "promo" && q.State == domain.URLStateExpired && q.Search == "example" &&
+						q.SortBy == domain.URLSortClickCount && q.Limit == 10
+				})).Return(&domain.URLPage{URLs: []domain.URL{{ID: 1, UserID: "user123"}}}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "Limit Too Large",
+			query:     domain.URLQuery{UserID: "user123", Limit: MaxListLimit + 1},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name:      "Unknown Sort",
+			query:     domain.URLQuery{UserID: "user123", SortBy: "original_url"},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name:      "Unknown State",
+			query:     domain.URLQuery{UserID: "user123", State: "deleted"},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name:      "Inverted Date Range",
+			query:     domain.URLQuery{UserID: "user123", CreatedAfter: &before, CreatedBefore: &after},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+		{
+			name:  "Not A Workspace Member",
+			query: domain.URLQuery{UserID: "user123", WorkspaceID: 9},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(9), "user123", domain.PermissionView).
+					Return(int64(0), &domain.ErrForbidden{Resource: "workspace", ID: 9})
+			},
+			wantErr: true,
+		},
+		{
+			name:  "Repository Error",
+			query: domain.URLQuery{UserID: "user123"},
+			mockSetup: func() {
+				mockRepo.On("List", ctx, mock.Anything).Return(nil, assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -210,17 +601,19 @@ func TestListUserURLs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionView).Return(int64(3), nil)
 			tt.mockSetup()
 
-			urls, err := service.ListUserURLs(ctx, tt.userID)
+			page, err := service.ListUserURLs(ctx, tt.query)
 			if tt.wantErr {
 				assert.Error(t, err)
-				assert.Nil(t, urls)
+				assert.Nil(t, page)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, urls)
-				for _, url := range urls {
-					assert.Equal(t, tt.userID, url.UserID)
+				assert.NotNil(t, page)
+				for _, url := range page.URLs {
+					assert.Equal(t, tt.query.UserID, url.UserID)
 				}
 			}
 		})
@@ -229,8 +622,10 @@ func TestListUserURLs(t *testing.T) {
 
 func TestDeleteURL(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewURLService(mockRepo, nil, mockOwners, nil, unlimitedQuotas())
 	ctx := context.Background()
+	workspaceID := int64(3)
 
 	tests := []struct {
 		name      string
@@ -244,16 +639,36 @@ func TestDeleteURL(t *testing.T) {
 			id:     1,
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("Delete", int64(1), "user123").Return(nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+				mockRepo.On("Delete", ctx, int64(1)).Return(nil)
 			},
 			wantErr: false,
 		},
+		{
+			name:   "Viewer",
+			id:     1,
+			userID: "user123",
+			mockSetup: func() {
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleViewer, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Not A Member",
+			id:     1,
+			userID: "user456",
+			mockSetup: func() {
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "user456").Return("", nil)
+			},
+			wantErr: true,
+		},
 		{
 			name:   "Repository Error",
 			id:     1,
 			userID: "user123",
 			mockSetup: func() {
-				mockRepo.On("Delete", int64(1), "user123").Return(assert.AnError)
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+				mockRepo.On("Delete", ctx, int64(1)).Return(assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -262,6 +677,8 @@ func TestDeleteURL(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, UserID: "user123", WorkspaceID: &workspaceID}, nil)
 			tt.mockSetup()
 
 			err := service.DeleteURL(ctx, tt.id, tt.userID)
@@ -274,9 +691,99 @@ func TestDeleteURL(t *testing.T) {
 	}
 }
 
+func TestBulkUpdateURLs(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewURLService(mockRepo, nil, mockOwners, nil, unlimitedQuotas())
+	ctx := context.Background()
+	later := time.Now().Add(24 * time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+	expr := &domain.TagExpr{Or: []*domain.TagExpr{{Tag: "summer"}, {Tag: "winter"}}}
+
+	tests := []struct {
+		name      string
+		query     domain.URLQuery
+		action    domain.URLBulkAction
+		mockSetup func()
+		want      *domain.URLBulkResult
+		wantErr   error
+	}{
+		{
+			name:   "Delete Under Tag",
+			query:  domain.URLQuery{UserID: "user123", Tag: " promo ", Search: "ignored", Limit: 5},
+			action: domain.URLBulkAction{Action: domain.URLBulkDelete},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(0), "user123", domain.PermissionEdit).Return(int64(3), nil)
+				mockRepo.On("BulkUpdate", ctx, domain.URLQuery{UserID: "user123", WorkspaceID: 3, Tag: "promo"}, domain.URLBulkAction{Action: domain.URLBulkDelete}, "user123").
+					Return([]domain.URL{{ID: 1}, {ID: 2}}, nil)
+			},
+			want: &domain.URLBulkResult{Affected: 2, IDs: []int64{1, 2}},
+		},
+		{
+			name:   "Extend Matching Expression",
+			query:  domain.URLQuery{UserID: "user123", WorkspaceID: 7, TagExpr: expr},
+			action: domain.URLBulkAction{Action: domain.URLBulkExtend, ExpiresAt: &later},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", domain.PermissionEdit).Return(int64(7), nil)
+				mockRepo.On("BulkUpdate", ctx, domain.URLQuery{UserID: "user123", WorkspaceID: 7, TagExpr: expr}, domain.URLBulkAction{Action: domain.URLBulkExtend, ExpiresAt: &later}, "user123").
+					Return([]domain.URL{}, nil)
+			},
+			want: &domain.URLBulkResult{Affected: 0, IDs: []int64{}},
+		},
+		{
+			name:      "Extend Into The Past",
+			query:     domain.URLQuery{UserID: "user123", Tag: "promo"},
+			action:    domain.URLBulkAction{Action: domain.URLBulkExtend, ExpiresAt: &earlier},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: "expires_at must be in the future"},
+		},
+		{
+			name:      "No Tag",
+			query:     domain.URLQuery{UserID: "user123"},
+			action:    domain.URLBulkAction{Action: domain.URLBulkDeactivate},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: "tag or tags is required"},
+		},
+		{
+			name:      "Unknown Action",
+			query:     domain.URLQuery{UserID: "user123", Tag: "promo"},
+			action:    domain.URLBulkAction{Action: "archive"},
+			mockSetup: func() {},
+			wantErr:   &domain.ErrInvalidBulkRequest{Reason: `action must be "deactivate", "extend" or "delete"`},
+		},
+		{
+			name:   "Viewer",
+			query:  domain.URLQuery{UserID: "user123", WorkspaceID: 7, Tag: "promo"},
+			action: domain.URLBulkAction{Action: domain.URLBulkDeactivate},
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", domain.PermissionEdit).Return(int64(0), &domain.ErrForbidden{Resource: "workspace", ID: 7})
+			},
+			wantErr: &domain.ErrForbidden{Resource: "workspace", ID: 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			tt.mockSetup()
+
+			result, err := service.BulkUpdateURLs(ctx, tt.query, tt.action)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, result)
+			}
+		})
+	}
+}
+
 func TestRecordClick(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	service := NewURLService(mockRepo, nil, nil, nil, unlimitedQuotas())
+	ctx := context.Background()
 
 	tests := []struct {
 		name      string
@@ -288,7 +795,7 @@ func TestRecordClick(t *testing.T) {
 			name:  "Success",
 			urlID: 1,
 			mockSetup: func() {
-				mockRepo.On("IncrementClickCount", int64(1)).Return(nil)
+				mockRepo.On("IncrementClickCount", ctx, int64(1)).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -296,7 +803,7 @@ func TestRecordClick(t *testing.T) {
 			name:  "Repository Error",
 			urlID: 1,
 			mockSetup: func() {
-				mockRepo.On("IncrementClickCount", int64(1)).Return(assert.AnError)
+				mockRepo.On("IncrementClickCount", ctx, int64(1)).Return(assert.AnError)
 			},
 			wantErr: true,
 		},
@@ -307,7 +814,7 @@ func TestRecordClick(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
 			tt.mockSetup()
 
-			err := service.RecordClick(tt.urlID)
+			err := service.RecordClick(ctx, tt.urlID)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -316,3 +823,264 @@ func TestRecordClick(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewURLService(mockRepo, nil, mockOwners, nil, unlimitedQuotas())
+	ctx := context.Background()
+	workspaceID := int64(3)
+
+	newDestination := "https://example.com/new"
+	newAlias := "fall-24"
+	newPassword := "open-sesame"
+	noPassword := ""
+	longPassword := strings.Repeat("x", 73)
+	inactive := false
+	active := true
+	future := time.Now().Add(24 * time.Hour)
+
+	current := func(customAlias bool) *domain.URL {
+		return &domain.URL{
+			ID:            1,
+			ShortCode:     "summer24",
+			OriginalURL:   "https://example.com/old",
+			UserID:        "user123",
+			WorkspaceID:   &workspaceID,
+			ExpiresAt:     &future,
+			IsActive:      true,
+			IsCustomAlias: customAlias,
+			Version:       3,
+		}
+	}
+
+	tests := []struct {
+		name            string
+		userID          string
+		update          domain.URLUpdate
+		expectedVersion int
+		mockSetup       func()
+		wantErr         bool
+		errType         interface{}
+		check           func(t *testing.T, url *domain.URL)
+	}{
+		{
+			name:            "Success",
+			userID:          "user123",
+			update:          domain.URLUpdate{OriginalURL: &newDestination, IsActive: &inactive, ClearExpiresAt: true},
+			expectedVersion: 3,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.URL"), 3, "user123").Return(nil)
+			},
+			check: func(t *testing.T, url *domain.URL) {
+				assert.Equal(t, newDestination, url.OriginalURL)
+				assert.False(t, url.IsActive)
+				assert.Nil(t, url.ExpiresAt)
+				assert.Equal(t, "summer24", url.ShortCode)
+			},
+		},
+		{
+			name:   "Deleted Link",
+			userID: "user123",
+			update: domain.URLUpdate{IsActive: &active},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(nil, &domain.ErrURLNotFound{ID: 1})
+			},
+			wantErr: true,
+			errType: &domain.ErrURLNotFound{},
+		},
+		{
+			name:   "Not A Member",
+			userID: "someone-else",
+			update: domain.URLUpdate{OriginalURL: &newDestination},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "someone-else").Return("", nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrURLNotFound{},
+		},
+		{
+			name:   "Viewer",
+			userID: "viewer1",
+			update: domain.URLUpdate{OriginalURL: &newDestination},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(3), "viewer1").Return(domain.RoleViewer, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrForbidden{},
+		},
+		{
+			name:            "Stale Version",
+			userID:          "user123",
+			update:          domain.URLUpdate{OriginalURL: &newDestination},
+			expectedVersion: 2,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrVersionMismatch{},
+		},
+		{
+			name:   "Concurrent Edit",
+			userID: "user123",
+			update: domain.URLUpdate{OriginalURL: &newDestination},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.URL"), 3, "user123").
+					Return(&domain.ErrVersionMismatch{ID: 1, ExpectedVersion: 3})
+			},
+			wantErr: true,
+			errType: &domain.ErrVersionMismatch{},
+		},
+		{
+			name:   "Alias On Generated Code",
+			userID: "user123",
+			update: domain.URLUpdate{Alias: &newAlias},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrInvalidAlias{},
+		},
+		{
+			name:   "Alias On Custom Alias",
+			userID: "user123",
+			update: domain.URLUpdate{Alias: &newAlias},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(true), nil)
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.URL"), 3, "user123").Return(nil)
+			},
+			check: func(t *testing.T, url *domain.URL) {
+				assert.Equal(t, newAlias, url.ShortCode)
+			},
+		},
+		{
+			name:   "Set Password",
+			userID: "user123",
+			update: domain.URLUpdate{Password: &newPassword},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.URL"), 3, "user123").Return(nil)
+			},
+			check: func(t *testing.T, url *domain.URL) {
+				assert.True(t, url.PasswordProtected)
+				assert.True(t, linkpass.Check(url.PasswordHash, newPassword))
+			},
+		},
+		{
+			name:   "Remove Password",
+			userID: "user123",
+			update: domain.URLUpdate{Password: &noPassword},
+			mockSetup: func() {
+				protected := current(false)
+				protected.PasswordHash = "hash"
+				protected.PasswordProtected = true
+				mockRepo.On("GetByID", ctx, int64(1)).Return(protected, nil)
+				mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.URL"), 3, "user123").Return(nil)
+			},
+			check: func(t *testing.T, url *domain.URL) {
+				assert.False(t, url.PasswordProtected)
+				assert.Empty(t, url.PasswordHash)
+			},
+		},
+		{
+			name:   "Password Too Long",
+			userID: "user123",
+			update: domain.URLUpdate{Password: &longPassword},
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(current(false), nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrInvalidPassword{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+			tt.mockSetup()
+
+			url, err := service.UpdateURL(ctx, 1, tt.userID, tt.update, tt.expectedVersion)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, url)
+				if tt.errType != nil {
+					assert.IsType(t, tt.errType, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, url)
+				tt.check(t, url)
+			}
+		})
+	}
+}
+
+func TestRollbackURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewURLService(mockRepo, nil, mockOwners, nil, unlimitedQuotas())
+	ctx := context.Background()
+	workspaceID := int64(3)
+
+	history := []domain.URLHistory{
+		{ID: 11, URLID: 1, Version: 2, OriginalURL: "https://example.com/v2"},
+		{ID: 10, URLID: 1, Version: 1, OriginalURL: "https://example.com/v1"},
+	}
+
+	tests := []struct {
+		name      string
+		historyID int64
+		mockSetup func()
+		wantErr   bool
+		errType   interface{}
+	}{
+		{
+			name:      "Success",
+			historyID: 10,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{
+					ID: 1, UserID: "user123", WorkspaceID: &workspaceID, OriginalURL: "https://example.com/v3", Version: 3,
+				}, nil)
+				mockRepo.On("GetHistory", ctx, int64(1)).Return(history, nil)
+				mockRepo.On("Update", ctx, mock.MatchedBy(func(url *domain.URL) bool {
+					return url.OriginalURL == "https://example.com/v1"
+				}), 3, "user123").Return(nil)
+			},
+		},
+		{
+			name:      "Unknown History Entry",
+			historyID: 99,
+			mockSetup: func() {
+				mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.URL{ID: 1, UserID: "user123", WorkspaceID: &workspaceID, Version: 3}, nil)
+				mockRepo.On("GetHistory", ctx, int64(1)).Return(history, nil)
+			},
+			wantErr: true,
+			errType: &domain.ErrHistoryNotFound{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			mockOwners.On("WorkspaceRole", ctx, int64(3), "user123").Return(domain.RoleEditor, nil)
+			tt.mockSetup()
+
+			url, err := service.RollbackURL(ctx, 1, "user123", tt.historyID, 0)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, url)
+				assert.IsType(t, tt.errType, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "https://example.com/v1", url.OriginalURL)
+			}
+		})
+	}
+}
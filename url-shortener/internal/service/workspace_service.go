@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+const (
+	// maxWorkspaceNameLength matches workspaces.name VARCHAR(100)
+	maxWorkspaceNameLength = 100
+
+	// invitationTokenBytes is the entropy of an invitation token
+	invitationTokenBytes = 32
+
+	// InvitationTTL is how long an invitation can be accepted
+	InvitationTTL = 7 * 24 * time.Hour
+)
+
+type WorkspaceService struct {
+	repo   internalDomain.WorkspaceRepository
+	owners internalDomain.OwnershipChecker
+	quotas internalDomain.QuotaChecker
+	now    func() time.Time
+}
+
+// NewWorkspaceService creates a new workspace service
+func NewWorkspaceService(repo internalDomain.WorkspaceRepository, owners internalDomain.OwnershipChecker, quotas internalDomain.QuotaChecker) internalDomain.WorkspaceService {
+	return &WorkspaceService{
+		repo:   repo,
+		owners: owners,
+		quotas: quotas,
+		now:    time.Now,
+	}
+}
+
+// hashInvitationToken returns the stored form of an invitation token
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateWorkspace creates a shared workspace owned by userID, up to the
+// number of workspaces the plans of userID allow
+func (s *WorkspaceService) CreateWorkspace(ctx context.Context, userID string, name string) (*internalDomain.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "name is required"}
+	}
+	if len(name) > maxWorkspaceNameLength {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "name must be at most 100 characters"}
+	}
+
+	quota, err := s.quotas.WorkspaceQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace := &internalDomain.Workspace{
+		Name:      name,
+		CreatedBy: userID,
+		Role:      internalDomain.RoleOwner,
+	}
+	if err := s.repo.Create(ctx, workspace, userID, quota); err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// ListWorkspaces returns the workspaces userID belongs to, personal first
+func (s *WorkspaceService) ListWorkspaces(ctx context.Context, userID string) ([]internalDomain.Workspace, error) {
+	if _, err := s.repo.EnsurePersonal(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// ListMembers returns the members of a workspace userID belongs to
+func (s *WorkspaceService) ListMembers(ctx context.Context, workspaceID int64, userID string) ([]internalDomain.WorkspaceMember, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListMembers(ctx, workspaceID)
+}
+
+// UpdateMemberRole changes memberID's role. Admins manage members below
+// owner; only owners can make or unmake owners.
+func (s *WorkspaceService) UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, memberID string, role string) (*internalDomain.WorkspaceMember, error) {
+	if !internalDomain.ValidRole(role) {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "role must be one of " + strings.Join(internalDomain.WorkspaceRoles, ", ")}
+	}
+
+	member, err := s.manageMember(ctx, workspaceID, userID, memberID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateMemberRole(ctx, member.WorkspaceID, memberID, role); err != nil {
+		return nil, err
+	}
+
+	member.Role = role
+	return member, nil
+}
+
+// RemoveMember removes memberID from the workspace. Anyone may leave; removing
+// someone else takes the same rights as changing their role.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, workspaceID int64, userID string, memberID string) error {
+	if memberID == userID {
+		workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionView)
+		if err != nil {
+			return err
+		}
+		return s.repo.RemoveMember(ctx, workspaceID, memberID)
+	}
+
+	member, err := s.manageMember(ctx, workspaceID, userID, memberID, "")
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RemoveMember(ctx, member.WorkspaceID, memberID)
+}
+
+// manageMember checks that userID may change memberID to role, where an
+// empty role stands for removing them
+func (s *WorkspaceService) manageMember(ctx context.Context, workspaceID int64, userID string, memberID string, role string) (*internalDomain.WorkspaceMember, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.repo.GetMember(ctx, workspaceID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	if member.Role == internalDomain.RoleOwner || role == internalDomain.RoleOwner {
+		if err := s.requireOwner(ctx, workspaceID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return member, nil
+}
+
+// requireOwner refuses anyone but the workspace's owners
+func (s *WorkspaceService) requireOwner(ctx context.Context, workspaceID int64, userID string) error {
+	role, err := s.owners.WorkspaceRole(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role != internalDomain.RoleOwner {
+		return &internalDomain.ErrForbidden{Resource: "workspace", ID: workspaceID}
+	}
+
+	return nil
+}
+
+// CreateInvitation invites email to join the workspace with role. The
+// returned token is not stored and cannot be retrieved later.
+func (s *WorkspaceService) CreateInvitation(ctx context.Context, workspaceID int64, userID string, email string, role string) (*internalDomain.NewWorkspaceInvitation, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "email is not a valid address"}
+	}
+	if !internalDomain.ValidRole(role) {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "role must be one of " + strings.Join(internalDomain.WorkspaceRoles, ", ")}
+	}
+
+	workspaceID, err = s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionManage)
+	if err != nil {
+		return nil, err
+	}
+	if role == internalDomain.RoleOwner {
+		if err := s.requireOwner(ctx, workspaceID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	workspace, err := s.repo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.Personal {
+		return nil, &internalDomain.ErrInvalidWorkspaceRequest{Reason: "personal workspaces cannot be shared"}
+	}
+
+	secret := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	invitation := internalDomain.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       address.Address,
+		Role:        role,
+		TokenHash:   hashInvitationToken(token),
+		InvitedBy:   userID,
+		ExpiresAt:   s.now().Add(InvitationTTL),
+	}
+	if err := s.repo.CreateInvitation(ctx, &invitation); err != nil {
+		return nil, err
+	}
+
+	return &internalDomain.NewWorkspaceInvitation{WorkspaceInvitation: invitation, Token: token}, nil
+}
+
+// ListInvitations returns the workspace's invitations that can still be accepted
+func (s *WorkspaceService) ListInvitations(ctx context.Context, workspaceID int64, userID string) ([]internalDomain.WorkspaceInvitation, error) {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListPendingInvitations(ctx, workspaceID, s.now())
+}
+
+// RevokeInvitation deletes an invitation that was not accepted yet
+func (s *WorkspaceService) RevokeInvitation(ctx context.Context, workspaceID int64, invitationID int64, userID string) error {
+	workspaceID, err := s.owners.CheckWorkspace(ctx, workspaceID, userID, internalDomain.PermissionManage)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteInvitation(ctx, workspaceID, invitationID)
+}
+
+// AcceptInvitation makes userID a member of the invitation's workspace
+func (s *WorkspaceService) AcceptInvitation(ctx context.Context, token string, userID string) (*internalDomain.Workspace, error) {
+	invitation, err := s.repo.AcceptInvitation(ctx, hashInvitationToken(strings.TrimSpace(token)), userID, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	workspace, err := s.repo.GetByID(ctx, invitation.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	workspace.Role = invitation.Role
+
+	return workspace, nil
+}
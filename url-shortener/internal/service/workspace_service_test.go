@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	internalDomain "github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockWorkspaceRepository is a mock implementation of WorkspaceRepository
+type MockWorkspaceRepository struct {
+	mock.Mock
+}
+
+func (m *MockWorkspaceRepository) Create(ctx context.Context, workspace *internalDomain.Workspace, owner string, quota internalDomain.QuotaLimit) error {
+	args := m.Called(ctx, workspace, owner, quota)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) GetByID(ctx context.Context, id int64) (*internalDomain.Workspace, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) EnsurePersonal(ctx context.Context, userID string) (*internalDomain.Workspace, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) ListByUser(ctx context.Context, userID string) ([]internalDomain.Workspace, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) GetMember(ctx context.Context, workspaceID int64, userID string) (*internalDomain.WorkspaceMember, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.WorkspaceMember), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) ListMembers(ctx context.Context, workspaceID int64) ([]internalDomain.WorkspaceMember, error) {
+	args := m.Called(ctx, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.WorkspaceMember), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID int64, userID string, role string) error {
+	args := m.Called(ctx, workspaceID, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) RemoveMember(ctx context.Context, workspaceID int64, userID string) error {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) CreateInvitation(ctx context.Context, invitation *internalDomain.WorkspaceInvitation) error {
+	args := m.Called(ctx, invitation)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) ListPendingInvitations(ctx context.Context, workspaceID int64, now time.Time) ([]internalDomain.WorkspaceInvitation, error) {
+	args := m.Called(ctx, workspaceID, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]internalDomain.WorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceRepository) DeleteInvitation(ctx context.Context, workspaceID int64, id int64) error {
+	args := m.Called(ctx, workspaceID, id)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) AcceptInvitation(ctx context.Context, tokenHash string, userID string, now time.Time) (*internalDomain.WorkspaceInvitation, error) {
+	args := m.Called(ctx, tokenHash, userID, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*internalDomain.WorkspaceInvitation), args.Error(1)
+}
+
+func TestCreateWorkspace(t *testing.T) {
+	mockRepo := new(MockWorkspaceRepository)
+	mockQuotas := new(MockQuotaChecker)
+	service := NewWorkspaceService(mockRepo, new(MockOwnershipChecker), mockQuotas)
+	ctx := context.Background()
+	free := internalDomain.QuotaLimit{Quota: internalDomain.QuotaWorkspaces, Plan: internalDomain.PlanFree, Limit: 2}
+
+	tests := []struct {
+		name      string
+		wsName    string
+		mockSetup func()
+		wantErr   interface{}
+	}{
+		{
+			name:   "Within The Cap",
+			wsName: " Marketing ",
+			mockSetup: func() {
+				mockQuotas.On("WorkspaceQuota", ctx, "user123").Return(free, nil)
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(w *internalDomain.Workspace) bool {
+					return w.Name == "Marketing" && w.CreatedBy == "user123" && !w.Personal
+				}), "user123", free).Return(nil)
+			},
+		},
+		{
+			name:   "Past The Cap",
+			wsName: "Marketing",
+			mockSetup: func() {
+				mockQuotas.On("WorkspaceQuota", ctx, "user123").Return(free, nil)
+				mockRepo.On("Create", ctx, mock.Anything, "user123", free).Return(free.Exceeded())
+			},
+			wantErr: &internalDomain.ErrQuotaExceeded{},
+		},
+		{
+			name:   "Quota Error",
+			wsName: "Marketing",
+			mockSetup: func() {
+				mockQuotas.On("WorkspaceQuota", ctx, "user123").Return(internalDomain.QuotaLimit{}, assert.AnError)
+			},
+			wantErr: assert.AnError,
+		},
+		{
+			name:      "Empty Name",
+			wsName:    "  ",
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidWorkspaceRequest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockQuotas.ExpectedCalls = nil
+			tt.mockSetup()
+
+			workspace, err := service.CreateWorkspace(ctx, "user123", tt.wsName)
+			if tt.wantErr != nil {
+				assert.Error(t, err)
+				assert.IsType(t, tt.wantErr, err)
+				assert.Nil(t, workspace)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, internalDomain.RoleOwner, workspace.Role)
+			}
+		})
+	}
+}
+
+// lockedWorkspaceRepository creates workspaces like the PostgreSQL
+// repository, counting the owner's shared workspaces and inserting under one lock
+type lockedWorkspaceRepository struct {
+	internalDomain.WorkspaceRepository
+	mu         sync.Mutex
+	workspaces []internalDomain.Workspace
+}
+
+func (r *lockedWorkspaceRepository) Create(ctx context.Context, workspace *internalDomain.Workspace, owner string, quota internalDomain.QuotaLimit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := 0
+	for _, w := range r.workspaces {
+		if w.CreatedBy == owner && !w.Personal {
+			held++
+		}
+	}
+	if !workspace.Personal && quota.Limit != internalDomain.Unlimited && held >= quota.Limit {
+		return quota.Exceeded()
+	}
+
+	workspace.ID = int64(len(r.workspaces) + 1)
+	r.workspaces = append(r.workspaces, *workspace)
+	return nil
+}
+
+func TestCreateWorkspacesConcurrently(t *testing.T) {
+	repo := &lockedWorkspaceRepository{}
+	mockQuotas := new(MockQuotaChecker)
+	service := NewWorkspaceService(repo, new(MockOwnershipChecker), mockQuotas)
+	ctx := context.Background()
+	free := internalDomain.QuotaLimit{Quota: internalDomain.QuotaWorkspaces, Plan: internalDomain.PlanFree, Limit: 2}
+
+	mockQuotas.On("WorkspaceQuota", ctx, "user123").Return(free, nil)
+
+	// Creations racing past the cap get exactly the quota
+	const attempts = 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = service.CreateWorkspace(ctx, "user123", fmt.Sprintf("Team %d", i))
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.IsType(t, &internalDomain.ErrQuotaExceeded{}, err)
+	}
+	assert.Equal(t, free.Limit, created)
+	assert.Len(t, repo.workspaces, free.Limit)
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	mockRepo := new(MockWorkspaceRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewWorkspaceService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		memberID  string
+		role      string
+		mockSetup func()
+		wantErr   interface{}
+	}{
+		{
+			name:     "Admin Promotes Viewer",
+			memberID: "user456",
+			role:     internalDomain.RoleEditor,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetMember", ctx, int64(7), "user456").Return(&internalDomain.WorkspaceMember{WorkspaceID: 7, UserID: "user456", Role: internalDomain.RoleViewer}, nil)
+				mockRepo.On("UpdateMemberRole", ctx, int64(7), "user456", internalDomain.RoleEditor).Return(nil)
+			},
+		},
+		{
+			name:     "Admin Grants Owner",
+			memberID: "user456",
+			role:     internalDomain.RoleOwner,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetMember", ctx, int64(7), "user456").Return(&internalDomain.WorkspaceMember{WorkspaceID: 7, UserID: "user456", Role: internalDomain.RoleEditor}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(7), "user123").Return(internalDomain.RoleAdmin, nil)
+			},
+			wantErr: &internalDomain.ErrForbidden{},
+		},
+		{
+			name:     "Admin Demotes Owner",
+			memberID: "user456",
+			role:     internalDomain.RoleViewer,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetMember", ctx, int64(7), "user456").Return(&internalDomain.WorkspaceMember{WorkspaceID: 7, UserID: "user456", Role: internalDomain.RoleOwner}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(7), "user123").Return(internalDomain.RoleAdmin, nil)
+			},
+			wantErr: &internalDomain.ErrForbidden{},
+		},
+		{
+			name:     "Last Owner",
+			memberID: "user123",
+			role:     internalDomain.RoleAdmin,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetMember", ctx, int64(7), "user123").Return(&internalDomain.WorkspaceMember{WorkspaceID: 7, UserID: "user123", Role: internalDomain.RoleOwner}, nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(7), "user123").Return(internalDomain.RoleOwner, nil)
+				mockRepo.On("UpdateMemberRole", ctx, int64(7), "user123", internalDomain.RoleAdmin).Return(&internalDomain.ErrLastOwner{WorkspaceID: 7})
+			},
+			wantErr: &internalDomain.ErrLastOwner{},
+		},
+		{
+			name:      "Unknown Role",
+			memberID:  "user456",
+			role:      "superuser",
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidWorkspaceRequest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			tt.mockSetup()
+
+			member, err := service.UpdateMemberRole(ctx, 7, "user123", tt.memberID, tt.role)
+			if tt.wantErr != nil {
+				assert.Error(t, err)
+				assert.IsType(t, tt.wantErr, err)
+				assert.Nil(t, member)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.role, member.Role)
+			}
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	mockRepo := new(MockWorkspaceRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewWorkspaceService(mockRepo, mockOwners, unlimitedQuotas())
+	ctx := context.Background()
+
+	t.Run("Viewer Leaves", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockOwners.ExpectedCalls = nil
+		mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionView).Return(int64(7), nil)
+		mockRepo.On("RemoveMember", ctx, int64(7), "user123").Return(nil)
+
+		assert.NoError(t, service.RemoveMember(ctx, 7, "user123", "user123"))
+	})
+
+	t.Run("Editor Removes Someone", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockOwners.ExpectedCalls = nil
+		mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).
+			Return(int64(0), &internalDomain.ErrForbidden{Resource: "workspace", ID: 7})
+
+		err := service.RemoveMember(ctx, 7, "user123", "user456")
+		assert.IsType(t, &internalDomain.ErrForbidden{}, err)
+	})
+}
+
+func TestCreateInvitation(t *testing.T) {
+	mockRepo := new(MockWorkspaceRepository)
+	mockOwners := new(MockOwnershipChecker)
+	service := NewWorkspaceService(mockRepo, mockOwners, unlimitedQuotas()).(*WorkspaceService)
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		email     string
+		role      string
+		mockSetup func()
+		wantErr   interface{}
+	}{
+		{
+			name:  "Success",
+			email: "Jo <jo@example.com>",
+			role:  internalDomain.RoleEditor,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetByID", ctx, int64(7)).Return(&internalDomain.Workspace{ID: 7, Name: "Marketing"}, nil)
+				mockRepo.On("CreateInvitation", ctx, mock.AnythingOfType("*domain.WorkspaceInvitation")).Return(nil)
+			},
+		},
+		{
+			name:  "Personal Workspace",
+			email: "jo@example.com",
+			role:  internalDomain.RoleViewer,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockRepo.On("GetByID", ctx, int64(7)).Return(&internalDomain.Workspace{ID: 7, Personal: true}, nil)
+			},
+			wantErr: &internalDomain.ErrInvalidWorkspaceRequest{},
+		},
+		{
+			name:      "Invalid Email",
+			email:     "not an address",
+			role:      internalDomain.RoleViewer,
+			mockSetup: func() {},
+			wantErr:   &internalDomain.ErrInvalidWorkspaceRequest{},
+		},
+		{
+			name:  "Admin Invites Owner",
+			email: "jo@example.com",
+			role:  internalDomain.RoleOwner,
+			mockSetup: func() {
+				mockOwners.On("CheckWorkspace", ctx, int64(7), "user123", internalDomain.PermissionManage).Return(int64(7), nil)
+				mockOwners.On("WorkspaceRole", ctx, int64(7), "user123").Return(internalDomain.RoleAdmin, nil)
+			},
+			wantErr: &internalDomain.ErrForbidden{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockOwners.ExpectedCalls = nil
+			tt.mockSetup()
+
+			invitation, err := service.CreateInvitation(ctx, 7, "user123", tt.email, tt.role)
+			if tt.wantErr != nil {
+				assert.Error(t, err)
+				assert.IsType(t, tt.wantErr, err)
+				assert.Nil(t, invitation)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "jo@example.com", invitation.Email)
+			assert.Equal(t, now.Add(InvitationTTL), invitation.ExpiresAt)
+			assert.Equal(t, hashInvitationToken(invitation.Token), invitation.TokenHash)
+			assert.NotEqual(t, invitation.Token, invitation.TokenHash)
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	mockRepo := new(MockWorkspaceRepository)
+	service := NewWorkspaceService(mockRepo, new(MockOwnershipChecker), unlimitedQuotas()).(*WorkspaceService)
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	t.Run("Success", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockRepo.On("AcceptInvitation", ctx, hashInvitationToken("secret"), "user456", now).
+			Return(&internalDomain.WorkspaceInvitation{WorkspaceID: 7, Role: internalDomain.RoleEditor}, nil)
+		mockRepo.On("GetByID", ctx, int64(7)).Return(&internalDomain.Workspace{ID: 7, Name: "Marketing"}, nil)
+
+		workspace, err := service.AcceptInvitation(ctx, "secret", "user456")
+		assert.NoError(t, err)
+		assert.Equal(t, internalDomain.RoleEditor, workspace.Role)
+	})
+
+	t.Run("Already Member", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockRepo.On("AcceptInvitation", ctx, hashInvitationToken("secret"), "user456", now).
+			Return(nil, &internalDomain.ErrAlreadyMember{WorkspaceID: 7})
+
+		workspace, err := service.AcceptInvitation(ctx, "secret", "user456")
+		assert.IsType(t, &internalDomain.ErrAlreadyMember{}, err)
+		assert.Nil(t, workspace)
+	})
+}
@@ -0,0 +1,234 @@
+// Package tagexpr parses boolean expressions over tag names, such as
+// promo AND (summer OR winter) AND NOT archived.
+//
+// AND binds tighter than OR and NOT tighter than both. Keywords are case
+// insensitive. Tag names run up to whitespace or a parenthesis; names with
+// spaces or parentheses, or spelled like a keyword, go in double quotes.
+package tagexpr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+const (
+	// MaxTerms bounds the number of tag names in an expression
+	MaxTerms = 20
+
+	// maxDepth bounds how deeply parentheses and NOTs nest
+	maxDepth = 10
+)
+
+type tokenKind int
+
+const (
+	tokenName tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+	tokenEnd
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// Parse parses s. Errors are *domain.ErrInvalidQuery.
+func Parse(s string) (*domain.TagExpr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEnd {
+		return nil, invalid("unexpected %s", p.peek().describe())
+	}
+
+	return expr, nil
+}
+
+func invalid(format string, args ...any) error {
+	return &domain.ErrInvalidQuery{Reason: "tags: " + fmt.Sprintf(format, args...)}
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	terms := 0
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, invalid("unterminated quote")
+			}
+			name := strings.TrimSpace(s[i+1 : i+1+end])
+			if name == "" {
+				return nil, invalid("empty tag name")
+			}
+			tokens = append(tokens, token{kind: tokenName, text: name})
+			terms++
+			i += end + 2
+		default:
+			end := strings.IndexFunc(s[i:], func(r rune) bool {
+				return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+			})
+			if end < 0 {
+				end = len(s) - i
+			}
+			word := s[i : i+end]
+			switch strings.ToUpper(word) {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd, text: word})
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr, text: word})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokenName, text: word})
+				terms++
+			}
+			i += end
+		}
+
+		if terms > MaxTerms {
+			return nil, invalid("at most %d tags are allowed", MaxTerms)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd}), nil
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEnd {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// or parses and-expressions separated by OR
+func (p *parser) or(depth int) (*domain.TagExpr, error) {
+	first, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*domain.TagExpr{first}
+	for p.peek().kind == tokenOr {
+		p.next()
+		operand, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &domain.TagExpr{Or: flatten(operands, func(e *domain.TagExpr) []*domain.TagExpr { return e.Or })}, nil
+}
+
+// and parses unary expressions separated by AND
+func (p *parser) and(depth int) (*domain.TagExpr, error) {
+	first, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*domain.TagExpr{first}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		operand, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &domain.TagExpr{And: flatten(operands, func(e *domain.TagExpr) []*domain.TagExpr { return e.And })}, nil
+}
+
+// unary parses a NOT, a parenthesized expression or a tag name
+func (p *parser) unary(depth int) (*domain.TagExpr, error) {
+	if depth > maxDepth {
+		return nil, invalid("expression is nested too deeply")
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		return &domain.TagExpr{Tag: t.text}, nil
+	case tokenNot:
+		operand, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.TagExpr{Not: operand}, nil
+	case tokenOpen:
+		expr, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenClose {
+			return nil, invalid("expected \")\" but found %s", closing.describe())
+		}
+		return expr, nil
+	default:
+		return nil, invalid("expected a tag name but found %s", t.describe())
+	}
+}
+
+// flatten merges operands that are themselves the same operator, so
+// a AND (b AND c) becomes a single AND of three
+func flatten(operands []*domain.TagExpr, same func(*domain.TagExpr) []*domain.TagExpr) []*domain.TagExpr {
+	var flat []*domain.TagExpr
+	for _, operand := range operands {
+		if inner := same(operand); inner != nil {
+			flat = append(flat, inner...)
+		} else {
+			flat = append(flat, operand)
+		}
+	}
+	return flat
+}
@@ -0,0 +1,100 @@
+package tagexpr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func tag(name string) *domain.TagExpr {
+	return &domain.TagExpr{Tag: name}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *domain.TagExpr
+		wantErr string
+	}{
+		{
+			name:  "Single Tag",
+			input: "promo",
+			want:  tag("promo"),
+		},
+		{
+			name:  "And Binds Tighter Than Or",
+			input: "a OR b AND c",
+			want:  &domain.TagExpr{Or: []*domain.TagExpr{tag("a"), {And: []*domain.TagExpr{tag("b"), tag("c")}}}},
+		},
+		{
+			name:  "Parentheses And Not",
+			input: "promo and (summer or winter) and not archived",
+			want: &domain.TagExpr{And: []*domain.TagExpr{
+				tag("promo"),
+				{Or: []*domain.TagExpr{tag("summer"), tag("winter")}},
+				{Not: tag("archived")},
+			}},
+		},
+		{
+			name:  "Nested Ands Are Flattened",
+			input: "a AND (b AND c)",
+			want:  &domain.TagExpr{And: []*domain.TagExpr{tag("a"), tag("b"), tag("c")}},
+		},
+		{
+			name:  "Quoted Names",
+			input: `"spring sale" OR "and"`,
+			want:  &domain.TagExpr{Or: []*domain.TagExpr{tag("spring sale"), tag("and")}},
+		},
+		{
+			name:    "Missing Operator",
+			input:   "a b",
+			wantErr: `tags: unexpected "b"`,
+		},
+		{
+			name:    "Dangling Operator",
+			input:   "a AND",
+			wantErr: "tags: expected a tag name but found end of expression",
+		},
+		{
+			name:    "Unbalanced Parenthesis",
+			input:   "(a OR b",
+			wantErr: `tags: expected ")" but found end of expression`,
+		},
+		{
+			name:    "Unterminated Quote",
+			input:   `"spring sale`,
+			wantErr: "tags: unterminated quote",
+		},
+		{
+			name:    "Empty",
+			input:   "  ",
+			wantErr: "tags: expected a tag name but found end of expression",
+		},
+		{
+			name:    "Too Many Tags",
+			input:   strings.Repeat("t OR ", MaxTerms) + "t",
+			wantErr: "tags: at most 20 tags are allowed",
+		},
+		{
+			name:    "Too Deep",
+			input:   strings.Repeat("(", maxDepth+1) + "a" + strings.Repeat(")", maxDepth+1),
+			wantErr: "tags: expression is nested too deeply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr != "" {
+				assert.Equal(t, &domain.ErrInvalidQuery{Reason: tt.wantErr}, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+const (
+	// issueBatchSize is the number of domains loaded per query
+	issueBatchSize = 20
+
+	// issueTimeout bounds a single order, challenges included
+	issueTimeout = 2 * time.Minute
+
+	// claimDuration outlasts issueTimeout so a claim only lapses when the
+	// instance holding it died
+	claimDuration = 10 * time.Minute
+
+	// retryDelay keeps failing domains from eating into the CA's rate limits
+	retryDelay = time.Hour
+)
+
+// Run issues and renews certificates until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.IssueDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[ERROR] certificate issuance failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IssueDue obtains a certificate for every verified domain without one or
+// with one expiring within RenewBefore, and returns how many it obtained.
+// Failures are recorded per domain and retried later.
+func (m *Manager) IssueDue(ctx context.Context) (int, error) {
+	issued := 0
+	// A CA issuing certificates shorter-lived than RenewBefore would keep a
+	// domain listed; each domain is tried once per call
+	tried := make(map[string]struct{})
+
+	for {
+		domains, err := m.repo.ListDomainsNeedingCertificates(ctx, m.now().Add(m.cfg.RenewBefore), issueBatchSize)
+		if err != nil {
+			return issued, err
+		}
+
+		fresh := 0
+		for _, name := range domains {
+			if _, ok := tried[name]; ok {
+				continue
+			}
+			tried[name] = struct{}{}
+			fresh++
+
+			claimed, err := m.repo.ClaimCertificate(ctx, name, m.now().Add(claimDuration))
+			if err != nil {
+				return issued, err
+			}
+			if !claimed {
+				// Another instance is on it
+				continue
+			}
+
+			if err := m.issue(ctx, name); err != nil {
+				if ctx.Err() != nil {
+					return issued, ctx.Err()
+				}
+				log.Printf("[ERROR] obtaining certificate for %s: %v", name, err)
+				if err := m.repo.RecordCertificateError(ctx, name, err.Error(), m.now().Add(retryDelay)); err != nil {
+					return issued, err
+				}
+				continue
+			}
+			issued++
+		}
+
+		// Issued, claimed and failed domains drop out of the listing, so a
+		// full batch means there may be more
+		if len(domains) < issueBatchSize || fresh == 0 {
+			return issued, nil
+		}
+	}
+}
+
+// issue runs an ACME order for name and stores the certificate
+func (m *Manager) issue(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, issueTimeout)
+	defer cancel()
+
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(name))
+	if err != nil {
+		return err
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: name},
+		DNSNames: []string{name},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		return errors.New("CA returned an empty certificate chain")
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return err
+	}
+	if err := leaf.VerifyHostname(name); err != nil {
+		return err
+	}
+
+	cert, err := encodeCertificate(name, chain, key, leaf.NotAfter)
+	if err != nil {
+		return err
+	}
+	if err := m.repo.SaveCertificate(ctx, cert); err != nil {
+		return err
+	}
+
+	m.forget(name)
+	log.Printf("Obtained certificate for %s valid until %s", name, leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// authorize satisfies a pending authorization with an HTTP-01 challenge
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("CA offered no http-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	keyAuthorization, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	if err := m.repo.PutChallenge(ctx, challenge.Token, keyAuthorization); err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.repo.DeleteChallenge(context.WithoutCancel(ctx), challenge.Token); err != nil {
+			log.Printf("[WARN] could not delete ACME challenge %s: %v", challenge.Token, err)
+		}
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// acmeClient returns the registered ACME client, creating the account on
+// first use. Every instance uses the account key stored first.
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := m.repo.EnsureAccountKey(ctx, m.cfg.DirectoryURL, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("stored ACME account key is not PEM encoded")
+	}
+	accountKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          accountKey,
+		HTTPClient:   m.cfg.HTTPClient,
+		DirectoryURL: m.cfg.DirectoryURL,
+	}
+
+	account := &acme.Account{}
+	if m.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, err
+	}
+
+	m.client = client
+	return client, nil
+}
+
+// encodeCertificate PEM-encodes a DER chain and its key for storage
+func encodeCertificate(name string, chain [][]byte, key *ecdsa.PrivateKey, notAfter time.Time) (*domain.Certificate, error) {
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Certificate{
+		Domain:   name,
+		CertPEM:  certPEM,
+		KeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		NotAfter: notAfter,
+	}, nil
+}
@@ -0,0 +1,181 @@
+// Package tlscert obtains certificates for verified custom domains from an
+// ACME CA using HTTP-01 challenges, renews them ahead of expiry and serves
+// them during TLS handshakes. Certificates, the account key and pending
+// challenges live in the CertificateRepository so every instance shares them.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+)
+
+// ChallengePath is the path prefix HTTP-01 challenges are served under
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// loadedCertTTL bounds how long a parsed certificate is served from memory,
+// so certificates renewed by another instance are picked up
+const loadedCertTTL = 10 * time.Minute
+
+// Config tunes certificate issuance
+type Config struct {
+	// DirectoryURL is the ACME directory; empty uses Let's Encrypt
+	DirectoryURL string
+	// Email is registered as the account contact; optional
+	Email string
+	// RenewBefore is how long before expiry a certificate is renewed
+	RenewBefore time.Duration
+	// Interval is how often domains needing a certificate are looked for
+	Interval time.Duration
+	// HTTPClient talks to the ACME directory; nil uses http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type loadedCert struct {
+	cert      *tls.Certificate
+	expiresAt time.Time
+}
+
+// Manager issues, renews and serves certificates of verified custom domains
+type Manager struct {
+	repo    domain.CertificateRepository
+	domains domain.CustomDomainService
+	cfg     Config
+	now     func() time.Time
+
+	clientMu sync.Mutex
+	client   *acme.Client
+
+	mu     sync.Mutex
+	loaded map[string]loadedCert
+}
+
+// NewManager creates a manager. Call Run to issue and renew certificates.
+func NewManager(repo domain.CertificateRepository, domains domain.CustomDomainService, cfg Config) *Manager {
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = acme.LetsEncryptURL
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = 30 * 24 * time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+
+	return &Manager{
+		repo:    repo,
+		domains: domains,
+		cfg:     cfg,
+		now:     time.Now,
+		loaded:  make(map[string]loadedCert),
+	}
+}
+
+// LoadRootCAs reads a PEM bundle of CA certificates to trust for the ACME
+// directory, such as the one a Pebble test server is signed with
+func LoadRootCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// GetCertificate serves the stored certificate of a verified custom domain.
+// It is meant for tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		return nil, errors.New("tlscert: missing server name")
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	entry, ok := m.loaded[name]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.cert, nil
+	}
+
+	ctx := hello.Context()
+	if ctx == nil {
+		// Only set during real handshakes
+		ctx = context.Background()
+	}
+	if _, err := m.domains.ResolveHost(ctx, name); err != nil {
+		return nil, fmt.Errorf("tlscert: %s is not a verified custom domain: %w", name, err)
+	}
+
+	stored, err := m.repo.GetCertificate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(stored.CertPEM, stored.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("tlscert: stored certificate for %s is unusable: %w", name, err)
+	}
+	if !now.Before(stored.NotAfter) {
+		return nil, fmt.Errorf("tlscert: certificate for %s expired at %s", name, stored.NotAfter)
+	}
+
+	m.mu.Lock()
+	m.loaded[name] = loadedCert{cert: &cert, expiresAt: minTime(now.Add(loadedCertTTL), stored.NotAfter)}
+	m.mu.Unlock()
+
+	return &cert, nil
+}
+
+// ServeHTTP answers HTTP-01 challenges under ChallengePath
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, ChallengePath)
+	if token == "" || token == r.URL.Path || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	keyAuthorization, err := m.repo.GetChallenge(r.Context(), token)
+	var notFound *domain.ErrChallengeNotFound
+	if errors.As(err, &notFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuthorization))
+}
+
+// forget drops the in-memory copy of name's certificate
+func (m *Manager) forget(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loaded, name)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
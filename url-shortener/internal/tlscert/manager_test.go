@@ -0,0 +1,296 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/Snax-be/url-shortener/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memRepo is an in-memory CertificateRepository
+type memRepo struct {
+	mu          sync.Mutex
+	verified    []string
+	certs       map[string]*domain.Certificate
+	claims      map[string]time.Time
+	errors      map[string]string
+	accountKeys map[string][]byte
+	challenges  map[string]string
+	certLookups int
+}
+
+func newMemRepo(verified ...string) *memRepo {
+	return &memRepo{
+		verified:    verified,
+		certs:       make(map[string]*domain.Certificate),
+		claims:      make(map[string]time.Time),
+		errors:      make(map[string]string),
+		accountKeys: make(map[string][]byte),
+		challenges:  make(map[string]string),
+	}
+}
+
+func (r *memRepo) GetCertificate(ctx context.Context, name string) (*domain.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.certLookups++
+	cert, ok := r.certs[name]
+	if !ok {
+		return nil, &domain.ErrCertificateNotFound{Domain: name}
+	}
+	return cert, nil
+}
+
+func (r *memRepo) SaveCertificate(ctx context.Context, cert *domain.Certificate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.certs[cert.Domain] = cert
+	delete(r.claims, cert.Domain)
+	delete(r.errors, cert.Domain)
+	return nil
+}
+
+func (r *memRepo) ListDomainsNeedingCertificates(ctx context.Context, t time.Time, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var domains []string
+	for _, name := range r.verified {
+		if cert, ok := r.certs[name]; ok && !cert.NotAfter.Before(t) {
+			continue
+		}
+		if r.claims[name].After(time.Now()) {
+			continue
+		}
+		if len(domains) < limit {
+			domains = append(domains, name)
+		}
+	}
+	return domains, nil
+}
+
+func (r *memRepo) ClaimCertificate(ctx context.Context, name string, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.claims[name].After(time.Now()) {
+		return false, nil
+	}
+	r.claims[name] = until
+	return true, nil
+}
+
+func (r *memRepo) RecordCertificateError(ctx context.Context, name string, reason string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors[name] = reason
+	r.claims[name] = retryAt
+	return nil
+}
+
+func (r *memRepo) EnsureAccountKey(ctx context.Context, directoryURL string, keyPEM []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.accountKeys[directoryURL]; ok {
+		return stored, nil
+	}
+	r.accountKeys[directoryURL] = keyPEM
+	return keyPEM, nil
+}
+
+func (r *memRepo) PutChallenge(ctx context.Context, token string, keyAuthorization string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.challenges[token] = keyAuthorization
+	return nil
+}
+
+func (r *memRepo) GetChallenge(ctx context.Context, token string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keyAuthorization, ok := r.challenges[token]
+	if !ok {
+		return "", &domain.ErrChallengeNotFound{Token: token}
+	}
+	return keyAuthorization, nil
+}
+
+func (r *memRepo) DeleteChallenge(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.challenges, token)
+	return nil
+}
+
+// verifiedDomains resolves only the listed hosts
+type verifiedDomains struct {
+	domain.CustomDomainService
+	hosts []string
+}
+
+func (v verifiedDomains) ResolveHost(ctx context.Context, host string) (*domain.CustomDomain, error) {
+	for _, h := range v.hosts {
+		if h == host {
+			return &domain.CustomDomain{Domain: host, Verified: true}, nil
+		}
+	}
+	return nil, &domain.ErrDomainNotFound{Domain: host}
+}
+
+// selfSigned creates a stored certificate for name valid until notAfter
+func selfSigned(t *testing.T, name string, notAfter time.Time) *domain.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := encodeCertificate(name, [][]byte{der}, key, notAfter)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestGetCertificate(t *testing.T) {
+	now := time.Now()
+	repo := newMemRepo()
+	repo.certs["go.acme.com"] = selfSigned(t, "go.acme.com", now.Add(60*24*time.Hour))
+	repo.certs["old.acme.com"] = selfSigned(t, "old.acme.com", now.Add(-time.Hour))
+	m := NewManager(repo, verifiedDomains{hosts: []string{"go.acme.com", "old.acme.com", "new.acme.com"}}, Config{})
+
+	t.Run("Serves Stored Certificate", func(t *testing.T) {
+		cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Go.Acme.com"})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		assert.NoError(t, leaf.VerifyHostname("go.acme.com"))
+
+		// Later handshakes are served from memory
+		lookups := repo.certLookups
+		_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "go.acme.com"})
+		require.NoError(t, err)
+		assert.Equal(t, lookups, repo.certLookups)
+	})
+
+	t.Run("Reloads After TTL", func(t *testing.T) {
+		lookups := repo.certLookups
+		m.now = func() time.Time { return now.Add(loadedCertTTL + time.Second) }
+		defer func() { m.now = time.Now }()
+
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "go.acme.com"})
+		require.NoError(t, err)
+		assert.Equal(t, lookups+1, repo.certLookups)
+	})
+
+	t.Run("Unverified Domain", func(t *testing.T) {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example.com"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Not Issued Yet", func(t *testing.T) {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "new.acme.com"})
+		assert.IsType(t, &domain.ErrCertificateNotFound{}, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "old.acme.com"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing Server Name", func(t *testing.T) {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{})
+		assert.Error(t, err)
+	})
+}
+
+func TestServeChallenge(t *testing.T) {
+	repo := newMemRepo()
+	repo.challenges["token123"] = "token123.thumbprint"
+	m := NewManager(repo, verifiedDomains{}, Config{})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Known Token", path: "/.well-known/acme-challenge/token123", wantStatus: http.StatusOK, wantBody: "token123.thumbprint"},
+		{name: "Unknown Token", path: "/.well-known/acme-challenge/nope", wantStatus: http.StatusNotFound},
+		{name: "Nested Path", path: "/.well-known/acme-challenge/token123/x", wantStatus: http.StatusNotFound},
+		{name: "Other Path", path: "/token123", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestIssueDue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// A CA rejecting every request makes each attempt fail. 5xx responses
+	// would be retried by the ACME client until the order times out.
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rejected", http.StatusForbidden)
+	}))
+	defer ca.Close()
+
+	repo := newMemRepo("new.acme.com", "busy.acme.com", "fresh.acme.com", "due.acme.com")
+	repo.claims["busy.acme.com"] = now.Add(time.Minute)
+	repo.certs["fresh.acme.com"] = selfSigned(t, "fresh.acme.com", now.Add(60*24*time.Hour))
+	repo.certs["due.acme.com"] = selfSigned(t, "due.acme.com", now.Add(10*24*time.Hour))
+	m := NewManager(repo, verifiedDomains{}, Config{DirectoryURL: ca.URL, HTTPClient: ca.Client()})
+
+	issued, err := m.IssueDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, issued)
+
+	// Domains without a certificate and those due for renewal were tried;
+	// the claimed and the fresh one were left alone
+	assert.Contains(t, repo.errors, "new.acme.com")
+	assert.Contains(t, repo.errors, "due.acme.com")
+	assert.NotContains(t, repo.errors, "busy.acme.com")
+	assert.NotContains(t, repo.errors, "fresh.acme.com")
+
+	// Failed domains wait before they are retried
+	assert.True(t, repo.claims["new.acme.com"].After(now.Add(retryDelay-time.Minute)))
+	issued, err = m.IssueDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, issued)
+}
@@ -0,0 +1,69 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIssueWithPebble obtains a certificate end-to-end from a Pebble ACME
+// test server. It is skipped unless PEBBLE_DIRECTORY_URL is set, e.g.
+//
+//	docker run -p 14000:14000 -e PEBBLE_VA_ALWAYS_VALID=1 ghcr.io/letsencrypt/pebble
+//	PEBBLE_DIRECTORY_URL=https://localhost:14000/dir PEBBLE_CA_CERT=pebble.minica.pem \
+//		go test ./internal/tlscert -run Pebble
+//
+// Without PEBBLE_VA_ALWAYS_VALID, Pebble must resolve PEBBLE_DOMAIN to this
+// machine, where challenges are served on PEBBLE_CHALLENGE_ADDR (:5002).
+func TestIssueWithPebble(t *testing.T) {
+	directoryURL := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if directoryURL == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL is not set")
+	}
+	name := getenv("PEBBLE_DOMAIN", "pebble.snax.test")
+	ctx := context.Background()
+
+	rootCAs, err := LoadRootCAs(os.Getenv("PEBBLE_CA_CERT"))
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+
+	repo := newMemRepo(name)
+	m := NewManager(repo, verifiedDomains{hosts: []string{name}}, Config{DirectoryURL: directoryURL, HTTPClient: client})
+
+	ln, err := net.Listen("tcp", getenv("PEBBLE_CHALLENGE_ADDR", ":5002"))
+	require.NoError(t, err)
+	challengeServer := &http.Server{Handler: m}
+	go challengeServer.Serve(ln)
+	defer challengeServer.Close()
+
+	issued, err := m.IssueDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, issued, repo.errors[name])
+	assert.Empty(t, repo.challenges)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.NoError(t, leaf.VerifyHostname(name))
+
+	// A fresh certificate is not renewed, and the account is reused
+	issued, err = m.IssueDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, issued)
+	assert.Len(t, repo.accountKeys, 1)
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
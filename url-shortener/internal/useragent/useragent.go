@@ -0,0 +1,183 @@
+// Package useragent classifies User-Agent headers into browser, operating
+// system and device type, and flags crawlers and link unfurlers. Rules are
+// embedded so parsing works offline.
+package useragent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Device types reported in Info.DeviceType
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	// DeviceUnknown is reported when no User-Agent was sent
+	DeviceUnknown = "unknown"
+)
+
+//go:embed rules.json
+var embeddedRules []byte
+
+// Info is the classification of a User-Agent
+type Info struct {
+	// Browser is the browser name, or the crawler name for bots
+	Browser    string
+	OS         string
+	DeviceType string
+	IsBot      bool
+}
+
+// rules is the layout of rules.json. Within each list the first match wins.
+type rules struct {
+	Bots     []namedRule  `json:"bots"`
+	Browsers []namedRule  `json:"browsers"`
+	OS       []namedRule  `json:"os"`
+	Devices  []deviceRule `json:"devices"`
+}
+
+type namedRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+type deviceRule struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	// Unless skips the rule when it also matches
+	Unless string `json:"unless"`
+}
+
+type namedMatcher struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type deviceMatcher struct {
+	deviceType string
+	pattern    *regexp.Regexp
+	unless     *regexp.Regexp
+}
+
+// Parser classifies User-Agents with a compiled rule set
+type Parser struct {
+	bots     []namedMatcher
+	browsers []namedMatcher
+	os       []namedMatcher
+	devices  []deviceMatcher
+}
+
+var defaultParser = mustNewParser(embeddedRules)
+
+// Parse classifies ua with the embedded rules
+func Parse(ua string) Info {
+	return defaultParser.Parse(ua)
+}
+
+// NewParser compiles rules in the rules.json format. Patterns are
+// case-insensitive regular expressions.
+func NewParser(data []byte) (*Parser, error) {
+	var r rules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid user agent rules: %w", err)
+	}
+
+	p := &Parser{}
+	var err error
+	if p.bots, err = compileNamed(r.Bots); err != nil {
+		return nil, err
+	}
+	if p.browsers, err = compileNamed(r.Browsers); err != nil {
+		return nil, err
+	}
+	if p.os, err = compileNamed(r.OS); err != nil {
+		return nil, err
+	}
+	for _, rule := range r.Devices {
+		m := deviceMatcher{deviceType: rule.Type}
+		if m.pattern, err = compile(rule.Pattern); err != nil {
+			return nil, err
+		}
+		if rule.Unless != "" {
+			if m.unless, err = compile(rule.Unless); err != nil {
+				return nil, err
+			}
+		}
+		p.devices = append(p.devices, m)
+	}
+
+	return p, nil
+}
+
+func mustNewParser(data []byte) *Parser {
+	p, err := NewParser(data)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Parse classifies ua. Bots keep their OS when it can be told but always
+// have DeviceType DeviceBot.
+func (p *Parser) Parse(ua string) Info {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Info{DeviceType: DeviceUnknown}
+	}
+
+	info := Info{
+		OS:         match(p.os, ua),
+		DeviceType: DeviceDesktop,
+	}
+
+	if bot := match(p.bots, ua); bot != "" {
+		info.Browser = bot
+		info.DeviceType = DeviceBot
+		info.IsBot = true
+		return info
+	}
+
+	info.Browser = match(p.browsers, ua)
+	for _, d := range p.devices {
+		if d.pattern.MatchString(ua) && (d.unless == nil || !d.unless.MatchString(ua)) {
+			info.DeviceType = d.deviceType
+			break
+		}
+	}
+
+	return info
+}
+
+func match(matchers []namedMatcher, ua string) string {
+	for _, m := range matchers {
+		if m.pattern.MatchString(ua) {
+			return m.name
+		}
+	}
+	return ""
+}
+
+func compileNamed(rules []namedRule) ([]namedMatcher, error) {
+	matchers := make([]namedMatcher, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, namedMatcher{name: rule.Name, pattern: pattern})
+	}
+	return matchers, nil
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user agent pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
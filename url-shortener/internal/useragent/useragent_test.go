@@ -0,0 +1,116 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "Chrome On Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Windows", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Edge On Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			want: Info{Browser: "Edge", OS: "Windows", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Safari On macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			want: Info{Browser: "Safari", OS: "macOS", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Firefox On Linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: Info{Browser: "Firefox", OS: "Linux", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Safari On iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", OS: "iOS", DeviceType: DeviceMobile},
+		},
+		{
+			name: "Chrome On Android Phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Android", DeviceType: DeviceMobile},
+		},
+		{
+			name: "Samsung Internet On Android Tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Safari/537.36",
+			want: Info{Browser: "Samsung Internet", OS: "Android", DeviceType: DeviceTablet},
+		},
+		{
+			name: "Chrome On CUBOT Phone",
+			ua:   "Mozilla/5.0 (Linux; Android 12; CUBOT P80) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Android", DeviceType: DeviceMobile},
+		},
+		{
+			name: "Safari On iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", OS: "iOS", DeviceType: DeviceTablet},
+		},
+		{
+			name: "Slackbot",
+			ua:   "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want: Info{Browser: "Slackbot", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Facebook Unfurler",
+			ua:   "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			want: Info{Browser: "Facebook", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Twitterbot",
+			ua:   "Twitterbot/1.0",
+			want: Info{Browser: "Twitterbot", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Googlebot Smartphone",
+			ua:   "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Googlebot", OS: "Android", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Unknown Crawler",
+			ua:   "Mozilla/5.0 (compatible; ExampleCrawler/0.1)",
+			want: Info{Browser: "Generic", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Unknown Bot",
+			ua:   "ExampleBot/2.1 (+https://example.com/bot)",
+			want: Info{Browser: "Generic", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.5.0",
+			want: Info{Browser: "curl", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Empty",
+			ua:   "",
+			want: Info{DeviceType: DeviceUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.ua))
+		})
+	}
+}
+
+func TestNewParserRejectsInvalidRules(t *testing.T) {
+	_, err := NewParser([]byte(`{"bots": [{"name": "Broken", "pattern": "("}]}`))
+	require.Error(t, err)
+
+	_, err = NewParser([]byte(`not json`))
+	require.Error(t, err)
+}
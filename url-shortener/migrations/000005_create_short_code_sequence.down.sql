@@ -0,0 +1,2 @@
+-- Drop sequence
+DROP SEQUENCE IF EXISTS short_code_seq; 
\ No newline at end of file
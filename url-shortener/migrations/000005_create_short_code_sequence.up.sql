@@ -0,0 +1,2 @@
+-- Standalone sequence for counter-based short code generation
+CREATE SEQUENCE IF NOT EXISTS short_code_seq; 
\ No newline at end of file
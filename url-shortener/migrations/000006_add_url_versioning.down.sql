@@ -0,0 +1,8 @@
+-- Drop history
+DROP TABLE IF EXISTS url_history;
+
+-- Drop columns
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS is_custom_alias,
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS updated_at; 
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- Track edits on URLs
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS is_custom_alias BOOLEAN NOT NULL DEFAULT false;
+
+-- Snapshot of a URL taken before each edit
+CREATE TABLE IF NOT EXISTS url_history (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    short_code VARCHAR(10) NOT NULL,
+    original_url TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    is_active BOOLEAN NOT NULL,
+    changed_by VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Also serves the lookups of a URL's history by url_id
+    UNIQUE (url_id, version)
+); 
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Drop search indexes; pg_trgm is left installed as other objects may use it
+DROP INDEX IF EXISTS idx_urls_short_code_trgm;
+DROP INDEX IF EXISTS idx_urls_original_url_trgm;
+
+-- Drop filter and pagination indexes
+DROP INDEX IF EXISTS idx_url_tags_tag_id;
+DROP INDEX IF EXISTS idx_urls_domain_id;
+DROP INDEX IF EXISTS idx_urls_user_clicks;
+DROP INDEX IF EXISTS idx_urls_user_created;
+
+-- Drop columns
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS domain_id; 
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- Links can be served on a custom domain
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS domain_id INTEGER REFERENCES custom_domains(id) ON DELETE SET NULL;
+
+-- Keyset pagination over a user's active links
+CREATE INDEX IF NOT EXISTS idx_urls_user_created ON urls(user_id, created_at DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_urls_user_clicks ON urls(user_id, click_count DESC, id DESC) WHERE is_active;
+
+-- Filters
+CREATE INDEX IF NOT EXISTS idx_urls_domain_id ON urls(domain_id);
+CREATE INDEX IF NOT EXISTS idx_url_tags_tag_id ON url_tags(tag_id);
+
+-- Substring search on original URL and short code
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING GIN (original_url gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING GIN (short_code gin_trgm_ops); 
\ No newline at end of file
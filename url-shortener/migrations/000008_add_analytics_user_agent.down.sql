@@ -0,0 +1,5 @@
+-- Drop columns
+ALTER TABLE analytics
+    DROP COLUMN IF EXISTS is_bot,
+    DROP COLUMN IF EXISTS os,
+    DROP COLUMN IF EXISTS browser; 
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Classification of the visitor's user agent
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS browser VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS os VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT false; 
\ No newline at end of file
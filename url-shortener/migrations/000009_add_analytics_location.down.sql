@@ -0,0 +1,7 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_analytics_url_country;
+
+-- Drop columns
+ALTER TABLE analytics
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS region; 
\ No newline at end of file
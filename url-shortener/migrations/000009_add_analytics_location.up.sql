@@ -0,0 +1,7 @@
+-- Location of the visitor
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS region VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS city VARCHAR(100);
+
+-- Create index
+CREATE INDEX IF NOT EXISTS idx_analytics_url_country ON analytics(url_id, country_code); 
\ No newline at end of file
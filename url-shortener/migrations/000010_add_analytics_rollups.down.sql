@@ -0,0 +1,7 @@
+-- Drop rollup tables
+DROP TABLE IF EXISTS analytics_rollup_state;
+DROP TABLE IF EXISTS analytics_rollup_hourly;
+
+-- Drop columns
+ALTER TABLE analytics
+    DROP COLUMN IF EXISTS ingested_at; 
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- Record when each visit was written, so the aggregator only rolls up settled visits
+ALTER TABLE analytics
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Create hourly rollup table; dimension '' holds the total over all visits
+CREATE TABLE IF NOT EXISTS analytics_rollup_hourly (
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    visitors BYTEA NOT NULL, -- HyperLogLog sketch of distinct visitors
+    PRIMARY KEY (url_id, dimension, bucket, value)
+);
+
+-- Create rollup watermark table
+CREATE TABLE IF NOT EXISTS analytics_rollup_state (
+    name VARCHAR(32) PRIMARY KEY,
+    last_id BIGINT NOT NULL DEFAULT 0, -- Highest analytics id rolled up
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO analytics_rollup_state (name) VALUES ('hourly') ON CONFLICT DO NOTHING; 
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_custom_domains_recheck;
+
+-- Drop columns
+ALTER TABLE custom_domains
+    DROP COLUMN IF EXISTS verification_error,
+    DROP COLUMN IF EXISTS last_checked_at,
+    DROP COLUMN IF EXISTS verified_at,
+    DROP COLUMN IF EXISTS verification_token; 
\ No newline at end of file
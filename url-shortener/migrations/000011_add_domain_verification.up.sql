@@ -0,0 +1,14 @@
+-- Add DNS verification state
+ALTER TABLE custom_domains
+    ADD COLUMN IF NOT EXISTS verification_token VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS verification_error TEXT;
+
+-- Give existing domains a token to publish
+UPDATE custom_domains
+SET verification_token = md5(random()::text || id::text)
+WHERE verification_token = '';
+
+-- Create index for the re-checker
+CREATE INDEX IF NOT EXISTS idx_custom_domains_recheck ON custom_domains(last_checked_at) WHERE verified; 
\ No newline at end of file
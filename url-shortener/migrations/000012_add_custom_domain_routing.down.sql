@@ -0,0 +1,15 @@
+-- Drop redirect targets
+ALTER TABLE custom_domains
+    DROP COLUMN IF EXISTS not_found_url,
+    DROP COLUMN IF EXISTS root_url;
+
+-- Restore the original foreign key
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_domain_id_fkey,
+    ADD CONSTRAINT urls_domain_id_fkey FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE SET NULL;
+
+-- Restore globally unique short codes; fails while a code is used on several domains
+DROP INDEX IF EXISTS idx_urls_domain_short_code;
+DROP INDEX IF EXISTS idx_urls_default_short_code;
+ALTER TABLE urls
+    ADD CONSTRAINT urls_short_code_key UNIQUE (short_code); 
\ No newline at end of file
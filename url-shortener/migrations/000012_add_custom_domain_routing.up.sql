@@ -0,0 +1,16 @@
+-- Short codes are unique per domain rather than globally
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_short_code_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_default_short_code ON urls(short_code) WHERE domain_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_domain_short_code ON urls(domain_id, short_code) WHERE domain_id IS NOT NULL;
+
+-- Moving a domain's links to the default host could clash with existing
+-- short codes, so a domain cannot be deleted while links are served on it
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_domain_id_fkey,
+    ADD CONSTRAINT urls_domain_id_fkey FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE RESTRICT;
+
+-- Per-domain redirect targets
+ALTER TABLE custom_domains
+    ADD COLUMN IF NOT EXISTS root_url TEXT,
+    ADD COLUMN IF NOT EXISTS not_found_url TEXT; 
\ No newline at end of file
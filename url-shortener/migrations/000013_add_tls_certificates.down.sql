@@ -0,0 +1,4 @@
+-- Drop tables
+DROP TABLE IF EXISTS acme_challenges;
+DROP TABLE IF EXISTS tls_certificates;
+DROP TABLE IF EXISTS acme_accounts; 
\ No newline at end of file
@@ -0,0 +1,29 @@
+-- ACME account keys, one per CA directory
+CREATE TABLE IF NOT EXISTS acme_accounts (
+    directory_url TEXT PRIMARY KEY,
+    key_pem BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Certificates of custom domains, shared by every instance
+CREATE TABLE IF NOT EXISTS tls_certificates (
+    domain VARCHAR(255) PRIMARY KEY REFERENCES custom_domains(domain) ON DELETE CASCADE,
+    cert_pem BYTEA,
+    key_pem BYTEA,
+    not_after TIMESTAMPTZ,
+    -- An instance holds the domain until claimed_until while it requests a
+    -- certificate; after a failure it is left alone until then
+    claimed_until TIMESTAMPTZ,
+    last_error TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Pending HTTP-01 challenge responses
+CREATE TABLE IF NOT EXISTS acme_challenges (
+    token VARCHAR(255) PRIMARY KEY,
+    key_authorization TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create index for the renewal scan
+CREATE INDEX IF NOT EXISTS idx_tls_certificates_not_after ON tls_certificates(not_after); 
\ No newline at end of file
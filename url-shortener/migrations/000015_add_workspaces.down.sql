@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_custom_domains_workspace_id;
+DROP INDEX IF EXISTS idx_urls_workspace_clicks;
+DROP INDEX IF EXISTS idx_urls_workspace_created;
+
+ALTER TABLE custom_domains DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE urls DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces; 
\ No newline at end of file
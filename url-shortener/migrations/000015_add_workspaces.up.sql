@@ -0,0 +1,69 @@
+-- Create workspaces; every user gets a personal one
+CREATE TABLE IF NOT EXISTS workspaces (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT false,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_personal ON workspaces(created_by) WHERE personal;
+
+-- Create memberships
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id);
+
+-- Create invitations; only a hash of the token is stored
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_by VARCHAR(255),
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_workspace_id ON workspace_invitations(workspace_id);
+
+-- Links and domains belong to a workspace; anonymous links belong to none
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id);
+ALTER TABLE custom_domains ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id);
+
+-- Move everything users own into their personal workspace
+INSERT INTO workspaces (name, personal, created_by)
+SELECT 'Personal', true, user_id FROM (
+    SELECT user_id FROM urls WHERE user_id <> ''
+    UNION SELECT user_id FROM custom_domains
+    UNION SELECT user_id FROM api_keys
+) owners
+ON CONFLICT (created_by) WHERE personal DO NOTHING;
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, created_by, 'owner' FROM workspaces WHERE personal
+ON CONFLICT DO NOTHING;
+
+UPDATE urls SET workspace_id = w.id
+FROM workspaces w
+WHERE w.personal AND w.created_by = urls.user_id AND urls.workspace_id IS NULL;
+
+UPDATE custom_domains SET workspace_id = w.id
+FROM workspaces w
+WHERE w.personal AND w.created_by = custom_domains.user_id AND custom_domains.workspace_id IS NULL;
+
+ALTER TABLE custom_domains ALTER COLUMN workspace_id SET NOT NULL;
+
+-- Create indexes for workspace listings
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_created ON urls(workspace_id, created_at DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_clicks ON urls(workspace_id, click_count DESC, id DESC) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_custom_domains_workspace_id ON custom_domains(workspace_id); 
\ No newline at end of file
@@ -0,0 +1,17 @@
+ALTER TABLE url_tags DROP CONSTRAINT IF EXISTS url_tags_tag_id_fkey;
+ALTER TABLE url_tags ADD CONSTRAINT url_tags_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tags(id);
+
+-- Fold tags with the same name back into one
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_workspace_name_key;
+
+UPDATE url_tags SET tag_id = keep.id
+FROM tags t, (SELECT name, MIN(id) AS id FROM tags GROUP BY name) keep
+WHERE t.id = url_tags.tag_id AND keep.name = t.name AND t.id <> keep.id;
+
+DELETE FROM tags WHERE id NOT IN (SELECT MIN(id) FROM tags GROUP BY name);
+
+ALTER TABLE tags DROP COLUMN IF EXISTS created_at;
+ALTER TABLE tags DROP COLUMN IF EXISTS description;
+ALTER TABLE tags DROP COLUMN IF EXISTS color;
+ALTER TABLE tags DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name); 
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- Tags belong to a workspace instead of being shared by everyone
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS color VARCHAR(7);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS description VARCHAR(200);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+
+-- Give every workspace its own copy of the tags its links carry
+INSERT INTO tags (workspace_id, name)
+SELECT DISTINCT u.workspace_id, t.name
+FROM url_tags ut
+JOIN tags t ON t.id = ut.tag_id
+JOIN urls u ON u.id = ut.url_id
+WHERE u.workspace_id IS NOT NULL AND t.workspace_id IS NULL;
+
+UPDATE url_tags SET tag_id = nt.id
+FROM tags ot, urls u, tags nt
+WHERE ot.id = url_tags.tag_id AND ot.workspace_id IS NULL
+  AND u.id = url_tags.url_id
+  AND nt.workspace_id = u.workspace_id AND nt.name = ot.name;
+
+-- Whatever is left was on anonymous links, which cannot be tagged
+DELETE FROM url_tags USING tags t WHERE t.id = url_tags.tag_id AND t.workspace_id IS NULL;
+DELETE FROM tags WHERE workspace_id IS NULL;
+
+ALTER TABLE tags ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE tags ADD CONSTRAINT tags_workspace_name_key UNIQUE (workspace_id, name);
+
+-- Deleting a tag removes it from its links
+ALTER TABLE url_tags DROP CONSTRAINT IF EXISTS url_tags_tag_id_fkey;
+ALTER TABLE url_tags ADD CONSTRAINT url_tags_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE; 
\ No newline at end of file
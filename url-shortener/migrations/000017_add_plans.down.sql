@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS workspace_usage;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS plan; 
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- Every workspace is on a plan that sets its quotas
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS plan VARCHAR(16) NOT NULL DEFAULT 'free'
+    CHECK (plan IN ('free', 'pro', 'business'));
+
+-- Links created per workspace and calendar month (UTC). Deleting links
+-- leaves the count alone, so the monthly quota cannot be recycled.
+CREATE TABLE IF NOT EXISTS workspace_usage (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    links_created INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (workspace_id, period)
+);
+
+-- Count the links already created this month
+INSERT INTO workspace_usage (workspace_id, period, links_created)
+SELECT workspace_id, date_trunc('month', created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+FROM urls
+WHERE workspace_id IS NOT NULL
+  AND created_at >= date_trunc('month', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING; 
\ No newline at end of file
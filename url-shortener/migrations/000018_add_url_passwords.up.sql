@@ -0,0 +1,3 @@
+-- Protected links hold a bcrypt hash of their password; NULL leaves a
+-- link open to everyone
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash VARCHAR(100); 
\ No newline at end of file
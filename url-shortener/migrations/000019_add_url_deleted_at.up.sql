@@ -0,0 +1,2 @@
+-- Deleted links stay behind for their history but can no longer be edited
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ; 
\ No newline at end of file